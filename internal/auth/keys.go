@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+
+	defaultKeyRotationInterval = 30 * 24 * time.Hour
+	rsaKeyBits                 = 2048
+	sealedKeyPrefix            = "enc:v1:"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// SigningKey is a key pair that signs access tokens. Kid is sent in the
+// header of every token so verifiers know which public key to use.
+type SigningKey struct {
+	Kid        string
+	Algorithm  string
+	PrivateKey crypto.Signer
+}
+
+// Public returns the key's public half.
+func (key *SigningKey) Public() crypto.PublicKey {
+	return key.PrivateKey.Public()
+}
+
+// KeyResolver finds the public key a token was signed with by its kid.
+type KeyResolver interface {
+	VerificationKey(kid string) (crypto.PublicKey, string, error)
+}
+
+// SigningAlgorithm is the algorithm of newly generated keys, from
+// JWT_SIGNING_ALG (RS256 or EdDSA).
+func SigningAlgorithm() string {
+	if strings.EqualFold(os.Getenv("JWT_SIGNING_ALG"), AlgorithmEdDSA) {
+		return AlgorithmEdDSA
+	}
+	return AlgorithmRS256
+}
+
+// KeyRotationInterval is how long a key signs tokens before the next one
+// takes over, from JWT_KEY_ROTATION_DAYS.
+func KeyRotationInterval() time.Duration {
+	if days, e := strconv.Atoi(os.Getenv("JWT_KEY_ROTATION_DAYS")); e == nil && days > 0 {
+		return time.Duration(days) * 24 * time.Hour
+	}
+	return defaultKeyRotationInterval
+}
+
+// GenerateSigningKey creates a key pair with a random kid.
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+	var private crypto.Signer
+	switch algorithm {
+	case AlgorithmRS256:
+		key, e := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if e != nil {
+			return nil, e
+		}
+		private = key
+	case AlgorithmEdDSA:
+		_, key, e := ed25519.GenerateKey(rand.Reader)
+		if e != nil {
+			return nil, e
+		}
+		private = key
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	return &SigningKey{Kid: uuid.New().String(), Algorithm: algorithm, PrivateKey: private}, nil
+}
+
+func signingMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+}
+
+// EncodePrivateKey returns the PKCS#8 PEM of a private key. With a secret
+// the PEM is sealed with AES-GCM, so a database dump does not leak it.
+func EncodePrivateKey(key crypto.Signer, secret string) (string, error) {
+	der, e := x509.MarshalPKCS8PrivateKey(key)
+	if e != nil {
+		return "", e
+	}
+	return SealSecret(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), secret)
+}
+
+// DecodePrivateKey reverses EncodePrivateKey.
+func DecodePrivateKey(encoded string, secret string) (crypto.Signer, error) {
+	raw, e := OpenSecret(encoded, secret)
+	if e != nil {
+		return nil, e
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("signing key is not PEM encoded")
+	}
+	key, e := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if e != nil {
+		return nil, e
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("signing key cannot sign")
+	}
+	return signer, nil
+}
+
+// SealSecret encrypts a value for storage with AES-GCM under a key derived
+// from secret. Without a secret the value is stored as is.
+func SealSecret(plain []byte, secret string) (string, error) {
+	if secret == "" {
+		return string(plain), nil
+	}
+	aead, e := keyCipher(secret)
+	if e != nil {
+		return "", e
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, e := rand.Read(nonce); e != nil {
+		return "", e
+	}
+	sealed := aead.Seal(nonce, nonce, plain, nil)
+	return sealedKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenSecret reverses SealSecret. Values stored before a secret was set are
+// returned as they are.
+func OpenSecret(stored string, secret string) ([]byte, error) {
+	sealed, found := strings.CutPrefix(stored, sealedKeyPrefix)
+	if !found {
+		return []byte(stored), nil
+	}
+	if secret == "" {
+		return nil, errors.New("value is sealed but no secret is set")
+	}
+	data, e := base64.StdEncoding.DecodeString(sealed)
+	if e != nil {
+		return nil, e
+	}
+	aead, e := keyCipher(secret)
+	if e != nil {
+		return nil, e
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("sealed value is too short")
+	}
+	plain, e := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if e != nil {
+		return nil, errors.New("unable to unseal value")
+	}
+	return plain, nil
+}
+
+func keyCipher(secret string) (cipher.AEAD, error) {
+	sum := sha256.Sum256([]byte(secret))
+	block, e := aes.NewCipher(sum[:])
+	if e != nil {
+		return nil, e
+	}
+	return cipher.NewGCM(block)
+}
+
+// JWK is a public key in JSON Web Key form (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is the document served at /returnJWK.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWK describes the public half of a signing key.
+func PublicJWK(kid string, algorithm string, public crypto.PublicKey) (JWK, error) {
+	jwk := JWK{Kid: kid, Use: "sig", Alg: algorithm}
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(key)
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key %T", public)
+	}
+	return jwk, nil
+}
+
+// PublicKey parses the key a JWK describes.
+func (jwk JWK) PublicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, e := base64.RawURLEncoding.DecodeString(jwk.N)
+		if e != nil {
+			return nil, e
+		}
+		exponent, e := base64.RawURLEncoding.DecodeString(jwk.E)
+		if e != nil {
+			return nil, e
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(exponent).Int64())}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, e := base64.RawURLEncoding.DecodeString(jwk.X)
+		if e != nil {
+			return nil, e
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
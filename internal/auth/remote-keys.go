@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	remoteKeysRefreshInterval = 10 * time.Minute
+	remoteKeysMinRefetch      = 30 * time.Second
+)
+
+// RemoteKeySet verifies tokens with the keys published at a JWKS URL, so a
+// service can trust Phoenix tokens without the database or a shared secret:
+//
+//	keys := auth.NewRemoteKeySet("https://phoenix.example/api/returnJWK")
+//	claims, err := auth.ParseAccessToken(token, keys)
+//
+// Keys are cached and fetched again every few minutes, or when a token names
+// a kid the cache does not know yet.
+type RemoteKeySet struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]JWK
+	fetchedAt time.Time
+}
+
+func NewRemoteKeySet(url string) *RemoteKeySet {
+	return &RemoteKeySet{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (set *RemoteKeySet) VerificationKey(kid string) (crypto.PublicKey, string, error) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	jwk, known := set.keys[kid]
+	stale := time.Since(set.fetchedAt) > remoteKeysRefreshInterval
+	if stale || (!known && time.Since(set.fetchedAt) > remoteKeysMinRefetch) {
+		if e := set.fetch(); e != nil && set.keys == nil {
+			return nil, "", e
+		}
+		jwk, known = set.keys[kid]
+	}
+	if !known {
+		return nil, "", ErrUnknownKey
+	}
+	public, e := jwk.PublicKey()
+	if e != nil {
+		return nil, "", e
+	}
+	return public, jwk.Alg, nil
+}
+
+// fetch replaces the cached keys. On failure the old keys are kept.
+func (set *RemoteKeySet) fetch() error {
+	set.fetchedAt = time.Now()
+	res, e := set.client.Get(set.url)
+	if e != nil {
+		return e
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS request returned %s", res.Status)
+	}
+	document := JWKS{}
+	if e := json.NewDecoder(res.Body).Decode(&document); e != nil {
+		return e
+	}
+	keys := make(map[string]JWK, len(document.Keys))
+	for _, jwk := range document.Keys {
+		if jwk.Use == "" || jwk.Use == "sig" {
+			keys[jwk.Kid] = jwk
+		}
+	}
+	set.keys = keys
+	return nil
+}
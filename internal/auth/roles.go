@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// Permissions guard the operational routes of the gateway. Users get them
+// through their roles, or one by one.
+const (
+	PermissionVisitsRead       = "visits:read"
+	PermissionKeysRead         = "keys:read"
+	PermissionScraperManage    = "scraper:manage"
+	PermissionLLMConfigsManage = "llm-configs:manage"
+	PermissionRolesManage      = "roles:manage"
+	PermissionDevicesManage    = "devices:manage"
+)
+
+const (
+	RoleAdmin   = "admin"
+	RoleAnalyst = "analyst"
+)
+
+// rolePermissions is what each role allows.
+var rolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermissionVisitsRead,
+		PermissionKeysRead,
+		PermissionScraperManage,
+		PermissionLLMConfigsManage,
+		PermissionRolesManage,
+		PermissionDevicesManage,
+	},
+	RoleAnalyst: {
+		PermissionVisitsRead,
+		PermissionKeysRead,
+	},
+}
+
+// Roles returns every role and what it allows.
+func Roles() map[string][]string {
+	roles := make(map[string][]string, len(rolePermissions))
+	for role, permissions := range rolePermissions {
+		roles[role] = append([]string{}, permissions...)
+	}
+	return roles
+}
+
+// IsRole tells whether a role exists.
+func IsRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// IsPermission tells whether a permission exists.
+func IsPermission(permission string) bool {
+	for _, permissions := range rolePermissions {
+		for _, known := range permissions {
+			if known == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions of a set of roles plus the ones
+// granted directly, sorted and without duplicates. Unknown roles allow
+// nothing.
+func Permissions(roles []string, granted []string) []string {
+	set := map[string]bool{}
+	for _, role := range roles {
+		for _, permission := range rolePermissions[role] {
+			set[permission] = true
+		}
+	}
+	for _, permission := range granted {
+		if IsPermission(permission) {
+			set[permission] = true
+		}
+	}
+	permissions := make([]string, 0, len(set))
+	for permission := range set {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return permissions
+}
+
+// HasPermission tells whether permissions contain permission.
+func HasPermission(permissions []string, permission string) bool {
+	for _, held := range permissions {
+		if held == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBootstrapAdmin tells whether an email is listed in ADMIN_EMAILS. Those
+// users are admins once their email is verified, so the first admin can be
+// set up without touching the database.
+func IsBootstrapAdmin(email string) bool {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return false
+	}
+	for _, admin := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if strings.EqualFold(strings.TrimSpace(admin), email) {
+			return true
+		}
+	}
+	return false
+}
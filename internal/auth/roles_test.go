@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPermissionsCombineRolesAndGrants(t *testing.T) {
+	got := Permissions([]string{RoleAnalyst, "unknown"}, []string{PermissionScraperManage, PermissionKeysRead, "made:up"})
+	want := []string{PermissionKeysRead, PermissionScraperManage, PermissionVisitsRead}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if len(Permissions(nil, nil)) != 0 {
+		t.Fatal("no roles should allow nothing")
+	}
+}
+
+func TestAdminHoldsEveryPermission(t *testing.T) {
+	admin := Permissions([]string{RoleAdmin}, nil)
+	for _, permissions := range Roles() {
+		for _, permission := range permissions {
+			if !HasPermission(admin, permission) {
+				t.Fatalf("admin lacks %s", permission)
+			}
+		}
+	}
+}
+
+func TestIsBootstrapAdmin(t *testing.T) {
+	t.Setenv("ADMIN_EMAILS", " ops@example.com, Root@Example.com ")
+	for email, want := range map[string]bool{
+		"ops@example.com":   true,
+		"root@example.com":  true,
+		"user@example.com":  false,
+		"":                  false,
+		"ops@example.com.x": false,
+	} {
+		if got := IsBootstrapAdmin(email); got != want {
+			t.Fatalf("%q: got %v, want %v", email, got, want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+	defaultIssuer          = "project-phoenix"
+	refreshTokenPrefix     = "rt_"
+)
+
+var (
+	ErrTokenExpired = errors.New("access token expired")
+	ErrTokenInvalid = errors.New("access token invalid")
+)
+
+// AccessClaims are the claims of an access token. The subject is the user
+// id and the id (jti) identifies the token for revocation. FamilyID links it
+// to the refresh tokens of the same login.
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid"`
+	Email     string `json:"email,omitempty"`
+	FamilyID  string `json:"fid,omitempty"`
+}
+
+// Issuer is the iss claim of our tokens, from JWT_ISSUER or APP_NAME.
+func Issuer() string {
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		return issuer
+	}
+	if appName := os.Getenv("APP_NAME"); appName != "" {
+		return appName
+	}
+	return defaultIssuer
+}
+
+// AccessTokenTTL is how long an access token is valid, from
+// ACCESS_TOKEN_TTL_MINUTES.
+func AccessTokenTTL() time.Duration {
+	if minutes, e := strconv.Atoi(os.Getenv("ACCESS_TOKEN_TTL_MINUTES")); e == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return defaultAccessTokenTTL
+}
+
+// RefreshTokenTTL is how long a refresh token can be used, from
+// REFRESH_TOKEN_TTL_DAYS.
+func RefreshTokenTTL() time.Duration {
+	if days, e := strconv.Atoi(os.Getenv("REFRESH_TOKEN_TTL_DAYS")); e == nil && days > 0 {
+		return time.Duration(days) * 24 * time.Hour
+	}
+	return defaultRefreshTokenTTL
+}
+
+// IssueAccessToken signs a new access token for a user within a session.
+func IssueAccessToken(key *SigningKey, userID string, email string, sessionID string, familyID string) (string, *AccessClaims, error) {
+	method, e := signingMethod(key.Algorithm)
+	if e != nil {
+		return "", nil, e
+	}
+	now := time.Now()
+	claims := &AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Subject:   userID,
+			Issuer:    Issuer(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL())),
+		},
+		SessionID: sessionID,
+		Email:     email,
+		FamilyID:  familyID,
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.Kid
+	signed, e := token.SignedString(key.PrivateKey)
+	if e != nil {
+		return "", nil, e
+	}
+	return signed, claims, nil
+}
+
+// ParseAccessToken checks an access token's signature, expiry and issuer and
+// returns its claims. The key is picked by the token's kid and has to be of
+// the algorithm the token claims. It does not check for revocation.
+func ParseAccessToken(token string, keys KeyResolver) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmEdDSA}))
+	if _, e := parser.ParseWithClaims(token, claims, func(parsed *jwt.Token) (interface{}, error) {
+		kid, _ := parsed.Header["kid"].(string)
+		if kid == "" {
+			return nil, ErrUnknownKey
+		}
+		public, algorithm, e := keys.VerificationKey(kid)
+		if e != nil {
+			return nil, e
+		}
+		if parsed.Method.Alg() != algorithm {
+			return nil, fmt.Errorf("key %s does not sign %s tokens", kid, parsed.Method.Alg())
+		}
+		return public, nil
+	}); e != nil {
+		if errors.Is(e, jwt.ErrTokenExpired) {
+			return nil, ErrTokenExpired
+		}
+		return nil, ErrTokenInvalid
+	}
+	if claims.ExpiresAt == nil || !claims.VerifyIssuer(Issuer(), true) || claims.Subject == "" || claims.ID == "" {
+		return nil, ErrTokenInvalid
+	}
+	return claims, nil
+}
+
+// NewRefreshToken returns a random refresh token. Only its hash is stored.
+func NewRefreshToken() (string, error) {
+	return NewOpaqueToken(refreshTokenPrefix)
+}
+
+// NewOpaqueToken returns 32 random bytes, URL safe, after a prefix that
+// tells what the token is for.
+func NewOpaqueToken(prefix string) (string, error) {
+	raw := make([]byte, 32)
+	if _, e := rand.Read(raw); e != nil {
+		return "", e
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// HashToken is the stored form of a refresh or other opaque token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// BearerToken returns the access token of a request. The password of a basic
+// Authorization header is accepted as well, which is how clients sent tokens
+// before.
+func BearerToken(r *http.Request) string {
+	if bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		return strings.TrimSpace(bearer)
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return ""
+}
+
+type claimsContextKey struct{}
+
+// ContextWithClaims stores the claims of an authenticated request.
+func ContextWithClaims(ctx context.Context, claims *AccessClaims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by ContextWithClaims.
+func ClaimsFromContext(ctx context.Context) (*AccessClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*AccessClaims)
+	return claims, ok
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"crypto"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// testKeys resolves keys the way a JWKS consumer would, from their JWKs.
+type testKeys map[string]JWK
+
+func (keys testKeys) VerificationKey(kid string) (crypto.PublicKey, string, error) {
+	jwk, found := keys[kid]
+	if !found {
+		return nil, "", ErrUnknownKey
+	}
+	public, err := jwk.PublicKey()
+	return public, jwk.Alg, err
+}
+
+func newTestKey(t *testing.T, algorithm string, keys testKeys) *SigningKey {
+	t.Setenv("JWT_ISSUER", "phoenix-test")
+	key, err := GenerateSigningKey(algorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := PublicJWK(key.Kid, key.Algorithm, key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys[key.Kid] = jwk
+	return key
+}
+
+func TestAccessTokenRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmRS256, AlgorithmEdDSA} {
+		keys := testKeys{}
+		key := newTestKey(t, algorithm, keys)
+		token, issued, err := IssueAccessToken(key, "user-1", "a@b.c", "session-1", "family-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := ParseAccessToken(token, keys)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		if claims.Subject != "user-1" || claims.SessionID != "session-1" || claims.FamilyID != "family-1" || claims.ID != issued.ID {
+			t.Fatalf("unexpected claims %+v", claims)
+		}
+	}
+}
+
+func TestPrivateKeySealing(t *testing.T) {
+	key, err := GenerateSigningKey(AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := EncodePrivateKey(key.PrivateKey, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, sealedKeyPrefix) {
+		t.Fatalf("key was not sealed: %q", sealed)
+	}
+	if _, err := DecodePrivateKey(sealed, "other"); err == nil {
+		t.Fatal("unsealed with the wrong secret")
+	}
+	decoded, err := DecodePrivateKey(sealed, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.PrivateKey.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(decoded.Public()) {
+		t.Fatal("decoded a different key")
+	}
+}
+
+func TestParseAccessTokenRejects(t *testing.T) {
+	keys := testKeys{}
+	rsaKey := newTestKey(t, AlgorithmRS256, keys)
+	edKey := newTestKey(t, AlgorithmEdDSA, keys)
+	stranger, _ := GenerateSigningKey(AlgorithmRS256)
+	signedWith := func(method jwt.SigningMethod, kid string, key interface{}, claims *AccessClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	signed := func(claims *AccessClaims) string {
+		return signedWith(jwt.SigningMethodRS256, rsaKey.Kid, rsaKey.PrivateKey, claims)
+	}
+	valid := func() *AccessClaims {
+		return &AccessClaims{RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "jti",
+			Subject:   "user-1",
+			Issuer:    "phoenix-test",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		}}
+	}
+
+	expired := valid()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	if _, err := ParseAccessToken(signed(expired), keys); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("expired token: %v", err)
+	}
+
+	otherIssuer := valid()
+	otherIssuer.Issuer = "someone-else"
+	noExpiry := valid()
+	noExpiry.ExpiresAt = nil
+	good, _, _ := IssueAccessToken(rsaKey, "user-1", "", "s", "f")
+	publicJWK := keys[rsaKey.Kid]
+	for name, token := range map[string]string{
+		"wrong key":       signedWith(jwt.SigningMethodRS256, rsaKey.Kid, stranger.PrivateKey, valid()),
+		"unknown kid":     signedWith(jwt.SigningMethodRS256, stranger.Kid, stranger.PrivateKey, valid()),
+		"no kid":          signedWith(jwt.SigningMethodRS256, "", rsaKey.PrivateKey, valid()),
+		"other key's alg": signedWith(jwt.SigningMethodEdDSA, rsaKey.Kid, edKey.PrivateKey, valid()),
+		"hmac with jwk":   signedWith(jwt.SigningMethodHS256, rsaKey.Kid, []byte(publicJWK.N), valid()),
+		"wrong issuer":    signed(otherIssuer),
+		"no expiry":       signed(noExpiry),
+		"alg none":        signedWith(jwt.SigningMethodNone, rsaKey.Kid, jwt.UnsafeAllowNoneSignatureType, valid()),
+		"tampered":        good[:strings.LastIndex(good, ".")] + ".AAAA",
+	} {
+		if _, err := ParseAccessToken(token, keys); !errors.Is(err, ErrTokenInvalid) {
+			t.Fatalf("%s: got %v, want ErrTokenInvalid", name, err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 seed of the RFC 6238 test vectors.
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	// The RFC lists 8 digit codes; ours are their last 6 digits.
+	for unix, want := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		code, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != want {
+			t.Fatalf("T=%d: got %s, want %s", unix, code, want)
+		}
+	}
+}
+
+func TestVerifyTOTPAllowsOneStepOfDrift(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	previous, _ := TOTPCode(rfc6238Secret, TOTPStep(now)-1)
+	if step, ok := VerifyTOTP(rfc6238Secret, previous, now); !ok || step != TOTPStep(now)-1 {
+		t.Fatalf("previous step: %d %v", step, ok)
+	}
+	old, _ := TOTPCode(rfc6238Secret, TOTPStep(now)-2)
+	if _, ok := VerifyTOTP(rfc6238Secret, old, now); ok {
+		t.Fatal("accepted a code two steps old")
+	}
+	if _, ok := VerifyTOTP(rfc6238Secret, "12345", now); ok {
+		t.Fatal("accepted a short code")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 14 || strings.Count(code, "-") != 2 || seen[code] {
+			t.Fatalf("bad or repeated code %q", code)
+		}
+		seen[code] = true
+	}
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))) {
+		t.Fatal("recovery code hash depends on formatting")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("ABC", "a@b.c", "Project Phoenix")
+	if !strings.HasPrefix(uri, "otpauth://totp/Project%20Phoenix:a@b.c?") || !strings.Contains(uri, "secret=ABC") || !strings.Contains(uri, "issuer=Project+Phoenix") {
+		t.Fatalf("unexpected URI %s", uri)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/joho/godotenv"
 )
 
@@ -26,32 +27,35 @@ type S3Service struct {
 
 // UploadFileStream uploads a stream to S3 and returns a presigned URL with TTL
 func (s *S3Service) UploadFileStream(
-    ctx context.Context,
-    key string,
-    body io.Reader,
-    mimeType string,
-    ttlMinutes int,
+	ctx context.Context,
+	key string,
+	body io.Reader,
+	mimeType string,
+	ttlMinutes int,
 ) (presignedUrl string, err error) {
-    log.Printf(" Uploading (stream) to S3: s3://%s/%s", s.bucketName, key)
-
-    _, err = s.client.PutObject(ctx, &s3.PutObjectInput{
-        Bucket:      aws.String(s.bucketName),
-        Key:         aws.String(key),
-        Body:        body,
-        ContentType: aws.String(mimeType),
-        Metadata: map[string]string{
-            "uploadTime": time.Now().UTC().Format(time.RFC3339),
-        },
-    })
-    if err != nil {
-        return "", fmt.Errorf("failed to upload stream to S3: %v", err)
-    }
-
-    presignedUrl, err = s.GetPresignedUrl(ctx, key, ttlMinutes)
-    if err != nil {
-        return "", err
-    }
-    return presignedUrl, nil
+	if err = s.PutFileStream(ctx, key, body, mimeType); err != nil {
+		return "", err
+	}
+	return s.GetPresignedUrl(ctx, key, ttlMinutes)
+}
+
+// PutFileStream uploads a stream to S3 without signing a URL for it.
+func (s *S3Service) PutFileStream(ctx context.Context, key string, body io.Reader, mimeType string) error {
+	log.Printf(" Uploading (stream) to S3: s3://%s/%s", s.bucketName, key)
+
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(mimeType),
+		Metadata: map[string]string{
+			"uploadTime": time.Now().UTC().Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload stream to S3: %v", err)
+	}
+	return nil
 }
 
 func NewS3Service(bucketName, region string) (*S3Service, error) {
@@ -78,7 +82,8 @@ func NewS3Service(bucketName, region string) (*S3Service, error) {
 
 // NewS3ServiceFromEnv constructs S3Service using environment variables.
 // Required envs: S3_BUCKET_NAME, S3_REGION, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY
-// Optional: S3_FOLDER_NAME (returned for convenience)
+// Optional: S3_FOLDER_NAME (returned for convenience), and S3_ENDPOINT for
+// S3-compatible servers such as MinIO, which also makes S3_REGION optional.
 func NewS3ServiceFromEnv() (*S3Service, string, error) {
 	// Load .env if present
 	_ = godotenv.Load()
@@ -88,6 +93,10 @@ func NewS3ServiceFromEnv() (*S3Service, string, error) {
 	accessKey := strings.TrimSpace(os.Getenv("S3_ACCESS_KEY_ID"))
 	secretKey := strings.TrimSpace(os.Getenv("S3_SECRET_ACCESS_KEY"))
 	folder := strings.TrimSpace(os.Getenv("S3_FOLDER_NAME"))
+	endpoint := strings.TrimRight(strings.TrimSpace(os.Getenv("S3_ENDPOINT")), "/")
+	if endpoint != "" && region == "" {
+		region = "us-east-1"
+	}
 
 	if bucket == "" || region == "" || accessKey == "" || secretKey == "" {
 		return nil, "", fmt.Errorf("missing one or more required S3 envs: S3_BUCKET_NAME, S3_REGION, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY")
@@ -103,8 +112,17 @@ func NewS3ServiceFromEnv() (*S3Service, string, error) {
 		return nil, "", fmt.Errorf("failed to load AWS config: %v", err)
 	}
 
-	client := s3.NewFromConfig(cfg)
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			// MinIO and most self-hosted servers do not support bucket subdomains.
+			o.UsePathStyle = os.Getenv("S3_USE_PATH_STYLE") != "false"
+		}
+	})
 	baseUrl := fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, region)
+	if endpoint != "" {
+		baseUrl = endpoint + "/" + bucket
+	}
 
 	svc := &S3Service{
 		client:     client,
@@ -193,4 +211,41 @@ func (s *S3Service) DeleteFile(ctx context.Context, key string) error {
 
 	log.Printf(" File deleted from S3: %s", key)
 	return nil
-}
\ No newline at end of file
+}
+
+// GetFileStream opens an object for reading. The caller closes the body.
+func (s *S3Service) GetFileStream(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return object.Body, nil
+}
+
+// HeadFile returns the size, content type and modification time of an object.
+func (s *S3Service) HeadFile(ctx context.Context, key string) (*s3.HeadObjectOutput, error) {
+	return s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+}
+
+// ListFiles returns every object whose key starts with prefix.
+func (s *S3Service) ListFiles(ctx context.Context, prefix string) ([]types.Object, error) {
+	objects := []types.Object{}
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list S3 objects: %v", err)
+		}
+		objects = append(objects, page.Contents...)
+	}
+	return objects, nil
+}
@@ -100,4 +100,25 @@ func (r *RabbitMQ) Close() {
 		log.Println("r.conn | Closing RabbitMQ Connection")
 		r.conn.Close()
 	}
-}
\ No newline at end of file
+}
+var (
+	probeMutex sync.Mutex
+	probeConn  *amqp091.Connection
+)
+
+// CheckRabbitMQ reports whether RabbitMQ is reachable. It keeps a single
+// connection open for the check and redials only when the server drops it, so
+// it is cheap enough for health probes.
+func CheckRabbitMQ() error {
+	probeMutex.Lock()
+	defer probeMutex.Unlock()
+	if probeConn != nil && !probeConn.IsClosed() {
+		return nil
+	}
+	conn, err := amqp091.Dial(ReturnRabbitMQConnString())
+	if err != nil {
+		return err
+	}
+	probeConn = conn
+	return nil
+}
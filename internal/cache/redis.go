@@ -135,6 +135,18 @@ func (r *Redis) SetWithExpiry(key string, value map[string]interface{}, ttlHours
 	}
 }
 
+// Delete removes keys. Keys that do not exist are ignored.
+func (r *Redis) Delete(keys ...string) (bool, error) {
+	if r == nil || len(keys) == 0 {
+		return true, nil
+	}
+	if err := r.client.Del(context.Background(), keys...).Err(); err != nil {
+		log.Println("Error deleting from Redis", err)
+		return false, err
+	}
+	return true, nil
+}
+
 // GetClient returns the underlying Redis client for advanced operations
 func (r *Redis) GetClient() interface{} {
 	if r == nil {
@@ -142,3 +154,17 @@ func (r *Redis) GetClient() interface{} {
 	}
 	return r.client
 }
+
+// Subscribe opens a subscription on the given channels and waits for Redis to
+// confirm it. The caller must close the returned PubSub.
+func (r *Redis) Subscribe(ctx context.Context, channelNames ...string) (*redis.PubSub, error) {
+	if r == nil {
+		return nil, errors.New("Redis uninitialized")
+	}
+	pubsub := r.client.Subscribe(ctx, channelNames...)
+	if _, e := pubsub.Receive(ctx); e != nil {
+		pubsub.Close()
+		return nil, e
+	}
+	return pubsub, nil
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"project-phoenix/v2/internal/auth"
+	"project-phoenix/v2/internal/db"
+	"project-phoenix/v2/internal/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	AccountTokenVerifyEmail   = "verify_email"
+	AccountTokenResetPassword = "reset_password"
+
+	verifyEmailTokenTTL   = 24 * time.Hour
+	resetPasswordTokenTTL = time.Hour
+)
+
+var ErrAccountTokenInvalid = errors.New("token is invalid, expired or already used")
+
+// AccountTokenController keeps the single-use tokens mailed for email
+// verification and password resets.
+type AccountTokenController struct {
+	CollectionName string
+	DB             db.DBInterface
+}
+
+func (ac *AccountTokenController) GetCollectionName() string {
+	return "account_tokens"
+}
+
+func (ac *AccountTokenController) PerformIndexing() error {
+	if ac.DB == nil {
+		return errors.New("DB not initialized")
+	}
+	if e := ac.DB.ValidateUniqueIndexing(ac.GetCollectionName(), bson.D{{Key: "tokenHash", Value: 1}}); e != nil {
+		return e
+	}
+	if e := ac.DB.ValidateIndexing(ac.GetCollectionName(), bson.D{{Key: "userId", Value: 1}, {Key: "purpose", Value: 1}}); e != nil {
+		return e
+	}
+	return ac.DB.ValidateIndexingTTL(ac.GetCollectionName(), bson.D{{Key: "expiresAt", Value: 1}}, 0)
+}
+
+func (ac *AccountTokenController) collection() (*mongo.Collection, func()) {
+	dbConn := db.GetConnectionFromPool()
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(ac.GetCollectionName())
+	return collection, func() { db.ReleaseConnectionToPool(dbConn) }
+}
+
+func accountTokenTTL(purpose string) time.Duration {
+	if purpose == AccountTokenResetPassword {
+		return resetPasswordTokenTTL
+	}
+	return verifyEmailTokenTTL
+}
+
+// Issue creates a token for a user. Earlier unused tokens of the same
+// purpose stop working, so only the latest email's link is valid.
+func (ac *AccountTokenController) Issue(purpose string, userID string, email string) (string, error) {
+	collection, release := ac.collection()
+	defer release()
+	now := time.Now().UTC()
+	if _, e := collection.UpdateMany(context.Background(),
+		bson.M{"userId": userID, "purpose": purpose, "usedAt": nil},
+		bson.M{"$set": bson.M{"usedAt": now}}); e != nil {
+		return "", e
+	}
+
+	token, e := auth.NewOpaqueToken(purpose + "_")
+	if e != nil {
+		return "", e
+	}
+	if _, e := ac.DB.Create(model.AccountToken{
+		TokenHash: auth.HashToken(token),
+		Purpose:   purpose,
+		UserID:    userID,
+		Email:     email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(accountTokenTTL(purpose)),
+	}, ac.GetCollectionName()); e != nil {
+		return "", e
+	}
+	return token, nil
+}
+
+// Consume marks a token as used and returns it. Checking and using it is one
+// update, so a token works only once even when submitted twice at a time.
+func (ac *AccountTokenController) Consume(purpose string, token string) (*model.AccountToken, error) {
+	if token == "" {
+		return nil, ErrAccountTokenInvalid
+	}
+	collection, release := ac.collection()
+	defer release()
+	now := time.Now().UTC()
+	stored := model.AccountToken{}
+	e := collection.FindOneAndUpdate(context.Background(),
+		bson.M{"tokenHash": auth.HashToken(token), "purpose": purpose, "usedAt": nil, "expiresAt": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"usedAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&stored)
+	if errors.Is(e, mongo.ErrNoDocuments) {
+		return nil, ErrAccountTokenInvalid
+	}
+	if e != nil {
+		return nil, e
+	}
+	return &stored, nil
+}
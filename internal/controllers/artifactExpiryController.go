@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"project-phoenix/v2/internal/db"
+	"project-phoenix/v2/internal/model"
+	"project-phoenix/v2/internal/storage"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ArtifactKindFile   = "file"
+	ArtifactKindObject = "object"
+
+	artifactSweepBatchSize  = 200
+	artifactRetryDelay      = 10 * time.Minute
+	artifactMaxSweepRetries = 10
+)
+
+// ArtifactExpiryController keeps a registry of temporary files and stored
+// objects with an expiry time, so they are deleted even if the service that
+// created them restarts. Any service can register artifacts; the SSE service
+// runs the sweeper.
+type ArtifactExpiryController struct {
+	CollectionName string
+	DB             db.DBInterface
+}
+
+func (ac *ArtifactExpiryController) GetCollectionName() string {
+	return "expiring_artifacts"
+}
+
+func (ac *ArtifactExpiryController) PerformIndexing() error {
+	if ac.DB == nil {
+		return errors.New("DB not initialized")
+	}
+	if e := ac.DB.ValidateUniqueIndexing(ac.GetCollectionName(), bson.D{{Key: "kind", Value: 1}, {Key: "location", Value: 1}}); e != nil {
+		return e
+	}
+	return ac.DB.ValidateIndexing(ac.GetCollectionName(), bson.D{{Key: "expiresAt", Value: 1}})
+}
+
+func (ac *ArtifactExpiryController) collection() (*mongo.Collection, func()) {
+	dbConn := db.GetConnectionFromPool()
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(ac.GetCollectionName())
+	return collection, func() { db.ReleaseConnectionToPool(dbConn) }
+}
+
+// RegisterFile schedules a local file for deletion after ttl.
+func (ac *ArtifactExpiryController) RegisterFile(path string, owner string, reference string, ttl time.Duration) error {
+	var size int64
+	if stat, err := os.Stat(path); err == nil {
+		size = stat.Size()
+	}
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	return ac.register(model.ExpiringArtifact{
+		Kind:      ArtifactKindFile,
+		Location:  absolute,
+		Owner:     owner,
+		Reference: reference,
+		SizeBytes: size,
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	})
+}
+
+// RegisterObject schedules an object in the configured storage for deletion
+// after ttl.
+func (ac *ArtifactExpiryController) RegisterObject(key string, sizeBytes int64, owner string, reference string, ttl time.Duration) error {
+	store := storage.GetInstance()
+	if store == nil {
+		return errors.New("object storage not initialized")
+	}
+	return ac.register(model.ExpiringArtifact{
+		Kind:      ArtifactKindObject,
+		Location:  key,
+		Backend:   store.Name(),
+		Owner:     owner,
+		Reference: reference,
+		SizeBytes: sizeBytes,
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	})
+}
+
+// register upserts on kind and location, so registering an artifact again
+// moves its expiry instead of adding a duplicate.
+func (ac *ArtifactExpiryController) register(artifact model.ExpiringArtifact) error {
+	collection, release := ac.collection()
+	defer release()
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{
+		"kind":     artifact.Kind,
+		"location": artifact.Location,
+	}, bson.M{
+		"$set": bson.M{
+			"backend":   artifact.Backend,
+			"owner":     artifact.Owner,
+			"reference": artifact.Reference,
+			"sizeBytes": artifact.SizeBytes,
+			"expiresAt": artifact.ExpiresAt,
+			"attempts":  0,
+			"lastError": "",
+		},
+		"$setOnInsert": bson.M{"createdAt": time.Now().UTC()},
+	}, options.Update().SetUpsert(true))
+	return err
+}
+
+func (ac *ArtifactExpiryController) deleteArtifact(artifact model.ExpiringArtifact) error {
+	switch artifact.Kind {
+	case ArtifactKindFile:
+		if err := os.Remove(artifact.Location); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	case ArtifactKindObject:
+		store := storage.GetInstance()
+		if store == nil {
+			return errors.New("object storage not initialized")
+		}
+		if store.Name() != artifact.Backend {
+			return errors.New("object is stored in " + artifact.Backend + " but the storage backend is " + store.Name())
+		}
+		return store.Delete(context.Background(), artifact.Location)
+	}
+	return errors.New("unknown artifact kind " + artifact.Kind)
+}
+
+// Sweep deletes every artifact that has expired. Failed deletions are retried
+// later and dropped from the registry after artifactMaxSweepRetries attempts.
+func (ac *ArtifactExpiryController) Sweep() (model.CleanupReport, error) {
+	report := model.CleanupReport{}
+	collection, release := ac.collection()
+	defer release()
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	cursor, err := collection.Find(ctx, bson.M{"expiresAt": bson.M{"$lte": now}},
+		options.Find().SetSort(bson.D{{Key: "expiresAt", Value: 1}}).SetLimit(artifactSweepBatchSize))
+	if err != nil {
+		return report, err
+	}
+	expired := []model.ExpiringArtifact{}
+	if err := cursor.All(ctx, &expired); err != nil {
+		return report, err
+	}
+
+	for _, artifact := range expired {
+		filter := bson.M{"kind": artifact.Kind, "location": artifact.Location, "expiresAt": artifact.ExpiresAt}
+		if err := ac.deleteArtifact(artifact); err != nil {
+			report.Failed++
+			log.Printf("Unable to delete expired %s %s: %v", artifact.Kind, artifact.Location, err)
+			if artifact.Attempts+1 >= artifactMaxSweepRetries {
+				collection.DeleteOne(ctx, filter)
+				continue
+			}
+			collection.UpdateOne(ctx, filter, bson.M{
+				"$set": bson.M{"expiresAt": now.Add(artifactRetryDelay), "lastError": err.Error()},
+				"$inc": bson.M{"attempts": 1},
+			})
+			continue
+		}
+		// The filter includes expiresAt so an artifact registered again while
+		// it was being deleted keeps its new entry.
+		collection.DeleteOne(ctx, filter)
+		report.Deleted++
+		report.ReclaimedBytes += artifact.SizeBytes
+	}
+	return report, nil
+}
+
+// CollectGarbage deletes files under dir that no registry entry accounts for,
+// such as leftovers from a crash. Files modified within minAge are skipped
+// because they may still be written to.
+func (ac *ArtifactExpiryController) CollectGarbage(dir string, minAge time.Duration) (model.CleanupReport, error) {
+	report := model.CleanupReport{}
+	absolute, err := filepath.Abs(dir)
+	if err != nil {
+		return report, err
+	}
+
+	collection, release := ac.collection()
+	defer release()
+	ctx := context.Background()
+	cursor, err := collection.Find(ctx, bson.M{"kind": ArtifactKindFile},
+		options.Find().SetProjection(bson.M{"location": 1}))
+	if err != nil {
+		return report, err
+	}
+	registered := map[string]bool{}
+	for cursor.Next(ctx) {
+		artifact := model.ExpiringArtifact{}
+		if cursor.Decode(&artifact) == nil {
+			registered[artifact.Location] = true
+		}
+	}
+	cursor.Close(ctx)
+
+	cutoff := time.Now().Add(-minAge)
+	err = filepath.WalkDir(absolute, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || registered[path] {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			report.Failed++
+			log.Printf("Unable to delete orphaned file %s: %v", path, err)
+			return nil
+		}
+		report.Deleted++
+		report.ReclaimedBytes += info.Size()
+		return nil
+	})
+	return report, err
+}
@@ -1,17 +1,27 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gosimple/slug"
+	"github.com/robfig/cron/v3"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
 	"net/http"
+	"os"
+	"project-phoenix/v2/internal/auth"
+	"project-phoenix/v2/internal/broker"
 	"project-phoenix/v2/internal/cache"
 	"project-phoenix/v2/internal/db"
 	"project-phoenix/v2/internal/enum"
 	"project-phoenix/v2/internal/model"
 	"project-phoenix/v2/pkg/helper"
+	"strconv"
 	"time"
 )
 
@@ -33,7 +43,7 @@ func (cs *CaptureScreenController) PerformIndexing() error {
 			return validateErr
 		}
 	}
-	return nil
+	return cs.DB.ValidateIndexing(cs.GetUptimeCollectionName(), bson.D{{Key: "deviceName", Value: 1}, {Key: "at", Value: 1}})
 
 }
 
@@ -67,6 +77,37 @@ func (cs *CaptureScreenController) Update(query map[string]interface{}, updateDa
 	return nil
 }
 
+// CheckOwner makes sure userID owns the device. Devices nobody has enrolled
+// while logged in have no owner and are refused too.
+func (cs *CaptureScreenController) CheckOwner(deviceName string, userID string) (int, error) {
+	device, e := cs.Find(map[string]interface{}{"deviceName": deviceName})
+	if e != nil || device == nil {
+		return int(enum.DEVICE_NOT_FOUND), errors.New("device " + deviceName + " not found")
+	}
+	if owner, _ := device["owner"].(string); owner == "" || owner != userID {
+		return int(enum.DEVICE_OWNED_BY_ANOTHER_USER), errors.New("device " + deviceName + " is not yours")
+	}
+	return 0, nil
+}
+
+// OwnedDeviceNames returns the names of the devices userID owns.
+func (cs *CaptureScreenController) OwnedDeviceNames(userID string) ([]string, error) {
+	dbConn := db.GetConnectionFromPool()
+	defer db.ReleaseConnectionToPool(dbConn)
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(cs.GetCollectionName())
+	names, e := collection.Distinct(context.Background(), "deviceName", bson.M{"owner": userID})
+	if e != nil {
+		return nil, e
+	}
+	deviceNames := []string{}
+	for _, name := range names {
+		if deviceName, ok := name.(string); ok && deviceName != "" {
+			deviceNames = append(deviceNames, deviceName)
+		}
+	}
+	return deviceNames, nil
+}
+
 func (cs *CaptureScreenController) ListDevices(page int) (int, map[string]interface{}, error) {
 	log.Println("List Devices")
 	totalPages, page, devices, e := cs.DB.FindAllWithPagination(map[string]interface{}{}, 1, cs.GetCollectionName())
@@ -92,14 +133,7 @@ func (cs *CaptureScreenController) CaptureScreen(w http.ResponseWriter, r *http.
 	if decodeErr != nil {
 		return int(enum.CAPTURE_SCREEN_EVENT_FAILED), decodeErr
 	}
-	data := "capture-screen-" + slug.Make(deviceModel.DeviceName)
-	dataInterface, e := helper.StringToInterface(data)
-	if e != nil {
-		return int(enum.CAPTURE_SCREEN_EVENT_FAILED), e
-	}
-	channelName := "capture-screen-" + slug.Make(deviceModel.DeviceName)
-	log.Println("Channel Name: ", channelName)
-	isPub, e := cache.GetInstance().PublishMessage(dataInterface, channelName)
+	isPub, e := cs.publishCaptureCommand(deviceModel.DeviceName)
 	if e != nil {
 		er := cs.TurnDeviceOffline(map[string]interface{}{"deviceName":deviceModel.DeviceName})
 		if er != nil {
@@ -113,6 +147,19 @@ func (cs *CaptureScreenController) CaptureScreen(w http.ResponseWriter, r *http.
 	return -1, nil
 }
 
+// publishCaptureCommand sends the capture-screen-<slug> command the device
+// agent listens for.
+func (cs *CaptureScreenController) publishCaptureCommand(deviceName string) (bool, error) {
+	data := "capture-screen-" + slug.Make(deviceName)
+	dataInterface, e := helper.StringToInterface(data)
+	if e != nil {
+		return false, e
+	}
+	channelName := "capture-screen-" + slug.Make(deviceName)
+	log.Println("Channel Name: ", channelName)
+	return cache.GetInstance().PublishMessage(dataInterface, channelName)
+}
+
 func (cs *CaptureScreenController) ScanDevices(w http.ResponseWriter, r *http.Request) (int, error) {
 	data := "scan-devices"
 	dataInterface, e := helper.StringToInterface(data)
@@ -172,8 +219,13 @@ func (cs *CaptureScreenController) ReturnDeviceName(w http.ResponseWriter, r *ht
 	}
 }
 
+// DeleteDevice deletes a device and revokes its credentials. Like revoking
+// its token, only the owner can, or a device manager when it has no owner.
 func (cs *CaptureScreenController) DeleteDevice(w http.ResponseWriter, r *http.Request) (int, error) {
-
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.USER_NOT_FOUND), errors.New("not logged in")
+	}
 	deviceModel := model.Device{}
 	log.Println("Params:", r.Body)
 	decodeErr := json.NewDecoder(r.Body).Decode(&deviceModel)
@@ -187,6 +239,13 @@ func (cs *CaptureScreenController) DeleteDevice(w http.ResponseWriter, r *http.R
 		return int(enum.DEVICE_FAILED_TO_DELETE), er
 	}
 	log.Println("Device ObjectId", objectId)
+	device, _ := cs.Find(map[string]interface{}{"_id": objectId})
+	if device == nil {
+		return int(enum.DEVICE_NOT_FOUND), errors.New("device not found")
+	}
+	if !canRevokeDevice(device, claims.Subject) {
+		return int(enum.DEVICE_OWNED_BY_ANOTHER_USER), errors.New("device is not yours")
+	}
 	_, e := cs.DB.Delete(map[string]interface{}{
 		"_id": objectId,
 	}, cs.GetCollectionName())
@@ -195,12 +254,24 @@ func (cs *CaptureScreenController) DeleteDevice(w http.ResponseWriter, r *http.R
 		log.Println("Failed to delete device:", e)
 		return int(enum.DEVICE_FAILED_TO_DELETE), e
 	}
+	// A deleted device must not keep talking to the gRPC gateway.
+	if deviceName, ok := device["deviceName"].(string); ok {
+		deviceCredentialController := GetControllerInstance(enum.DeviceCredentialController, enum.MONGODB).(*DeviceCredentialController)
+		if _, er := deviceCredentialController.RevokeDevice(deviceName); er != nil {
+			log.Println("Error revoking device credentials", er)
+		}
+	}
 	log.Println("Device has been deleted")
 	return int(enum.DEVICE_DELETED), nil
 }
 
-func (cs *CaptureScreenController) ShowDeviceInfo(deviceId string) (int, interface{}, error) {
-
+// ShowDeviceInfo returns one of the caller's devices with URLs of its last
+// screenshot.
+func (cs *CaptureScreenController) ShowDeviceInfo(r *http.Request, deviceId string) (int, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.USER_NOT_FOUND), nil, errors.New("not logged in")
+	}
 	objectId, er := primitive.ObjectIDFromHex(deviceId)
 	if er != nil {
 		return int(enum.ERROR), nil, er
@@ -212,6 +283,18 @@ func (cs *CaptureScreenController) ShowDeviceInfo(deviceId string) (int, interfa
 	if e != nil {
 		return int(enum.DEVICE_NOT_FOUND), nil, e
 	}
+	deviceName, _ := device["deviceName"].(string)
+	if code, e := cs.CheckOwner(deviceName, claims.Subject); e != nil {
+		return code, nil, e
+	}
+	if screenshotId, ok := device["lastScreenshotId"].(string); ok && screenshotId != "" {
+		if screenshotController, ok := GetControllerInstance(enum.ScreenshotController, enum.MONGODB).(*ScreenshotController); ok {
+			if screenshot, err := screenshotController.GetScreenshot(screenshotId); err == nil {
+				device["lastImageUrl"] = screenshot.ImageURL
+				device["lastThumbnailUrl"] = screenshot.ThumbnailURL
+			}
+		}
+	}
 	return int(enum.DEVICE_FOUND), device, nil
 }
 
@@ -248,15 +331,499 @@ func (cs *CaptureScreenController) PingDevice(w http.ResponseWriter, r *http.Req
 	return -1, nil
 } 
 
-func (cs *CaptureScreenController) TurnDeviceOffline (query map[string]interface{}) (error){
-	updateData := map[string]interface{}{
-		"isOnline": false,
-		"updatedAt": time.Now().UTC(),
-	}
-	_, e := cs.DB.Update(query, updateData, cs.GetCollectionName())
+// TurnDeviceOffline marks the matching online device offline. The update only
+// applies to devices that are still online so every transition is recorded
+// once and reported to the SSE service.
+func (cs *CaptureScreenController) TurnDeviceOffline(query map[string]interface{}) error {
+	deviceName, _ := query["deviceName"].(string)
+	changed, e := cs.setDeviceOnline(deviceName, false, enum.DEVICE_PUBLISH_FAILED)
 	if e != nil {
 		log.Println("Error occurred while updating the device", e)
 		return e
 	}
+	if changed {
+		broker.CreateBroker(enum.RABBITMQ).PublishMessage(map[string]interface{}{
+			"deviceName": deviceName,
+			"isOnline":   false,
+			"reason":     string(enum.DEVICE_PUBLISH_FAILED),
+		}, "api-gateway-queue", enum.DEVICE_STATUS_CHANGED_TOPIC)
+	}
+	return nil
+}
+const (
+	minScheduleIntervalSeconds = 30
+	// A device counts as in use if it reported input within this window.
+	userActiveWindow = 5 * time.Minute
+)
+
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+func scheduleLocation(schedule *model.CaptureSchedule) (*time.Location, error) {
+	if schedule.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(schedule.Timezone)
+}
+
+// nextScheduledRun returns the first run strictly after from.
+func nextScheduledRun(schedule *model.CaptureSchedule, from time.Time) (time.Time, error) {
+	if schedule.Cron != "" {
+		loc, e := scheduleLocation(schedule)
+		if e != nil {
+			return time.Time{}, e
+		}
+		cronSchedule, e := cronParser.Parse(schedule.Cron)
+		if e != nil {
+			return time.Time{}, e
+		}
+		return cronSchedule.Next(from.In(loc)).UTC(), nil
+	}
+	return from.Add(time.Duration(schedule.IntervalSeconds) * time.Second).UTC(), nil
+}
+
+func parseClock(value string) (int, error) {
+	t, e := time.Parse("15:04", value)
+	if e != nil {
+		return 0, errors.New("active hours must use HH:MM, got " + value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// withinActiveHours reports whether at falls inside the schedule's daily
+// window. Windows whose end is before their start wrap past midnight.
+func withinActiveHours(schedule *model.CaptureSchedule, at time.Time) bool {
+	if schedule.ActiveHours == nil {
+		return true
+	}
+	loc, e := scheduleLocation(schedule)
+	if e != nil {
+		return false
+	}
+	local := at.In(loc)
+	if len(schedule.ActiveHours.Days) > 0 {
+		allowed := false
+		for _, day := range schedule.ActiveHours.Days {
+			if time.Weekday(day) == local.Weekday() {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	start, e := parseClock(schedule.ActiveHours.Start)
+	if e != nil {
+		return false
+	}
+	end, e := parseClock(schedule.ActiveHours.End)
+	if e != nil {
+		return false
+	}
+	now := local.Hour()*60 + local.Minute()
+	if start <= end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+func validateCaptureSchedule(schedule *model.CaptureSchedule) error {
+	if schedule.IntervalSeconds > 0 && schedule.Cron != "" {
+		return errors.New("set either intervalSeconds or cron, not both")
+	}
+	if schedule.Cron == "" && schedule.IntervalSeconds < minScheduleIntervalSeconds {
+		return fmt.Errorf("intervalSeconds must be at least %d", minScheduleIntervalSeconds)
+	}
+	if schedule.Cron != "" {
+		if _, e := cronParser.Parse(schedule.Cron); e != nil {
+			return fmt.Errorf("invalid cron expression: %v", e)
+		}
+	}
+	if _, e := scheduleLocation(schedule); e != nil {
+		return fmt.Errorf("invalid timezone: %v", e)
+	}
+	if schedule.ActiveHours != nil {
+		if _, e := parseClock(schedule.ActiveHours.Start); e != nil {
+			return e
+		}
+		if _, e := parseClock(schedule.ActiveHours.End); e != nil {
+			return e
+		}
+		for _, day := range schedule.ActiveHours.Days {
+			if day < 0 || day > 6 {
+				return errors.New("active hour days must be between 0 (Sunday) and 6 (Saturday)")
+			}
+		}
+	}
+	switch enum.CaptureMissedRunPolicy(schedule.MissedRunPolicy) {
+	case "":
+		schedule.MissedRunPolicy = string(enum.MISSED_RUN_SKIP)
+	case enum.MISSED_RUN_SKIP, enum.MISSED_RUN_CATCH_UP:
+	default:
+		return errors.New("missedRunPolicy must be skip or catch-up")
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+// SetCaptureSchedule replaces the capture schedule of one of the caller's
+// devices. The scheduler reads schedules from the database on every pass, so
+// changes apply on its next tick.
+func (cs *CaptureScreenController) SetCaptureSchedule(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.USER_NOT_FOUND), nil, errors.New("not logged in")
+	}
+	deviceModel := model.Device{}
+	if decodeErr := json.NewDecoder(r.Body).Decode(&deviceModel); decodeErr != nil {
+		return int(enum.DEVICE_SCHEDULE_INVALID), nil, decodeErr
+	}
+	schedule := deviceModel.CaptureSchedule
+	if deviceModel.DeviceName == "" || schedule == nil {
+		return int(enum.DEVICE_SCHEDULE_INVALID), nil, errors.New("deviceName and captureSchedule are required")
+	}
+
+	query := map[string]interface{}{"deviceName": deviceModel.DeviceName}
+	if code, e := cs.CheckOwner(deviceModel.DeviceName, claims.Subject); e != nil {
+		return code, nil, e
+	}
+
+	if schedule.Enabled {
+		if e := validateCaptureSchedule(schedule); e != nil {
+			return int(enum.DEVICE_SCHEDULE_INVALID), nil, e
+		}
+		nextRun, e := nextScheduledRun(schedule, time.Now().UTC())
+		if e != nil {
+			return int(enum.DEVICE_SCHEDULE_INVALID), nil, e
+		}
+		schedule.NextRunAt = &nextRun
+	} else {
+		schedule.NextRunAt = nil
+	}
+	schedule.LastRunAt = nil
+	schedule.LastRunStatus = ""
+	schedule.MissedRuns = 0
+	schedule.MissedRunPending = false
+
+	if e := cs.Update(query, map[string]interface{}{
+		"captureSchedule": schedule,
+		"updatedAt":       time.Now().UTC(),
+	}); e != nil {
+		return int(enum.DEVICE_SCHEDULE_NOT_UPDATED), nil, e
+	}
+	return int(enum.DEVICE_SCHEDULE_UPDATED), schedule, nil
+}
+
+// RunScheduledCaptures publishes capture commands for every device whose
+// schedule is due, and retries pending catch-up runs for devices that were
+// offline. Runs are claimed by moving nextRunAt forward with a conditional
+// update, so several gateway instances never fire the same slot twice.
+func (cs *CaptureScreenController) RunScheduledCaptures(now time.Time) error {
+	dbConn := db.GetConnectionFromPool()
+	defer db.ReleaseConnectionToPool(dbConn)
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(cs.GetCollectionName())
+
+	ctx := context.Background()
+	cursor, e := collection.Find(ctx, bson.M{
+		"captureSchedule.enabled": true,
+		"$or": bson.A{
+			bson.M{"captureSchedule.nextRunAt": bson.M{"$lte": now}},
+			bson.M{"captureSchedule.missedRunPending": true},
+		},
+	})
+	if e != nil {
+		return e
+	}
+	defer cursor.Close(ctx)
+
+	var devices []model.Device
+	if e = cursor.All(ctx, &devices); e != nil {
+		return e
+	}
+
+	for _, device := range devices {
+		cs.runScheduledCapture(device, now)
+	}
+	return nil
+}
+
+func (cs *CaptureScreenController) runScheduledCapture(device model.Device, now time.Time) {
+	schedule := device.CaptureSchedule
+	objectId, e := primitive.ObjectIDFromHex(device.ID)
+	if e != nil {
+		log.Println("Invalid device id", device.ID, e)
+		return
+	}
+
+	due := schedule.NextRunAt != nil && !schedule.NextRunAt.After(now)
+	update := bson.M{}
+	if due {
+		nextRun, e := nextScheduledRun(schedule, now)
+		if e != nil {
+			log.Println("Unable to compute next capture run for", device.DeviceName, e)
+			return
+		}
+		claimed, e := cs.DB.UpdateWithOperators(bson.M{
+			"_id":                       objectId,
+			"captureSchedule.nextRunAt": schedule.NextRunAt,
+		}, bson.M{"$set": bson.M{"captureSchedule.nextRunAt": nextRun}}, cs.GetCollectionName())
+		if e != nil || claimed == "0" {
+			return
+		}
+	}
+
+	status := enum.CAPTURE_RUN_SENT
+	if !withinActiveHours(schedule, now) {
+		status = enum.CAPTURE_RUN_OUTSIDE_HOURS
+	} else if schedule.OnlyWhenUserActive && (device.LastUserActivity == nil || now.Sub(*device.LastUserActivity) > userActiveWindow) {
+		status = enum.CAPTURE_RUN_USER_INACTIVE
+	}
+
+	if status != enum.CAPTURE_RUN_SENT {
+		// A skipped slot also retires any pending catch-up; the user or the
+		// window has moved on since it was missed.
+		update["captureSchedule.missedRunPending"] = false
+	} else if _, pubErr := cs.publishCaptureCommand(device.DeviceName); pubErr != nil {
+		if !due {
+			// Still offline; keep the catch-up pending without rewriting the record.
+			return
+		}
+		status = enum.CAPTURE_RUN_MISSED
+		if device.IsOnline {
+			if er := cs.TurnDeviceOffline(map[string]interface{}{"deviceName": device.DeviceName}); er != nil {
+				log.Println("Error turning device offline", er)
+			}
+		}
+		update["captureSchedule.missedRunPending"] = schedule.MissedRunPolicy == string(enum.MISSED_RUN_CATCH_UP)
+	} else {
+		if !due {
+			status = enum.CAPTURE_RUN_CAUGHT_UP
+		}
+		update["captureSchedule.lastRunAt"] = now
+		update["captureSchedule.missedRunPending"] = false
+	}
+	update["captureSchedule.lastRunStatus"] = status
+
+	operators := bson.M{"$set": update}
+	if status == enum.CAPTURE_RUN_MISSED {
+		operators["$inc"] = bson.M{"captureSchedule.missedRuns": 1}
+	}
+	if _, e := cs.DB.UpdateWithOperators(bson.M{"_id": objectId}, operators, cs.GetCollectionName()); e != nil {
+		log.Println("Error updating capture schedule for", device.DeviceName, e)
+		return
+	}
+	log.Printf("Scheduled capture for %s: %s", device.DeviceName, status)
+}
+
+const (
+	defaultOfflineThresholdSeconds = 180
+	defaultUptimeWindow            = 24 * time.Hour
+)
+
+func (cs *CaptureScreenController) GetUptimeCollectionName() string {
+	return "device_uptime_events"
+}
+
+// DeviceOfflineThreshold is how long a device may stay silent before the
+// heartbeat monitor marks it offline, from DEVICE_OFFLINE_THRESHOLD_SECONDS.
+func DeviceOfflineThreshold() time.Duration {
+	seconds, e := strconv.Atoi(os.Getenv("DEVICE_OFFLINE_THRESHOLD_SECONDS"))
+	if e != nil || seconds <= 0 {
+		seconds = defaultOfflineThresholdSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// setDeviceOnline flips isOnline only when it differs from the stored value and
+// records the transition in the uptime history. It reports whether the device
+// changed state.
+func (cs *CaptureScreenController) setDeviceOnline(deviceName string, online bool, reason enum.DeviceStatusReason) (bool, error) {
+	if deviceName == "" {
+		return false, errors.New("deviceName is required")
+	}
+	now := time.Now().UTC()
+	modified, e := cs.DB.Update(bson.M{
+		"deviceName": deviceName,
+		"isOnline":   bson.M{"$ne": online},
+	}, bson.M{
+		"isOnline":  online,
+		"updatedAt": now,
+	}, cs.GetCollectionName())
+	if e != nil {
+		return false, e
+	}
+	if modified == "0" {
+		return false, nil
+	}
+	if _, e := cs.DB.Create(model.DeviceUptimeEvent{
+		DeviceName: deviceName,
+		IsOnline:   online,
+		Reason:     string(reason),
+		At:         now,
+	}, cs.GetUptimeCollectionName()); e != nil {
+		log.Println("Error recording uptime event for", deviceName, e)
+	}
+	return true, nil
+}
+
+// MarkDeviceOnline is called whenever a device reports in. It returns true if
+// the device was offline until now.
+func (cs *CaptureScreenController) MarkDeviceOnline(deviceName string) (bool, error) {
+	return cs.setDeviceOnline(deviceName, true, enum.DEVICE_HEARTBEAT_RESUMED)
+}
+
+// MarkStaleDevicesOffline marks online devices that have not reported within
+// threshold as offline and returns the devices that changed state.
+func (cs *CaptureScreenController) MarkStaleDevicesOffline(threshold time.Duration) ([]model.Device, error) {
+	dbConn := db.GetConnectionFromPool()
+	defer db.ReleaseConnectionToPool(dbConn)
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(cs.GetCollectionName())
+
+	ctx := context.Background()
+	cursor, e := collection.Find(ctx, bson.M{
+		"isOnline":   true,
+		"lastOnline": bson.M{"$lt": time.Now().UTC().Add(-threshold)},
+	})
+	if e != nil {
+		return nil, e
+	}
+	defer cursor.Close(ctx)
+
+	var stale []model.Device
+	if e = cursor.All(ctx, &stale); e != nil {
+		return nil, e
+	}
+
+	var changed []model.Device
+	for _, device := range stale {
+		// Another instance or a fresh heartbeat may have got there first.
+		ok, e := cs.setDeviceOnline(device.DeviceName, false, enum.DEVICE_HEARTBEAT_TIMEOUT)
+		if e != nil {
+			log.Println("Error marking device offline", device.DeviceName, e)
+			continue
+		}
+		if ok {
+			device.IsOnline = false
+			changed = append(changed, device)
+		}
+	}
+	return changed, nil
+}
+
+// SetDeviceWatch toggles whether one of the caller's devices going offline
+// raises an alert.
+func (cs *CaptureScreenController) SetDeviceWatch(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.USER_NOT_FOUND), nil, errors.New("not logged in")
+	}
+	req := model.DeviceWatchRequestModel{}
+	if decodeErr := json.NewDecoder(r.Body).Decode(&req); decodeErr != nil {
+		return int(enum.DEVICE_WATCH_NOT_UPDATED), nil, decodeErr
+	}
+	if req.DeviceName == "" {
+		return int(enum.DEVICE_WATCH_NOT_UPDATED), nil, errors.New("deviceName is required")
+	}
+	query := map[string]interface{}{"deviceName": req.DeviceName}
+	if code, e := cs.CheckOwner(req.DeviceName, claims.Subject); e != nil {
+		return code, nil, e
+	}
+	if e := cs.Update(query, map[string]interface{}{
+		"watched":   req.Watched,
+		"updatedAt": time.Now().UTC(),
+	}); e != nil {
+		return int(enum.DEVICE_WATCH_NOT_UPDATED), nil, e
+	}
+	return int(enum.DEVICE_WATCH_UPDATED), req, nil
+}
+
+// GetUptimeHistory returns the online/offline transitions of one of the
+// caller's devices between from and to (RFC3339, default the last 24 hours)
+// and the share of that window the device spent online.
+func (cs *CaptureScreenController) GetUptimeHistory(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.USER_NOT_FOUND), nil, errors.New("not logged in")
+	}
+	params := r.URL.Query()
+	deviceName := params.Get("deviceName")
+	if deviceName == "" {
+		return int(enum.DATA_NOT_FETCHED), nil, errors.New("deviceName is required")
+	}
+	if code, e := cs.CheckOwner(deviceName, claims.Subject); e != nil {
+		return code, nil, e
+	}
+	to := time.Now().UTC()
+	if raw := params.Get("to"); raw != "" {
+		parsed, e := time.Parse(time.RFC3339, raw)
+		if e != nil {
+			return int(enum.DATA_NOT_FETCHED), nil, errors.New("to must be an RFC3339 timestamp")
+		}
+		to = parsed.UTC()
+	}
+	from := to.Add(-defaultUptimeWindow)
+	if raw := params.Get("from"); raw != "" {
+		parsed, e := time.Parse(time.RFC3339, raw)
+		if e != nil {
+			return int(enum.DATA_NOT_FETCHED), nil, errors.New("from must be an RFC3339 timestamp")
+		}
+		from = parsed.UTC()
+	}
+	if !from.Before(to) {
+		return int(enum.DATA_NOT_FETCHED), nil, errors.New("from must be before to")
+	}
+
+	dbConn := db.GetConnectionFromPool()
+	defer db.ReleaseConnectionToPool(dbConn)
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(cs.GetUptimeCollectionName())
+	ctx := context.Background()
+
+	// The last transition before the window tells us the state it opened in.
+	online := false
+	previous := model.DeviceUptimeEvent{}
+	e := collection.FindOne(ctx, bson.M{
+		"deviceName": deviceName,
+		"at":         bson.M{"$lt": from},
+	}, options.FindOne().SetSort(bson.D{{Key: "at", Value: -1}})).Decode(&previous)
+	if e == nil {
+		online = previous.IsOnline
+	} else if e != mongo.ErrNoDocuments {
+		return int(enum.DATA_NOT_FETCHED), nil, e
+	}
+
+	cursor, e := collection.Find(ctx, bson.M{
+		"deviceName": deviceName,
+		"at":         bson.M{"$gte": from, "$lte": to},
+	}, options.Find().SetSort(bson.D{{Key: "at", Value: 1}}))
+	if e != nil {
+		return int(enum.DATA_NOT_FETCHED), nil, e
+	}
+	defer cursor.Close(ctx)
+
+	events := []model.DeviceUptimeEvent{}
+	if e = cursor.All(ctx, &events); e != nil {
+		return int(enum.DATA_NOT_FETCHED), nil, e
+	}
+
+	var onlineFor time.Duration
+	since := from
+	for _, event := range events {
+		if online {
+			onlineFor += event.At.Sub(since)
+		}
+		online = event.IsOnline
+		since = event.At
+	}
+	if online {
+		onlineFor += to.Sub(since)
+	}
+	window := to.Sub(from)
+
+	return int(enum.DEVICE_UPTIME_FOUND), map[string]interface{}{
+		"deviceName":    deviceName,
+		"from":          from,
+		"to":            to,
+		"onlineSeconds": int64(onlineFor.Seconds()),
+		"uptimePercent": float64(onlineFor) / float64(window) * 100,
+		"events":        events,
+	}, nil
+}
@@ -1,19 +1,32 @@
 package controllers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"html"
 	"log"
 	"math/rand"
 	"net/http"
+	"os"
+	"path/filepath"
+	"project-phoenix/v2/internal/broker"
 	"project-phoenix/v2/internal/db"
 	"project-phoenix/v2/internal/enum"
 	"project-phoenix/v2/internal/model"
+	"project-phoenix/v2/internal/storage"
 	"project-phoenix/v2/pkg/helper"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/gosimple/slug"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type ClipboardRoomController struct {
@@ -21,11 +34,23 @@ type ClipboardRoomController struct {
 	DB             db.DBInterface
 }
 
+const (
+	clipboardTextIndexName        = "clipboard_text_search"
+	clipboardSearchPageSize       = 20
+	defaultClipboardMaxAttachment = 25 << 20
+	clipboardAttachmentURLTTL     = 24 * time.Hour
+)
+
 func (cs *ClipboardRoomController) GetCollectionName() string {
 	return "clipboardRooms"
 }
 
 func (cs *ClipboardRoomController) PerformIndexing() error {
+	if cs.DB == nil {
+		log.Println("Warning: DB instance is nil, skipping indexing")
+		return nil
+	}
+
 	indexes := []interface{}{"roomName"}
 	var validateErr error
 	for _, index := range indexes {
@@ -34,8 +59,12 @@ func (cs *ClipboardRoomController) PerformIndexing() error {
 			return validateErr
 		}
 	}
-	return nil
 
+	textIndex := bson.D{
+		{Key: "messages.message", Value: "text"},
+		{Key: "roomName", Value: "text"},
+	}
+	return cs.DB.ValidateTextIndexing(cs.GetCollectionName(), clipboardTextIndexName, textIndex)
 }
 
 func (cs *ClipboardRoomController) Create(room model.ClipboardRoom) (bson.M, error) {
@@ -118,6 +147,7 @@ func (cs *ClipboardRoomController) CreateRoom(w http.ResponseWriter, r *http.Req
 				UserAgent:  userAgent,
 				JoinedAt:   time.Now(),
 				DeviceInfo: roomRequestBody.DeviceInfo,
+				Sessions:   clipboardSessions(r.Header.Get("sessionId")),
 			},
 		},
 		Messages: []model.ClipboardRoomMessage{},
@@ -152,7 +182,10 @@ func (cs *ClipboardRoomController) JoinRoom(w http.ResponseWriter, r *http.Reque
 	}
 	userAgent := r.Header.Get("User-Agent")
 
-	// First check if user is already a member
+	session := clipboardSession(r.Header.Get("sessionId"))
+
+	// A device that is already a member adds its current session to its
+	// membership
 	existingRoom, e := cs.DB.FindOne(map[string]interface{}{
 		"code": roomRequestBody.Code,
 		"members": map[string]interface{}{
@@ -163,6 +196,15 @@ func (cs *ClipboardRoomController) JoinRoom(w http.ResponseWriter, r *http.Reque
 	}, cs.GetCollectionName())
 
 	if existingRoom != nil {
+		if session != "" {
+			_, err := cs.DB.UpdateWithOperators(bson.M{
+				"code":    roomRequestBody.Code,
+				"members": bson.M{"$elemMatch": bson.M{"deviceInfo": roomRequestBody.DeviceInfo}},
+			}, bson.M{"$addToSet": bson.M{"members.$.sessions": session}}, cs.GetCollectionName())
+			if err != nil {
+				return int(enum.ERROR), nil, err
+			}
+		}
 		roomModel := model.ClipboardRoom{}
 		if err := helper.MapToStruct(existingRoom, &roomModel); err != nil {
 			return int(enum.ERROR), nil, err
@@ -188,20 +230,40 @@ func (cs *ClipboardRoomController) JoinRoom(w http.ResponseWriter, r *http.Reque
 		UserAgent:  userAgent,
 		JoinedAt:   time.Now(),
 		DeviceInfo: roomRequestBody.DeviceInfo,
+		Sessions:   clipboardSessions(r.Header.Get("sessionId")),
 	}
 
-	roomModel.Members = append(roomModel.Members, newMember)
-	_, err := cs.DB.Update(map[string]interface{}{"code": roomRequestBody.Code},
-		map[string]interface{}{"members": roomModel.Members},
+	// Pushed rather than rewriting the members, whose sessions do not
+	// survive MapToStruct
+	_, err := cs.DB.UpdateWithOperators(bson.M{"code": roomRequestBody.Code},
+		bson.M{"$push": bson.M{"members": newMember}},
 		cs.GetCollectionName())
 	if err != nil {
 		return int(enum.ERROR), nil, err
 	}
+	roomModel.Members = append(roomModel.Members, newMember)
 
 	return int(enum.ROOM_FOUND), roomModel, nil
 
 }
 
+// clipboardSession hashes a session id. Rooms tell members and senders apart
+// by it without storing sessions that could be used to sign in.
+func clipboardSession(sessionID string) string {
+	if sessionID == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:])
+}
+
+func clipboardSessions(sessionID string) []string {
+	if session := clipboardSession(sessionID); session != "" {
+		return []string{session}
+	}
+	return nil
+}
+
 func generateCode() string {
 	charset := "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	code := make([]byte, 6)
@@ -228,6 +290,10 @@ func (cs *ClipboardRoomController) DeleteRoom(w http.ResponseWriter, r *http.Req
 		return int(enum.ROOM_NOT_DELETED), er
 	}
 	log.Println("Room ObjectId", objectId)
+	roomCode := roomModel.Code
+	if room, _ := cs.Find(map[string]interface{}{"_id": objectId}); room != nil {
+		roomCode, _ = room["code"].(string)
+	}
 	_, e := cs.DB.Delete(map[string]interface{}{
 		"_id": objectId,
 	}, cs.GetCollectionName())
@@ -237,6 +303,9 @@ func (cs *ClipboardRoomController) DeleteRoom(w http.ResponseWriter, r *http.Req
 		return int(enum.ROOM_NOT_DELETED), e
 	}
 	log.Println("Room has been deleted")
+	if roomCode != "" {
+		cs.deleteAttachments(roomCode)
+	}
 	return int(enum.ROOM_DELETED), nil
 }
 
@@ -256,7 +325,9 @@ func (cs *ClipboardRoomController) ShowRoomInfo(roomId string) (int, interface{}
 	return int(enum.ROOM_FOUND), room, nil
 }
 
-func (cs *ClipboardRoomController) ProcessRoomMessage(roomCode string, data map[string]interface{}) (int, interface{}, error) {
+// ProcessRoomMessage stores a message sent over the socket by the given
+// session.
+func (cs *ClipboardRoomController) ProcessRoomMessage(roomCode string, data map[string]interface{}, sessionID string) (int, interface{}, error) {
 	log.Println("Processing room message:", data)
 
 	// // Extract message data
@@ -266,9 +337,18 @@ func (cs *ClipboardRoomController) ProcessRoomMessage(roomCode string, data map[
 		log.Println("Error parsing message data:", err)
 		return int(enum.ERROR), nil, err
 	}
+	// Keys are signed and deleted with the message later, so only keys
+	// uploaded to this room are accepted.
+	if messageData.AttachmentKey != "" {
+		key, err := storage.CleanKey(messageData.AttachmentKey)
+		if err != nil || key != messageData.AttachmentKey || !strings.HasPrefix(key, clipboardAttachmentPrefix(roomCode)) {
+			return int(enum.ERROR), nil, errors.New("attachmentKey does not belong to room " + roomCode)
+		}
+	}
 
 	// Create message object
 	message := map[string]interface{}{
+		"_id":            primitive.NewObjectID(),
 		"roomId":         messageData.RoomID,
 		"message":        messageData.Message,
 		"createdAt":      messageData.TimeStamp,
@@ -276,7 +356,9 @@ func (cs *ClipboardRoomController) ProcessRoomMessage(roomCode string, data map[
 		"isAttachment":   messageData.IsAttachment,
 		"attachmentType": messageData.AttachmentType,
 		"attachmentURL":  messageData.AttachmentURL,
+		"attachmentKey":  messageData.AttachmentKey,
 		"deviceInfo":     messageData.DeviceInfo.SlugifiedDeviceName,
+		"senderSession":  clipboardSession(sessionID),
 	}
 
 	log.Println("Message:", message)
@@ -329,6 +411,14 @@ func (cs *ClipboardRoomController) GetRoomMessages(w http.ResponseWriter, r *htt
 	// Get total messages count
 	totalMessages := len(clipboardRoom.Messages)
 
+	// Pinned messages are returned regardless of the requested page
+	pinnedMessages := []model.ClipboardRoomMessage{}
+	for _, m := range clipboardRoom.Messages {
+		if m.IsPinned && !m.IsDeleted {
+			pinnedMessages = append(pinnedMessages, m)
+		}
+	}
+
 	// Apply pagination to messages
 	startIndex := totalMessages - skip - limit
 	endIndex := totalMessages - skip
@@ -350,12 +440,538 @@ func (cs *ClipboardRoomController) GetRoomMessages(w http.ResponseWriter, r *htt
 		clipboardRoom.Messages = []model.ClipboardRoomMessage{}
 	}
 
+	cs.signAttachmentURLs(clipboardRoom.Messages)
+	cs.signAttachmentURLs(pinnedMessages)
+
 	response := map[string]interface{}{
-		"totalMessages": totalMessages,
-		"page":          pageNum,
-		"messages":      clipboardRoom.Messages,
-		"limit":         limit,
+		"totalMessages":  totalMessages,
+		"page":           pageNum,
+		"messages":       clipboardRoom.Messages,
+		"pinnedMessages": pinnedMessages,
+		"limit":          limit,
 	}
 
 	return int(enum.ROOM_FOUND), response, nil
 }
+
+// findRoomMessage checks that the session is a member of the room and that
+// the message exists and matches the extra element conditions (e.g. sender
+// ownership) before it is modified. It also returns the deviceInfo of the
+// member the session belongs to, which is who pins and reacts.
+func (cs *ClipboardRoomController) findRoomMessage(code string, messageID string, session string, extra bson.M) (primitive.ObjectID, string, error) {
+	if code == "" || messageID == "" {
+		return primitive.NilObjectID, "", errors.New("code and messageId are required")
+	}
+	if session == "" {
+		return primitive.NilObjectID, "", errors.New("a session is required")
+	}
+	objectId, er := primitive.ObjectIDFromHex(messageID)
+	if er != nil {
+		return primitive.NilObjectID, "", er
+	}
+	elemMatch := bson.M{"_id": objectId}
+	for k, v := range extra {
+		elemMatch[k] = v
+	}
+	room, e := cs.DB.FindOne(bson.M{"code": code, "members.sessions": session, "messages": bson.M{"$elemMatch": elemMatch}}, cs.GetCollectionName())
+	if e != nil || room == nil {
+		return primitive.NilObjectID, "", errors.New("message not found")
+	}
+	return objectId, roomMember(room, session), nil
+}
+
+// roomMember returns the deviceInfo of the room member that joined with the
+// hashed session.
+func roomMember(room bson.M, session string) string {
+	members, _ := room["members"].(bson.A)
+	for _, m := range members {
+		member, ok := m.(bson.M)
+		if !ok {
+			continue
+		}
+		sessions, _ := member["sessions"].(bson.A)
+		for _, s := range sessions {
+			if s == session {
+				deviceInfo, _ := member["deviceInfo"].(string)
+				return deviceInfo
+			}
+		}
+	}
+	return ""
+}
+
+func (cs *ClipboardRoomController) updateRoomMessage(code string, objectId primitive.ObjectID, update bson.M) error {
+	_, e := cs.DB.UpdateWithOperators(bson.M{"code": code, "messages._id": objectId}, update, cs.GetCollectionName())
+	if e != nil {
+		log.Println("Error updating room message", e)
+	}
+	return e
+}
+
+// EditMessage replaces the text of a message. Only the session that sent it
+// may edit, and no edit history is kept so a corrected paste does not linger
+// in storage.
+func (cs *ClipboardRoomController) EditMessage(req model.ClipboardMessageActionRequestModel, sessionID string) (int, map[string]interface{}, error) {
+	session := clipboardSession(sessionID)
+	objectId, _, e := cs.findRoomMessage(req.Code, req.MessageID, session, bson.M{"senderSession": session, "isDeleted": bson.M{"$ne": true}})
+	if e != nil {
+		return int(enum.ROOM_MESSAGE_NOT_FOUND), nil, e
+	}
+	editedAt := time.Now()
+	e = cs.updateRoomMessage(req.Code, objectId, bson.M{"$set": bson.M{
+		"messages.$.message":  req.Message,
+		"messages.$.editedAt": editedAt,
+	}})
+	if e != nil {
+		return int(enum.ROOM_MESSAGE_NOT_UPDATED), nil, e
+	}
+	return int(enum.ROOM_MESSAGE_UPDATED), map[string]interface{}{
+		"code":      req.Code,
+		"messageId": req.MessageID,
+		"message":   req.Message,
+		"editedAt":  editedAt,
+	}, nil
+}
+
+// DeleteMessage soft-deletes a message of the session that sent it. The
+// tombstone keeps its position in the room, but the text, attachment and
+// reactions are purged from the document.
+func (cs *ClipboardRoomController) DeleteMessage(req model.ClipboardMessageActionRequestModel, sessionID string) (int, map[string]interface{}, error) {
+	session := clipboardSession(sessionID)
+	objectId, _, e := cs.findRoomMessage(req.Code, req.MessageID, session, bson.M{"senderSession": session, "isDeleted": bson.M{"$ne": true}})
+	if e != nil {
+		return int(enum.ROOM_MESSAGE_NOT_FOUND), nil, e
+	}
+	attachmentKey := cs.attachmentKey(req.Code, objectId)
+	deletedAt := time.Now()
+	e = cs.updateRoomMessage(req.Code, objectId, bson.M{
+		"$set": bson.M{
+			"messages.$.message":        "",
+			"messages.$.isAttachment":   false,
+			"messages.$.attachmentType": "",
+			"messages.$.attachmentURL":  "",
+			"messages.$.isPinned":       false,
+			"messages.$.isDeleted":      true,
+			"messages.$.deletedAt":      deletedAt,
+		},
+		"$unset": bson.M{
+			"messages.$.attachmentKey": "",
+			"messages.$.reactions":     "",
+			"messages.$.editedAt":      "",
+			"messages.$.pinnedAt":      "",
+			"messages.$.pinnedBy":      "",
+		},
+	})
+	if e != nil {
+		return int(enum.ROOM_MESSAGE_NOT_DELETED), nil, e
+	}
+	if attachmentKey != "" {
+		if store := storage.GetInstance(); store != nil {
+			if e := store.Delete(context.Background(), attachmentKey); e != nil {
+				log.Println("Error deleting clipboard attachment", attachmentKey, e)
+			}
+		}
+	}
+	return int(enum.ROOM_MESSAGE_DELETED), map[string]interface{}{
+		"code":      req.Code,
+		"messageId": req.MessageID,
+		"deletedAt": deletedAt,
+	}, nil
+}
+
+// PinMessage pins or unpins a message for every member of the room. The pin
+// is credited to the caller's membership, never to the sender it claims.
+func (cs *ClipboardRoomController) PinMessage(req model.ClipboardMessageActionRequestModel, sessionID string) (int, map[string]interface{}, error) {
+	objectId, member, e := cs.findRoomMessage(req.Code, req.MessageID, clipboardSession(sessionID), bson.M{"isDeleted": bson.M{"$ne": true}})
+	if e != nil {
+		return int(enum.ROOM_MESSAGE_NOT_FOUND), nil, e
+	}
+	update := bson.M{"$set": bson.M{
+		"messages.$.isPinned": true,
+		"messages.$.pinnedAt": time.Now(),
+		"messages.$.pinnedBy": member,
+	}}
+	if !req.Pinned {
+		update = bson.M{
+			"$set":   bson.M{"messages.$.isPinned": false},
+			"$unset": bson.M{"messages.$.pinnedAt": "", "messages.$.pinnedBy": ""},
+		}
+	}
+	if e = cs.updateRoomMessage(req.Code, objectId, update); e != nil {
+		return int(enum.ROOM_MESSAGE_NOT_UPDATED), nil, e
+	}
+	return int(enum.ROOM_MESSAGE_UPDATED), map[string]interface{}{
+		"code":      req.Code,
+		"messageId": req.MessageID,
+		"pinned":    req.Pinned,
+		"pinnedBy":  member,
+	}, nil
+}
+
+// ReactToMessage adds (or, with Remove set, withdraws) the caller's reaction.
+// Reactions are keyed by the caller's membership, so a member can only add or
+// take back their own.
+func (cs *ClipboardRoomController) ReactToMessage(req model.ClipboardMessageActionRequestModel, sessionID string) (int, map[string]interface{}, error) {
+	emoji := strings.TrimSpace(req.Emoji)
+	if emoji == "" || len(emoji) > 32 || strings.ContainsAny(emoji, ".$") {
+		return int(enum.ROOM_MESSAGE_NOT_UPDATED), nil, errors.New("invalid reaction")
+	}
+	objectId, member, e := cs.findRoomMessage(req.Code, req.MessageID, clipboardSession(sessionID), bson.M{"isDeleted": bson.M{"$ne": true}})
+	if e != nil {
+		return int(enum.ROOM_MESSAGE_NOT_FOUND), nil, e
+	}
+	if member == "" {
+		return int(enum.ROOM_MESSAGE_NOT_UPDATED), nil, errors.New("invalid reaction")
+	}
+	field := "messages.$.reactions." + emoji
+	update := bson.M{"$addToSet": bson.M{field: member}}
+	if req.Remove {
+		update = bson.M{"$pull": bson.M{field: member}}
+	}
+	if e = cs.updateRoomMessage(req.Code, objectId, update); e != nil {
+		return int(enum.ROOM_MESSAGE_NOT_UPDATED), nil, e
+	}
+	return int(enum.ROOM_MESSAGE_UPDATED), map[string]interface{}{
+		"code":      req.Code,
+		"messageId": req.MessageID,
+		"emoji":     emoji,
+		"sender":    member,
+		"removed":   req.Remove,
+	}, nil
+}
+
+// HandleMessageAction decodes a REST message action, applies it and hands the
+// result to the socket service so connected room members see the change.
+func (cs *ClipboardRoomController) HandleMessageAction(w http.ResponseWriter, r *http.Request, event enum.ClipboardMessageEvent) (int, interface{}, error) {
+	req := model.ClipboardMessageActionRequestModel{}
+	if decodeErr := json.NewDecoder(r.Body).Decode(&req); decodeErr != nil {
+		return int(enum.ERROR), nil, decodeErr
+	}
+	sessionID := r.Header.Get("sessionId")
+
+	var (
+		code    int
+		payload map[string]interface{}
+		e       error
+	)
+	switch event {
+	case enum.CLIPBOARD_MESSAGE_EDITED:
+		code, payload, e = cs.EditMessage(req, sessionID)
+	case enum.CLIPBOARD_MESSAGE_DELETED:
+		code, payload, e = cs.DeleteMessage(req, sessionID)
+	case enum.CLIPBOARD_MESSAGE_PINNED:
+		code, payload, e = cs.PinMessage(req, sessionID)
+	case enum.CLIPBOARD_MESSAGE_REACTED:
+		code, payload, e = cs.ReactToMessage(req, sessionID)
+	default:
+		return int(enum.ERROR), nil, errors.New("unknown message action")
+	}
+	if e != nil {
+		return code, nil, e
+	}
+
+	broker.CreateBroker(enum.RABBITMQ).PublishMessage(map[string]interface{}{
+		"action": string(event),
+		"data":   payload,
+	}, "api-gateway-queue", enum.CLIPBOARD_MESSAGE_UPDATED_TOPIC)
+
+	return code, payload, nil
+}
+
+// SearchMessages runs a full-text search over the messages of every room the
+// caller's session is a member of. Filters: roomCode, sender, device, from/to
+// (RFC3339) and attachmentType; results are paginated and carry highlighted text.
+func (cs *ClipboardRoomController) SearchMessages(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	params := r.URL.Query()
+	searchText := strings.TrimSpace(params.Get("q"))
+	session := clipboardSession(r.Header.Get("sessionId"))
+	if session == "" {
+		return int(enum.ROOM_NOT_FOUND), nil, errors.New("a session is required to resolve room membership")
+	}
+
+	pageNum := 1
+	if p, err := strconv.Atoi(params.Get("page")); err == nil && p > 0 {
+		pageNum = p
+	}
+
+	// Membership is enforced in the first stage so rooms the session has not
+	// joined never reach the message filters
+	roomMatch := bson.M{"members.sessions": session}
+	if searchText != "" {
+		roomMatch["$text"] = bson.M{"$search": searchText}
+	}
+	if roomCode := params.Get("roomCode"); roomCode != "" {
+		roomMatch["code"] = roomCode
+	}
+
+	messageMatch := bson.M{"messages.isDeleted": bson.M{"$ne": true}}
+	terms := searchTerms(searchText)
+	if len(terms) > 0 {
+		quoted := make([]string, len(terms))
+		for i, term := range terms {
+			quoted[i] = regexp.QuoteMeta(term)
+		}
+		messageMatch["messages.message"] = primitive.Regex{Pattern: strings.Join(quoted, "|"), Options: "i"}
+	}
+	if sender := params.Get("sender"); sender != "" {
+		messageMatch["messages.sender"] = sender
+	}
+	if device := params.Get("device"); device != "" {
+		messageMatch["messages.deviceInfo"] = device
+	}
+	if attachmentType := params.Get("attachmentType"); attachmentType != "" {
+		messageMatch["messages.isAttachment"] = true
+		messageMatch["messages.attachmentType"] = attachmentType
+	}
+	createdAt := bson.M{}
+	if from, err := time.Parse(time.RFC3339, params.Get("from")); err == nil {
+		createdAt["$gte"] = from
+	}
+	if to, err := time.Parse(time.RFC3339, params.Get("to")); err == nil {
+		createdAt["$lte"] = to
+	}
+	if len(createdAt) > 0 {
+		messageMatch["messages.createdAt"] = createdAt
+	}
+
+	sort := bson.D{{Key: "messages.createdAt", Value: -1}}
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: roomMatch}}}
+	if searchText != "" {
+		pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.M{"score": bson.M{"$meta": "textScore"}}}})
+		sort = append(bson.D{{Key: "score", Value: -1}}, sort...)
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$unwind", Value: "$messages"}},
+		bson.D{{Key: "$match", Value: messageMatch}},
+		bson.D{{Key: "$sort", Value: sort}},
+		bson.D{{Key: "$project", Value: bson.M{
+			"_id":      0,
+			"code":     1,
+			"roomName": 1,
+			"message":  "$messages",
+		}}},
+		bson.D{{Key: "$facet", Value: bson.M{
+			"total": bson.A{bson.M{"$count": "count"}},
+			"results": bson.A{
+				bson.M{"$skip": (pageNum - 1) * clipboardSearchPageSize},
+				bson.M{"$limit": clipboardSearchPageSize},
+			},
+		}}},
+	)
+
+	dbConn := db.GetConnectionFromPool()
+	defer db.ReleaseConnectionToPool(dbConn)
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(cs.GetCollectionName())
+
+	ctx := context.Background()
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Println("Error searching clipboard rooms", err)
+		return int(enum.DATA_NOT_FETCHED), nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var facets []struct {
+		Total []struct {
+			Count int `bson:"count"`
+		} `bson:"total"`
+		Results []struct {
+			Code     string                     `bson:"code"`
+			RoomName string                     `bson:"roomName"`
+			Message  model.ClipboardRoomMessage `bson:"message"`
+		} `bson:"results"`
+	}
+	if err = cursor.All(ctx, &facets); err != nil {
+		return int(enum.DATA_NOT_FETCHED), nil, err
+	}
+
+	total := 0
+	results := []map[string]interface{}{}
+	if len(facets) > 0 {
+		if len(facets[0].Total) > 0 {
+			total = facets[0].Total[0].Count
+		}
+		for _, hit := range facets[0].Results {
+			cs.signAttachmentURLs([]model.ClipboardRoomMessage{hit.Message})
+			results = append(results, map[string]interface{}{
+				"code":        hit.Code,
+				"roomName":    hit.RoomName,
+				"message":     hit.Message,
+				"highlighted": highlightMatches(hit.Message.Message, terms),
+			})
+		}
+	}
+
+	totalPages := total / clipboardSearchPageSize
+	if total%clipboardSearchPageSize > 0 {
+		totalPages++
+	}
+
+	return int(enum.DATA_FETCHED), map[string]interface{}{
+		"query":      searchText,
+		"total":      total,
+		"page":       pageNum,
+		"totalPages": totalPages,
+		"results":    results,
+	}, nil
+}
+
+// searchTerms splits a $text search string into the plain words used for
+// regex filtering and highlighting; negated terms are dropped.
+func searchTerms(searchText string) []string {
+	terms := []string{}
+	for _, field := range strings.Fields(strings.ReplaceAll(searchText, "\"", " ")) {
+		if strings.HasPrefix(field, "-") {
+			continue
+		}
+		terms = append(terms, field)
+	}
+	return terms
+}
+
+// highlightMatches wraps every case-insensitive occurrence of the terms in
+// <mark> tags and HTML-escapes the rest, so the result is safe to render.
+// Terms are matched against the raw text so they never land inside an entity.
+func highlightMatches(text string, terms []string) string {
+	if text == "" || len(terms) == 0 {
+		return html.EscapeString(text)
+	}
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	pattern, err := regexp.Compile("(?i)" + strings.Join(quoted, "|"))
+	if err != nil {
+		return html.EscapeString(text)
+	}
+	var highlighted strings.Builder
+	last := 0
+	for _, match := range pattern.FindAllStringIndex(text, -1) {
+		if match[0] == match[1] {
+			continue
+		}
+		highlighted.WriteString(html.EscapeString(text[last:match[0]]))
+		highlighted.WriteString("<mark>" + html.EscapeString(text[match[0]:match[1]]) + "</mark>")
+		last = match[1]
+	}
+	highlighted.WriteString(html.EscapeString(text[last:]))
+	return highlighted.String()
+}
+
+func clipboardAttachmentPrefix(code string) string {
+	return "clipboard/" + code + "/"
+}
+
+func clipboardMaxAttachmentBytes() int64 {
+	limit, err := strconv.ParseInt(os.Getenv("CLIPBOARD_MAX_ATTACHMENT_BYTES"), 10, 64)
+	if err != nil || limit <= 0 {
+		return defaultClipboardMaxAttachment
+	}
+	return limit
+}
+
+// UploadAttachment stores a file sent as multipart form data ("file" and
+// "roomCode") by a member of the room and returns the key and a signed URL to send with the room
+// message. The URL is signed again whenever messages are read.
+func (cs *ClipboardRoomController) UploadAttachment(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	store := storage.GetInstance()
+	if store == nil {
+		return int(enum.ATTACHMENT_NOT_UPLOADED), nil, errors.New("object storage not initialized")
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, clipboardMaxAttachmentBytes()+1<<20)
+	if e := r.ParseMultipartForm(8 << 20); e != nil {
+		return int(enum.ATTACHMENT_NOT_UPLOADED), nil, e
+	}
+	roomCode := r.FormValue("roomCode")
+	session := clipboardSession(r.Header.Get("sessionId"))
+	if session == "" || roomCode == "" {
+		return int(enum.ROOM_NOT_FOUND), nil, errors.New("room not found")
+	}
+	if room, e := cs.Find(map[string]interface{}{"code": roomCode, "members.sessions": session}); e != nil || room == nil {
+		return int(enum.ROOM_NOT_FOUND), nil, errors.New("room not found")
+	}
+	file, header, e := r.FormFile("file")
+	if e != nil {
+		return int(enum.ATTACHMENT_NOT_UPLOADED), nil, e
+	}
+	defer file.Close()
+	if header.Size > clipboardMaxAttachmentBytes() {
+		return int(enum.ATTACHMENT_NOT_UPLOADED), nil, errors.New("attachment is larger than " + strconv.FormatInt(clipboardMaxAttachmentBytes(), 10) + " bytes")
+	}
+
+	contentType := header.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	key := clipboardAttachmentPrefix(roomCode) + primitive.NewObjectID().Hex() + "/" + slug.Make(strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))) + strings.ToLower(filepath.Ext(header.Filename))
+	if e := store.Put(r.Context(), key, file, contentType); e != nil {
+		log.Println("Error storing clipboard attachment", e)
+		return int(enum.ATTACHMENT_NOT_UPLOADED), nil, e
+	}
+	url, e := store.SignedURL(r.Context(), key, clipboardAttachmentURLTTL)
+	if e != nil {
+		return int(enum.ATTACHMENT_NOT_UPLOADED), nil, e
+	}
+	return int(enum.ATTACHMENT_UPLOADED), map[string]interface{}{
+		"attachmentKey":  key,
+		"attachmentURL":  url,
+		"attachmentType": contentType,
+		"fileName":       header.Filename,
+		"size":           header.Size,
+	}, nil
+}
+
+// signAttachmentURLs replaces the URLs of stored attachments with fresh signed
+// ones. Messages that link to an external URL are left alone.
+func (cs *ClipboardRoomController) signAttachmentURLs(messages []model.ClipboardRoomMessage) {
+	store := storage.GetInstance()
+	if store == nil {
+		return
+	}
+	for i := range messages {
+		if messages[i].AttachmentKey == "" {
+			continue
+		}
+		url, e := store.SignedURL(context.Background(), messages[i].AttachmentKey, clipboardAttachmentURLTTL)
+		if e != nil {
+			log.Println("Error signing clipboard attachment URL", e)
+			continue
+		}
+		messages[i].AttachmentURL = url
+	}
+}
+
+// attachmentKey returns the storage key of a message's attachment, if any.
+func (cs *ClipboardRoomController) attachmentKey(code string, objectId primitive.ObjectID) string {
+	room, e := cs.DB.FindOne(bson.M{"code": code}, cs.GetCollectionName())
+	if e != nil || room == nil {
+		return ""
+	}
+	clipboardRoom := model.ClipboardRoom{}
+	if helper.InterfaceToStruct(room, &clipboardRoom) != nil {
+		return ""
+	}
+	for _, message := range clipboardRoom.Messages {
+		if message.ID == objectId.Hex() {
+			return message.AttachmentKey
+		}
+	}
+	return ""
+}
+
+func (cs *ClipboardRoomController) deleteAttachments(code string) {
+	store := storage.GetInstance()
+	if store == nil {
+		return
+	}
+	objects, e := store.List(context.Background(), clipboardAttachmentPrefix(code))
+	if e != nil {
+		log.Println("Error listing clipboard attachments", e)
+		return
+	}
+	for _, object := range objects {
+		if e := store.Delete(context.Background(), object.Key); e != nil {
+			log.Println("Error deleting clipboard attachment", object.Key, e)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestHighlightMatchesEscapesText(t *testing.T) {
+	for _, tc := range []struct {
+		text  string
+		terms []string
+		want  string
+	}{
+		{"copy this", []string{"COPY"}, "<mark>copy</mark> this"},
+		{"<script>alert(1)</script> token", []string{"token"}, "&lt;script&gt;alert(1)&lt;/script&gt; <mark>token</mark>"},
+		{"a & b", []string{"&"}, "a <mark>&amp;</mark> b"},
+		{"fish & chips <amp> \"quoted\"", []string{"amp", "lt", "quot"}, "fish &amp; chips &lt;<mark>amp</mark>&gt; &#34;<mark>quot</mark>ed&#34;"},
+		{"x < y && y > z", []string{"<", "&&"}, "x <mark>&lt;</mark> y <mark>&amp;&amp;</mark> y &gt; z"},
+		{"<b>", nil, "&lt;b&gt;"},
+		{"", []string{"x"}, ""},
+	} {
+		if got := highlightMatches(tc.text, tc.terms); got != tc.want {
+			t.Errorf("highlightMatches(%q, %v) = %q, want %q", tc.text, tc.terms, got, tc.want)
+		}
+	}
+}
+
+func TestRoomMember(t *testing.T) {
+	room := bson.M{"members": bson.A{
+		bson.M{"deviceInfo": "laptop", "sessions": bson.A{"a", "b"}},
+		bson.M{"deviceInfo": "phone", "sessions": bson.A{"c"}},
+		bson.M{"deviceInfo": "legacy"},
+	}}
+	for session, want := range map[string]string{"b": "laptop", "c": "phone", "d": "", "": ""} {
+		if got := roomMember(room, session); got != want {
+			t.Errorf("roomMember(%q) = %q, want %q", session, got, want)
+		}
+	}
+}
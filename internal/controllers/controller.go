@@ -21,25 +21,36 @@ var (
 	registryMutex      = sync.Mutex{}
 
 	// Controllers
-	sessionControllerInstance         *SessionController
-	userControllerInstance            *UserController
-	userTripControllerInstance        *UserTripController
-	userLocationControllerInstance    *UserLocationController
-	userTripHistoryControllerInstance *UserTripHistoryController
-	loginActivityControllerInstance   *LoginActivityController
-	captureScreenControllerInstance   *CaptureScreenController
-	clipboardRoomControllerInstance   *ClipboardRoomController
-	googleControllerInstance          *GoogleController
-	gollmControllerInstance           *GoLLMController
-	llmAPIConfigControllerInstance    *LLMAPIConfigController
-	apiKeyControllerInstance          *APIKeyController
-	scraperConfigControllerInstance   *ScraperConfigController
-	fileExtensionControllerInstance   *FileExtensionController
-	visitControllerInstance           *VisitController
+	sessionControllerInstance          *SessionController
+	userControllerInstance             *UserController
+	userTripControllerInstance         *UserTripController
+	userLocationControllerInstance     *UserLocationController
+	userTripHistoryControllerInstance  *UserTripHistoryController
+	loginActivityControllerInstance    *LoginActivityController
+	captureScreenControllerInstance    *CaptureScreenController
+	clipboardRoomControllerInstance    *ClipboardRoomController
+	googleControllerInstance           *GoogleController
+	gollmControllerInstance            *GoLLMController
+	llmAPIConfigControllerInstance     *LLMAPIConfigController
+	apiKeyControllerInstance           *APIKeyController
+	scraperConfigControllerInstance    *ScraperConfigController
+	fileExtensionControllerInstance    *FileExtensionController
+	visitControllerInstance            *VisitController
+	deviceCommandControllerInstance    *DeviceCommandController
+	screenshotControllerInstance       *ScreenshotController
+	deviceMetricControllerInstance     *DeviceMetricController
+	deviceCredentialControllerInstance *DeviceCredentialController
+	downloadJobControllerInstance      *DownloadJobController
+	artifactExpiryControllerInstance   *ArtifactExpiryController
+	downloadBatchControllerInstance    *DownloadBatchController
+	refreshTokenControllerInstance     *RefreshTokenController
+	signingKeyControllerInstance       *SigningKeyController
+	accountTokenControllerInstance     *AccountTokenController
+	twoFactorControllerInstance        *TwoFactorController
 )
 
 func getControllerKey(controllerType enum.ControllerType, dbType enum.DBType) string {
-	return fmt.Sprintf("%s-%s", controllerType, dbType)
+	return fmt.Sprintf("%d-%d", controllerType, dbType)
 }
 
 func registerControllerInstance(key string, instance Controller) {
@@ -94,6 +105,9 @@ func GetControllerInstance(controllerType enum.ControllerType, dbType enum.DBTyp
 				DB: dbInstance,
 			}
 
+			if e := userControllerInstance.PerformIndexing(); e != nil {
+				log.Println("Error while indexing: ", e)
+			}
 		}
 		return userControllerInstance
 	case enum.UserTripController:
@@ -191,6 +205,11 @@ func GetControllerInstance(controllerType enum.ControllerType, dbType enum.DBTyp
 			clipboardRoomControllerInstance = &ClipboardRoomController{
 				DB: dbInstance,
 			}
+
+			e := clipboardRoomControllerInstance.PerformIndexing()
+			if e != nil {
+				log.Println("Error while indexing: ", e)
+			}
 		}
 		return clipboardRoomControllerInstance
 	case enum.GoogleController:
@@ -305,6 +324,205 @@ func GetControllerInstance(controllerType enum.ControllerType, dbType enum.DBTyp
 			}
 		}
 		return visitControllerInstance
+	case enum.DeviceCommandController:
+		if deviceCommandControllerInstance == nil {
+			log.Println("Initialize Device Command Controller")
+			dbInstance, err := db.GetDBInstance(dbType)
+			if err != nil {
+				log.Println("Error while getting DB Instance: ", err)
+				return nil
+			}
+
+			deviceCommandControllerInstance = &DeviceCommandController{
+				DB: dbInstance,
+			}
+
+			if e := deviceCommandControllerInstance.PerformIndexing(); e != nil {
+				log.Println("Error while indexing: ", e)
+			}
+		}
+		return deviceCommandControllerInstance
+	case enum.ScreenshotController:
+		if screenshotControllerInstance == nil {
+			log.Println("Initialize Screenshot Controller")
+			dbInstance, err := db.GetDBInstance(dbType)
+			if err != nil {
+				log.Println("Error while getting DB Instance: ", err)
+				return nil
+			}
+
+			screenshotControllerInstance = &ScreenshotController{
+				DB: dbInstance,
+			}
+			screenshotControllerInstance.InitStorage()
+
+			if e := screenshotControllerInstance.PerformIndexing(); e != nil {
+				log.Println("Error while indexing: ", e)
+			}
+		}
+		return screenshotControllerInstance
+	case enum.DeviceMetricController:
+		if deviceMetricControllerInstance == nil {
+			log.Println("Initialize Device Metric Controller")
+			dbInstance, err := db.GetDBInstance(dbType)
+			if err != nil {
+				log.Println("Error while getting DB Instance: ", err)
+				return nil
+			}
+
+			deviceMetricControllerInstance = &DeviceMetricController{
+				DB: dbInstance,
+			}
+
+			if e := deviceMetricControllerInstance.PerformIndexing(); e != nil {
+				log.Println("Error while indexing: ", e)
+			}
+		}
+		return deviceMetricControllerInstance
+	case enum.DeviceCredentialController:
+		if deviceCredentialControllerInstance == nil {
+			log.Println("Initialize Device Credential Controller")
+			dbInstance, err := db.GetDBInstance(dbType)
+			if err != nil {
+				log.Println("Error while getting DB Instance: ", err)
+				return nil
+			}
+
+			deviceCredentialControllerInstance = &DeviceCredentialController{
+				DB: dbInstance,
+			}
+
+			if e := deviceCredentialControllerInstance.PerformIndexing(); e != nil {
+				log.Println("Error while indexing: ", e)
+			}
+		}
+		return deviceCredentialControllerInstance
+	case enum.DownloadJobController:
+		if downloadJobControllerInstance == nil {
+			log.Println("Initialize Download Job Controller")
+			dbInstance, err := db.GetDBInstance(dbType)
+			if err != nil {
+				log.Println("Error while getting DB Instance: ", err)
+				return nil
+			}
+
+			downloadJobControllerInstance = &DownloadJobController{
+				DB: dbInstance,
+			}
+
+			if e := downloadJobControllerInstance.PerformIndexing(); e != nil {
+				log.Println("Error while indexing: ", e)
+			}
+		}
+		return downloadJobControllerInstance
+	case enum.ArtifactExpiryController:
+		if artifactExpiryControllerInstance == nil {
+			log.Println("Initialize Artifact Expiry Controller")
+			dbInstance, err := db.GetDBInstance(dbType)
+			if err != nil {
+				log.Println("Error while getting DB Instance: ", err)
+				return nil
+			}
+
+			artifactExpiryControllerInstance = &ArtifactExpiryController{
+				DB: dbInstance,
+			}
+
+			if e := artifactExpiryControllerInstance.PerformIndexing(); e != nil {
+				log.Println("Error while indexing: ", e)
+			}
+		}
+		return artifactExpiryControllerInstance
+	case enum.DownloadBatchController:
+		if downloadBatchControllerInstance == nil {
+			log.Println("Initialize Download Batch Controller")
+			dbInstance, err := db.GetDBInstance(dbType)
+			if err != nil {
+				log.Println("Error while getting DB Instance: ", err)
+				return nil
+			}
+
+			downloadBatchControllerInstance = &DownloadBatchController{
+				DB: dbInstance,
+			}
+
+			if e := downloadBatchControllerInstance.PerformIndexing(); e != nil {
+				log.Println("Error while indexing: ", e)
+			}
+		}
+		return downloadBatchControllerInstance
+	case enum.RefreshTokenController:
+		if refreshTokenControllerInstance == nil {
+			log.Println("Initialize Refresh Token Controller")
+			dbInstance, err := db.GetDBInstance(dbType)
+			if err != nil {
+				log.Println("Error while getting DB Instance: ", err)
+				return nil
+			}
+
+			refreshTokenControllerInstance = &RefreshTokenController{
+				DB: dbInstance,
+			}
+
+			if e := refreshTokenControllerInstance.PerformIndexing(); e != nil {
+				log.Println("Error while indexing: ", e)
+			}
+		}
+		return refreshTokenControllerInstance
+	case enum.SigningKeyController:
+		if signingKeyControllerInstance == nil {
+			log.Println("Initialize Signing Key Controller")
+			dbInstance, err := db.GetDBInstance(dbType)
+			if err != nil {
+				log.Println("Error while getting DB Instance: ", err)
+				return nil
+			}
+
+			signingKeyControllerInstance = &SigningKeyController{
+				DB: dbInstance,
+			}
+
+			if e := signingKeyControllerInstance.PerformIndexing(); e != nil {
+				log.Println("Error while indexing: ", e)
+			}
+		}
+		return signingKeyControllerInstance
+	case enum.AccountTokenController:
+		if accountTokenControllerInstance == nil {
+			log.Println("Initialize Account Token Controller")
+			dbInstance, err := db.GetDBInstance(dbType)
+			if err != nil {
+				log.Println("Error while getting DB Instance: ", err)
+				return nil
+			}
+
+			accountTokenControllerInstance = &AccountTokenController{
+				DB: dbInstance,
+			}
+
+			if e := accountTokenControllerInstance.PerformIndexing(); e != nil {
+				log.Println("Error while indexing: ", e)
+			}
+		}
+		return accountTokenControllerInstance
+	case enum.TwoFactorController:
+		if twoFactorControllerInstance == nil {
+			log.Println("Initialize Two Factor Controller")
+			dbInstance, err := db.GetDBInstance(dbType)
+			if err != nil {
+				log.Println("Error while getting DB Instance: ", err)
+				return nil
+			}
+
+			twoFactorControllerInstance = &TwoFactorController{
+				DB: dbInstance,
+			}
+
+			if e := twoFactorControllerInstance.PerformIndexing(); e != nil {
+				log.Println("Error while indexing: ", e)
+			}
+		}
+		return twoFactorControllerInstance
 	default:
 		log.Println("Unknown controller type: ", controllerType)
 		return nil
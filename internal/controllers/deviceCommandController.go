@@ -0,0 +1,340 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"project-phoenix/v2/internal/auth"
+	"project-phoenix/v2/internal/cache"
+	"project-phoenix/v2/internal/db"
+	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/model"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gosimple/slug"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultCommandTimeoutSeconds = 60
+	maxCommandTimeoutSeconds     = 3600
+	minCaptureIntervalSeconds    = 5
+)
+
+type DeviceCommandController struct {
+	CollectionName string
+	DB             db.DBInterface
+}
+
+func (dc *DeviceCommandController) GetCollectionName() string {
+	return "device_commands"
+}
+
+func (dc *DeviceCommandController) PerformIndexing() error {
+	if dc.DB == nil {
+		return errors.New("DB not initialized")
+	}
+	if e := dc.DB.ValidateUniqueIndexing(dc.GetCollectionName(), bson.D{{Key: "commandId", Value: 1}}); e != nil {
+		return e
+	}
+	indexes := []bson.D{
+		{{Key: "deviceName", Value: 1}, {Key: "createdAt", Value: -1}},
+		{{Key: "status", Value: 1}, {Key: "expiresAt", Value: 1}},
+	}
+	for _, index := range indexes {
+		if e := dc.DB.ValidateIndexing(dc.GetCollectionName(), index); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// pendingCommandStatuses are the statuses a command can still leave; results
+// and timeouts are only applied to commands in one of these.
+func pendingCommandStatuses() []string {
+	return []string{
+		string(enum.COMMAND_QUEUED),
+		string(enum.COMMAND_SENT),
+		string(enum.COMMAND_ACKNOWLEDGED),
+	}
+}
+
+// allowedScripts returns the script names devices may be asked to run, taken
+// from the comma separated DEVICE_COMMAND_SCRIPTS env variable.
+func allowedScripts() map[string]bool {
+	scripts := map[string]bool{}
+	for _, script := range strings.Split(os.Getenv("DEVICE_COMMAND_SCRIPTS"), ",") {
+		script = strings.TrimSpace(script)
+		if script != "" {
+			scripts[script] = true
+		}
+	}
+	return scripts
+}
+
+// validateCommand checks the command type and the payload it requires.
+func validateCommand(req model.DeviceCommandRequestModel) error {
+	if strings.TrimSpace(req.DeviceName) == "" {
+		return errors.New("deviceName is required")
+	}
+	switch enum.DeviceCommandType(req.Type) {
+	case enum.LOCK_SCREEN, enum.COLLECT_LOGS:
+		return nil
+	case enum.RUN_SCRIPT:
+		script, _ := req.Payload["script"].(string)
+		if script == "" {
+			return errors.New("payload.script is required")
+		}
+		if !allowedScripts()[script] {
+			return errors.New("script " + script + " is not whitelisted")
+		}
+		return nil
+	case enum.SET_CAPTURE_INTERVAL:
+		interval, ok := req.Payload["intervalSeconds"].(float64)
+		if !ok || interval < minCaptureIntervalSeconds {
+			return errors.New("payload.intervalSeconds must be at least " + strconv.Itoa(minCaptureIntervalSeconds))
+		}
+		return nil
+	case enum.UPDATE_CONFIG:
+		config, ok := req.Payload["config"].(map[string]interface{})
+		if !ok || len(config) == 0 {
+			return errors.New("payload.config is required")
+		}
+		return nil
+	default:
+		return errors.New("unknown command type " + req.Type)
+	}
+}
+
+// SendCommand stores a typed command for a device and publishes it on the
+// device's command channel. The agent reports the outcome over gRPC.
+func (dc *DeviceCommandController) SendCommand(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	req := model.DeviceCommandRequestModel{}
+	if decodeErr := json.NewDecoder(r.Body).Decode(&req); decodeErr != nil {
+		return int(enum.DEVICE_COMMAND_INVALID), nil, decodeErr
+	}
+	if e := validateCommand(req); e != nil {
+		return int(enum.DEVICE_COMMAND_INVALID), nil, e
+	}
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.USER_NOT_FOUND), nil, errors.New("not logged in")
+	}
+	captureScreenController := GetControllerInstance(enum.CaptureScreenController, enum.MONGODB).(*CaptureScreenController)
+	if code, e := captureScreenController.CheckOwner(req.DeviceName, claims.Subject); e != nil {
+		return code, nil, e
+	}
+
+	timeout := req.TimeoutSeconds
+	if timeout <= 0 {
+		timeout = defaultCommandTimeoutSeconds
+	}
+	if timeout > maxCommandTimeoutSeconds {
+		timeout = maxCommandTimeoutSeconds
+	}
+
+	now := time.Now().UTC()
+	command := model.DeviceCommand{
+		CommandID:      uuid.New().String(),
+		DeviceName:     req.DeviceName,
+		Type:           req.Type,
+		Payload:        req.Payload,
+		Status:         string(enum.COMMAND_QUEUED),
+		TimeoutSeconds: timeout,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		ExpiresAt:      now.Add(time.Duration(timeout) * time.Second),
+	}
+	if _, e := dc.DB.Create(command, dc.GetCollectionName()); e != nil {
+		log.Println("Error creating device command", e)
+		return int(enum.DEVICE_COMMAND_NOT_SENT), nil, e
+	}
+
+	message, e := json.Marshal(map[string]interface{}{
+		"commandId":      command.CommandID,
+		"type":           command.Type,
+		"payload":        command.Payload,
+		"timeoutSeconds": command.TimeoutSeconds,
+		"issuedAt":       now,
+	})
+	if e != nil {
+		return int(enum.DEVICE_COMMAND_NOT_SENT), nil, e
+	}
+
+	channelName := "device-command-" + slug.Make(req.DeviceName)
+	log.Println("Channel Name: ", channelName)
+	query := map[string]interface{}{"commandId": command.CommandID}
+	if _, e := cache.GetInstance().PublishMessage(string(message), channelName); e != nil {
+		failedAt := time.Now().UTC()
+		dc.DB.Update(query, map[string]interface{}{
+			"status":      enum.COMMAND_FAILED,
+			"error":       e.Error(),
+			"updatedAt":   failedAt,
+			"completedAt": failedAt,
+		}, dc.GetCollectionName())
+		if er := captureScreenController.TurnDeviceOffline(map[string]interface{}{"deviceName": req.DeviceName}); er != nil {
+			log.Println("Error turning device offline", er)
+		}
+		return int(enum.DEVICE_COMMAND_NOT_SENT), nil, e
+	}
+
+	sentAt := time.Now().UTC()
+	command.Status = string(enum.COMMAND_SENT)
+	command.SentAt = &sentAt
+	command.UpdatedAt = sentAt
+	if _, e := dc.DB.Update(query, map[string]interface{}{
+		"status":    command.Status,
+		"sentAt":    sentAt,
+		"updatedAt": sentAt,
+	}, dc.GetCollectionName()); e != nil {
+		log.Println("Error updating device command", e)
+	}
+	return int(enum.DEVICE_COMMAND_SENT), command, nil
+}
+
+// GetCommand returns a command sent to one of the caller's devices.
+func (dc *DeviceCommandController) GetCommand(r *http.Request, commandID string) (int, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.USER_NOT_FOUND), nil, errors.New("not logged in")
+	}
+	command, e := dc.DB.FindOne(map[string]interface{}{"commandId": commandID}, dc.GetCollectionName())
+	if e != nil || command == nil {
+		return int(enum.DEVICE_COMMAND_NOT_FOUND), nil, e
+	}
+	deviceName, _ := command["deviceName"].(string)
+	captureScreenController := GetControllerInstance(enum.CaptureScreenController, enum.MONGODB).(*CaptureScreenController)
+	if code, e := captureScreenController.CheckOwner(deviceName, claims.Subject); e != nil {
+		return code, nil, e
+	}
+	return int(enum.DEVICE_COMMAND_FOUND), command, nil
+}
+
+// ListCommands lists the commands sent to the caller's devices, or to one of
+// them with deviceName.
+func (dc *DeviceCommandController) ListCommands(r *http.Request) (int, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.USER_NOT_FOUND), nil, errors.New("not logged in")
+	}
+	captureScreenController := GetControllerInstance(enum.CaptureScreenController, enum.MONGODB).(*CaptureScreenController)
+	query := map[string]interface{}{}
+	if deviceName := r.URL.Query().Get("deviceName"); deviceName != "" {
+		if code, e := captureScreenController.CheckOwner(deviceName, claims.Subject); e != nil {
+			return code, nil, e
+		}
+		query["deviceName"] = deviceName
+	} else {
+		deviceNames, e := captureScreenController.OwnedDeviceNames(claims.Subject)
+		if e != nil {
+			log.Println("Error listing owned devices", e)
+			return int(enum.DATA_NOT_FETCHED), nil, e
+		}
+		query["deviceName"] = bson.M{"$in": deviceNames}
+	}
+	if status := r.URL.Query().Get("status"); status != "" {
+		query["status"] = status
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+
+	totalPages, page, commands, e := dc.DB.FindAllWithPagination(query, page, dc.GetCollectionName())
+	if e != nil {
+		log.Println("Error listing device commands", e)
+		return int(enum.DATA_NOT_FETCHED), nil, e
+	}
+	if commands == nil {
+		commands = []primitive.M{}
+	}
+	return int(enum.DEVICE_COMMANDS_FOUND), map[string]interface{}{
+		"totalPages": totalPages,
+		"page":       page,
+		"commands":   commands,
+	}, nil
+}
+
+// RecordResult applies a status reported by a device agent. Results for
+// commands that already finished or timed out are ignored.
+func (dc *DeviceCommandController) RecordResult(commandID string, deviceName string, status string, result string, errorMessage string) (bson.M, error) {
+	switch enum.DeviceCommandStatus(status) {
+	case enum.COMMAND_ACKNOWLEDGED, enum.COMMAND_SUCCEEDED, enum.COMMAND_FAILED:
+	default:
+		return nil, errors.New("invalid command status " + status)
+	}
+
+	now := time.Now().UTC()
+	set := bson.M{
+		"status":    status,
+		"updatedAt": now,
+	}
+	if status != string(enum.COMMAND_ACKNOWLEDGED) {
+		set["result"] = result
+		set["error"] = errorMessage
+		set["completedAt"] = now
+	}
+	query := bson.M{
+		"commandId":  commandID,
+		"deviceName": deviceName,
+		"status":     bson.M{"$in": pendingCommandStatuses()},
+	}
+	modified, e := dc.DB.UpdateWithOperators(query, bson.M{"$set": set}, dc.GetCollectionName())
+	if e != nil {
+		return nil, e
+	}
+	if modified == "0" {
+		return nil, errors.New("command " + commandID + " is not pending for device " + deviceName)
+	}
+	return dc.DB.FindOne(bson.M{"commandId": commandID}, dc.GetCollectionName())
+}
+
+// ExpireTimedOutCommands marks pending commands past their deadline as
+// timed-out and returns them so callers can notify listeners.
+func (dc *DeviceCommandController) ExpireTimedOutCommands() ([]bson.M, error) {
+	dbConn := db.GetConnectionFromPool()
+	defer db.ReleaseConnectionToPool(dbConn)
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(dc.GetCollectionName())
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	filter := bson.M{
+		"status":    bson.M{"$in": pendingCommandStatuses()},
+		"expiresAt": bson.M{"$lte": now},
+	}
+	cursor, e := collection.Find(ctx, filter)
+	if e != nil {
+		return nil, e
+	}
+	defer cursor.Close(ctx)
+
+	var expired []bson.M
+	if e = cursor.All(ctx, &expired); e != nil {
+		return nil, e
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	ids := bson.A{}
+	for _, command := range expired {
+		ids = append(ids, command["_id"])
+		command["status"] = string(enum.COMMAND_TIMED_OUT)
+		command["completedAt"] = now
+	}
+	filter["_id"] = bson.M{"$in": ids}
+	_, e = collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{
+		"status":      enum.COMMAND_TIMED_OUT,
+		"error":       "device did not report a result before the timeout",
+		"updatedAt":   now,
+		"completedAt": now,
+	}})
+	if e != nil {
+		return nil, e
+	}
+	return expired, nil
+}
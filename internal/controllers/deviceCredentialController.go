@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"project-phoenix/v2/internal/auth"
+	"project-phoenix/v2/internal/cache"
+	"project-phoenix/v2/internal/db"
+	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/model"
+	"strings"
+	"time"
+
+	"github.com/gosimple/slug"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const deviceTokenPrefix = "pdt_"
+
+type DeviceCredentialController struct {
+	CollectionName string
+	DB             db.DBInterface
+}
+
+func (dc *DeviceCredentialController) GetCollectionName() string {
+	return "device_credentials"
+}
+
+func (dc *DeviceCredentialController) PerformIndexing() error {
+	if dc.DB == nil {
+		return errors.New("DB not initialized")
+	}
+	if e := dc.DB.ValidateUniqueIndexing(dc.GetCollectionName(), bson.D{{Key: "tokenHash", Value: 1}}); e != nil {
+		return e
+	}
+	return dc.DB.ValidateIndexing(dc.GetCollectionName(), bson.D{{Key: "deviceName", Value: 1}, {Key: "revokedAt", Value: 1}})
+}
+
+// DeviceRevokedChannel is the Redis channel a gRPC agent stream listens on so
+// it can be closed as soon as the device's credentials are revoked.
+func DeviceRevokedChannel(deviceName string) string {
+	return "device-revoked-" + slug.Make(deviceName)
+}
+
+func hashDeviceToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newDeviceToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, e := rand.Read(raw); e != nil {
+		return "", e
+	}
+	return deviceTokenPrefix + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Enroll issues a new API token for a device, creating the device if needed.
+// Any token issued earlier is revoked, so enrolling again rotates the
+// credential. The token is only returned here.
+func (dc *DeviceCredentialController) Enroll(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	req := model.DeviceEnrollRequestModel{}
+	if decodeErr := json.NewDecoder(r.Body).Decode(&req); decodeErr != nil {
+		return int(enum.DEVICE_NOT_ENROLLED), nil, decodeErr
+	}
+	req.DeviceName = strings.TrimSpace(req.DeviceName)
+	if req.DeviceName == "" {
+		return int(enum.DEVICE_NOT_ENROLLED), nil, errors.New("deviceName is required")
+	}
+
+	// The caller becomes the device's owner. A device that already has one
+	// can only be enrolled again by that user, and one enrolled before
+	// devices had owners only by someone allowed to manage devices.
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.USER_NOT_FOUND), nil, errors.New("not logged in")
+	}
+	projectType := ""
+	sessionController := GetControllerInstance(enum.SessionController, enum.MONGODB).(*SessionController)
+	if session, e := sessionController.FindSession(r.Header.Get("sessionId")); e == nil {
+		projectType = session.ProjectType
+	}
+
+	captureScreenController := GetControllerInstance(enum.CaptureScreenController, enum.MONGODB).(*CaptureScreenController)
+	deviceQuery := map[string]interface{}{"deviceName": req.DeviceName}
+	if device, _ := captureScreenController.Find(deviceQuery); device == nil {
+		now := time.Now().UTC()
+		if _, e := captureScreenController.Create(model.Device{
+			DeviceName:  req.DeviceName,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			Owner:       claims.Subject,
+			ProjectType: projectType,
+		}); e != nil {
+			return int(enum.DEVICE_NOT_ENROLLED), nil, e
+		}
+	} else if currentOwner, _ := device["owner"].(string); currentOwner != "" && currentOwner != claims.Subject {
+		return int(enum.DEVICE_OWNED_BY_ANOTHER_USER), nil, errors.New("device " + req.DeviceName + " is owned by another user")
+	} else if currentOwner == "" {
+		if !canManageDevices(claims.Subject) {
+			return int(enum.DEVICE_OWNED_BY_ANOTHER_USER), nil, errors.New("device " + req.DeviceName + " has no owner and can only be claimed by an admin")
+		}
+		if e := captureScreenController.Update(deviceQuery, map[string]interface{}{"owner": claims.Subject, "projectType": projectType}); e != nil {
+			return int(enum.DEVICE_NOT_ENROLLED), nil, e
+		}
+	}
+
+	if _, e := dc.RevokeDevice(req.DeviceName); e != nil {
+		return int(enum.DEVICE_NOT_ENROLLED), nil, e
+	}
+
+	token, e := newDeviceToken()
+	if e != nil {
+		return int(enum.DEVICE_NOT_ENROLLED), nil, e
+	}
+	credential := model.DeviceCredential{
+		DeviceName:  req.DeviceName,
+		TokenHash:   hashDeviceToken(token),
+		TokenPrefix: token[:len(deviceTokenPrefix)+6],
+		CreatedAt:   time.Now().UTC(),
+	}
+	if _, e := dc.DB.Create(credential, dc.GetCollectionName()); e != nil {
+		log.Println("Error storing device credential", e)
+		return int(enum.DEVICE_NOT_ENROLLED), nil, e
+	}
+	return int(enum.DEVICE_ENROLLED), map[string]interface{}{
+		"deviceName":  credential.DeviceName,
+		"token":       token,
+		"tokenPrefix": credential.TokenPrefix,
+		"createdAt":   credential.CreatedAt,
+	}, nil
+}
+
+// canManageDevices tells whether a user may claim and revoke devices that
+// have no owner.
+func canManageDevices(userID string) bool {
+	userController := GetControllerInstance(enum.UserController, enum.MONGODB).(*UserController)
+	permissions, e := userController.Permissions(userID)
+	return e == nil && auth.HasPermission(permissions, auth.PermissionDevicesManage)
+}
+
+// canRevokeDevice tells whether userID may revoke or delete a device: its
+// owner can, and so can a device manager when it has no owner.
+func canRevokeDevice(device bson.M, userID string) bool {
+	owner, _ := device["owner"].(string)
+	return owner == userID || owner == "" && canManageDevices(userID)
+}
+
+// Authenticate returns the device a token was issued to. Unknown and revoked
+// tokens are rejected.
+func (dc *DeviceCredentialController) Authenticate(token string) (string, error) {
+	if !strings.HasPrefix(token, deviceTokenPrefix) {
+		return "", errors.New("malformed device token")
+	}
+	tokenHash := hashDeviceToken(token)
+	credential, e := dc.DB.FindOne(bson.M{
+		"tokenHash": tokenHash,
+		"revokedAt": nil,
+	}, dc.GetCollectionName())
+	if e != nil || credential == nil {
+		return "", errors.New("device is not enrolled or its token was revoked")
+	}
+	deviceName, _ := credential["deviceName"].(string)
+	if _, e := dc.DB.Update(bson.M{"tokenHash": tokenHash}, bson.M{"lastUsedAt": time.Now().UTC()}, dc.GetCollectionName()); e != nil {
+		log.Println("Error updating device credential usage", e)
+	}
+	return deviceName, nil
+}
+
+// RevokeDevice revokes every active token of a device and tells any connected
+// agent stream to close. It returns the number of tokens revoked.
+func (dc *DeviceCredentialController) RevokeDevice(deviceName string) (int64, error) {
+	dbConn := db.GetConnectionFromPool()
+	defer db.ReleaseConnectionToPool(dbConn)
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(dc.GetCollectionName())
+
+	res, e := collection.UpdateMany(context.Background(), bson.M{
+		"deviceName": deviceName,
+		"revokedAt":  nil,
+	}, bson.M{"$set": bson.M{"revokedAt": time.Now().UTC()}})
+	if e != nil {
+		return 0, e
+	}
+	if res.ModifiedCount > 0 {
+		// Nobody listening just means the agent is not connected.
+		cache.GetInstance().PublishMessage("revoked", DeviceRevokedChannel(deviceName))
+	}
+	return res.ModifiedCount, nil
+}
+
+// RevokeToken handles DELETE /device/token. Only the device's owner can
+// revoke its token, or a device manager when it has no owner.
+func (dc *DeviceCredentialController) RevokeToken(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	req := model.DeviceEnrollRequestModel{}
+	if decodeErr := json.NewDecoder(r.Body).Decode(&req); decodeErr != nil {
+		return int(enum.DEVICE_TOKEN_NOT_REVOKED), nil, decodeErr
+	}
+	if req.DeviceName == "" {
+		return int(enum.DEVICE_TOKEN_NOT_REVOKED), nil, errors.New("deviceName is required")
+	}
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.USER_NOT_FOUND), nil, errors.New("not logged in")
+	}
+	captureScreenController := GetControllerInstance(enum.CaptureScreenController, enum.MONGODB).(*CaptureScreenController)
+	device, _ := captureScreenController.Find(map[string]interface{}{"deviceName": req.DeviceName})
+	if device == nil {
+		return int(enum.DEVICE_NOT_FOUND), nil, errors.New("device " + req.DeviceName + " not found")
+	}
+	if !canRevokeDevice(device, claims.Subject) {
+		return int(enum.DEVICE_OWNED_BY_ANOTHER_USER), nil, errors.New("device " + req.DeviceName + " is not yours")
+	}
+	revoked, e := dc.RevokeDevice(req.DeviceName)
+	if e != nil {
+		return int(enum.DEVICE_TOKEN_NOT_REVOKED), nil, e
+	}
+	return int(enum.DEVICE_TOKEN_REVOKED), map[string]interface{}{
+		"deviceName": req.DeviceName,
+		"revoked":    revoked,
+	}, nil
+}
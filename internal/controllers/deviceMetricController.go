@@ -0,0 +1,347 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"project-phoenix/v2/internal/auth"
+	"project-phoenix/v2/internal/db"
+	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/model"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultMetricsRetentionDays = 30
+	defaultDiskAlertPercent     = 90
+	defaultMemoryAlertPercent   = 90
+	// Queries are downsampled to roughly this many points per series.
+	targetSeriesPoints = 200
+)
+
+var (
+	percentPattern = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*%`)
+	sizePattern    = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*(tib|gib|mib|kib|tb|gb|mb|kb|t|g|m|k|b)\b`)
+	plainPattern   = regexp.MustCompile(`^\s*(\d+(?:\.\d+)?)\s*$`)
+)
+
+var sizeUnits = map[string]float64{
+	"b": 1,
+	"k": 1 << 10, "kb": 1 << 10, "kib": 1 << 10,
+	"m": 1 << 20, "mb": 1 << 20, "mib": 1 << 20,
+	"g": 1 << 30, "gb": 1 << 30, "gib": 1 << 30,
+	"t": 1 << 40, "tb": 1 << 40, "tib": 1 << 40,
+}
+
+type DeviceMetricController struct {
+	CollectionName string
+	DB             db.DBInterface
+}
+
+func (dm *DeviceMetricController) GetCollectionName() string {
+	return "device_metrics"
+}
+
+// PerformIndexing creates device_metrics as a time-series collection that
+// expires samples after DEVICE_METRICS_RETENTION_DAYS. Servers without
+// time-series support fall back to a regular collection indexed by device and
+// time.
+func (dm *DeviceMetricController) PerformIndexing() error {
+	dbConn := db.GetConnectionFromPool()
+	defer db.ReleaseConnectionToPool(dbConn)
+	database := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME"))
+
+	ctx := context.Background()
+	names, e := database.ListCollectionNames(ctx, bson.M{"name": dm.GetCollectionName()})
+	if e != nil {
+		return e
+	}
+	retention := int64(envInt("DEVICE_METRICS_RETENTION_DAYS", defaultMetricsRetentionDays)) * 24 * 60 * 60
+	if len(names) == 0 {
+		e = database.CreateCollection(ctx, dm.GetCollectionName(), options.CreateCollection().
+			SetTimeSeriesOptions(options.TimeSeries().
+				SetTimeField("at").
+				SetMetaField("deviceName").
+				SetGranularity("minutes")).
+			SetExpireAfterSeconds(retention))
+		if e == nil {
+			return nil
+		}
+		log.Println("Time-series collections unavailable, using a regular collection for device metrics", e)
+	}
+	if e := dm.DB.ValidateIndexing(dm.GetCollectionName(), bson.D{{Key: "deviceName", Value: 1}, {Key: "at", Value: 1}}); e != nil {
+		return e
+	}
+	return nil
+}
+
+func envInt(name string, fallback int) int {
+	value, e := strconv.Atoi(os.Getenv(name))
+	if e != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// alertThreshold returns the percentage above which a metric raises an alert,
+// read from DEVICE_<METRIC>_ALERT_PERCENT.
+func alertThreshold(metric enum.DeviceMetricName) float64 {
+	switch metric {
+	case enum.DEVICE_METRIC_DISK:
+		return float64(envInt("DEVICE_DISK_ALERT_PERCENT", defaultDiskAlertPercent))
+	default:
+		return float64(envInt("DEVICE_MEMORY_ALERT_PERCENT", defaultMemoryAlertPercent))
+	}
+}
+
+// ParseResourceUsage reads the free-form usage strings agents send, e.g.
+// "73%", "7.5 GB / 16 GB", "used 412GiB of 512GiB (80%)" or "8 GB free of 16 GB".
+// Readings that say free or available are turned into used space. It returns
+// nil when nothing numeric can be found or a percentage is out of range.
+func ParseResourceUsage(raw string) *model.ResourceUsage {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	usage := &model.ResourceUsage{}
+	lower := strings.ToLower(raw)
+	free := strings.Contains(lower, "free") || strings.Contains(lower, "available")
+
+	match := percentPattern.FindStringSubmatch(raw)
+	if match == nil {
+		match = plainPattern.FindStringSubmatch(raw)
+	}
+	if match != nil {
+		percent, e := strconv.ParseFloat(match[1], 64)
+		if e != nil || percent < 0 || percent > 100 {
+			return nil
+		}
+		if free {
+			percent = 100 - percent
+		}
+		usage.Percent = &percent
+	}
+
+	var sizes []float64
+	for _, match := range sizePattern.FindAllStringSubmatch(raw, -1) {
+		value, e := strconv.ParseFloat(match[1], 64)
+		if e != nil {
+			continue
+		}
+		sizes = append(sizes, value*sizeUnits[strings.ToLower(match[2])])
+	}
+	if len(sizes) >= 2 {
+		used, total := sizes[0], sizes[1]
+		if free {
+			used = total - sizes[0]
+		}
+		if total > 0 && used >= 0 && used <= total {
+			usage.UsedBytes = &used
+			usage.TotalBytes = &total
+			if usage.Percent == nil {
+				percent := math.Round(used/total*10000) / 100
+				usage.Percent = &percent
+			}
+		}
+	} else if len(sizes) == 1 && !free {
+		usage.UsedBytes = &sizes[0]
+	}
+
+	if usage.Percent == nil && usage.UsedBytes == nil {
+		return nil
+	}
+	return usage
+}
+
+// RecordSample parses a device report into a metric sample, stores it and
+// returns any threshold crossings it caused.
+func (dm *DeviceMetricController) RecordSample(device model.Device, at time.Time) (*model.DeviceMetric, []model.DeviceMetricAlert, error) {
+	metric := model.DeviceMetric{
+		DeviceName: device.DeviceName,
+		At:         at,
+		OSName:     device.OSName,
+		Memory:     ParseResourceUsage(device.MemoryUsage),
+		Disk:       ParseResourceUsage(device.DiskUsage),
+	}
+	if metric.Memory == nil && metric.Disk == nil {
+		return nil, nil, nil
+	}
+	if _, e := dm.DB.Create(metric, dm.GetCollectionName()); e != nil {
+		return nil, nil, e
+	}
+
+	var alerts []model.DeviceMetricAlert
+	for name, usage := range map[enum.DeviceMetricName]*model.ResourceUsage{
+		enum.DEVICE_METRIC_MEMORY: metric.Memory,
+		enum.DEVICE_METRIC_DISK:   metric.Disk,
+	} {
+		if usage == nil || usage.Percent == nil {
+			continue
+		}
+		alert, e := dm.checkThreshold(device.DeviceName, name, *usage.Percent, at)
+		if e != nil {
+			log.Println("Error checking metric threshold for", device.DeviceName, e)
+			continue
+		}
+		if alert != nil {
+			alerts = append(alerts, *alert)
+		}
+	}
+	return &metric, alerts, nil
+}
+
+// checkThreshold flips the device's alert flag for a metric when the reading
+// crosses the threshold. The flag is changed with a conditional update so an
+// alert fires once per crossing rather than on every ping.
+func (dm *DeviceMetricController) checkThreshold(deviceName string, metric enum.DeviceMetricName, percent float64, at time.Time) (*model.DeviceMetricAlert, error) {
+	threshold := alertThreshold(metric)
+	raised := percent > threshold
+	field := "metricAlerts." + string(metric)
+
+	query := bson.M{"deviceName": deviceName, field: true}
+	if raised {
+		query[field] = bson.M{"$ne": true}
+	}
+	captureScreenController := GetControllerInstance(enum.CaptureScreenController, enum.MONGODB).(*CaptureScreenController)
+	modified, e := dm.DB.Update(query, bson.M{field: raised}, captureScreenController.GetCollectionName())
+	if e != nil {
+		return nil, e
+	}
+	if modified == "0" {
+		return nil, nil
+	}
+	return &model.DeviceMetricAlert{
+		DeviceName: deviceName,
+		Metric:     string(metric),
+		Percent:    percent,
+		Threshold:  threshold,
+		Raised:     raised,
+		At:         at,
+	}, nil
+}
+
+// GetMetrics returns min/avg/max memory and disk usage for one of the caller's
+// devices between from and to (RFC3339, default the last 24 hours), plus a
+// downsampled series for graphs. intervalMinutes sets the bucket size; by
+// default it is picked so the series has about 200 points.
+func (dm *DeviceMetricController) GetMetrics(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.USER_NOT_FOUND), nil, errors.New("not logged in")
+	}
+	params := r.URL.Query()
+	deviceName := params.Get("deviceName")
+	if deviceName == "" {
+		return int(enum.DEVICE_METRICS_NOT_FOUND), nil, errors.New("deviceName is required")
+	}
+	captureScreenController := GetControllerInstance(enum.CaptureScreenController, enum.MONGODB).(*CaptureScreenController)
+	if code, e := captureScreenController.CheckOwner(deviceName, claims.Subject); e != nil {
+		return code, nil, e
+	}
+	to := time.Now().UTC()
+	if raw := params.Get("to"); raw != "" {
+		parsed, e := time.Parse(time.RFC3339, raw)
+		if e != nil {
+			return int(enum.DEVICE_METRICS_NOT_FOUND), nil, errors.New("to must be an RFC3339 timestamp")
+		}
+		to = parsed.UTC()
+	}
+	from := to.Add(-24 * time.Hour)
+	if raw := params.Get("from"); raw != "" {
+		parsed, e := time.Parse(time.RFC3339, raw)
+		if e != nil {
+			return int(enum.DEVICE_METRICS_NOT_FOUND), nil, errors.New("from must be an RFC3339 timestamp")
+		}
+		from = parsed.UTC()
+	}
+	if !from.Before(to) {
+		return int(enum.DEVICE_METRICS_NOT_FOUND), nil, errors.New("from must be before to")
+	}
+	interval, _ := strconv.Atoi(params.Get("intervalMinutes"))
+	if interval <= 0 {
+		interval = int(math.Ceil(to.Sub(from).Minutes() / targetSeriesPoints))
+		if interval < 1 {
+			interval = 1
+		}
+	}
+
+	dbConn := db.GetConnectionFromPool()
+	defer db.ReleaseConnectionToPool(dbConn)
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(dm.GetCollectionName())
+	ctx := context.Background()
+
+	match := bson.D{{Key: "$match", Value: bson.M{
+		"deviceName": deviceName,
+		"at":         bson.M{"$gte": from, "$lte": to},
+	}}}
+	stats := bson.M{
+		"samples":   bson.M{"$sum": 1},
+		"memoryMin": bson.M{"$min": "$memory.percent"},
+		"memoryAvg": bson.M{"$avg": "$memory.percent"},
+		"memoryMax": bson.M{"$max": "$memory.percent"},
+		"diskMin":   bson.M{"$min": "$disk.percent"},
+		"diskAvg":   bson.M{"$avg": "$disk.percent"},
+		"diskMax":   bson.M{"$max": "$disk.percent"},
+	}
+
+	summaryGroup := bson.M{"_id": nil}
+	seriesGroup := bson.M{"_id": bson.M{"$dateTrunc": bson.M{
+		"date":    "$at",
+		"unit":    "minute",
+		"binSize": interval,
+	}}}
+	for key, value := range stats {
+		summaryGroup[key] = value
+		seriesGroup[key] = value
+	}
+
+	cursor, e := collection.Aggregate(ctx, bson.A{match, bson.D{{Key: "$group", Value: summaryGroup}}})
+	if e != nil {
+		return int(enum.DEVICE_METRICS_NOT_FOUND), nil, e
+	}
+	var summary []bson.M
+	if e = cursor.All(ctx, &summary); e != nil {
+		return int(enum.DEVICE_METRICS_NOT_FOUND), nil, e
+	}
+	if len(summary) == 0 {
+		return int(enum.DEVICE_METRICS_NOT_FOUND), nil, errors.New("no metrics recorded for " + deviceName + " in this range")
+	}
+	delete(summary[0], "_id")
+
+	cursor, e = collection.Aggregate(ctx, bson.A{
+		match,
+		bson.D{{Key: "$group", Value: seriesGroup}},
+		bson.D{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		bson.D{{Key: "$set", Value: bson.M{"at": "$_id"}}},
+		bson.D{{Key: "$unset", Value: "_id"}},
+	})
+	if e != nil {
+		return int(enum.DEVICE_METRICS_NOT_FOUND), nil, e
+	}
+	series := []bson.M{}
+	if e = cursor.All(ctx, &series); e != nil {
+		return int(enum.DEVICE_METRICS_NOT_FOUND), nil, e
+	}
+
+	return int(enum.DEVICE_METRICS_FOUND), map[string]interface{}{
+		"deviceName":      deviceName,
+		"from":            from,
+		"to":              to,
+		"intervalMinutes": interval,
+		"summary":         summary[0],
+		"thresholds": map[string]float64{
+			string(enum.DEVICE_METRIC_MEMORY): alertThreshold(enum.DEVICE_METRIC_MEMORY),
+			string(enum.DEVICE_METRIC_DISK):   alertThreshold(enum.DEVICE_METRIC_DISK),
+		},
+		"series": series,
+	}, nil
+}
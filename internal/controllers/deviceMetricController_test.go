@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseResourceUsage(t *testing.T) {
+	const gib = 1 << 30
+	value := func(v float64) *float64 { return &v }
+	for _, tc := range []struct {
+		raw                   string
+		percent               *float64
+		usedBytes, totalBytes *float64
+		wantNil               bool
+	}{
+		// Well formed.
+		{raw: "73%", percent: value(73)},
+		{raw: " 42 ", percent: value(42)},
+		{raw: "7.5 GB / 16 GB", percent: value(46.88), usedBytes: value(7.5 * gib), totalBytes: value(16 * gib)},
+		{raw: "used 412GiB of 512GiB (80%)", percent: value(80), usedBytes: value(412 * gib), totalBytes: value(512 * gib)},
+		{raw: "8 GB free of 16 GB", percent: value(50), usedBytes: value(8 * gib), totalBytes: value(16 * gib)},
+		{raw: "6g/8g available", percent: value(25), usedBytes: value(2 * gib), totalBytes: value(8 * gib)},
+		{raw: "10% free", percent: value(90)},
+		{raw: "disk: 2.5% available", percent: value(97.5)},
+		{raw: "1.6 GB free of 16 GB (10%)", percent: value(90), usedBytes: value(14.4 * gib), totalBytes: value(16 * gib)},
+
+		// Partial.
+		{raw: "512 MB", usedBytes: value(512 << 20)},
+		{raw: "memory: 12.5% used", percent: value(12.5)},
+
+		// Garbage.
+		{raw: "", wantNil: true},
+		{raw: "   ", wantNil: true},
+		{raw: "n/a", wantNil: true},
+		{raw: "150%", wantNil: true},
+		{raw: "150% of 8 GB", wantNil: true},
+		{raw: "120", wantNil: true},
+		{raw: "4 GB free", wantNil: true},
+		{raw: "16 GB / 8 GB", wantNil: true},
+		{raw: "0 GB / 0 GB", wantNil: true},
+		{raw: "lots of GB", wantNil: true},
+	} {
+		usage := ParseResourceUsage(tc.raw)
+		if tc.wantNil {
+			if usage != nil {
+				t.Errorf("ParseResourceUsage(%q) = %+v, want nil", tc.raw, usage)
+			}
+			continue
+		}
+		if usage == nil {
+			t.Errorf("ParseResourceUsage(%q) = nil", tc.raw)
+			continue
+		}
+		for _, field := range []struct {
+			name      string
+			got, want *float64
+		}{
+			{"percent", usage.Percent, tc.percent},
+			{"usedBytes", usage.UsedBytes, tc.usedBytes},
+			{"totalBytes", usage.TotalBytes, tc.totalBytes},
+		} {
+			switch {
+			case field.got == nil && field.want == nil:
+			case field.got == nil || field.want == nil:
+				t.Errorf("ParseResourceUsage(%q).%s = %v, want %v", tc.raw, field.name, field.got, field.want)
+			case math.Abs(*field.got-*field.want) > 0.01:
+				t.Errorf("ParseResourceUsage(%q).%s = %v, want %v", tc.raw, field.name, *field.got, *field.want)
+			}
+		}
+	}
+}
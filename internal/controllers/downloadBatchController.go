@@ -0,0 +1,320 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"project-phoenix/v2/internal/broker"
+	"project-phoenix/v2/internal/db"
+	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/media"
+	"project-phoenix/v2/internal/model"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const defaultDownloadBatchMaxItems = 50
+
+// DownloadBatchController stores batch downloads. The SSE service expands a
+// batch into one DownloadJob per video and finishes it once every job has
+// settled.
+type DownloadBatchController struct {
+	CollectionName string
+	DB             db.DBInterface
+}
+
+func (bc *DownloadBatchController) GetCollectionName() string {
+	return "download_batches"
+}
+
+func (bc *DownloadBatchController) PerformIndexing() error {
+	if bc.DB == nil {
+		return errors.New("DB not initialized")
+	}
+	if e := bc.DB.ValidateUniqueIndexing(bc.GetCollectionName(), bson.D{{Key: "batchId", Value: 1}}); e != nil {
+		return e
+	}
+	if e := bc.DB.ValidateIndexing(bc.GetCollectionName(), bson.D{{Key: "status", Value: 1}, {Key: "updatedAt", Value: 1}}); e != nil {
+		return e
+	}
+	return bc.DB.ValidateIndexing(bc.GetCollectionName(), bson.D{{Key: "owner", Value: 1}, {Key: "createdAt", Value: -1}})
+}
+
+// MaxDownloadBatchItems is the largest batch accepted, from
+// DOWNLOAD_BATCH_MAX_ITEMS. Longer playlists are cut to this size.
+func MaxDownloadBatchItems() int {
+	if limit, e := strconv.Atoi(os.Getenv("DOWNLOAD_BATCH_MAX_ITEMS")); e == nil && limit > 0 {
+		return limit
+	}
+	return defaultDownloadBatchMaxItems
+}
+
+// BatchItemDownloadID is the job id of the index-th item, so a redelivered
+// batch message queues the same jobs again instead of new ones.
+func BatchItemDownloadID(batchID string, index int) string {
+	return fmt.Sprintf("%s-%03d", batchID, index+1)
+}
+
+func (bc *DownloadBatchController) collection() (*mongo.Collection, func()) {
+	dbConn := db.GetConnectionFromPool()
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(bc.GetCollectionName())
+	return collection, func() { db.ReleaseConnectionToPool(dbConn) }
+}
+
+func (bc *DownloadBatchController) Get(batchID string) (*model.DownloadBatch, error) {
+	collection, release := bc.collection()
+	defer release()
+
+	batch := model.DownloadBatch{}
+	if e := collection.FindOne(context.Background(), bson.M{"batchId": batchID}).Decode(&batch); e != nil {
+		return nil, e
+	}
+	return &batch, nil
+}
+
+// transition moves a batch from one of the from statuses and reports whether
+// it did, so only one caller wins a race.
+func (bc *DownloadBatchController) transition(batchID string, from []string, fields bson.M) (bool, error) {
+	fields["updatedAt"] = time.Now().UTC()
+	modified, e := bc.DB.Update(bson.M{
+		"batchId": batchID,
+		"status":  bson.M{"$in": from},
+	}, fields, bc.GetCollectionName())
+	if e != nil {
+		return false, e
+	}
+	return modified != "0", nil
+}
+
+// Start records the resolved items and lets the batch run. It returns false
+// if the batch was cancelled while it was being resolved.
+func (bc *DownloadBatchController) Start(batchID string, title string, items []model.DownloadBatchItem) (bool, error) {
+	fields := bson.M{
+		"status": enum.BATCH_RUNNING,
+		"items":  items,
+		"total":  len(items),
+	}
+	if title != "" {
+		fields["title"] = title
+	}
+	return bc.transition(batchID, []string{enum.BATCH_RESOLVING}, fields)
+}
+
+// FailToResolve ends a batch whose playlist could not be read.
+func (bc *DownloadBatchController) FailToResolve(batchID string, cause error) error {
+	now := time.Now().UTC()
+	_, e := bc.transition(batchID, []string{enum.BATCH_RESOLVING}, bson.M{
+		"status":      enum.DOWNLOAD_FAILED,
+		"error":       cause.Error(),
+		"completedAt": now,
+	})
+	return e
+}
+
+// BeginFinalizing claims a running batch whose items have all settled.
+func (bc *DownloadBatchController) BeginFinalizing(batchID string) (bool, error) {
+	return bc.transition(batchID, []string{enum.BATCH_RUNNING}, bson.M{"status": enum.BATCH_FINALIZING})
+}
+
+// Finish stores the outcome of a finalizing batch.
+func (bc *DownloadBatchController) Finish(batchID string, fields bson.M) error {
+	fields["completedAt"] = time.Now().UTC()
+	_, e := bc.transition(batchID, []string{enum.BATCH_FINALIZING}, fields)
+	return e
+}
+
+// Cancel stops a batch that has not finished. Its jobs are cancelled by the
+// caller.
+func (bc *DownloadBatchController) Cancel(batchID string) (bool, error) {
+	return bc.transition(batchID, []string{enum.BATCH_RESOLVING, enum.BATCH_RUNNING}, bson.M{
+		"status":      enum.CANCELLED,
+		"completedAt": time.Now().UTC(),
+	})
+}
+
+// RunningBatches returns the ids of batches still waiting for their items.
+// Batches stuck finalizing for longer than staleAfter, for example because the
+// instance bundling them restarted, are put back to running first.
+func (bc *DownloadBatchController) RunningBatches(staleAfter time.Duration) ([]string, error) {
+	collection, release := bc.collection()
+	defer release()
+
+	now := time.Now().UTC()
+	if _, e := collection.UpdateMany(context.Background(), bson.M{
+		"status":    enum.BATCH_FINALIZING,
+		"updatedAt": bson.M{"$lt": now.Add(-staleAfter)},
+	}, bson.M{"$set": bson.M{"status": enum.BATCH_RUNNING, "updatedAt": now}}); e != nil {
+		return nil, e
+	}
+	cursor, e := collection.Find(context.Background(), bson.M{"status": enum.BATCH_RUNNING})
+	if e != nil {
+		return nil, e
+	}
+	batches := []model.DownloadBatch{}
+	if e := cursor.All(context.Background(), &batches); e != nil {
+		return nil, e
+	}
+	ids := make([]string, 0, len(batches))
+	for _, batch := range batches {
+		ids = append(ids, batch.BatchID)
+	}
+	return ids, nil
+}
+
+// SettledCounts summarizes the jobs of a batch: how many completed, failed
+// and were cancelled, and whether all of them have settled.
+func SettledCounts(jobs []model.DownloadJob) (completed int, failed int, cancelled int, settled bool) {
+	for _, job := range jobs {
+		switch job.Status {
+		case enum.COMPLETED:
+			completed++
+		case enum.DOWNLOAD_FAILED:
+			failed++
+		case enum.CANCELLED:
+			cancelled++
+		}
+	}
+	return completed, failed, cancelled, completed+failed+cancelled == len(jobs)
+}
+
+func downloadJobController() *DownloadJobController {
+	controller, _ := GetControllerInstance(enum.DownloadJobController, enum.MONGODB).(*DownloadJobController)
+	return controller
+}
+
+// ownedBatch loads a batch for the session making the request.
+func (bc *DownloadBatchController) ownedBatch(r *http.Request) (*model.DownloadBatch, error) {
+	batchID := r.URL.Query().Get("batchId")
+	if batchID == "" {
+		return nil, errors.New("batchId is required")
+	}
+	batch, e := bc.Get(batchID)
+	if e != nil || batch.Owner != r.Header.Get("sessionId") {
+		return nil, errors.New("batch " + batchID + " not found")
+	}
+	return batch, nil
+}
+
+// CreateBatchDownload handles POST /download-batch. The batch is stored here
+// and expanded into jobs by the SSE service, which also reads playlists.
+func (bc *DownloadBatchController) CreateBatchDownload(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	request := model.DownloadBatchRequestModel{}
+	if e := json.NewDecoder(r.Body).Decode(&request); e != nil {
+		return int(enum.DOWNLOAD_BATCH_NOT_CREATED), nil, e
+	}
+	request.PlaylistURL = strings.TrimSpace(request.PlaylistURL)
+	if (request.PlaylistURL == "") == (len(request.Videos) == 0) {
+		return int(enum.DOWNLOAD_BATCH_NOT_CREATED), nil, errors.New("either playlistUrl or videos is required")
+	}
+	if len(request.Videos) > MaxDownloadBatchItems() {
+		return int(enum.DOWNLOAD_BATCH_NOT_CREATED), nil, fmt.Errorf("a batch can hold at most %d videos", MaxDownloadBatchItems())
+	}
+	for _, video := range request.Videos {
+		if strings.TrimSpace(video.VideoID) == "" {
+			return int(enum.DOWNLOAD_BATCH_NOT_CREATED), nil, errors.New("every video needs a videoId")
+		}
+	}
+	if request.PostProcess.Requested() {
+		if e := media.Validate(*request.PostProcess); e != nil {
+			return int(enum.DOWNLOAD_OPTIONS_INVALID), nil, e
+		}
+	}
+
+	batchID := request.BatchId
+	if batchID == "" {
+		batchID = uuid.New().String()
+	}
+	now := time.Now().UTC()
+	batch := model.DownloadBatch{
+		BatchID:     batchID,
+		Owner:       r.Header.Get("sessionId"),
+		PlaylistURL: request.PlaylistURL,
+		Items:       request.Videos,
+		Format:      request.Format,
+		Quality:     request.Quality,
+		BitRate:     request.BitRate,
+		PostProcess: request.PostProcess,
+		Zip:         request.Zip,
+		Status:      enum.BATCH_RESOLVING,
+		Total:       len(request.Videos),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if batch.Items == nil {
+		batch.Items = []model.DownloadBatchItem{}
+	}
+	if _, e := bc.DB.Create(batch, bc.GetCollectionName()); e != nil {
+		if mongo.IsDuplicateKeyError(e) {
+			return int(enum.DOWNLOAD_BATCH_NOT_CREATED), nil, errors.New("batch " + batchID + " already exists")
+		}
+		return int(enum.DOWNLOAD_BATCH_NOT_CREATED), nil, e
+	}
+
+	broker.CreateBroker(enum.RABBITMQ).PublishMessage(map[string]interface{}{
+		"batchId": batchID,
+	}, "api-gateway-queue", enum.DOWNLOAD_BATCH_TOPIC)
+
+	return int(enum.DOWNLOAD_BATCH_CREATED), map[string]interface{}{
+		"batchId":     batchID,
+		"status":      batch.Status,
+		"sseEndpoint": fmt.Sprintf("/events/batch-%s", batchID),
+	}, nil
+}
+
+// GetBatchDownload handles GET /download-batch?batchId= and returns the batch
+// with the current state of each item.
+func (bc *DownloadBatchController) GetBatchDownload(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	batch, e := bc.ownedBatch(r)
+	if e != nil {
+		return int(enum.DOWNLOAD_BATCH_NOT_FOUND), nil, e
+	}
+	jobs := []model.DownloadJob{}
+	if controller := downloadJobController(); controller != nil {
+		if jobs, e = controller.ListByBatch(batch.BatchID); e != nil {
+			return int(enum.DOWNLOAD_BATCH_NOT_FOUND), nil, e
+		}
+	}
+	return int(enum.DOWNLOAD_BATCH_FOUND), map[string]interface{}{
+		"batch": batch,
+		"items": jobs,
+	}, nil
+}
+
+// CancelBatchDownload handles DELETE /download-batch?batchId=. Items that
+// already finished keep their results.
+func (bc *DownloadBatchController) CancelBatchDownload(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	batch, e := bc.ownedBatch(r)
+	if e != nil {
+		return int(enum.DOWNLOAD_BATCH_NOT_CANCELLED), nil, e
+	}
+	cancelled, e := bc.Cancel(batch.BatchID)
+	if e != nil {
+		return int(enum.DOWNLOAD_BATCH_NOT_CANCELLED), nil, e
+	}
+	if !cancelled {
+		return int(enum.DOWNLOAD_BATCH_NOT_CANCELLED), nil, errors.New("batch " + batch.BatchID + " has already finished")
+	}
+
+	rabbitMQBroker := broker.CreateBroker(enum.RABBITMQ)
+	if controller := downloadJobController(); controller != nil {
+		downloadIDs, e := controller.CancelBatch(batch.BatchID)
+		if e != nil {
+			return int(enum.DOWNLOAD_BATCH_NOT_CANCELLED), nil, e
+		}
+		for _, downloadID := range downloadIDs {
+			rabbitMQBroker.PublishMessage(map[string]interface{}{
+				"downloadId": downloadID,
+			}, "api-gateway-queue", enum.DOWNLOAD_CANCELLED_TOPIC)
+		}
+	}
+	batch, _ = bc.Get(batch.BatchID)
+	return int(enum.DOWNLOAD_BATCH_CANCELLED), batch, nil
+}
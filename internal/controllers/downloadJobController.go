@@ -0,0 +1,403 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"project-phoenix/v2/internal/broker"
+	"project-phoenix/v2/internal/db"
+	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/model"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultDownloadMaxAttempts = 3
+	defaultDownloadMaxPerOwner = 2
+	downloadRetryBaseDelay     = 30 * time.Second
+	downloadRetryMaxDelay      = 10 * time.Minute
+)
+
+type DownloadJobController struct {
+	CollectionName string
+	DB             db.DBInterface
+}
+
+func (dj *DownloadJobController) GetCollectionName() string {
+	return "download_jobs"
+}
+
+func (dj *DownloadJobController) PerformIndexing() error {
+	if dj.DB == nil {
+		return errors.New("DB not initialized")
+	}
+	if e := dj.DB.ValidateUniqueIndexing(dj.GetCollectionName(), bson.D{{Key: "downloadId", Value: 1}}); e != nil {
+		return e
+	}
+	indexes := []bson.D{
+		{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}},
+		{{Key: "status", Value: 1}, {Key: "heartbeatAt", Value: 1}},
+		{{Key: "owner", Value: 1}, {Key: "status", Value: 1}},
+		{{Key: "batchId", Value: 1}},
+	}
+	for _, index := range indexes {
+		if e := dj.DB.ValidateIndexing(dj.GetCollectionName(), index); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func (dj *DownloadJobController) collection() (*mongo.Collection, func()) {
+	dbConn := db.GetConnectionFromPool()
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(dj.GetCollectionName())
+	return collection, func() { db.ReleaseConnectionToPool(dbConn) }
+}
+
+// activeDownloadStatuses are the statuses of a job a worker currently owns.
+func activeDownloadStatuses() []string {
+	return []string{enum.DOWNLOADING, enum.PROCESSING}
+}
+
+// maxDownloadsPerOwner is how many jobs of one owner may run at the same time,
+// from DOWNLOAD_MAX_PER_USER.
+func maxDownloadsPerOwner() int {
+	if limit, e := strconv.Atoi(os.Getenv("DOWNLOAD_MAX_PER_USER")); e == nil && limit > 0 {
+		return limit
+	}
+	return defaultDownloadMaxPerOwner
+}
+
+// busyOwners returns the owners already running as many jobs as they may.
+func (dj *DownloadJobController) busyOwners(collection *mongo.Collection) ([]string, error) {
+	cursor, e := collection.Aggregate(context.Background(), mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"status": bson.M{"$in": activeDownloadStatuses()},
+			"owner":  bson.M{"$exists": true, "$ne": ""},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": "$owner", "running": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"running": bson.M{"$gte": maxDownloadsPerOwner()}}}},
+	})
+	if e != nil {
+		return nil, e
+	}
+	defer cursor.Close(context.Background())
+	owners := []string{}
+	for cursor.Next(context.Background()) {
+		group := struct {
+			Owner string `bson:"_id"`
+		}{}
+		if e := cursor.Decode(&group); e == nil {
+			owners = append(owners, group.Owner)
+		}
+	}
+	return owners, cursor.Err()
+}
+
+// Enqueue stores a new job. Redelivered broker messages for a job that already
+// exists are ignored, so it returns false in that case.
+func (dj *DownloadJobController) Enqueue(job model.DownloadJob) (bool, error) {
+	now := time.Now().UTC()
+	job.Status = enum.QUEUED
+	job.MaxAttempts = defaultDownloadMaxAttempts
+	if attempts, e := strconv.Atoi(os.Getenv("DOWNLOAD_MAX_ATTEMPTS")); e == nil && attempts > 0 {
+		job.MaxAttempts = attempts
+	}
+	job.NextAttemptAt = now
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	if _, e := dj.DB.Create(job, dj.GetCollectionName()); e != nil {
+		if mongo.IsDuplicateKeyError(e) {
+			return false, nil
+		}
+		return false, e
+	}
+	return true, nil
+}
+
+// ClaimNext hands the oldest runnable job to a worker. The claim is a single
+// findAndModify, so concurrent workers never get the same job. Jobs of owners
+// at their limit are skipped; the limit is checked just before claiming, so
+// workers claiming at the same moment can exceed it by a job each.
+func (dj *DownloadJobController) ClaimNext(workerID string) (*model.DownloadJob, error) {
+	collection, release := dj.collection()
+	defer release()
+
+	now := time.Now().UTC()
+	filter := bson.M{
+		"status":        enum.QUEUED,
+		"nextAttemptAt": bson.M{"$lte": now},
+	}
+	busy, e := dj.busyOwners(collection)
+	if e != nil {
+		return nil, e
+	}
+	if len(busy) > 0 {
+		filter["owner"] = bson.M{"$nin": busy}
+	}
+	job := model.DownloadJob{}
+	e = collection.FindOneAndUpdate(context.Background(), filter, bson.M{
+		"$set": bson.M{
+			"status":      enum.DOWNLOADING,
+			"workerId":    workerID,
+			"startedAt":   now,
+			"heartbeatAt": now,
+			"updatedAt":   now,
+			"error":       "",
+		},
+		"$inc": bson.M{"attempts": 1},
+	}, options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).
+		SetReturnDocument(options.After)).Decode(&job)
+	if e == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if e != nil {
+		return nil, e
+	}
+	return &job, nil
+}
+
+// Heartbeat records progress for a running job and returns its stored status,
+// which tells the worker whether the job was cancelled meanwhile.
+func (dj *DownloadJobController) Heartbeat(downloadID string, workerID string, status string, progress int) (string, error) {
+	now := time.Now().UTC()
+	_, e := dj.DB.Update(bson.M{
+		"downloadId": downloadID,
+		"workerId":   workerID,
+		"status":     bson.M{"$in": activeDownloadStatuses()},
+	}, bson.M{
+		"status":      status,
+		"progress":    progress,
+		"heartbeatAt": now,
+		"updatedAt":   now,
+	}, dj.GetCollectionName())
+	if e != nil {
+		return "", e
+	}
+	job, e := dj.Get(downloadID)
+	if e != nil {
+		return "", e
+	}
+	return job.Status, nil
+}
+
+// Complete marks a running job as finished.
+func (dj *DownloadJobController) Complete(downloadID string, workerID string, fields bson.M) error {
+	now := time.Now().UTC()
+	fields["status"] = enum.COMPLETED
+	fields["progress"] = 100
+	fields["completedAt"] = now
+	fields["updatedAt"] = now
+	_, e := dj.DB.Update(bson.M{
+		"downloadId": downloadID,
+		"workerId":   workerID,
+		"status":     bson.M{"$in": activeDownloadStatuses()},
+	}, fields, dj.GetCollectionName())
+	return e
+}
+
+// retryDelay doubles from downloadRetryBaseDelay with every attempt.
+func retryDelay(attempts int) time.Duration {
+	delay := time.Duration(float64(downloadRetryBaseDelay) * math.Pow(2, float64(attempts-1)))
+	if delay > downloadRetryMaxDelay {
+		return downloadRetryMaxDelay
+	}
+	return delay
+}
+
+// Fail records a failed attempt. The job goes back to the queue with backoff
+// unless it is out of attempts or the error is permanent, in which case it
+// fails for good. It returns the updated job.
+func (dj *DownloadJobController) Fail(job *model.DownloadJob, workerID string, cause error, permanent bool) (*model.DownloadJob, error) {
+	now := time.Now().UTC()
+	update := bson.M{
+		"error":     cause.Error(),
+		"updatedAt": now,
+	}
+	if permanent || job.Attempts >= job.MaxAttempts {
+		update["status"] = enum.DOWNLOAD_FAILED
+		update["completedAt"] = now
+	} else {
+		update["status"] = enum.QUEUED
+		update["progress"] = 0
+		update["nextAttemptAt"] = now.Add(retryDelay(job.Attempts))
+	}
+	if _, e := dj.DB.Update(bson.M{
+		"downloadId": job.DownloadID,
+		"workerId":   workerID,
+		"status":     bson.M{"$in": activeDownloadStatuses()},
+	}, update, dj.GetCollectionName()); e != nil {
+		return nil, e
+	}
+	return dj.Get(job.DownloadID)
+}
+
+// RequeueStale puts back jobs whose worker stopped sending heartbeats, such as
+// jobs interrupted by a restart. It returns the number of jobs requeued.
+func (dj *DownloadJobController) RequeueStale(staleAfter time.Duration) (int64, error) {
+	collection, release := dj.collection()
+	defer release()
+
+	now := time.Now().UTC()
+	res, e := collection.UpdateMany(context.Background(), bson.M{
+		"status":      bson.M{"$in": activeDownloadStatuses()},
+		"heartbeatAt": bson.M{"$lt": now.Add(-staleAfter)},
+	}, bson.M{"$set": bson.M{
+		"status":        enum.QUEUED,
+		"progress":      0,
+		"message":       "Interrupted, waiting to resume",
+		"nextAttemptAt": now,
+		"updatedAt":     now,
+	}})
+	if e != nil {
+		return 0, e
+	}
+	return res.ModifiedCount, nil
+}
+
+func (dj *DownloadJobController) Get(downloadID string) (*model.DownloadJob, error) {
+	collection, release := dj.collection()
+	defer release()
+
+	job := model.DownloadJob{}
+	if e := collection.FindOne(context.Background(), bson.M{"downloadId": downloadID}).Decode(&job); e != nil {
+		return nil, e
+	}
+	return &job, nil
+}
+
+// Cancel stops a job that has not finished yet. A running job is stopped by
+// its worker on the next heartbeat.
+func (dj *DownloadJobController) Cancel(downloadID string) (*model.DownloadJob, error) {
+	now := time.Now().UTC()
+	modified, e := dj.DB.Update(bson.M{
+		"downloadId": downloadID,
+		"status":     bson.M{"$in": append(activeDownloadStatuses(), enum.QUEUED)},
+	}, bson.M{
+		"status":      enum.CANCELLED,
+		"message":     "Download cancelled",
+		"completedAt": now,
+		"updatedAt":   now,
+	}, dj.GetCollectionName())
+	if e != nil {
+		return nil, e
+	}
+	if modified == "0" {
+		return nil, errors.New("download " + downloadID + " has already finished or does not exist")
+	}
+	return dj.Get(downloadID)
+}
+
+// ListByBatch returns the jobs of a batch in the order they were queued.
+func (dj *DownloadJobController) ListByBatch(batchID string) ([]model.DownloadJob, error) {
+	collection, release := dj.collection()
+	defer release()
+
+	cursor, e := collection.Find(context.Background(), bson.M{"batchId": batchID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "downloadId", Value: 1}}))
+	if e != nil {
+		return nil, e
+	}
+	jobs := []model.DownloadJob{}
+	if e := cursor.All(context.Background(), &jobs); e != nil {
+		return nil, e
+	}
+	return jobs, nil
+}
+
+// CancelBatch cancels every unfinished job of a batch and returns their ids.
+func (dj *DownloadJobController) CancelBatch(batchID string) ([]string, error) {
+	jobs, e := dj.ListByBatch(batchID)
+	if e != nil {
+		return nil, e
+	}
+	cancelled := []string{}
+	for _, job := range jobs {
+		if _, e := dj.Cancel(job.DownloadID); e == nil {
+			cancelled = append(cancelled, job.DownloadID)
+		}
+	}
+	return cancelled, nil
+}
+
+// ownedDownload loads a download for the session making the request.
+func (dj *DownloadJobController) ownedDownload(r *http.Request) (*model.DownloadJob, error) {
+	downloadID := r.URL.Query().Get("downloadId")
+	if downloadID == "" {
+		return nil, errors.New("downloadId is required")
+	}
+	sessionID := r.Header.Get("sessionId")
+	job, e := dj.Get(downloadID)
+	if e != nil || sessionID == "" || job.Owner != sessionID {
+		return nil, errors.New("download " + downloadID + " not found")
+	}
+	return job, nil
+}
+
+// GetDownload handles GET /download?downloadId=.
+func (dj *DownloadJobController) GetDownload(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	job, e := dj.ownedDownload(r)
+	if e != nil {
+		return int(enum.DOWNLOAD_NOT_FOUND), nil, e
+	}
+	return int(enum.DOWNLOAD_FOUND), job, nil
+}
+
+// ListDownloads handles GET /downloads: the caller's downloads, optionally
+// filtered by status.
+func (dj *DownloadJobController) ListDownloads(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	sessionID := r.Header.Get("sessionId")
+	if sessionID == "" {
+		return int(enum.DATA_NOT_FETCHED), nil, errors.New("sessionId is required")
+	}
+	query := map[string]interface{}{"owner": sessionID}
+	if status := r.URL.Query().Get("status"); status != "" {
+		query["status"] = status
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+
+	totalPages, page, jobs, e := dj.DB.FindAllWithPagination(query, page, dj.GetCollectionName())
+	if e != nil {
+		log.Println("Error listing downloads", e)
+		return int(enum.DATA_NOT_FETCHED), nil, e
+	}
+	if jobs == nil {
+		jobs = []primitive.M{}
+	}
+	for _, job := range jobs {
+		delete(job, "owner")
+	}
+	return int(enum.DOWNLOADS_FOUND), map[string]interface{}{
+		"totalPages": totalPages,
+		"page":       page,
+		"downloads":  jobs,
+	}, nil
+}
+
+// CancelDownload handles DELETE /download?downloadId= and lets SSE clients
+// know straight away.
+func (dj *DownloadJobController) CancelDownload(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	owned, e := dj.ownedDownload(r)
+	if e != nil {
+		return int(enum.DOWNLOAD_NOT_CANCELLED), nil, e
+	}
+	downloadID := owned.DownloadID
+	job, e := dj.Cancel(downloadID)
+	if e != nil {
+		return int(enum.DOWNLOAD_NOT_CANCELLED), nil, e
+	}
+	broker.CreateBroker(enum.RABBITMQ).PublishMessage(map[string]interface{}{
+		"downloadId": downloadID,
+	}, "api-gateway-queue", enum.DOWNLOAD_CANCELLED_TOPIC)
+	return int(enum.DOWNLOAD_CANCELLED), job, nil
+}
@@ -8,6 +8,7 @@ import (
 	"project-phoenix/v2/internal/db"
 	"project-phoenix/v2/internal/enum"
 	"project-phoenix/v2/internal/google"
+	"project-phoenix/v2/internal/media"
 	"project-phoenix/v2/internal/model"
 	internal "project-phoenix/v2/internal/service-configs"
 	"time"
@@ -48,6 +49,11 @@ func (g *GoogleController) DownloadYoutubeVideos(w http.ResponseWriter, r *http.
 	if decodeErr != nil {
 		return int(enum.ERROR), nil, decodeErr
 	}
+	if downloadRequestBody.PostProcess.Requested() {
+		if err := media.Validate(*downloadRequestBody.PostProcess); err != nil {
+			return int(enum.DOWNLOAD_OPTIONS_INVALID), nil, err
+		}
+	}
 	// Generate unique download ID
 	var downloadId string
 	if downloadRequestBody.DownloadId == "" {
@@ -71,6 +77,13 @@ func (g *GoogleController) DownloadYoutubeVideos(w http.ResponseWriter, r *http.
 		"timestamp":  time.Now().UTC(),
 		"status":     "queued",
 	}
+	if downloadRequestBody.PostProcess.Requested() {
+		downloadMessage["postProcess"] = downloadRequestBody.PostProcess
+	}
+	// Only the requesting session may follow a download made with one.
+	if sessionId := r.Header.Get("sessionId"); sessionId != "" {
+		downloadMessage["owner"] = sessionId
+	}
 	// Publish to process-yt-video queue for SSE service to consume
 	rabbitMQBroker.PublishMessage(downloadMessage, g.APIGatewayServiceConfig.ServiceName, "process-yt-video")
 
@@ -1,9 +1,23 @@
 package controllers
 
 import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"project-phoenix/v2/internal/auth"
+	"project-phoenix/v2/internal/broker"
+	"project-phoenix/v2/internal/cache"
 	"project-phoenix/v2/internal/db"
+	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/model"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type LoginActivityController struct {
@@ -23,9 +37,12 @@ func (la *LoginActivityController) PerformIndexing() error {
 		{{Key: "token", Value: 1}},
 		{{Key: "userId", Value: 1}},
 		{{Key: "email", Value: 1}},
+		{{Key: "tokenFamily", Value: 1}},
 	}
 	var validateErr error
-	minutes := 120 //2 hours
+	// A login lasts as long as its refresh tokens. createdAt is moved
+	// forward whenever they are used, so logins in use never expire.
+	minutes := int(auth.RefreshTokenTTL().Minutes())
 	for _, index := range indexes {
 		validateErr = la.DB.ValidateIndexingTTL(la.GetCollectionName(), index, minutes)
 		if validateErr != nil {
@@ -35,3 +52,201 @@ func (la *LoginActivityController) PerformIndexing() error {
 	return nil
 
 }
+
+func (la *LoginActivityController) collection() (*mongo.Collection, func()) {
+	dbConn := db.GetConnectionFromPool()
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(la.GetCollectionName())
+	return collection, func() { db.ReleaseConnectionToPool(dbConn) }
+}
+
+func loginActivityCacheKey(sessionID string, email string) string {
+	return "login-activity:" + sessionID + ":" + email
+}
+
+// RecordCountry looks up the country of a login's IP address. The lookup is
+// a remote call, so it runs after the login was answered.
+func (la *LoginActivityController) RecordCountry(query bson.M, ip string) {
+	if ip == "" || isPrivateIP(ip) {
+		return
+	}
+	country, _ := lookupIPCountry(ip)
+	if _, e := la.DB.Update(query, bson.M{"country": country}, la.GetCollectionName()); e != nil {
+		log.Println("Error while recording login country", e)
+	}
+}
+
+// Seen marks the login of a token family as used now, from sessionID, when
+// its tokens are refreshed.
+func (la *LoginActivityController) Seen(familyID string, sessionID string) {
+	now := time.Now()
+	fields := bson.M{"createdAt": now, "lastSeenAt": now, "updatedAt": now}
+	if sessionID != "" {
+		fields["sessionId"] = sessionID
+	}
+	if _, e := la.DB.Update(bson.M{"tokenFamily": familyID}, fields, la.GetCollectionName()); e != nil {
+		log.Println("Error while updating login activity", e)
+	}
+}
+
+func (la *LoginActivityController) find(query bson.M) ([]model.LoginActivity, error) {
+	collection, release := la.collection()
+	defer release()
+	cursor, e := collection.Find(context.Background(), query, options.Find().SetSort(bson.D{{Key: "lastSeenAt", Value: -1}}))
+	if e != nil {
+		return nil, e
+	}
+	activities := []model.LoginActivity{}
+	if e := cursor.All(context.Background(), &activities); e != nil {
+		return nil, e
+	}
+	return activities, nil
+}
+
+// end removes the logins matching query and disconnects the sessions they
+// were made from. keepSession is the caller's session, which stays connected
+// unless its own login is among them. Revoking the logins' tokens is up to
+// the caller.
+func (la *LoginActivityController) end(query bson.M, keepSession string, currentFamily string) ([]model.LoginActivity, error) {
+	activities, e := la.find(query)
+	if e != nil || len(activities) == 0 {
+		return activities, e
+	}
+	collection, release := la.collection()
+	_, e = collection.DeleteMany(context.Background(), query)
+	release()
+	if e != nil {
+		return nil, e
+	}
+
+	cacheKeys := []string{}
+	sessionIDs := []string{}
+	for _, activity := range activities {
+		cacheKeys = append(cacheKeys, loginActivityCacheKey(activity.SessionID, activity.Email))
+		// A session can carry more than one login, so another login may
+		// use the caller's.
+		if activity.SessionID == "" || (activity.SessionID == keepSession && activity.TokenFamily != currentFamily) {
+			continue
+		}
+		sessionIDs = append(sessionIDs, activity.SessionID)
+	}
+	if _, e := cache.GetInstance().Delete(cacheKeys...); e != nil {
+		log.Println("Error while removing login activity from redis", e)
+	}
+	if len(sessionIDs) > 0 {
+		sessionController := GetControllerInstance(enum.SessionController, enum.MONGODB).(*SessionController)
+		for _, sessionID := range sessionIDs {
+			if e := sessionController.EndSession(sessionID); e != nil {
+				log.Println("Error while ending session", e)
+			}
+		}
+		broker.CreateBroker(enum.RABBITMQ).PublishMessage(map[string]interface{}{
+			"sessionIds": sessionIDs,
+		}, "api-gateway-queue", enum.SESSION_REVOKED_TOPIC)
+	}
+	return activities, nil
+}
+
+// EndLogins removes the login activity of a user's logins, except the one of
+// keepFamily when it is set, and disconnects their sessions other than
+// keepSession.
+func (la *LoginActivityController) EndLogins(userID string, keepFamily string, keepSession string) error {
+	query := bson.M{"userId": userID}
+	if keepFamily != "" {
+		query["tokenFamily"] = bson.M{"$ne": keepFamily}
+	}
+	_, e := la.end(query, keepSession, keepFamily)
+	return e
+}
+
+// ListSessions handles GET /sessions: the caller's logins that are still
+// active, most recently used first.
+func (la *LoginActivityController) ListSessions(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.USER_NOT_FOUND), nil, errors.New("not logged in")
+	}
+	activities, e := la.find(bson.M{"userId": claims.Subject})
+	if e != nil {
+		return int(enum.ERROR), nil, e
+	}
+	sessions := make([]model.ActiveSession, 0, len(activities))
+	for _, activity := range activities {
+		sessions = append(sessions, model.ActiveSession{
+			ID:            activity.ID,
+			DeviceName:    activity.DeviceName,
+			UserAgent:     activity.UserAgent,
+			IP:            activity.IP,
+			Country:       activity.Country,
+			SignedInAt:    activity.SignedInAt,
+			LastSeenAt:    activity.LastSeenAt,
+			TrustedDevice: activity.TrustedDeviceID != "",
+			Current:       activity.TokenFamily == claims.FamilyID,
+		})
+	}
+	return int(enum.SESSIONS_LISTED), sessions, nil
+}
+
+// RevokeSession handles DELETE /session?id=: signs one of the caller's
+// logins out. Its tokens stop working and its sockets and event streams are
+// closed.
+func (la *LoginActivityController) RevokeSession(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.USER_NOT_FOUND), nil, errors.New("not logged in")
+	}
+	objectId, e := primitive.ObjectIDFromHex(r.URL.Query().Get("id"))
+	if e != nil {
+		return int(enum.LOGIN_SESSION_NOT_FOUND), nil, errors.New("id is required")
+	}
+	query := bson.M{"_id": objectId, "userId": claims.Subject}
+	activities, e := la.find(query)
+	if e != nil {
+		return int(enum.SESSION_NOT_REVOKED), nil, e
+	}
+	if len(activities) == 0 {
+		return int(enum.LOGIN_SESSION_NOT_FOUND), nil, errors.New("session not found")
+	}
+
+	refreshTokenController := GetControllerInstance(enum.RefreshTokenController, enum.MONGODB).(*RefreshTokenController)
+	if e := refreshTokenController.RevokeFamily(activities[0].TokenFamily); e != nil {
+		return int(enum.SESSION_NOT_REVOKED), nil, e
+	}
+	if _, e := la.end(query, claims.SessionID, claims.FamilyID); e != nil {
+		return int(enum.SESSION_NOT_REVOKED), nil, e
+	}
+	return int(enum.SESSION_REVOKED), nil, nil
+}
+
+// RevokeOtherSessions handles DELETE /sessions/others: signs out every login
+// of the caller except the one making the request.
+func (la *LoginActivityController) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok || claims.FamilyID == "" {
+		return int(enum.USER_NOT_FOUND), nil, errors.New("not logged in")
+	}
+	refreshTokenController := GetControllerInstance(enum.RefreshTokenController, enum.MONGODB).(*RefreshTokenController)
+	revoked, e := refreshTokenController.RevokeUserFamilies(claims.Subject, claims.FamilyID)
+	if e != nil {
+		return int(enum.SESSION_NOT_REVOKED), nil, e
+	}
+	if e := la.EndLogins(claims.Subject, claims.FamilyID, claims.SessionID); e != nil {
+		return int(enum.SESSION_NOT_REVOKED), nil, e
+	}
+	log.Printf("Signed out %d other login(s) of user %s", len(revoked), claims.Subject)
+	return int(enum.SESSIONS_REVOKED), map[string]interface{}{"revoked": len(revoked)}, nil
+}
+
+// RequestCredentials returns the session id and access token a request
+// carries. Both can also be query parameters, for clients such as EventSource that
+// cannot set headers.
+func RequestCredentials(r *http.Request) (string, string) {
+	sessionID := r.Header.Get("sessionId")
+	if sessionID == "" {
+		sessionID = r.URL.Query().Get("sessionId")
+	}
+	token := auth.BearerToken(r)
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	return sessionID, token
+}
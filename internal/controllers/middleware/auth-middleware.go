@@ -2,14 +2,14 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
-	"project-phoenix/v2/internal/cache"
+	"project-phoenix/v2/internal/auth"
+	"project-phoenix/v2/internal/controllers"
 	"project-phoenix/v2/internal/enum"
-	"project-phoenix/v2/internal/model"
 	"project-phoenix/v2/internal/response"
 	internal "project-phoenix/v2/internal/service-configs"
-	"project-phoenix/v2/pkg/helper"
 
 	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -30,61 +30,34 @@ func NewAuthMiddleware() *AuthMiddleware {
 	return &AuthMiddleware{}
 }
 
+// Middleware only lets requests with a valid access token through. The token
+// comes as a bearer token (or, for older clients, as the basic auth password)
+// and has to belong to the request's session.
 func (a *AuthMiddleware) Middleware(next http.Handler) http.Handler {
 	log.Println("Auth Middleware")
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Println("Auth Middleware | Request URL: ", r.URL.Path)
-		email, hash, ok := r.BasicAuth()
-		log.Println(email, hash)
-		if !ok {
-			log.Println("Auth Middleware | No Basic Auth")
+		token := auth.BearerToken(r)
+		if token == "" {
+			log.Println("Auth Middleware | No Access Token")
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
-		} else if email == "" || hash == "" {
-			log.Println("Either Username or Hash not Provided in Basic Auth Header")
-			response.SendResponse(w, int(enum.USER_NOT_FOUND), nil)
-			return
-		}
-		// loginActivityQuery := map[string]interface{}{
-		// "token": hash,
-		// "email": email,
-		// }
-		// dbInstance, er := db.GetDBInstance(enum.MONGODB)
-		// if er != nil {
-		// log.Println("Error while getting DB Instance: ", er)
-		// http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		// return
-		// } else {
-		sessionId := r.Header.Get("sessionId")
-		loginActivityRedisKey := "login-activity:" + sessionId + ":" + email
-		existingActivity, existingUserActivityError := cache.GetInstance().Get(loginActivityRedisKey)
-		if existingUserActivityError != nil {
-			log.Println("Auth Middleware | No User Activity in Redis")
-			response.SendResponse(w, int(enum.LOGIN_SESSION_EXPIRED), nil)
-			return
 		}
-		// existingActivity, existingUserActivityError := dbInstance.FindOne(loginActivityQuery, "loginactivities")
-		//store the user id in the request context
-		loginActivity := &model.LoginActivity{}
-		e := helper.JSONStringToStruct(existingActivity, &loginActivity)
-		if e != nil {
-			log.Println("Error while converting interface to struct: ", e)
-			response.SendResponse(w, int(enum.LOGIN_SESSION_EXPIRED), nil)
-			return
-		}
-		ctx := context.WithValue(r.Context(), "userId", loginActivity.UserID)
-		r = r.WithContext(ctx)
-		if existingUserActivityError == nil && existingActivity == nil {
-			log.Println("Auth Middleware | No User Activity")
-			response.SendResponse(w, int(enum.LOGIN_SESSION_EXPIRED), nil)
+
+		refreshTokenController := controllers.GetControllerInstance(enum.RefreshTokenController, enum.MONGODB).(*controllers.RefreshTokenController)
+		claims, err := refreshTokenController.Authenticate(token, r.Header.Get("sessionId"))
+		if errors.Is(err, auth.ErrTokenExpired) {
+			response.SendResponse(w, int(enum.ACCESS_TOKEN_EXPIRED), nil)
 			return
-		} else if existingUserActivityError != nil {
-			//No login activity found. Throw error in response
-			log.Println("Auth Middleware | User Login Activity Not Found")
-			response.SendResponse(w, int(enum.LOGIN_SESSION_EXPIRED), nil)
+		} else if err != nil {
+			log.Println("Auth Middleware | Rejected Access Token: ", err)
+			response.SendResponse(w, int(enum.ACCESS_TOKEN_INVALID), nil)
 			return
 		}
-		// }
-		next.ServeHTTP(w, r)
+
+		//store the user id in the request context
+		ctx := context.WithValue(r.Context(), "userId", claims.Subject)
+		ctx = auth.ContextWithClaims(ctx, claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"project-phoenix/v2/internal/auth"
+	"project-phoenix/v2/internal/controllers"
+	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/response"
+)
+
+type PermissionMiddleware struct{}
+
+func NewPermissionMiddleware() *PermissionMiddleware {
+	return &PermissionMiddleware{}
+}
+
+// Require only lets requests through whose user holds permission. It has to
+// run after AuthMiddleware, which puts the user's claims in the context.
+func (p *PermissionMiddleware) Require(permission string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.ClaimsFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		userController := controllers.GetControllerInstance(enum.UserController, enum.MONGODB).(*controllers.UserController)
+		permissions, err := userController.Permissions(claims.Subject)
+		if err != nil {
+			log.Println("Permission Middleware | Unable to load permissions: ", err)
+			response.SendStatusResponse(w, http.StatusForbidden, int(enum.PERMISSION_DENIED), nil)
+			return
+		}
+		if !auth.HasPermission(permissions, permission) {
+			log.Printf("Permission Middleware | User %s lacks %s for %s %s", claims.Subject, permission, r.Method, r.URL.Path)
+			response.SendStatusResponse(w, http.StatusForbidden, int(enum.PERMISSION_DENIED), nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"project-phoenix/v2/internal/auth"
+	"project-phoenix/v2/internal/db"
+	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/model"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	revokedKindAccessToken = "jti"
+	revokedKindFamily      = "family"
+)
+
+// RefreshTokenController issues access and refresh tokens and keeps the
+// refresh tokens, hashed, together with the list of revoked access tokens.
+type RefreshTokenController struct {
+	CollectionName string
+	DB             db.DBInterface
+}
+
+func (rc *RefreshTokenController) GetCollectionName() string {
+	return "refresh_tokens"
+}
+
+func (rc *RefreshTokenController) GetRevokedCollectionName() string {
+	return "revoked_tokens"
+}
+
+func (rc *RefreshTokenController) PerformIndexing() error {
+	if rc.DB == nil {
+		return errors.New("DB not initialized")
+	}
+	if e := rc.DB.ValidateUniqueIndexing(rc.GetCollectionName(), bson.D{{Key: "tokenHash", Value: 1}}); e != nil {
+		return e
+	}
+	if e := rc.DB.ValidateIndexing(rc.GetCollectionName(), bson.D{{Key: "familyId", Value: 1}}); e != nil {
+		return e
+	}
+	if e := rc.DB.ValidateIndexing(rc.GetCollectionName(), bson.D{{Key: "userId", Value: 1}}); e != nil {
+		return e
+	}
+	// Expired tokens and revocations are removed by Mongo.
+	if e := rc.DB.ValidateIndexingTTL(rc.GetCollectionName(), bson.D{{Key: "expiresAt", Value: 1}}, 0); e != nil {
+		return e
+	}
+	if e := rc.DB.ValidateIndexing(rc.GetRevokedCollectionName(), bson.D{{Key: "value", Value: 1}}); e != nil {
+		return e
+	}
+	return rc.DB.ValidateIndexingTTL(rc.GetRevokedCollectionName(), bson.D{{Key: "expiresAt", Value: 1}}, 0)
+}
+
+func (rc *RefreshTokenController) collection(name string) (*mongo.Collection, func()) {
+	dbConn := db.GetConnectionFromPool()
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(name)
+	return collection, func() { db.ReleaseConnectionToPool(dbConn) }
+}
+
+func signingKeys() *SigningKeyController {
+	return GetControllerInstance(enum.SigningKeyController, enum.MONGODB).(*SigningKeyController)
+}
+
+// IssueTokens starts a new token family for a login and returns its first
+// token pair.
+func (rc *RefreshTokenController) IssueTokens(userID string, email string, sessionID string) (*model.TokenPair, string, error) {
+	familyID := uuid.New().String()
+	pair, e := rc.issue(userID, email, sessionID, familyID)
+	return pair, familyID, e
+}
+
+func (rc *RefreshTokenController) issue(userID string, email string, sessionID string, familyID string) (*model.TokenPair, error) {
+	key, e := signingKeys().ActiveKey()
+	if e != nil {
+		return nil, e
+	}
+	accessToken, claims, e := auth.IssueAccessToken(key, userID, email, sessionID, familyID)
+	if e != nil {
+		return nil, e
+	}
+	refreshToken, e := auth.NewRefreshToken()
+	if e != nil {
+		return nil, e
+	}
+	now := time.Now().UTC()
+	if _, e := rc.DB.Create(model.RefreshToken{
+		TokenHash: auth.HashToken(refreshToken),
+		FamilyID:  familyID,
+		UserID:    userID,
+		Email:     email,
+		SessionID: sessionID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(auth.RefreshTokenTTL()),
+	}, rc.GetCollectionName()); e != nil {
+		return nil, e
+	}
+	return &model.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.AccessTokenTTL().Seconds()),
+		ExpiresAt:    claims.ExpiresAt.Time,
+	}, nil
+}
+
+// Rotate exchanges a refresh token for a new pair of the same family, bound
+// to sessionID. A token that was already exchanged means it leaked, so the
+// whole family is revoked and its owner has to log in again.
+func (rc *RefreshTokenController) Rotate(refreshToken string, sessionID string) (*model.TokenPair, int, error) {
+	tokenHash := auth.HashToken(refreshToken)
+	collection, release := rc.collection(rc.GetCollectionName())
+	defer release()
+
+	stored := model.RefreshToken{}
+	if e := collection.FindOne(context.Background(), bson.M{"tokenHash": tokenHash}).Decode(&stored); e != nil {
+		return nil, int(enum.TOKEN_NOT_REFRESHED), errors.New("unknown refresh token")
+	}
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, int(enum.TOKEN_NOT_REFRESHED), errors.New("refresh token expired or revoked")
+	}
+
+	// Claiming the token and checking it was unused is one update, so two
+	// refreshes racing with the same token cannot both succeed.
+	res, e := collection.UpdateOne(context.Background(),
+		bson.M{"tokenHash": tokenHash, "usedAt": nil, "revokedAt": nil},
+		bson.M{"$set": bson.M{"usedAt": time.Now().UTC()}})
+	if e != nil {
+		return nil, int(enum.TOKEN_NOT_REFRESHED), e
+	}
+	if res.ModifiedCount == 0 {
+		log.Printf("Refresh token of family %s was reused, revoking the family", stored.FamilyID)
+		if e := rc.RevokeFamily(stored.FamilyID); e != nil {
+			log.Println("Error revoking token family", e)
+		}
+		return nil, int(enum.REFRESH_TOKEN_REUSED), errors.New("refresh token was already used")
+	}
+
+	pair, e := rc.issue(stored.UserID, stored.Email, sessionID, stored.FamilyID)
+	if e != nil {
+		return nil, int(enum.TOKEN_NOT_REFRESHED), e
+	}
+	loginActivityController := GetControllerInstance(enum.LoginActivityController, enum.MONGODB).(*LoginActivityController)
+	loginActivityController.Seen(stored.FamilyID, sessionID)
+	return pair, int(enum.TOKEN_REFRESHED), nil
+}
+
+// RevokeFamily revokes every refresh token of a family and rejects the
+// access tokens issued with them.
+func (rc *RefreshTokenController) RevokeFamily(familyID string) error {
+	if familyID == "" {
+		return nil
+	}
+	collection, release := rc.collection(rc.GetCollectionName())
+	defer release()
+	now := time.Now().UTC()
+	if _, e := collection.UpdateMany(context.Background(),
+		bson.M{"familyId": familyID, "revokedAt": nil},
+		bson.M{"$set": bson.M{"revokedAt": now}}); e != nil {
+		return e
+	}
+	return rc.revoke(revokedKindFamily, familyID, now.Add(auth.AccessTokenTTL()))
+}
+
+// RevokeUserFamilies revokes every login of a user except keepFamily, which
+// may be empty to end all of them, and returns the revoked families.
+func (rc *RefreshTokenController) RevokeUserFamilies(userID string, keepFamily string) ([]string, error) {
+	collection, release := rc.collection(rc.GetCollectionName())
+	families, e := collection.Distinct(context.Background(), "familyId", bson.M{
+		"userId":    userID,
+		"revokedAt": nil,
+		"expiresAt": bson.M{"$gt": time.Now().UTC()},
+	})
+	release()
+	if e != nil {
+		return nil, e
+	}
+	revoked := []string{}
+	for _, family := range families {
+		familyID, _ := family.(string)
+		if familyID == "" || familyID == keepFamily {
+			continue
+		}
+		if e := rc.RevokeFamily(familyID); e != nil {
+			return revoked, e
+		}
+		revoked = append(revoked, familyID)
+	}
+	return revoked, nil
+}
+
+// RevokeAccessToken rejects one access token until it expires.
+func (rc *RefreshTokenController) RevokeAccessToken(claims *auth.AccessClaims) error {
+	return rc.revoke(revokedKindAccessToken, claims.ID, claims.ExpiresAt.Time)
+}
+
+func (rc *RefreshTokenController) revoke(kind string, value string, until time.Time) error {
+	_, e := rc.DB.Create(model.RevokedToken{Kind: kind, Value: value, ExpiresAt: until}, rc.GetRevokedCollectionName())
+	return e
+}
+
+func (rc *RefreshTokenController) isRevoked(claims *auth.AccessClaims) (bool, error) {
+	collection, release := rc.collection(rc.GetRevokedCollectionName())
+	defer release()
+	values := []string{claims.ID}
+	if claims.FamilyID != "" {
+		values = append(values, claims.FamilyID)
+	}
+	count, e := collection.CountDocuments(context.Background(), bson.M{"value": bson.M{"$in": values}})
+	return count > 0, e
+}
+
+// Authenticate validates an access token presented within a session and
+// returns its claims. Tokens are bound to the session they were issued for.
+func (rc *RefreshTokenController) Authenticate(token string, sessionID string) (*auth.AccessClaims, error) {
+	claims, e := auth.ParseAccessToken(token, signingKeys())
+	if e != nil {
+		return nil, e
+	}
+	if sessionID != "" && claims.SessionID != sessionID {
+		return nil, auth.ErrTokenInvalid
+	}
+	revoked, e := rc.isRevoked(claims)
+	if e != nil {
+		return nil, e
+	}
+	if revoked {
+		return nil, auth.ErrTokenInvalid
+	}
+	return claims, nil
+}
+
+// RefreshToken handles /token/refresh.
+func (rc *RefreshTokenController) RefreshToken(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	req := model.RefreshTokenRequestModel{}
+	if e := json.NewDecoder(r.Body).Decode(&req); e != nil || req.RefreshToken == "" {
+		return int(enum.TOKEN_NOT_REFRESHED), nil, errors.New("refreshToken is required")
+	}
+	pair, code, e := rc.Rotate(req.RefreshToken, r.Header.Get("sessionId"))
+	if e != nil {
+		return code, nil, e
+	}
+	return code, pair, nil
+}
@@ -0,0 +1,366 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"log"
+	"net/http"
+	"os"
+	"project-phoenix/v2/internal/auth"
+	"project-phoenix/v2/internal/db"
+	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/model"
+	"project-phoenix/v2/internal/storage"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosimple/slug"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	screenshotThumbnailWidth       = 320
+	screenshotURLTTLMinutes        = 60
+	screenshotTimelinePageSize     = 20
+	defaultScreenshotRetentionDays = 7
+)
+
+type ScreenshotController struct {
+	CollectionName string
+	DB             db.DBInterface
+	storage        storage.Storage
+	s3Folder       string
+}
+
+func (sc *ScreenshotController) GetCollectionName() string {
+	return "device_screenshots"
+}
+
+func (sc *ScreenshotController) PerformIndexing() error {
+	if sc.DB == nil {
+		return errors.New("DB not initialized")
+	}
+	return sc.DB.ValidateIndexing(sc.GetCollectionName(), bson.D{{Key: "deviceName", Value: 1}, {Key: "capturedAt", Value: -1}})
+}
+
+// InitStorage uses the shared object storage; see storage.GetInstance for how
+// the backend is chosen.
+func (sc *ScreenshotController) InitStorage() {
+	sc.storage = storage.GetInstance()
+	if sc.storage != nil && sc.storage.Name() == storage.BackendS3 {
+		sc.s3Folder = strings.Trim(os.Getenv("S3_FOLDER_NAME"), "/")
+	}
+}
+
+func (sc *ScreenshotController) storageBackend() string {
+	if sc.storage == nil {
+		return ""
+	}
+	return sc.storage.Name()
+}
+
+func screenshotRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("SCREENSHOT_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		days = defaultScreenshotRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func (sc *ScreenshotController) putObject(key string, data []byte, contentType string) error {
+	if sc.storage == nil {
+		return errors.New("object storage not initialized")
+	}
+	return sc.storage.Put(context.Background(), key, bytes.NewReader(data), contentType)
+}
+
+// deleteObject removes an object, provided it lives in the backend currently
+// configured.
+func (sc *ScreenshotController) deleteObject(backend string, key string) error {
+	if key == "" {
+		return nil
+	}
+	if backend != sc.storageBackend() {
+		return fmt.Errorf("screenshot stored in %q but the storage backend is %q", backend, sc.storageBackend())
+	}
+	return sc.storage.Delete(context.Background(), key)
+}
+
+// objectURL returns a short-lived signed URL for a stored object.
+func (sc *ScreenshotController) objectURL(backend string, key string) string {
+	if key == "" || backend != sc.storageBackend() {
+		return ""
+	}
+	url, err := sc.storage.SignedURL(context.Background(), key, screenshotURLTTLMinutes*time.Minute)
+	if err != nil {
+		log.Println("Error signing screenshot URL", err)
+		return ""
+	}
+	return url
+}
+
+// WithURLs fills in the image and thumbnail URLs of a stored screenshot.
+func (sc *ScreenshotController) WithURLs(screenshot *model.Screenshot) *model.Screenshot {
+	screenshot.ImageURL = sc.objectURL(screenshot.Storage, screenshot.StorageKey)
+	screenshot.ThumbnailURL = sc.objectURL(screenshot.Storage, screenshot.ThumbnailKey)
+	return screenshot
+}
+
+// decodeCaptureImage accepts the raw base64 sent by agents, with or without a
+// data URL prefix.
+func decodeCaptureImage(encoded string) ([]byte, error) {
+	if i := strings.Index(encoded, ","); strings.HasPrefix(encoded, "data:") && i != -1 {
+		encoded = encoded[i+1:]
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 image: %v", err)
+	}
+	return data, nil
+}
+
+// makeThumbnail scales img down to screenshotThumbnailWidth using nearest
+// neighbour sampling, which is plenty for a timeline preview.
+func makeThumbnail(img image.Image) ([]byte, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return nil, errors.New("empty image")
+	}
+	thumbWidth := screenshotThumbnailWidth
+	if width < thumbWidth {
+		thumbWidth = width
+	}
+	thumbHeight := height * thumbWidth / width
+	if thumbHeight == 0 {
+		thumbHeight = 1
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for y := 0; y < thumbHeight; y++ {
+		srcY := bounds.Min.Y + y*height/thumbHeight
+		for x := 0; x < thumbWidth; x++ {
+			thumb.Set(x, y, img.At(bounds.Min.X+x*width/thumbWidth, srcY))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 70}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// StoreCapture writes the capture and its thumbnail to object storage and
+// records a metadata row for the device timeline.
+func (sc *ScreenshotController) StoreCapture(device model.Device, capturedAt time.Time) (*model.Screenshot, error) {
+	data, err := decodeCaptureImage(device.LastImage)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := http.DetectContentType(data)
+	extension := "png"
+	if contentType == "image/jpeg" {
+		extension = "jpg"
+	}
+
+	keyPrefix := "screenshots/" + slug.Make(device.DeviceName) + "/" + strconv.FormatInt(capturedAt.UnixNano(), 10)
+	if sc.s3Folder != "" {
+		keyPrefix = sc.s3Folder + "/" + keyPrefix
+	}
+
+	screenshot := model.Screenshot{
+		DeviceName:  device.DeviceName,
+		CapturedAt:  capturedAt,
+		Storage:     sc.storageBackend(),
+		StorageKey:  keyPrefix + "." + extension,
+		ContentType: contentType,
+		SizeBytes:   len(data),
+		OSName:      device.OSName,
+		MemoryUsage: device.MemoryUsage,
+		DiskUsage:   device.DiskUsage,
+	}
+
+	if err := sc.putObject(screenshot.StorageKey, data, contentType); err != nil {
+		return nil, fmt.Errorf("failed to store screenshot: %v", err)
+	}
+
+	// A capture we cannot decode is still kept; it just has no thumbnail.
+	if img, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+		screenshot.Width = img.Bounds().Dx()
+		screenshot.Height = img.Bounds().Dy()
+		if thumb, err := makeThumbnail(img); err == nil {
+			thumbKey := keyPrefix + "_thumb.jpg"
+			if err := sc.putObject(thumbKey, thumb, "image/jpeg"); err == nil {
+				screenshot.ThumbnailKey = thumbKey
+			} else {
+				log.Println("Error storing screenshot thumbnail", err)
+			}
+		}
+	} else {
+		log.Println("Unable to decode screenshot for thumbnail", err)
+	}
+
+	created, err := sc.DB.Create(screenshot, sc.GetCollectionName())
+	if err != nil {
+		sc.deleteObject(screenshot.Storage, screenshot.StorageKey)
+		sc.deleteObject(screenshot.Storage, screenshot.ThumbnailKey)
+		return nil, err
+	}
+	if id, ok := created["_id"].(primitive.ObjectID); ok {
+		screenshot.ID = id.Hex()
+	}
+	return sc.WithURLs(&screenshot), nil
+}
+
+// GetTimeline lists the screenshots of one of the caller's devices newest
+// first. from and to are optional RFC3339 bounds on the capture time.
+func (sc *ScreenshotController) GetTimeline(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.USER_NOT_FOUND), nil, errors.New("not logged in")
+	}
+	params := r.URL.Query()
+	deviceName := params.Get("deviceName")
+	if deviceName == "" {
+		return int(enum.SCREENSHOTS_NOT_FOUND), nil, errors.New("deviceName is required")
+	}
+	captureScreenController := GetControllerInstance(enum.CaptureScreenController, enum.MONGODB).(*CaptureScreenController)
+	if code, e := captureScreenController.CheckOwner(deviceName, claims.Subject); e != nil {
+		return code, nil, e
+	}
+
+	query := bson.M{"deviceName": deviceName}
+	capturedAt := bson.M{}
+	if from := params.Get("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return int(enum.SCREENSHOTS_NOT_FOUND), nil, fmt.Errorf("invalid from: %v", err)
+		}
+		capturedAt["$gte"] = t
+	}
+	if to := params.Get("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return int(enum.SCREENSHOTS_NOT_FOUND), nil, fmt.Errorf("invalid to: %v", err)
+		}
+		capturedAt["$lte"] = t
+	}
+	if len(capturedAt) > 0 {
+		query["capturedAt"] = capturedAt
+	}
+
+	page, _ := strconv.Atoi(params.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	dbConn := db.GetConnectionFromPool()
+	defer db.ReleaseConnectionToPool(dbConn)
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(sc.GetCollectionName())
+
+	ctx := context.Background()
+	total, err := collection.CountDocuments(ctx, query)
+	if err != nil {
+		return int(enum.DATA_NOT_FETCHED), nil, err
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "capturedAt", Value: -1}}).
+		SetSkip(int64((page - 1) * screenshotTimelinePageSize)).
+		SetLimit(screenshotTimelinePageSize)
+	cursor, err := collection.Find(ctx, query, opts)
+	if err != nil {
+		return int(enum.DATA_NOT_FETCHED), nil, err
+	}
+	defer cursor.Close(ctx)
+
+	screenshots := []model.Screenshot{}
+	if err = cursor.All(ctx, &screenshots); err != nil {
+		return int(enum.DATA_NOT_FETCHED), nil, err
+	}
+	for i := range screenshots {
+		sc.WithURLs(&screenshots[i])
+	}
+
+	totalPages := int(total) / screenshotTimelinePageSize
+	if int(total)%screenshotTimelinePageSize > 0 {
+		totalPages++
+	}
+	return int(enum.SCREENSHOTS_FOUND), map[string]interface{}{
+		"total":       total,
+		"page":        page,
+		"totalPages":  totalPages,
+		"screenshots": screenshots,
+	}, nil
+}
+
+// GetScreenshot returns a single screenshot with fresh URLs.
+func (sc *ScreenshotController) GetScreenshot(screenshotID string) (*model.Screenshot, error) {
+	objectId, err := primitive.ObjectIDFromHex(screenshotID)
+	if err != nil {
+		return nil, err
+	}
+	dbConn := db.GetConnectionFromPool()
+	defer db.ReleaseConnectionToPool(dbConn)
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(sc.GetCollectionName())
+
+	screenshot := model.Screenshot{}
+	if err := collection.FindOne(context.Background(), bson.M{"_id": objectId}).Decode(&screenshot); err != nil {
+		return nil, err
+	}
+	return sc.WithURLs(&screenshot), nil
+}
+
+// PurgeExpired deletes screenshots older than SCREENSHOT_RETENTION_DAYS along
+// with their stored objects, and returns how many were removed.
+func (sc *ScreenshotController) PurgeExpired() (int, error) {
+	dbConn := db.GetConnectionFromPool()
+	defer db.ReleaseConnectionToPool(dbConn)
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(sc.GetCollectionName())
+
+	ctx := context.Background()
+	cutoff := time.Now().UTC().Add(-screenshotRetention())
+	cursor, err := collection.Find(ctx, bson.M{"capturedAt": bson.M{"$lt": cutoff}}, options.Find().SetLimit(500))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	expired := []model.Screenshot{}
+	if err = cursor.All(ctx, &expired); err != nil {
+		return 0, err
+	}
+
+	ids := bson.A{}
+	for _, screenshot := range expired {
+		if err := sc.deleteObject(screenshot.Storage, screenshot.StorageKey); err != nil {
+			// Keep the row so the object is retried on the next sweep.
+			log.Println("Error deleting screenshot object", screenshot.StorageKey, err)
+			continue
+		}
+		if err := sc.deleteObject(screenshot.Storage, screenshot.ThumbnailKey); err != nil {
+			log.Println("Error deleting screenshot thumbnail", screenshot.ThumbnailKey, err)
+		}
+		if objectId, err := primitive.ObjectIDFromHex(screenshot.ID); err == nil {
+			ids = append(ids, objectId)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	res, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
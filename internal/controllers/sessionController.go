@@ -7,26 +7,51 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"project-phoenix/v2/internal/cache"
 	"project-phoenix/v2/internal/db"
 	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/model"
+	"project-phoenix/v2/internal/ratelimit"
+	"strconv"
 	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type SessionController struct {
 	CollectionName string
 	DB             db.DBInterface
-	SessionMutex   sync.Mutex
 }
 
 func (sc *SessionController) GetCollectionName() string {
 	return "sessions"
 }
 
+var (
+	sessionDedupOnce sync.Once
+	sessionDedupObj  *ratelimit.Dedup
+)
+
+// sessionDedup hands a client that asks for sessions again within
+// SESSION_DEDUP_SECONDS (default 20) the one it just got. Clients are told
+// apart by IP, user agent and project.
+func sessionDedup() *ratelimit.Dedup {
+	sessionDedupOnce.Do(func() {
+		seconds := 20
+		if configured, e := strconv.Atoi(os.Getenv("SESSION_DEDUP_SECONDS")); e == nil && configured > 0 {
+			seconds = configured
+		}
+		sessionDedupObj = &ratelimit.Dedup{
+			Name:   "session",
+			Window: time.Duration(seconds) * time.Second,
+			Store:  ratelimit.NewStore(),
+		}
+	})
+	return sessionDedupObj
+}
+
 func (sc *SessionController) PerformIndexing() error {
 	if sc.DB == nil {
 		log.Println("Warning: DB instance is nil, skipping indexing")
@@ -71,45 +96,29 @@ func (sc *SessionController) CreateSession(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
-	// Add mutex lock to prevent concurrent session creation
-	sc.SessionMutex.Lock()
-	defer sc.SessionMutex.Unlock()
-
-	filter := bson.M{
-		"ip": clientIP,
-		"createdAt": bson.M{
-			"$gte": time.Now().Add(-20 * time.Second),
-		},
-	}
-
-	if projectType.IsValid() {
-		filter["projectType"] = string(projectType)
-	}
-
-	lastSession, err := sc.DB.FindOne(filter, sc.GetCollectionName())
-	if err == nil && lastSession != nil {
-		if existingSessionID, ok := lastSession["sessionID"].(string); ok && existingSessionID != "" {
-			w.Header().Set("sessionId", existingSessionID)
-			return existingSessionID, nil
-		}
-
-		if existingSessionID, ok := lastSession["sessionId"].(string); ok && existingSessionID != "" {
-			w.Header().Set("sessionId", existingSessionID)
-			return existingSessionID, nil
-		}
-	}
-
-	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
-		log.Printf("SessionController | CreateSession | recent session lookup failed: %v", err)
-	}
-
-	// Create new session if no recent one found
 	sessionID, err := sc.generateSessionID(15)
 	if err != nil {
 		log.Println("Unable to generate session ID", err)
 		return "", err
 	}
 
+	// Clients asking again right away, as some do on every page load, get
+	// the session they just got; floods beyond that are held back by the
+	// gateway's rate limit on /createSession.
+	dedup := sessionDedup()
+	dedupKey := TrustedClientIP(r) + ":" + string(projectType) + ":" + userAgent
+	if kept, e := dedup.Claim(r.Context(), dedupKey, sessionID); e != nil {
+		log.Println("Unable to check for a recent session", e)
+	} else if kept != sessionID {
+		w.Header().Set("sessionId", kept)
+		return kept, nil
+	}
+	release := func() {
+		if e := dedup.Release(r.Context(), dedupKey, sessionID); e != nil {
+			log.Println("Unable to release recent session", e)
+		}
+	}
+
 	sessionData := map[string]interface{}{
 		"sessionID":   sessionID,
 		"createdAt":   time.Now(),
@@ -121,6 +130,7 @@ func (sc *SessionController) CreateSession(w http.ResponseWriter, r *http.Reques
 	_, err = sc.DB.Create(sessionData, sc.GetCollectionName())
 	if err != nil {
 		log.Println("Unable to store session in DB", err)
+		release()
 		return "", err
 	}
 
@@ -129,6 +139,7 @@ func (sc *SessionController) CreateSession(w http.ResponseWriter, r *http.Reques
 	isAddedToRedis, err := cache.GetInstance().SetWithExpiry(sessionKey, map[string]interface{}{"sessionID": sessionData["sessionID"]}, hours)
 	if err != nil {
 		log.Println("Unable to store session in Redis", err)
+		release()
 		return "", err
 	}
 
@@ -138,6 +149,7 @@ func (sc *SessionController) CreateSession(w http.ResponseWriter, r *http.Reques
 	}
 
 	log.Println("Unable to store session in Redis")
+	release()
 	return "", nil
 
 }
@@ -181,3 +193,31 @@ func (sc *SessionController) generateSessionID(length int) (string, error) {
 	}
 	return hex.EncodeToString(bytes), nil
 }
+
+// FindSession loads a stored session, including the project it was created
+// for.
+func (sc *SessionController) FindSession(sessionID string) (*model.Session, error) {
+	if sessionID == "" {
+		return nil, errors.New("session id is required")
+	}
+	found, err := sc.DB.FindOne(bson.M{"sessionID": sessionID}, sc.GetCollectionName())
+	if err != nil {
+		return nil, err
+	}
+	// The JSON names of model.Session differ from the stored ones.
+	session := &model.Session{}
+	session.SessionID, _ = found["sessionID"].(string)
+	session.IP, _ = found["ip"].(string)
+	session.ProjectType, _ = found["projectType"].(string)
+	return session, nil
+}
+
+// EndSession removes a session, so requests and connections made with it are
+// refused from now on.
+func (sc *SessionController) EndSession(sessionID string) error {
+	if _, err := cache.GetInstance().Delete("session:" + sessionID); err != nil {
+		return err
+	}
+	_, err := sc.DB.Delete(bson.M{"sessionID": sessionID}, sc.GetCollectionName())
+	return err
+}
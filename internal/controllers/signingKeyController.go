@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"project-phoenix/v2/internal/auth"
+	"project-phoenix/v2/internal/db"
+	"project-phoenix/v2/internal/model"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// keyCacheTTL is how long replicas use the keys they loaded before
+	// reading them again. New keys are published keyPrepublishPeriod before
+	// they sign anything, so every replica and every JWKS cache knows them in
+	// time.
+	keyCacheTTL         = time.Minute
+	keyUnknownReload    = 10 * time.Second
+	keyPrepublishPeriod = time.Hour
+	// keyRetirementGrace keeps a replaced key a little longer than the
+	// tokens it signed, for clocks that are off.
+	keyRetirementGrace = 5 * time.Minute
+	jwksMaxAge         = 5 * time.Minute
+)
+
+type loadedSigningKey struct {
+	auth.SigningKey
+	Generation  int
+	ActivatesAt time.Time
+}
+
+// SigningKeyController keeps the key pairs access tokens are signed with.
+// The newest activated key signs, older keys keep verifying until their
+// tokens expire, and the public halves of all of them are published as a
+// JWKS at /returnJWK.
+type SigningKeyController struct {
+	CollectionName string
+	DB             db.DBInterface
+
+	mu       sync.Mutex
+	keys     []loadedSigningKey
+	loadedAt time.Time
+}
+
+func (kc *SigningKeyController) GetCollectionName() string {
+	return "signing_keys"
+}
+
+func (kc *SigningKeyController) PerformIndexing() error {
+	if kc.DB == nil {
+		return errors.New("DB not initialized")
+	}
+	// Replicas rotating at the same time race for the next generation; the
+	// index lets only one of them win.
+	return kc.DB.ValidateUniqueIndexing(kc.GetCollectionName(), bson.D{{Key: "generation", Value: 1}})
+}
+
+func (kc *SigningKeyController) collection() (*mongo.Collection, func()) {
+	dbConn := db.GetConnectionFromPool()
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(kc.GetCollectionName())
+	return collection, func() { db.ReleaseConnectionToPool(dbConn) }
+}
+
+// load reads every stored key, oldest generation first. Keys that cannot be
+// decoded, e.g. sealed with another SIGNING_KEYS_SECRET, are skipped.
+func (kc *SigningKeyController) load() ([]loadedSigningKey, error) {
+	collection, release := kc.collection()
+	defer release()
+	cursor, e := collection.Find(context.Background(), bson.M{}, options.Find().SetSort(bson.D{{Key: "generation", Value: 1}}))
+	if e != nil {
+		return nil, e
+	}
+	stored := []model.SigningKey{}
+	if e := cursor.All(context.Background(), &stored); e != nil {
+		return nil, e
+	}
+
+	secret := os.Getenv("SIGNING_KEYS_SECRET")
+	keys := make([]loadedSigningKey, 0, len(stored))
+	for _, key := range stored {
+		private, e := auth.DecodePrivateKey(key.PrivateKey, secret)
+		if e != nil {
+			log.Printf("Skipping signing key %s: %v", key.Kid, e)
+			continue
+		}
+		keys = append(keys, loadedSigningKey{
+			SigningKey:  auth.SigningKey{Kid: key.Kid, Algorithm: key.Algorithm, PrivateKey: private},
+			Generation:  key.Generation,
+			ActivatesAt: key.ActivatesAt,
+		})
+	}
+
+	kc.mu.Lock()
+	kc.keys = keys
+	kc.loadedAt = time.Now()
+	kc.mu.Unlock()
+	return keys, nil
+}
+
+// cached returns the loaded keys, reading them again once they are older
+// than maxAge.
+func (kc *SigningKeyController) cached(maxAge time.Duration) ([]loadedSigningKey, error) {
+	kc.mu.Lock()
+	keys, loadedAt := kc.keys, kc.loadedAt
+	kc.mu.Unlock()
+	if time.Since(loadedAt) < maxAge {
+		return keys, nil
+	}
+	return kc.load()
+}
+
+// activeKey is the newest key that has activated by now.
+func activeKey(keys []loadedSigningKey, now time.Time) *loadedSigningKey {
+	for i := len(keys) - 1; i >= 0; i-- {
+		if !keys[i].ActivatesAt.After(now) {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+// verifiable tells whether tokens signed with keys[i] may still be valid:
+// until the key after it took over and the longest token lifetime passed.
+func verifiable(keys []loadedSigningKey, i int, now time.Time) bool {
+	if i == len(keys)-1 {
+		return true
+	}
+	retiredAt := keys[i+1].ActivatesAt
+	return now.Before(retiredAt.Add(auth.AccessTokenTTL() + keyRetirementGrace))
+}
+
+// ActiveKey returns the key new tokens are signed with, creating the first
+// key if there is none.
+func (kc *SigningKeyController) ActiveKey() (*auth.SigningKey, error) {
+	keys, e := kc.cached(keyCacheTTL)
+	if e != nil {
+		return nil, e
+	}
+	if key := activeKey(keys, time.Now()); key != nil {
+		return &key.SigningKey, nil
+	}
+	if e := kc.RotateKeys(time.Now()); e != nil {
+		return nil, e
+	}
+	keys, e = kc.cached(0)
+	if e != nil {
+		return nil, e
+	}
+	if key := activeKey(keys, time.Now()); key != nil {
+		return &key.SigningKey, nil
+	}
+	return nil, errors.New("no active signing key")
+}
+
+// VerificationKey implements auth.KeyResolver over the stored keys.
+func (kc *SigningKeyController) VerificationKey(kid string) (crypto.PublicKey, string, error) {
+	keys, e := kc.cached(keyCacheTTL)
+	if e != nil {
+		return nil, "", e
+	}
+	if public, algorithm, found := findVerificationKey(keys, kid); found {
+		return public, algorithm, nil
+	}
+	// A key another replica just created is read at most every few seconds.
+	if keys, e = kc.cached(keyUnknownReload); e != nil {
+		return nil, "", e
+	}
+	if public, algorithm, found := findVerificationKey(keys, kid); found {
+		return public, algorithm, nil
+	}
+	return nil, "", auth.ErrUnknownKey
+}
+
+func findVerificationKey(keys []loadedSigningKey, kid string) (crypto.PublicKey, string, bool) {
+	now := time.Now()
+	for i, key := range keys {
+		if key.Kid == kid && verifiable(keys, i, now) {
+			return key.Public(), key.Algorithm, true
+		}
+	}
+	return nil, "", false
+}
+
+// RotateKeys creates the next key when the active one is due to be replaced
+// and removes keys whose tokens have all expired. The next key is created
+// keyPrepublishPeriod before it activates, so verifiers fetching the JWKS
+// know it before the first token signed with it arrives.
+func (kc *SigningKeyController) RotateKeys(now time.Time) error {
+	keys, e := kc.load()
+	if e != nil {
+		return e
+	}
+	generation := 0
+	if len(keys) > 0 {
+		generation = keys[len(keys)-1].Generation
+	}
+
+	active := activeKey(keys, now)
+	pending := len(keys) > 0 && keys[len(keys)-1].ActivatesAt.After(now)
+	switch {
+	case active == nil:
+		e = kc.create(generation+1, now)
+	case !pending && !now.Before(active.ActivatesAt.Add(auth.KeyRotationInterval()-keyPrepublishPeriod)):
+		e = kc.create(generation+1, now.Add(keyPrepublishPeriod))
+	}
+	if e != nil {
+		return e
+	}
+
+	retired := []string{}
+	for i, key := range keys {
+		if !verifiable(keys, i, now) {
+			retired = append(retired, key.Kid)
+		}
+	}
+	if len(retired) > 0 {
+		collection, release := kc.collection()
+		defer release()
+		if _, e := collection.DeleteMany(context.Background(), bson.M{"_id": bson.M{"$in": retired}}); e != nil {
+			return e
+		}
+		log.Printf("Removed %d retired signing key(s)", len(retired))
+	}
+	_, e = kc.load()
+	return e
+}
+
+func (kc *SigningKeyController) create(generation int, activatesAt time.Time) error {
+	key, e := auth.GenerateSigningKey(auth.SigningAlgorithm())
+	if e != nil {
+		return e
+	}
+	private, e := auth.EncodePrivateKey(key.PrivateKey, os.Getenv("SIGNING_KEYS_SECRET"))
+	if e != nil {
+		return e
+	}
+	if _, e := kc.DB.Create(model.SigningKey{
+		Kid:         key.Kid,
+		Algorithm:   key.Algorithm,
+		Generation:  generation,
+		PrivateKey:  private,
+		CreatedAt:   time.Now().UTC(),
+		ActivatesAt: activatesAt.UTC(),
+	}, kc.GetCollectionName()); e != nil {
+		if mongo.IsDuplicateKeyError(e) {
+			// Another replica created this generation first.
+			return nil
+		}
+		return e
+	}
+	log.Printf("Created %s signing key %s, active from %s", key.Algorithm, key.Kid, activatesAt.UTC().Format(time.RFC3339))
+	return nil
+}
+
+// JWKS returns the public keys verifiers should accept: the upcoming key,
+// the active one and those whose tokens may still be valid.
+func (kc *SigningKeyController) JWKS() (auth.JWKS, error) {
+	keys, e := kc.cached(keyCacheTTL)
+	if e != nil {
+		return auth.JWKS{}, e
+	}
+	document := auth.JWKS{Keys: []auth.JWK{}}
+	now := time.Now()
+	for i := len(keys) - 1; i >= 0; i-- {
+		if !verifiable(keys, i, now) {
+			continue
+		}
+		jwk, e := auth.PublicJWK(keys[i].Kid, keys[i].Algorithm, keys[i].Public())
+		if e != nil {
+			return auth.JWKS{}, e
+		}
+		document.Keys = append(document.Keys, jwk)
+	}
+	return document, nil
+}
+
+// ReturnJWK handles /returnJWK. The JWKS is written as is, not wrapped in
+// our response envelope, so standard JWT libraries can read it.
+func (kc *SigningKeyController) ReturnJWK(w http.ResponseWriter, r *http.Request) error {
+	document, e := kc.JWKS()
+	if e != nil {
+		return e
+	}
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(jwksMaxAge.Seconds())))
+	return json.NewEncoder(w).Encode(document)
+}
@@ -0,0 +1,492 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"project-phoenix/v2/internal/auth"
+	"project-phoenix/v2/internal/db"
+	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/model"
+	"project-phoenix/v2/pkg/helper"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	TwoFactorMethodPassword = "password"
+	TwoFactorMethodGoogle   = "google"
+
+	twoFactorChallengeTTL    = 5 * time.Minute
+	maxTwoFactorAttempts     = 5
+	trustedDeviceTTL         = 30 * 24 * time.Hour
+	recoveryCodeCount        = 10
+	twoFactorChallengePrefix = "mfa_"
+	trustedDevicePrefix      = "td_"
+)
+
+var ErrTwoFactorChallengeInvalid = errors.New("two-factor challenge is invalid or expired")
+
+// TwoFactorController keeps TOTP enrollments, the logins waiting for a
+// second factor and the devices users asked to remember.
+type TwoFactorController struct {
+	CollectionName string
+	DB             db.DBInterface
+}
+
+func (tc *TwoFactorController) GetCollectionName() string {
+	return "two_factor"
+}
+
+func (tc *TwoFactorController) GetChallengeCollectionName() string {
+	return "two_factor_challenges"
+}
+
+func (tc *TwoFactorController) GetTrustedDeviceCollectionName() string {
+	return "trusted_devices"
+}
+
+func (tc *TwoFactorController) PerformIndexing() error {
+	if tc.DB == nil {
+		return errors.New("DB not initialized")
+	}
+	if secretsKey() == "" {
+		log.Println("WARNING: TOTP_SECRETS_KEY is not set, two-factor setup is refused until it is")
+	}
+	for _, name := range []string{tc.GetChallengeCollectionName(), tc.GetTrustedDeviceCollectionName()} {
+		if e := tc.DB.ValidateUniqueIndexing(name, bson.D{{Key: "tokenHash", Value: 1}}); e != nil {
+			return e
+		}
+		if e := tc.DB.ValidateIndexingTTL(name, bson.D{{Key: "expiresAt", Value: 1}}, 0); e != nil {
+			return e
+		}
+	}
+	return tc.DB.ValidateIndexing(tc.GetTrustedDeviceCollectionName(), bson.D{{Key: "userId", Value: 1}})
+}
+
+func (tc *TwoFactorController) collection(name string) (*mongo.Collection, func()) {
+	dbConn := db.GetConnectionFromPool()
+	collection := dbConn.Client.Database(os.Getenv("MONGO_DB_NAME")).Collection(name)
+	return collection, func() { db.ReleaseConnectionToPool(dbConn) }
+}
+
+// get returns a user's enrollment, or nil if there is none.
+func (tc *TwoFactorController) get(userID string) (*model.TwoFactor, error) {
+	collection, release := tc.collection(tc.GetCollectionName())
+	defer release()
+	twoFactor := model.TwoFactor{}
+	e := collection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&twoFactor)
+	if errors.Is(e, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if e != nil {
+		return nil, e
+	}
+	return &twoFactor, nil
+}
+
+// Enabled returns a user's enrollment if the second factor is on.
+func (tc *TwoFactorController) Enabled(userID string) (*model.TwoFactor, error) {
+	twoFactor, e := tc.get(userID)
+	if e != nil || twoFactor == nil || !twoFactor.Enabled {
+		return nil, e
+	}
+	return twoFactor, nil
+}
+
+// secretsKey seals TOTP secrets at rest, from TOTP_SECRETS_KEY. Without it
+// no new secrets are handed out, so none is stored in plaintext.
+func secretsKey() string {
+	return os.Getenv("TOTP_SECRETS_KEY")
+}
+
+// checkCode accepts an authenticator code newer than the last one used, or
+// an unused recovery code, which it removes. Both are claimed with a single
+// conditional update, so the same code cannot pass twice.
+func (tc *TwoFactorController) checkCode(twoFactor *model.TwoFactor, codes model.TwoFactorCodeModel) (bool, error) {
+	collection, release := tc.collection(tc.GetCollectionName())
+	defer release()
+
+	if codes.RecoveryCode != "" {
+		res, e := collection.UpdateOne(context.Background(),
+			bson.M{"_id": twoFactor.UserID, "recoveryCodes": auth.HashRecoveryCode(codes.RecoveryCode)},
+			bson.M{"$pull": bson.M{"recoveryCodes": auth.HashRecoveryCode(codes.RecoveryCode)}})
+		if e != nil {
+			return false, e
+		}
+		return res.ModifiedCount == 1, nil
+	}
+
+	secret, e := auth.OpenSecret(twoFactor.Secret, secretsKey())
+	if e != nil {
+		return false, e
+	}
+	step, ok := auth.VerifyTOTP(string(secret), codes.Code, time.Now())
+	if !ok || step <= twoFactor.LastUsedStep {
+		return false, nil
+	}
+	res, e := collection.UpdateOne(context.Background(),
+		bson.M{"_id": twoFactor.UserID, "lastUsedStep": bson.M{"$lt": step}},
+		bson.M{"$set": bson.M{"lastUsedStep": step}})
+	if e != nil {
+		return false, e
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, e := auth.NewRecoveryCodes(recoveryCodeCount)
+	if e != nil {
+		return nil, nil, e
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// StartChallenge records a login that needs its second factor and returns
+// the token the client completes it with.
+func (tc *TwoFactorController) StartChallenge(userID string, sessionID string, method string, fcmKey string) (string, time.Time, error) {
+	token, e := auth.NewOpaqueToken(twoFactorChallengePrefix)
+	if e != nil {
+		return "", time.Time{}, e
+	}
+	now := time.Now().UTC()
+	expiresAt := now.Add(twoFactorChallengeTTL)
+	_, e = tc.DB.Create(model.TwoFactorChallenge{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		SessionID: sessionID,
+		Method:    method,
+		FcmKey:    fcmKey,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}, tc.GetChallengeCollectionName())
+	return token, expiresAt, e
+}
+
+// TakeChallenge finds a pending challenge of the session.
+func (tc *TwoFactorController) TakeChallenge(token string, sessionID string) (*model.TwoFactorChallenge, error) {
+	collection, release := tc.collection(tc.GetChallengeCollectionName())
+	defer release()
+	challenge := model.TwoFactorChallenge{}
+	e := collection.FindOne(context.Background(), bson.M{
+		"tokenHash": auth.HashToken(token),
+		"sessionId": sessionID,
+		"expiresAt": bson.M{"$gt": time.Now().UTC()},
+		"attempts":  bson.M{"$lt": maxTwoFactorAttempts},
+	}).Decode(&challenge)
+	if e != nil {
+		return nil, ErrTwoFactorChallengeInvalid
+	}
+	return &challenge, nil
+}
+
+// VerifyChallenge checks the code of a challenge. A wrong code uses up one of
+// its attempts; a right one ends the challenge, and only one request can end
+// it.
+func (tc *TwoFactorController) VerifyChallenge(challenge *model.TwoFactorChallenge, codes model.TwoFactorCodeModel) (bool, error) {
+	twoFactor, e := tc.Enabled(challenge.UserID)
+	if e != nil {
+		return false, e
+	}
+	ok := false
+	if twoFactor != nil {
+		if ok, e = tc.checkCode(twoFactor, codes); e != nil {
+			return false, e
+		}
+	}
+	collection, release := tc.collection(tc.GetChallengeCollectionName())
+	defer release()
+	if !ok {
+		_, e = collection.UpdateOne(context.Background(), bson.M{"tokenHash": challenge.TokenHash}, bson.M{"$inc": bson.M{"attempts": 1}})
+		return false, e
+	}
+	res, e := collection.DeleteOne(context.Background(), bson.M{"tokenHash": challenge.TokenHash})
+	if e != nil {
+		return false, e
+	}
+	return res.DeletedCount == 1, nil
+}
+
+// TrustDevice remembers the device of a request for trustedDeviceTTL and
+// returns its token and id.
+func (tc *TwoFactorController) TrustDevice(userID string, r *http.Request) (string, string, error) {
+	token, e := auth.NewOpaqueToken(trustedDevicePrefix)
+	if e != nil {
+		return "", "", e
+	}
+	now := time.Now().UTC()
+	created, e := tc.DB.Create(model.TrustedDevice{
+		TokenHash:  auth.HashToken(token),
+		UserID:     userID,
+		UserAgent:  r.UserAgent(),
+		IP:         TrustedClientIP(r),
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(trustedDeviceTTL),
+	}, tc.GetTrustedDeviceCollectionName())
+	if e != nil {
+		return "", "", e
+	}
+	return token, helper.InterfaceToString(created["_id"]), nil
+}
+
+// TrustedDevice returns the id of the user's remembered device with this
+// token, or "" if there is none.
+func (tc *TwoFactorController) TrustedDevice(userID string, token string) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+	collection, release := tc.collection(tc.GetTrustedDeviceCollectionName())
+	defer release()
+	now := time.Now().UTC()
+	device := model.TrustedDevice{}
+	e := collection.FindOneAndUpdate(context.Background(),
+		bson.M{"tokenHash": auth.HashToken(token), "userId": userID, "expiresAt": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"lastUsedAt": now}}).Decode(&device)
+	if errors.Is(e, mongo.ErrNoDocuments) {
+		return "", nil
+	}
+	return device.ID, e
+}
+
+// ForgetDevices removes every remembered device of a user.
+func (tc *TwoFactorController) ForgetDevices(userID string) error {
+	collection, release := tc.collection(tc.GetTrustedDeviceCollectionName())
+	defer release()
+	_, e := collection.DeleteMany(context.Background(), bson.M{"userId": userID})
+	return e
+}
+
+// TwoFactorStatus handles GET /2fa.
+func (tc *TwoFactorController) TwoFactorStatus(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.NOT_LOGGED_IN), nil, errors.New("not logged in")
+	}
+	twoFactor, e := tc.get(claims.Subject)
+	if e != nil {
+		return int(enum.ERROR), nil, e
+	}
+	status := map[string]interface{}{"enabled": false}
+	if twoFactor != nil && twoFactor.Enabled {
+		status = map[string]interface{}{
+			"enabled":           true,
+			"enabledAt":         twoFactor.EnabledAt,
+			"requireForGoogle":  twoFactor.RequireForGoogle,
+			"recoveryCodesLeft": len(twoFactor.RecoveryCodes),
+		}
+	}
+	return int(enum.TWO_FACTOR_STATUS_FETCHED), status, nil
+}
+
+// SetupTwoFactor handles POST /2fa/setup. It creates a new secret, pending
+// until EnableTwoFactor confirms a code, and returns it with the
+// otpauth:// URI to show as a QR code.
+func (tc *TwoFactorController) SetupTwoFactor(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.NOT_LOGGED_IN), nil, errors.New("not logged in")
+	}
+	if twoFactor, e := tc.get(claims.Subject); e != nil || (twoFactor != nil && twoFactor.Enabled) {
+		if e != nil {
+			return int(enum.ERROR), nil, e
+		}
+		return int(enum.TWO_FACTOR_ALREADY_ENABLED), nil, errors.New("two-factor authentication is already enabled")
+	}
+	if secretsKey() == "" {
+		return int(enum.TWO_FACTOR_UNAVAILABLE), nil, errors.New("two-factor authentication is not configured")
+	}
+	secret, e := auth.NewTOTPSecret()
+	if e != nil {
+		return int(enum.ERROR), nil, e
+	}
+	sealed, e := auth.SealSecret([]byte(secret), secretsKey())
+	if e != nil {
+		return int(enum.ERROR), nil, e
+	}
+	collection, release := tc.collection(tc.GetCollectionName())
+	defer release()
+	if _, e := collection.ReplaceOne(context.Background(), bson.M{"_id": claims.Subject, "enabled": false}, model.TwoFactor{
+		UserID:        claims.Subject,
+		Secret:        sealed,
+		RecoveryCodes: []string{},
+		CreatedAt:     time.Now().UTC(),
+	}, options.Replace().SetUpsert(true)); e != nil {
+		return int(enum.ERROR), nil, e
+	}
+	account := claims.Email
+	if account == "" {
+		account = claims.Subject
+	}
+	return int(enum.TWO_FACTOR_SETUP_STARTED), map[string]interface{}{
+		"secret": secret,
+		"uri":    auth.TOTPProvisioningURI(secret, account, auth.Issuer()),
+	}, nil
+}
+
+// EnableTwoFactor handles POST /2fa/enable with a code from the app set up
+// by SetupTwoFactor, and returns the recovery codes. They are shown only
+// this once.
+func (tc *TwoFactorController) EnableTwoFactor(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.NOT_LOGGED_IN), nil, errors.New("not logged in")
+	}
+	enableModel := model.TwoFactorEnableModel{}
+	if e := json.NewDecoder(r.Body).Decode(&enableModel); e != nil {
+		return int(enum.ERROR), nil, e
+	}
+	twoFactor, e := tc.get(claims.Subject)
+	if e != nil {
+		return int(enum.ERROR), nil, e
+	}
+	if twoFactor == nil {
+		return int(enum.TWO_FACTOR_NOT_ENABLED), nil, errors.New("two-factor setup was not started")
+	}
+	if twoFactor.Enabled {
+		return int(enum.TWO_FACTOR_ALREADY_ENABLED), nil, errors.New("two-factor authentication is already enabled")
+	}
+	if ok, e := tc.checkCode(twoFactor, model.TwoFactorCodeModel{Code: enableModel.Code}); e != nil || !ok {
+		if e != nil {
+			return int(enum.ERROR), nil, e
+		}
+		return int(enum.TWO_FACTOR_CODE_INVALID), nil, errors.New("invalid code")
+	}
+	codes, hashes, e := newRecoveryCodes()
+	if e != nil {
+		return int(enum.ERROR), nil, e
+	}
+	requireForGoogle := enableModel.RequireForGoogle == nil || *enableModel.RequireForGoogle
+	collection, release := tc.collection(tc.GetCollectionName())
+	defer release()
+	if _, e := collection.UpdateOne(context.Background(), bson.M{"_id": claims.Subject}, bson.M{"$set": bson.M{
+		"enabled":          true,
+		"enabledAt":        time.Now().UTC(),
+		"requireForGoogle": requireForGoogle,
+		"recoveryCodes":    hashes,
+	}}); e != nil {
+		return int(enum.ERROR), nil, e
+	}
+	return int(enum.TWO_FACTOR_ENABLED), map[string]interface{}{"recoveryCodes": codes, "requireForGoogle": requireForGoogle}, nil
+}
+
+// enabledWithCode returns the enrollment of the logged in user once a code
+// of it was checked.
+func (tc *TwoFactorController) enabledWithCode(r *http.Request, codes model.TwoFactorCodeModel) (*model.TwoFactor, int, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return nil, int(enum.NOT_LOGGED_IN), errors.New("not logged in")
+	}
+	twoFactor, e := tc.Enabled(claims.Subject)
+	if e != nil {
+		return nil, int(enum.ERROR), e
+	}
+	if twoFactor == nil {
+		return nil, int(enum.TWO_FACTOR_NOT_ENABLED), errors.New("two-factor authentication is not enabled")
+	}
+	ok, e = tc.checkCode(twoFactor, codes)
+	if e != nil {
+		return nil, int(enum.ERROR), e
+	}
+	if !ok {
+		return nil, int(enum.TWO_FACTOR_CODE_INVALID), errors.New("invalid code")
+	}
+	return twoFactor, 0, nil
+}
+
+// DisableTwoFactor handles POST /2fa/disable with a code or recovery code.
+// Remembered devices are forgotten with it.
+func (tc *TwoFactorController) DisableTwoFactor(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	codes := model.TwoFactorCodeModel{}
+	if e := json.NewDecoder(r.Body).Decode(&codes); e != nil {
+		return int(enum.ERROR), nil, e
+	}
+	twoFactor, code, e := tc.enabledWithCode(r, codes)
+	if e != nil {
+		return code, nil, e
+	}
+	if e := tc.Remove(twoFactor.UserID); e != nil {
+		return int(enum.ERROR), nil, e
+	}
+	return int(enum.TWO_FACTOR_DISABLED), nil, nil
+}
+
+// Remove turns the second factor of a user off and forgets their
+// remembered devices.
+func (tc *TwoFactorController) Remove(userID string) error {
+	collection, release := tc.collection(tc.GetCollectionName())
+	defer release()
+	if _, e := collection.DeleteOne(context.Background(), bson.M{"_id": userID}); e != nil {
+		return e
+	}
+	return tc.ForgetDevices(userID)
+}
+
+// RegenerateRecoveryCodes handles POST /2fa/recovery-codes. The old codes
+// stop working.
+func (tc *TwoFactorController) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	codes := model.TwoFactorCodeModel{}
+	if e := json.NewDecoder(r.Body).Decode(&codes); e != nil {
+		return int(enum.ERROR), nil, e
+	}
+	twoFactor, code, e := tc.enabledWithCode(r, codes)
+	if e != nil {
+		return code, nil, e
+	}
+	recoveryCodes, hashes, e := newRecoveryCodes()
+	if e != nil {
+		return int(enum.ERROR), nil, e
+	}
+	collection, release := tc.collection(tc.GetCollectionName())
+	defer release()
+	if _, e := collection.UpdateOne(context.Background(), bson.M{"_id": twoFactor.UserID}, bson.M{"$set": bson.M{"recoveryCodes": hashes}}); e != nil {
+		return int(enum.ERROR), nil, e
+	}
+	return int(enum.RECOVERY_CODES_GENERATED), map[string]interface{}{"recoveryCodes": recoveryCodes}, nil
+}
+
+// UpdateTwoFactor handles PUT /2fa, which turns the second factor for Google
+// logins on or off.
+func (tc *TwoFactorController) UpdateTwoFactor(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.NOT_LOGGED_IN), nil, errors.New("not logged in")
+	}
+	settings := model.TwoFactorSettingsModel{}
+	if e := json.NewDecoder(r.Body).Decode(&settings); e != nil || settings.RequireForGoogle == nil {
+		return int(enum.ERROR), nil, errors.New("requireForGoogle is required")
+	}
+	collection, release := tc.collection(tc.GetCollectionName())
+	defer release()
+	res, e := collection.UpdateOne(context.Background(), bson.M{"_id": claims.Subject, "enabled": true},
+		bson.M{"$set": bson.M{"requireForGoogle": *settings.RequireForGoogle}})
+	if e != nil {
+		return int(enum.ERROR), nil, e
+	}
+	if res.MatchedCount == 0 {
+		return int(enum.TWO_FACTOR_NOT_ENABLED), nil, errors.New("two-factor authentication is not enabled")
+	}
+	return int(enum.TWO_FACTOR_UPDATED), map[string]interface{}{"requireForGoogle": *settings.RequireForGoogle}, nil
+}
+
+// ForgetTrustedDevices handles DELETE /2fa/trusted-devices.
+func (tc *TwoFactorController) ForgetTrustedDevices(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.NOT_LOGGED_IN), nil, errors.New("not logged in")
+	}
+	if e := tc.ForgetDevices(claims.Subject); e != nil {
+		return int(enum.ERROR), nil, e
+	}
+	return int(enum.TRUSTED_DEVICES_FORGOTTEN), nil, nil
+}
@@ -1,23 +1,35 @@
 package controllers
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"project-phoenix/v2/internal/auth"
 	"project-phoenix/v2/internal/cache"
 	"project-phoenix/v2/internal/db"
 	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/mailer"
 	"project-phoenix/v2/internal/model"
+	"project-phoenix/v2/internal/ratelimit"
 	"project-phoenix/v2/pkg/helper"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	firebase "firebase.google.com/go"
-	"github.com/golang-jwt/jwt/v4"
+	"github.com/go-playground/validator/v10"
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/api/option"
 )
@@ -31,55 +43,65 @@ func (u *UserController) GetCollectionName() string {
 	return "users"
 }
 
+func (u *UserController) PerformIndexing() error {
+	if u.DB == nil {
+		return errors.New("DB not initialized")
+	}
+	return u.DB.ValidateUniqueIndexing(u.GetCollectionName(), bson.D{{Key: "email", Value: 1}})
+}
+
 func (u *UserController) Register(w http.ResponseWriter, r *http.Request) (int, string, interface{}, error) {
-	userModel := model.User{}
 	registerModel := model.RegisterModel{}
 	decodeErr := json.NewDecoder(r.Body).Decode(&registerModel)
-	if decodeErr == nil {
-		log.Println("Login Body", registerModel)
-		log.Println("Decoded", userModel)
-		if registerModel.Password != registerModel.ConfirmPassword {
-			// response.SendResponse(w, http.StatusBadRequest, "Passwords do not match")
-			return int(enum.PASSWORD_MISMATCH), "", nil, nil
-		}
-		//now let's hash the password, but first let's check if the user exists
-		userQuery := map[string]interface{}{
-			"email": registerModel.Email,
-		}
-		user, _ := u.DB.FindOne(userQuery, u.GetCollectionName())
-		if user == nil {
-			hashedPassword, hashErr := hashPassword(registerModel.Password)
-			if hashErr != nil {
-				log.Println("Error while hashing password", hashErr)
-				return int(enum.ERROR), "Error while hashing password", nil, hashErr
-			} else {
-				//save user
-				userModel = registerModel.User
-				userModel.CreatedAt = time.Now()
-				userModel.UpdatedAt = time.Now()
-				userModel.Password = hashedPassword
-
-				log.Println("User Model", userModel)
-				insertedUser, userErr := u.DB.Create(userModel, u.GetCollectionName())
-				if userErr != nil {
-					log.Println("Error while creating user", userErr)
-					return int(enum.REGISTER_FAILED), "", nil, userErr
-				}
-				log.Println("Inserted User", insertedUser)
-				userModel.ID = helper.InterfaceToString(insertedUser["_id"])
-				return int(enum.REGISTERED_SUCCESS), "", userModel, nil
-			}
-		} else {
-			log.Println("User exists")
-			// response.SendResponse(w, http.StatusBadRequest, "User already exists")
-			return int(enum.EMAIL_EXISTS), "", nil, nil
-		}
-
-	} else {
+	if decodeErr != nil {
 		log.Println("Unable to decode request body", decodeErr)
 		return -1, "Unable to decode request body", nil, decodeErr
+	}
+	userModel := registerModel.User
+	userModel.ID = ""
+	userModel.Email = strings.TrimSpace(userModel.Email)
+	userModel.Username = strings.TrimSpace(userModel.Username)
+	if invalid := invalidUserFields(userModel); len(invalid) > 0 {
+		return int(enum.REGISTRATION_INVALID), "", map[string]interface{}{"invalidFields": invalid}, nil
+	}
+	if code := checkNewPassword(registerModel.Password, registerModel.ConfirmPassword); code != 0 {
+		return code, "", nil, nil
+	}
+	if user, _ := u.DB.FindOne(map[string]interface{}{"email": userModel.Email}, u.GetCollectionName()); user != nil {
+		log.Println("User exists")
+		return int(enum.EMAIL_EXISTS), "", nil, nil
+	}
+	if user, _ := u.DB.FindOne(map[string]interface{}{"username": userModel.Username}, u.GetCollectionName()); user != nil {
+		return int(enum.USERNAME_EXISTS), "", nil, nil
+	}
 
+	hashedPassword, hashErr := hashPassword(userModel.Password)
+	if hashErr != nil {
+		log.Println("Error while hashing password", hashErr)
+		return int(enum.ERROR), "Error while hashing password", nil, hashErr
 	}
+	userModel.CreatedAt = time.Now()
+	userModel.UpdatedAt = time.Now()
+	userModel.Password = hashedPassword
+	userModel.EmailVerified = false
+	userModel.PasswordChangedAt = nil
+	userModel.Roles = nil
+	userModel.Permissions = nil
+	insertedUser, userErr := u.DB.Create(userModel, u.GetCollectionName())
+	if userErr != nil {
+		if mongo.IsDuplicateKeyError(userErr) {
+			// registered at the same time by another request
+			return int(enum.EMAIL_EXISTS), "", nil, nil
+		}
+		log.Println("Error while creating user", userErr)
+		return int(enum.REGISTER_FAILED), "", nil, userErr
+	}
+	userModel.ID = helper.InterfaceToString(insertedUser["_id"])
+	if e := u.sendVerificationEmail(userModel); e != nil {
+		log.Println("Error while sending verification email", e)
+	}
+	userModel.Password = ""
+	return int(enum.REGISTERED_SUCCESS), "", userModel, nil
 }
 
 func (u *UserController) Login(w http.ResponseWriter, r *http.Request) (int, string, interface{}, error) {
@@ -87,11 +109,17 @@ func (u *UserController) Login(w http.ResponseWriter, r *http.Request) (int, str
 	userModel := model.User{}
 	decodeErr := json.NewDecoder(r.Body).Decode(&loginModel)
 	if decodeErr == nil {
+		if locked := loginLockedFor(loginModel.Email, r); locked > 0 {
+			return loginLockedResponse(w, locked)
+		}
 		userQuery := map[string]interface{}{
 			"email": loginModel.Email,
 		}
 		existingUser, _ := u.DB.FindOne(userQuery, u.GetCollectionName())
 		if existingUser == nil {
+			if locked := loginFailed(loginModel.Email, r); locked > 0 {
+				return loginLockedResponse(w, locked)
+			}
 			return int(enum.USER_NOT_FOUND), "", nil, nil
 		} else {
 			e := helper.MapToStruct(existingUser, &userModel)
@@ -101,20 +129,30 @@ func (u *UserController) Login(w http.ResponseWriter, r *http.Request) (int, str
 			} else {
 				if u.MatchPasswords(loginModel.Password, userModel.Password) {
 					log.Println("User Model ", userModel)
-					generatedToken, generateEr := GenerateJWT("")
-					if generateEr != nil {
-						log.Println("Error while generating JWT", generateEr)
-						return int(enum.ERROR), "Error while generating JWT", nil, generateEr
+					challenge, trustedDeviceID, factorEr := u.secondFactor(userModel, TwoFactorMethodPassword, loginModel.FcmKey, loginModel.TrustedDevice, r)
+					if factorEr != nil {
+						log.Println("Error while checking second factor", factorEr)
+						return int(enum.ERROR), "Error while checking second factor", nil, factorEr
+					}
+					if challenge != nil {
+						return int(enum.TWO_FACTOR_REQUIRED), "", challenge, nil
+					}
+					tokens, tokenEr := u.startLogin(userModel, loginModel, r, trustedDeviceID)
+					if tokenEr != nil {
+						log.Println("Error while issuing tokens", tokenEr)
+						return int(enum.ERROR), "Error while issuing tokens", nil, tokenEr
 					} else {
-						u.HandleLoginActivity(userModel, loginModel, r, generatedToken)
-
+						loginSucceeded(loginModel.Email, r)
 						//hide important info
 						userModel.Password = ""
 						userModel.ID = ""
-						return int(enum.USER_LOGGED_IN), "", map[string]interface{}{"user": userModel, "token": generatedToken}, nil
+						return int(enum.USER_LOGGED_IN), "", helper.MergeStructAndMap(*tokens, map[string]interface{}{"user": userModel}), nil
 					}
 
 				} else {
+					if locked := loginFailed(loginModel.Email, r); locked > 0 {
+						return loginLockedResponse(w, locked)
+					}
 					return int(enum.LOGIN_FAILED), "", nil, nil
 				}
 			}
@@ -127,18 +165,24 @@ func (u *UserController) Login(w http.ResponseWriter, r *http.Request) (int, str
 }
 
 func (u *UserController) Logout(w http.ResponseWriter, r *http.Request) (int, string, interface{}, error) {
-	// userModel := model.User{}
-	//body will be empty
-	sessionId := r.Header.Get("sessionId")
-	userName, hash, ok := r.BasicAuth()
+	//body will be empty. The access token's login is ended: its refresh
+	// tokens and the token itself stop working.
+	claims, ok := auth.ClaimsFromContext(r.Context())
 	if !ok {
 		return int(enum.USER_NOT_FOUND), "", nil, nil
-	} else if userName == "" || hash == "" {
-
+	}
+	refreshTokenController := GetControllerInstance(enum.RefreshTokenController, enum.MONGODB).(*RefreshTokenController)
+	if er := refreshTokenController.RevokeFamily(claims.FamilyID); er != nil {
+		log.Println("Error while revoking refresh tokens", er)
+		return int(enum.ERROR), "Error while logging out", nil, er
+	}
+	if er := refreshTokenController.RevokeAccessToken(claims); er != nil {
+		log.Println("Error while revoking access token", er)
+		return int(enum.ERROR), "Error while logging out", nil, er
 	}
 	userQuery := map[string]interface{}{
-		"token":     hash,
-		"sessionId": sessionId,
+		"userId":      claims.Subject,
+		"tokenFamily": claims.FamilyID,
 	}
 	_, er := u.DB.Delete(userQuery, "loginactivities")
 	if er != nil {
@@ -190,38 +234,163 @@ func (u *UserController) GoogleLogin(w http.ResponseWriter, r *http.Request) (in
 			return int(enum.ERROR), "Error while decoding google user", nil, a
 		}
 		// googleUserModel.Firebase.Identities.Email[0] = googleUserModel.Firebase.Identities.Email[0]
-		generatedToken, generateEr := GenerateJWT(googleUserModel.Iss)
-		if generateEr != nil {
-			log.Println("Error while generating JWT", generateEr)
-			return int(enum.ERROR), "Error while generating JWT", nil, generateEr
-		} else {
-			userModel := model.User{
-				Email:     googleUserModel.Firebase.Identities.Email[0],
-				Name:      googleUserModel.Name,
-				Avatar:    googleUserModel.Picture,
-				UpdatedAt: time.Now(),
-			}
+		userModel := model.User{
+			Email:         googleUserModel.Firebase.Identities.Email[0],
+			Name:          googleUserModel.Name,
+			Avatar:        googleUserModel.Picture,
+			UpdatedAt:     time.Now(),
+			EmailVerified: true,
+		}
 
-			returnedUserID := u.DB.UpdateOrCreate(map[string]interface{}{"email": googleUserModel.
-				Firebase.Identities.Email[0]}, userModel, "users")
-			if returnedUserID == nil {
-				log.Println("Error while creating user", returnedUserID)
-				return int(enum.ERROR), "Error while creating user", nil, nil
-			} else {
-				userModel.ID = helper.InterfaceToString(returnedUserID)
-				u.HandleLoginActivity(userModel, model.LoginModel{FcmKey: googleLoginBody.FcmToken}, r, generatedToken)
+		// An account registered with this email but never verified may have
+		// been set up by someone else to wait for the owner, so what they
+		// could have left on it goes before Google verifies it.
+		if existing, _ := u.DB.FindOne(bson.M{"email": userModel.Email}, u.GetCollectionName()); existing != nil {
+			if verified, _ := existing["emailVerified"].(bool); !verified {
+				if e := u.releaseUnverifiedAccount(helper.InterfaceToString(existing["_id"])); e != nil {
+					log.Println("Error while releasing unverified account", e)
+					return int(enum.ERROR), "Error while creating user", nil, e
+				}
+			}
+		}
 
-				return int(enum.USER_LOGGED_IN), "", helper.MergeStructAndMap(userModel, map[string]interface{}{"token": generatedToken}), nil
+		// Only the fields Google knows are set, so the password, username and
+		// phone of a verified account stay as they are.
+		returnedUserID := u.DB.UpdateOrCreate(map[string]interface{}{"email": googleUserModel.
+			Firebase.Identities.Email[0]}, bson.M{
+			"email":         userModel.Email,
+			"name":          userModel.Name,
+			"avatar":        userModel.Avatar,
+			"updatedAt":     userModel.UpdatedAt,
+			"emailVerified": true,
+		}, "users")
+		if returnedUserID == nil {
+			log.Println("Error while creating user", returnedUserID)
+			return int(enum.ERROR), "Error while creating user", nil, nil
+		} else {
+			userModel.ID = helper.InterfaceToString(returnedUserID)
+			challenge, trustedDeviceID, factorEr := u.secondFactor(userModel, TwoFactorMethodGoogle, googleLoginBody.FcmToken, googleLoginBody.TrustedDevice, r)
+			if factorEr != nil {
+				log.Println("Error while checking second factor", factorEr)
+				return int(enum.ERROR), "Error while checking second factor", nil, factorEr
 			}
-			// return int(enum.DATA_FETCHED), "", generatedToken, nil
+			if challenge != nil {
+				return int(enum.TWO_FACTOR_REQUIRED), "", challenge, nil
+			}
+			tokens, tokenEr := u.startLogin(userModel, model.LoginModel{FcmKey: googleLoginBody.FcmToken}, r, trustedDeviceID)
+			if tokenEr != nil {
+				log.Println("Error while issuing tokens", tokenEr)
+				return int(enum.ERROR), "Error while issuing tokens", nil, tokenEr
+			}
+
+			return int(enum.USER_LOGGED_IN), "", helper.MergeStructAndMap(userModel, map[string]interface{}{
+				"token":        tokens.AccessToken,
+				"refreshToken": tokens.RefreshToken,
+				"tokenType":    tokens.TokenType,
+				"expiresIn":    tokens.ExpiresIn,
+				"expiresAt":    tokens.ExpiresAt,
+			}), nil
 		}
+		// return int(enum.DATA_FETCHED), "", generatedToken, nil
 	} else {
 		log.Println("Unable to decode request body", decodeErr)
 		return int(enum.ERROR), "Unable to decode request body", nil, decodeErr
 	}
 }
 
-func (u *UserController) HandleLoginActivity(userModel model.User, loginModel model.LoginModel, r *http.Request, token string) {
+// secondFactor starts a two-factor challenge when the user has the second
+// factor on and the login is not from a remembered device. It returns the
+// challenge to send back, or nil and the remembered device's id, if any,
+// when the login can go ahead.
+func (u *UserController) secondFactor(userModel model.User, method string, fcmKey string, trustedDevice string, r *http.Request) (map[string]interface{}, string, error) {
+	twoFactorController := GetControllerInstance(enum.TwoFactorController, enum.MONGODB).(*TwoFactorController)
+	twoFactor, e := twoFactorController.Enabled(userModel.ID)
+	if e != nil || twoFactor == nil {
+		return nil, "", e
+	}
+	if method == TwoFactorMethodGoogle && !twoFactor.RequireForGoogle {
+		return nil, "", nil
+	}
+	trustedDeviceID, e := twoFactorController.TrustedDevice(userModel.ID, trustedDevice)
+	if e != nil || trustedDeviceID != "" {
+		return nil, trustedDeviceID, e
+	}
+	challenge, expiresAt, e := twoFactorController.StartChallenge(userModel.ID, r.Header.Get("sessionId"), method, fcmKey)
+	if e != nil {
+		return nil, "", e
+	}
+	return map[string]interface{}{
+		"challenge": challenge,
+		"expiresAt": expiresAt,
+		"methods":   []string{"code", "recoveryCode"},
+	}, "", nil
+}
+
+// CompleteTwoFactorLogin handles POST /login/2fa: the challenge from Login
+// or GoogleLogin with an authenticator or recovery code. With
+// rememberDevice the response also has a trustedDevice token, which later
+// logins from this device send to skip the code.
+func (u *UserController) CompleteTwoFactorLogin(w http.ResponseWriter, r *http.Request) (int, string, interface{}, error) {
+	loginModel := model.TwoFactorLoginModel{}
+	if e := json.NewDecoder(r.Body).Decode(&loginModel); e != nil {
+		return int(enum.ERROR), "Unable to decode request body", nil, e
+	}
+	twoFactorController := GetControllerInstance(enum.TwoFactorController, enum.MONGODB).(*TwoFactorController)
+	challenge, e := twoFactorController.TakeChallenge(loginModel.Challenge, r.Header.Get("sessionId"))
+	if e != nil {
+		return int(enum.TWO_FACTOR_CHALLENGE_INVALID), e.Error(), nil, e
+	}
+	user, e := u.findUser(challenge.UserID)
+	if e != nil {
+		return int(enum.USER_NOT_FOUND), "", nil, nil
+	}
+	if locked := loginLockedFor(user.Email, r); locked > 0 {
+		return loginLockedResponse(w, locked)
+	}
+	ok, e := twoFactorController.VerifyChallenge(challenge, loginModel.TwoFactorCodeModel)
+	if e != nil {
+		log.Println("Error while verifying second factor", e)
+		return int(enum.ERROR), "Error while verifying second factor", nil, e
+	}
+	if !ok {
+		if locked := loginFailed(user.Email, r); locked > 0 {
+			return loginLockedResponse(w, locked)
+		}
+		return int(enum.TWO_FACTOR_CODE_INVALID), "", nil, nil
+	}
+	loginSucceeded(user.Email, r)
+
+	trustedDevice, trustedDeviceID := "", ""
+	if loginModel.RememberDevice {
+		if trustedDevice, trustedDeviceID, e = twoFactorController.TrustDevice(user.ID, r); e != nil {
+			log.Println("Error while remembering device", e)
+		}
+	}
+	tokens, e := u.startLogin(*user, model.LoginModel{FcmKey: challenge.FcmKey}, r, trustedDeviceID)
+	if e != nil {
+		log.Println("Error while issuing tokens", e)
+		return int(enum.ERROR), "Error while issuing tokens", nil, e
+	}
+	user.Password = ""
+	result := helper.MergeStructAndMap(*tokens, map[string]interface{}{"user": user})
+	if trustedDevice != "" {
+		result["trustedDevice"] = trustedDevice
+	}
+	return int(enum.USER_LOGGED_IN), "", result, nil
+}
+
+// startLogin issues the tokens of a new login and records its activity.
+func (u *UserController) startLogin(userModel model.User, loginModel model.LoginModel, r *http.Request, trustedDeviceID string) (*model.TokenPair, error) {
+	refreshTokenController := GetControllerInstance(enum.RefreshTokenController, enum.MONGODB).(*RefreshTokenController)
+	tokens, familyID, e := refreshTokenController.IssueTokens(userModel.ID, userModel.Email, r.Header.Get("sessionId"))
+	if e != nil {
+		return nil, e
+	}
+	u.HandleLoginActivity(userModel, loginModel, r, tokens.AccessToken, familyID, trustedDeviceID)
+	return tokens, nil
+}
+
+func (u *UserController) HandleLoginActivity(userModel model.User, loginModel model.LoginModel, r *http.Request, token string, tokenFamily string, trustedDeviceID string) {
 	// Construct the query to check for existing loginActivity with the same sessionId and userId
 	sessionId := r.Header.Get("sessionId")
 	query := bson.M{
@@ -230,17 +399,25 @@ func (u *UserController) HandleLoginActivity(userModel model.User, loginModel mo
 	}
 
 	// Prepare the update or insert data
+	now := time.Now()
+	clientIP := GetClientIP(r)
 	update := bson.M{
-		"userId":      userModel.ID,
-		"ip":          r.RemoteAddr,
-		"createdAt":   time.Now(),
-		"fcmKey":      loginModel.FcmKey,
-		"isRider":     false,
-		"isSpectator": false,
-		"deviceName":  "",
-		"token":       token,
-		"email":       userModel.Email,
-		"updatedAt":   time.Now(),
+		"userId":          userModel.ID,
+		"ip":              clientIP,
+		"userAgent":       GetUserAgent(r),
+		"country":         "",
+		"createdAt":       now,
+		"signedInAt":      now,
+		"lastSeenAt":      now,
+		"fcmKey":          loginModel.FcmKey,
+		"isRider":         false,
+		"isSpectator":     false,
+		"deviceName":      "",
+		"token":           token,
+		"tokenFamily":     tokenFamily,
+		"trustedDeviceId": trustedDeviceID,
+		"email":           userModel.Email,
+		"updatedAt":       now,
 	}
 
 	// Call UpdateOrCreate with the constructed query and update data
@@ -249,8 +426,9 @@ func (u *UserController) HandleLoginActivity(userModel model.User, loginModel mo
 	loginActivityController := controller.(*LoginActivityController)
 	res := loginActivityController.DB.UpdateOrCreate(query, update, loginActivityController.GetCollectionName())
 	log.Println("Login Activity", res)
+	go loginActivityController.RecordCountry(query, clientIP)
 
-	redisLoginActivityKey := "login-activity:" + sessionId + ":" + userModel.Email
+	redisLoginActivityKey := loginActivityCacheKey(sessionId, userModel.Email)
 	hours := 2
 	_, e := cache.GetInstance().SetWithExpiry(redisLoginActivityKey, update, hours)
 	if e != nil {
@@ -258,31 +436,6 @@ func (u *UserController) HandleLoginActivity(userModel model.User, loginModel mo
 	}
 }
 
-func GenerateJWT(issuer string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
-	appName := ""
-	if issuer != "" {
-		godotenv.Load()
-		appName = os.Getenv("APP_NAME")
-	} else {
-		appName = issuer
-	}
-	jwtKey := os.Getenv("JWT_KEY")
-	claims := jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(expirationTime),
-		Issuer:    appName,
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(jwtKey))
-
-	if err != nil {
-		return "", err
-	}
-	return tokenString, nil
-}
-
 func (u *UserController) MatchPasswords(password string, hashedPassword string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	if err != nil {
@@ -325,3 +478,555 @@ func (u *UserController) generateSessionID(length int) (string, error) {
 	}
 	return hex.EncodeToString(bytes), nil
 }
+
+const minPasswordLength = 8
+
+var userValidator = newUserValidator()
+
+func newUserValidator() *validator.Validate {
+	v := validator.New()
+	// report fields by their JSON names, which is what clients send
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return strings.Split(field.Tag.Get("json"), ",")[0]
+	})
+	return v
+}
+
+// invalidUserFields checks the validate tags of model.User and returns the
+// fields that fail them.
+func invalidUserFields(user model.User) []string {
+	e := userValidator.Struct(user)
+	if e == nil {
+		return nil
+	}
+	validationErrors := validator.ValidationErrors{}
+	if !errors.As(e, &validationErrors) {
+		return []string{e.Error()}
+	}
+	fields := []string{}
+	for _, fieldError := range validationErrors {
+		fields = append(fields, fieldError.Field())
+	}
+	return fields
+}
+
+// checkNewPassword returns the response code for a password that cannot be
+// used, or 0.
+func checkNewPassword(password string, confirmPassword string) int {
+	if password != confirmPassword {
+		return int(enum.PASSWORD_MISMATCH)
+	}
+	if len(password) < minPasswordLength {
+		return int(enum.PASSWORD_TOO_SHORT)
+	}
+	return 0
+}
+
+func (u *UserController) findUser(userID string) (*model.User, error) {
+	objectId, e := primitive.ObjectIDFromHex(userID)
+	if e != nil {
+		return nil, e
+	}
+	stored, e := u.DB.FindOne(bson.M{"_id": objectId}, u.GetCollectionName())
+	if e != nil {
+		return nil, e
+	}
+	if stored == nil {
+		return nil, errors.New("user not found")
+	}
+	user := model.User{}
+	if e := helper.MapToStruct(stored, &user); e != nil {
+		return nil, e
+	}
+	return &user, nil
+}
+
+func (u *UserController) updateUser(userID string, fields bson.M) error {
+	objectId, e := primitive.ObjectIDFromHex(userID)
+	if e != nil {
+		return e
+	}
+	fields["updatedAt"] = time.Now()
+	_, e = u.DB.Update(bson.M{"_id": objectId}, fields, u.GetCollectionName())
+	return e
+}
+
+// sendAccountEmail mails a user a fresh single-use token of a purpose. The
+// link goes to the web app when APP_BASE_URL is set; the token is in the
+// email either way.
+func (u *UserController) sendAccountEmail(user model.User, purpose string, subject string, intro string, path string) error {
+	transport := mailer.GetInstance()
+	if transport == nil {
+		return errors.New("email is not configured")
+	}
+	accountTokenController := GetControllerInstance(enum.AccountTokenController, enum.MONGODB).(*AccountTokenController)
+	token, e := accountTokenController.Issue(purpose, user.ID, user.Email)
+	if e != nil {
+		return e
+	}
+	body := "Hi " + user.Name + ",\n\n" + intro + "\n\n"
+	if link := mailer.Link(path, "token", token); link != "" {
+		body += link + "\n\n"
+	}
+	body += "Token: " + token + "\n\nIt expires in " + accountTokenTTL(purpose).String() + " and works once. If you did not ask for this, ignore this email.\n"
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return transport.Send(ctx, mailer.Message{To: user.Email, Subject: subject, Body: body})
+}
+
+func (u *UserController) sendVerificationEmail(user model.User) error {
+	return u.sendAccountEmail(user, AccountTokenVerifyEmail, "Verify your email address",
+		"Confirm your email address by opening this link:", "/verify-email")
+}
+
+func (u *UserController) sendPasswordResetEmail(user model.User) error {
+	return u.sendAccountEmail(user, AccountTokenResetPassword, "Reset your password",
+		"Someone asked to reset your password. Choose a new one by opening this link:", "/reset-password")
+}
+
+// endLogins revokes a user's logins, except keepFamily when it is set, and
+// disconnects their sessions other than keepSession.
+func (u *UserController) endLogins(userID string, keepFamily string, keepSession string) error {
+	refreshTokenController := GetControllerInstance(enum.RefreshTokenController, enum.MONGODB).(*RefreshTokenController)
+	revoked, e := refreshTokenController.RevokeUserFamilies(userID, keepFamily)
+	if e != nil {
+		return e
+	}
+	log.Printf("Revoked %d login(s) of user %s", len(revoked), userID)
+	loginActivityController := GetControllerInstance(enum.LoginActivityController, enum.MONGODB).(*LoginActivityController)
+	return loginActivityController.EndLogins(userID, keepFamily, keepSession)
+}
+
+// releaseUnverifiedAccount takes off an unverified account its password,
+// second factor and logins, so whoever registered it cannot get in once the
+// email's owner verifies it by other means.
+func (u *UserController) releaseUnverifiedAccount(userID string) error {
+	objectId, e := primitive.ObjectIDFromHex(userID)
+	if e != nil {
+		return e
+	}
+	if _, e := u.DB.UpdateWithOperators(bson.M{"_id": objectId}, bson.M{
+		"$unset": bson.M{"password": "", "passwordChangedAt": ""},
+	}, u.GetCollectionName()); e != nil {
+		return e
+	}
+	twoFactorController := GetControllerInstance(enum.TwoFactorController, enum.MONGODB).(*TwoFactorController)
+	if e := twoFactorController.Remove(userID); e != nil {
+		return e
+	}
+	return u.endLogins(userID, "", "")
+}
+
+// forgetTrustedDevices makes every device ask for the second factor again,
+// after the password changed.
+func (u *UserController) forgetTrustedDevices(userID string) {
+	twoFactorController := GetControllerInstance(enum.TwoFactorController, enum.MONGODB).(*TwoFactorController)
+	if e := twoFactorController.ForgetDevices(userID); e != nil {
+		log.Println("Error while forgetting trusted devices", e)
+	}
+}
+
+var (
+	loginLockoutOnce     sync.Once
+	loginLockoutObj      *ratelimit.Lockout
+	loginEmailLockoutObj *ratelimit.Lockout
+)
+
+// loginLockouts returns the two lockouts of failed logins. The first locks
+// the logins of an email from one IP after LOGIN_LOCKOUT_ATTEMPTS failures
+// (default 5) within LOGIN_LOCKOUT_MINUTES (default 15), for as long; keying
+// by IP too keeps others from locking a user out. The second caps guessing
+// spread over many IPs: it locks an email everywhere after
+// LOGIN_LOCKOUT_EMAIL_ATTEMPTS failures (default 100) in the same window.
+// That one can be used to lock a user out, by anyone with enough IPs to get
+// past it 5 failures at a time (20 by default), so it is kept well above
+// what a user mistyping ever reaches and only bounds how fast a password can
+// be guessed.
+func loginLockouts() (*ratelimit.Lockout, *ratelimit.Lockout) {
+	loginLockoutOnce.Do(func() {
+		attempts, emailAttempts, minutes := 5, 100, 15
+		if configured, e := strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_ATTEMPTS")); e == nil && configured > 0 {
+			attempts = configured
+		}
+		if configured, e := strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_EMAIL_ATTEMPTS")); e == nil && configured > 0 {
+			emailAttempts = configured
+		}
+		if configured, e := strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_MINUTES")); e == nil && configured > 0 {
+			minutes = configured
+		}
+		store := ratelimit.NewStore()
+		loginLockoutObj = &ratelimit.Lockout{
+			Name:     "login",
+			Failures: attempts,
+			Window:   time.Duration(minutes) * time.Minute,
+			Lock:     time.Duration(minutes) * time.Minute,
+			Store:    store,
+		}
+		loginEmailLockoutObj = &ratelimit.Lockout{
+			Name:     "login-email",
+			Failures: emailAttempts,
+			Window:   time.Duration(minutes) * time.Minute,
+			Lock:     time.Duration(minutes) * time.Minute,
+			Store:    store,
+		}
+	})
+	return loginLockoutObj, loginEmailLockoutObj
+}
+
+type loginLockoutKey struct {
+	lockout *ratelimit.Lockout
+	key     string
+}
+
+// loginLockoutKeys returns what a login of email from the client of r counts
+// against: the email from that IP, and the email.
+func loginLockoutKeys(email string, r *http.Request) []loginLockoutKey {
+	byIP, byEmail := loginLockouts()
+	email = strings.ToLower(strings.TrimSpace(email))
+	return []loginLockoutKey{
+		{byIP, email + ":" + TrustedClientIP(r)},
+		{byEmail, email},
+	}
+}
+
+// loginLockedFor returns how long logins of email from the client of r are
+// locked. Logins are not locked when the lockout store fails.
+func loginLockedFor(email string, r *http.Request) time.Duration {
+	locked := time.Duration(0)
+	for _, counted := range loginLockoutKeys(email, r) {
+		lockedFor, e := counted.lockout.LockedFor(r.Context(), counted.key)
+		if e != nil {
+			log.Println("Error while checking login lockout", e)
+		}
+		locked = max(locked, lockedFor)
+	}
+	return locked
+}
+
+// loginFailed counts a failed login and returns how long it locked logins
+// for, or zero.
+func loginFailed(email string, r *http.Request) time.Duration {
+	locked := time.Duration(0)
+	for _, counted := range loginLockoutKeys(email, r) {
+		lockedFor, e := counted.lockout.Fail(r.Context(), counted.key)
+		if e != nil {
+			log.Println("Error while counting failed login", e)
+		}
+		if lockedFor > 0 {
+			log.Printf("Locked %s logins of %s for %s", counted.lockout.Name, counted.key, lockedFor)
+		}
+		locked = max(locked, lockedFor)
+	}
+	return locked
+}
+
+// loginSucceeded forgets the failures from the client of r. Failures of the
+// email from other IPs still count, so one good login does not reset
+// guessing spread over many IPs.
+func loginSucceeded(email string, r *http.Request) {
+	counted := loginLockoutKeys(email, r)[0]
+	if e := counted.lockout.Succeed(r.Context(), counted.key); e != nil {
+		log.Println("Error while clearing failed logins", e)
+	}
+}
+
+// loginLockedResponse answers a locked login with when to try again.
+func loginLockedResponse(w http.ResponseWriter, locked time.Duration) (int, string, interface{}, error) {
+	retryAfter := int(math.Ceil(locked.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	return int(enum.LOGIN_LOCKED), "", map[string]interface{}{"retryAfter": retryAfter}, nil
+}
+
+// ResendVerification handles POST /email/verification for the logged in user.
+func (u *UserController) ResendVerification(w http.ResponseWriter, r *http.Request) (int, string, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.NOT_LOGGED_IN), "", nil, nil
+	}
+	user, e := u.findUser(claims.Subject)
+	if e != nil {
+		return int(enum.USER_NOT_FOUND), "", nil, nil
+	}
+	if user.EmailVerified {
+		return int(enum.EMAIL_ALREADY_VERIFIED), "", nil, nil
+	}
+	if e := u.sendVerificationEmail(*user); e != nil {
+		log.Println("Error while sending verification email", e)
+		return int(enum.VERIFICATION_EMAIL_NOT_SENT), "Unable to send verification email", nil, e
+	}
+	return int(enum.VERIFICATION_EMAIL_SENT), "", nil, nil
+}
+
+// VerifyEmail handles POST /email/verify with a token from a verification
+// email.
+func (u *UserController) VerifyEmail(w http.ResponseWriter, r *http.Request) (int, string, interface{}, error) {
+	tokenModel := model.AccountTokenModel{}
+	if e := json.NewDecoder(r.Body).Decode(&tokenModel); e != nil {
+		return int(enum.ERROR), "Unable to decode request body", nil, e
+	}
+	accountTokenController := GetControllerInstance(enum.AccountTokenController, enum.MONGODB).(*AccountTokenController)
+	token, e := accountTokenController.Consume(AccountTokenVerifyEmail, tokenModel.Token)
+	if e != nil {
+		return int(enum.EMAIL_NOT_VERIFIED), e.Error(), nil, e
+	}
+	if e := u.updateUser(token.UserID, bson.M{"emailVerified": true}); e != nil {
+		log.Println("Error while verifying email", e)
+		return int(enum.EMAIL_NOT_VERIFIED), "Unable to verify email", nil, e
+	}
+	return int(enum.EMAIL_VERIFIED), "", nil, nil
+}
+
+// ForgotPassword handles POST /password/forgot. The answer is the same
+// whether or not the email is registered, and the email is sent in the
+// background so timing does not tell either.
+func (u *UserController) ForgotPassword(w http.ResponseWriter, r *http.Request) (int, string, interface{}, error) {
+	forgotModel := model.ForgotPasswordModel{}
+	if e := json.NewDecoder(r.Body).Decode(&forgotModel); e != nil {
+		return int(enum.ERROR), "Unable to decode request body", nil, e
+	}
+	stored, _ := u.DB.FindOne(map[string]interface{}{"email": strings.TrimSpace(forgotModel.Email)}, u.GetCollectionName())
+	if stored != nil {
+		user := model.User{}
+		if e := helper.MapToStruct(stored, &user); e == nil {
+			go func() {
+				if e := u.sendPasswordResetEmail(user); e != nil {
+					log.Println("Error while sending password reset email", e)
+				}
+			}()
+		}
+	}
+	return int(enum.PASSWORD_RESET_REQUESTED), "", nil, nil
+}
+
+// ResetPassword handles POST /password/reset with a token from a reset
+// email. Every login of the user ends; the email counts as verified since
+// the user received it.
+func (u *UserController) ResetPassword(w http.ResponseWriter, r *http.Request) (int, string, interface{}, error) {
+	resetModel := model.ResetPasswordModel{}
+	if e := json.NewDecoder(r.Body).Decode(&resetModel); e != nil {
+		return int(enum.ERROR), "Unable to decode request body", nil, e
+	}
+	if code := checkNewPassword(resetModel.Password, resetModel.ConfirmPassword); code != 0 {
+		return code, "", nil, nil
+	}
+	accountTokenController := GetControllerInstance(enum.AccountTokenController, enum.MONGODB).(*AccountTokenController)
+	token, e := accountTokenController.Consume(AccountTokenResetPassword, resetModel.Token)
+	if e != nil {
+		return int(enum.PASSWORD_NOT_RESET), e.Error(), nil, e
+	}
+	if e := u.setPassword(token.UserID, resetModel.Password, bson.M{"emailVerified": true}); e != nil {
+		log.Println("Error while resetting password", e)
+		return int(enum.PASSWORD_NOT_RESET), "Unable to reset password", nil, e
+	}
+	if e := u.endLogins(token.UserID, "", ""); e != nil {
+		log.Println("Error while ending logins after password reset", e)
+	}
+	u.forgetTrustedDevices(token.UserID)
+	return int(enum.PASSWORD_RESET), "", nil, nil
+}
+
+// ChangePassword handles POST /password/change for the logged in user. The
+// user's other logins end; the current one stays.
+func (u *UserController) ChangePassword(w http.ResponseWriter, r *http.Request) (int, string, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.NOT_LOGGED_IN), "", nil, nil
+	}
+	changeModel := model.ChangePasswordModel{}
+	if e := json.NewDecoder(r.Body).Decode(&changeModel); e != nil {
+		return int(enum.ERROR), "Unable to decode request body", nil, e
+	}
+	if code := checkNewPassword(changeModel.Password, changeModel.ConfirmPassword); code != 0 {
+		return code, "", nil, nil
+	}
+	user, e := u.findUser(claims.Subject)
+	if e != nil {
+		return int(enum.USER_NOT_FOUND), "", nil, nil
+	}
+	// accounts created with Google have no password to confirm yet
+	if user.Password != "" && !u.MatchPasswords(changeModel.CurrentPassword, user.Password) {
+		return int(enum.INVALID_PASSWORD), "", nil, nil
+	}
+	if e := u.setPassword(claims.Subject, changeModel.Password, bson.M{}); e != nil {
+		log.Println("Error while changing password", e)
+		return int(enum.PASSWORD_NOT_CHANGED), "Unable to change password", nil, e
+	}
+	if e := u.endLogins(claims.Subject, claims.FamilyID, claims.SessionID); e != nil {
+		log.Println("Error while ending logins after password change", e)
+	}
+	u.forgetTrustedDevices(claims.Subject)
+	return int(enum.PASSWORD_CHANGED), "", nil, nil
+}
+
+func (u *UserController) setPassword(userID string, password string, fields bson.M) error {
+	hashedPassword, e := hashPassword(password)
+	if e != nil {
+		return e
+	}
+	fields["password"] = hashedPassword
+	fields["passwordChangedAt"] = time.Now()
+	return u.updateUser(userID, fields)
+}
+
+// GetProfile handles GET /profile.
+func (u *UserController) GetProfile(w http.ResponseWriter, r *http.Request) (int, string, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.NOT_LOGGED_IN), "", nil, nil
+	}
+	user, e := u.findUser(claims.Subject)
+	if e != nil {
+		return int(enum.USER_NOT_FOUND), "", nil, nil
+	}
+	user.Password = ""
+	return int(enum.USER_FETCHED), "", helper.MergeStructAndMap(*user, map[string]interface{}{"grantedPermissions": userPermissions(*user)}), nil
+}
+
+// UpdateProfile handles PUT /profile. Only name, avatar and phone can be
+// changed; fields left out of the body keep their value.
+func (u *UserController) UpdateProfile(w http.ResponseWriter, r *http.Request) (int, string, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.NOT_LOGGED_IN), "", nil, nil
+	}
+	profileModel := model.ProfileUpdateModel{}
+	if e := json.NewDecoder(r.Body).Decode(&profileModel); e != nil {
+		return int(enum.ERROR), "Unable to decode request body", nil, e
+	}
+	fields := bson.M{}
+	if profileModel.Name != nil {
+		name := strings.TrimSpace(*profileModel.Name)
+		if name == "" {
+			return int(enum.PROFILE_NOT_UPDATED), "Name cannot be empty", nil, errors.New("name cannot be empty")
+		}
+		fields["name"] = name
+	}
+	if profileModel.Avatar != nil {
+		fields["avatar"] = strings.TrimSpace(*profileModel.Avatar)
+	}
+	if profileModel.Phone != nil {
+		fields["phone"] = strings.TrimSpace(*profileModel.Phone)
+	}
+	if len(fields) == 0 {
+		return int(enum.PROFILE_NOT_UPDATED), "Nothing to update", nil, errors.New("nothing to update")
+	}
+	if e := u.updateUser(claims.Subject, fields); e != nil {
+		log.Println("Error while updating profile", e)
+		return int(enum.PROFILE_NOT_UPDATED), "Unable to update profile", nil, e
+	}
+	user, e := u.findUser(claims.Subject)
+	if e != nil {
+		return int(enum.USER_NOT_FOUND), "", nil, nil
+	}
+	user.Password = ""
+	return int(enum.PROFILE_UPDATED), "", user, nil
+}
+
+// userPermissions is everything a user's roles and grants allow. Verified
+// users listed in ADMIN_EMAILS are admins as well.
+func userPermissions(user model.User) []string {
+	roles := user.Roles
+	if user.EmailVerified && auth.IsBootstrapAdmin(user.Email) {
+		roles = append([]string{auth.RoleAdmin}, roles...)
+	}
+	return auth.Permissions(roles, user.Permissions)
+}
+
+// Permissions returns what a user is allowed to do. It is read on every
+// request to a guarded route, so role changes apply right away.
+func (u *UserController) Permissions(userID string) ([]string, error) {
+	user, e := u.findUser(userID)
+	if e != nil {
+		return nil, e
+	}
+	return userPermissions(*user), nil
+}
+
+// findUserBy looks a user up by id, or by email when no id is given.
+func (u *UserController) findUserBy(userID string, email string) (*model.User, error) {
+	if userID != "" {
+		return u.findUser(userID)
+	}
+	stored, e := u.DB.FindOne(bson.M{"email": strings.TrimSpace(email)}, u.GetCollectionName())
+	if e != nil {
+		return nil, e
+	}
+	if stored == nil {
+		return nil, errors.New("user not found")
+	}
+	user := model.User{}
+	if e := helper.MapToStruct(stored, &user); e != nil {
+		return nil, e
+	}
+	return &user, nil
+}
+
+func userRoles(user model.User) map[string]interface{} {
+	return map[string]interface{}{
+		"userId":             user.ID,
+		"email":              user.Email,
+		"roles":              user.Roles,
+		"permissions":        user.Permissions,
+		"grantedPermissions": userPermissions(user),
+	}
+}
+
+// ListRoles handles GET /admin/roles: every role and its permissions.
+func (u *UserController) ListRoles(w http.ResponseWriter, r *http.Request) (int, string, interface{}, error) {
+	return int(enum.ROLES_FETCHED), "", auth.Roles(), nil
+}
+
+// GetUserRoles handles GET /admin/user/roles?userId= (or ?email=).
+func (u *UserController) GetUserRoles(w http.ResponseWriter, r *http.Request) (int, string, interface{}, error) {
+	user, e := u.findUserBy(r.URL.Query().Get("userId"), r.URL.Query().Get("email"))
+	if e != nil {
+		return int(enum.USER_NOT_FOUND), "", nil, nil
+	}
+	return int(enum.ROLES_FETCHED), "", userRoles(*user), nil
+}
+
+// SetUserRoles handles PUT /admin/user/roles: replaces a user's roles and
+// extra permissions. Admins cannot take the right to manage roles away from
+// themselves, so there is always someone left who can.
+func (u *UserController) SetUserRoles(w http.ResponseWriter, r *http.Request) (int, string, interface{}, error) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return int(enum.NOT_LOGGED_IN), "", nil, nil
+	}
+	rolesModel := model.UserRolesModel{}
+	if e := json.NewDecoder(r.Body).Decode(&rolesModel); e != nil {
+		return int(enum.ERROR), "Unable to decode request body", nil, e
+	}
+	for _, role := range rolesModel.Roles {
+		if !auth.IsRole(role) {
+			return int(enum.ROLE_INVALID), "Unknown role " + role, nil, errors.New("unknown role")
+		}
+	}
+	for _, permission := range rolesModel.Permissions {
+		if !auth.IsPermission(permission) {
+			return int(enum.ROLE_INVALID), "Unknown permission " + permission, nil, errors.New("unknown permission")
+		}
+	}
+	user, e := u.findUserBy(rolesModel.UserID, rolesModel.Email)
+	if e != nil {
+		return int(enum.USER_NOT_FOUND), "", nil, nil
+	}
+
+	user.Roles = rolesModel.Roles
+	user.Permissions = rolesModel.Permissions
+	if user.ID == claims.Subject && !auth.HasPermission(userPermissions(*user), auth.PermissionRolesManage) {
+		return int(enum.ROLES_NOT_UPDATED), "You cannot remove your own right to manage roles", nil, errors.New("cannot remove own role management")
+	}
+	if user.Roles == nil {
+		user.Roles = []string{}
+	}
+	if user.Permissions == nil {
+		user.Permissions = []string{}
+	}
+	if e := u.updateUser(user.ID, bson.M{"roles": user.Roles, "permissions": user.Permissions}); e != nil {
+		log.Println("Error while updating roles", e)
+		return int(enum.ROLES_NOT_UPDATED), "Unable to update roles", nil, e
+	}
+	log.Printf("User %s set the roles of user %s to %v and permissions to %v", claims.Subject, user.ID, user.Roles, user.Permissions)
+	return int(enum.ROLES_UPDATED), "", userRoles(*user), nil
+}
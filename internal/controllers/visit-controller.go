@@ -226,6 +226,74 @@ func GetClientIP(r *http.Request) string {
 	return strings.TrimSpace(r.RemoteAddr)
 }
 
+// trustedProxies reads TRUSTED_PROXIES, a comma separated list of IPs and
+// CIDRs of the proxies in front of the gateway.
+func trustedProxies() []*net.IPNet {
+	proxies := []*net.IPNet{}
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		if _, network, e := net.ParseCIDR(entry); e == nil {
+			proxies = append(proxies, network)
+		} else {
+			log.Printf("Ignoring trusted proxy %q: %v", entry, e)
+		}
+	}
+	return proxies
+}
+
+func isTrustedProxy(proxies []*net.IPNet, address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustedClientIP returns the IP a request came from, for limits and
+// lockouts a client must not get around. Unlike GetClientIP it only believes
+// X-Forwarded-For and X-Real-IP when the connection comes from one of the
+// TRUSTED_PROXIES; the client is then the right-most forwarded address that
+// is not a trusted proxy itself.
+func TrustedClientIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
+	if err != nil {
+		remote = strings.TrimSpace(r.RemoteAddr)
+	}
+	proxies := trustedProxies()
+	if !isTrustedProxy(proxies, remote) {
+		return remote
+	}
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		address := strings.TrimSpace(forwarded[i])
+		if address == "" {
+			continue
+		}
+		if !isTrustedProxy(proxies, address) || i == 0 {
+			return address
+		}
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		return realIP
+	}
+	return remote
+}
+
 func GetUserAgent(r *http.Request) string {
 	return strings.TrimSpace(r.Header.Get("User-Agent"))
 }
@@ -32,6 +32,8 @@ type DBInterface interface {
 	ValidateIndexing(string, interface{}) error
 	ValidateUniqueIndexing(string, interface{}) error
 	ValidateIndexingTTL(string, bson.D, int) error
+	//Creates a named text index over the given fields if it does not already exist.
+	ValidateTextIndexing(string, string, bson.D) error
 	//Fetches the single most recent document from the collection based on the query.
 	FindRecentDocument(query interface{}, collectionName string) (interface{}, error)
 	FindAllWithPagination(interface{}, int, string) (int64, int, []bson.M, error)
@@ -417,6 +417,39 @@ func (m *MongoDB) ValidateIndexingTTL(collectionName string, indexKeys bson.D, t
 	return nil
 }
 
+func (m *MongoDB) ValidateTextIndexing(collectionName string, indexName string, indexKeys bson.D) error {
+	conn := GetConnectionFromPool()
+	defer ReleaseConnectionToPool(conn)
+	collection := conn.db.Collection(collectionName)
+	indexView, err := collection.Indexes().List(context.Background())
+	if err != nil {
+		log.Println("Error while fetching indexes: ", err)
+		return err
+	}
+	for indexView.Next(context.Background()) {
+		var index bson.M
+		if err := indexView.Decode(&index); err != nil {
+			log.Println("Error while decoding index: ", err)
+			return err
+		}
+		if index["name"] == indexName {
+			return nil
+		}
+	}
+
+	// Mongo allows a single text index per collection, so it is always created under a fixed name
+	indexModel := mongo.IndexModel{
+		Keys:    indexKeys,
+		Options: options.Index().SetName(indexName),
+	}
+	_, createErr := collection.Indexes().CreateOne(context.Background(), indexModel)
+	if createErr != nil {
+		log.Println("Error while creating text index: ", createErr)
+		return createErr
+	}
+	return nil
+}
+
 func getIndexName(indexKeys bson.D) string {
 	var name string
 	for _, key := range indexKeys {
@@ -99,4 +99,88 @@ const (
 	ROOM_NOT_UPDATED
 	VISITS_FETCHED
 	VISITS_NOT_FETCHED
+	ROOM_MESSAGE_UPDATED
+	ROOM_MESSAGE_NOT_UPDATED
+	ROOM_MESSAGE_DELETED
+	ROOM_MESSAGE_NOT_DELETED
+	ROOM_MESSAGE_NOT_FOUND
+	DEVICE_COMMAND_SENT
+	DEVICE_COMMAND_NOT_SENT
+	DEVICE_COMMAND_FOUND
+	DEVICE_COMMAND_NOT_FOUND
+	DEVICE_COMMANDS_FOUND
+	DEVICE_COMMAND_INVALID
+	DEVICE_SCHEDULE_UPDATED
+	DEVICE_SCHEDULE_NOT_UPDATED
+	DEVICE_SCHEDULE_INVALID
+	SCREENSHOTS_FOUND
+	SCREENSHOTS_NOT_FOUND
+	DEVICE_UPTIME_FOUND
+	DEVICE_WATCH_UPDATED
+	DEVICE_WATCH_NOT_UPDATED
+	DEVICE_METRICS_FOUND
+	DEVICE_METRICS_NOT_FOUND
+	DEVICE_ENROLLED
+	DEVICE_NOT_ENROLLED
+	DEVICE_TOKEN_REVOKED
+	DEVICE_TOKEN_NOT_REVOKED
+	DOWNLOAD_FOUND
+	DOWNLOAD_NOT_FOUND
+	DOWNLOADS_FOUND
+	DOWNLOAD_CANCELLED
+	DOWNLOAD_NOT_CANCELLED
+	ATTACHMENT_UPLOADED
+	ATTACHMENT_NOT_UPLOADED
+	DOWNLOAD_OPTIONS_INVALID
+	DOWNLOAD_BATCH_CREATED
+	DOWNLOAD_BATCH_NOT_CREATED
+	DOWNLOAD_BATCH_FOUND
+	DOWNLOAD_BATCH_NOT_FOUND
+	DOWNLOAD_BATCH_CANCELLED
+	DOWNLOAD_BATCH_NOT_CANCELLED
+	DEVICE_OWNED_BY_ANOTHER_USER
+	TOKEN_REFRESHED
+	TOKEN_NOT_REFRESHED
+	REFRESH_TOKEN_REUSED
+	ACCESS_TOKEN_INVALID
+	ACCESS_TOKEN_EXPIRED
+	EMAIL_VERIFIED
+	EMAIL_NOT_VERIFIED
+	EMAIL_ALREADY_VERIFIED
+	VERIFICATION_EMAIL_SENT
+	VERIFICATION_EMAIL_NOT_SENT
+	PASSWORD_RESET_REQUESTED
+	PASSWORD_RESET
+	PASSWORD_NOT_RESET
+	PASSWORD_CHANGED
+	PASSWORD_NOT_CHANGED
+	PASSWORD_TOO_SHORT
+	PROFILE_UPDATED
+	PROFILE_NOT_UPDATED
+	REGISTRATION_INVALID
+	USERNAME_EXISTS
+	TWO_FACTOR_REQUIRED
+	TWO_FACTOR_CHALLENGE_INVALID
+	TWO_FACTOR_CODE_INVALID
+	TWO_FACTOR_STATUS_FETCHED
+	TWO_FACTOR_SETUP_STARTED
+	TWO_FACTOR_ENABLED
+	TWO_FACTOR_DISABLED
+	TWO_FACTOR_ALREADY_ENABLED
+	TWO_FACTOR_NOT_ENABLED
+	TWO_FACTOR_UPDATED
+	RECOVERY_CODES_GENERATED
+	TRUSTED_DEVICES_FORGOTTEN
+	SESSION_REVOKED
+	SESSION_NOT_REVOKED
+	SESSIONS_REVOKED
+	LOGIN_SESSION_NOT_FOUND
+	PERMISSION_DENIED
+	ROLES_FETCHED
+	ROLES_UPDATED
+	ROLES_NOT_UPDATED
+	ROLE_INVALID
+	RATE_LIMITED
+	LOGIN_LOCKED
+	TWO_FACTOR_UNAVAILABLE
 )
@@ -5,4 +5,45 @@ type CaptureScreenEnum int
 const (
 	CAPTURE_SCREEN CaptureScreenEnum = iota
 	PING_DEVICE
-)
\ No newline at end of file
+)
+
+type CaptureMissedRunPolicy string
+
+const (
+	// Drop runs that could not be delivered and wait for the next slot.
+	MISSED_RUN_SKIP CaptureMissedRunPolicy = "skip"
+	// Deliver a single catch-up capture as soon as the device is reachable.
+	MISSED_RUN_CATCH_UP CaptureMissedRunPolicy = "catch-up"
+)
+
+type CaptureRunStatus string
+
+const (
+	CAPTURE_RUN_SENT          CaptureRunStatus = "sent"
+	CAPTURE_RUN_MISSED        CaptureRunStatus = "missed"
+	CAPTURE_RUN_CAUGHT_UP     CaptureRunStatus = "caught-up"
+	CAPTURE_RUN_OUTSIDE_HOURS CaptureRunStatus = "skipped-outside-active-hours"
+	CAPTURE_RUN_USER_INACTIVE CaptureRunStatus = "skipped-user-inactive"
+)
+
+type DeviceStatusReason string
+
+const (
+	// The device sent a ping or capture after being offline.
+	DEVICE_HEARTBEAT_RESUMED DeviceStatusReason = "heartbeat-resumed"
+	// No ping or capture arrived within the offline threshold.
+	DEVICE_HEARTBEAT_TIMEOUT DeviceStatusReason = "heartbeat-timeout"
+	// Nobody was listening on the device's Redis channel.
+	DEVICE_PUBLISH_FAILED DeviceStatusReason = "publish-failed"
+)
+
+// Broker topic used by the API gateway to report devices it marked offline to
+// the SSE service.
+const DEVICE_STATUS_CHANGED_TOPIC = "device-status-changed"
+
+type DeviceMetricName string
+
+const (
+	DEVICE_METRIC_MEMORY DeviceMetricName = "memory"
+	DEVICE_METRIC_DISK   DeviceMetricName = "disk"
+)
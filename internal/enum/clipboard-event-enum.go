@@ -0,0 +1,14 @@
+package enum
+
+type ClipboardMessageEvent string
+
+const (
+	CLIPBOARD_MESSAGE_EDITED  ClipboardMessageEvent = "roomMessageEdited"
+	CLIPBOARD_MESSAGE_DELETED ClipboardMessageEvent = "roomMessageDeleted"
+	CLIPBOARD_MESSAGE_PINNED  ClipboardMessageEvent = "roomMessagePinned"
+	CLIPBOARD_MESSAGE_REACTED ClipboardMessageEvent = "roomMessageReacted"
+)
+
+// Broker topic used by the API gateway to hand REST-originated message changes
+// to the socket service for broadcasting.
+const CLIPBOARD_MESSAGE_UPDATED_TOPIC = "clipboard-message-updated"
@@ -19,4 +19,15 @@ const (
 	ScraperConfigController
 	FileExtensionController
 	VisitController
+	DeviceCommandController
+	ScreenshotController
+	DeviceMetricController
+	DeviceCredentialController
+	DownloadJobController
+	ArtifactExpiryController
+	DownloadBatchController
+	RefreshTokenController
+	SigningKeyController
+	AccountTokenController
+	TwoFactorController
 )
@@ -0,0 +1,26 @@
+package enum
+
+type DeviceCommandType string
+
+const (
+	LOCK_SCREEN          DeviceCommandType = "lock-screen"
+	RUN_SCRIPT           DeviceCommandType = "run-script"
+	COLLECT_LOGS         DeviceCommandType = "collect-logs"
+	SET_CAPTURE_INTERVAL DeviceCommandType = "set-capture-interval"
+	UPDATE_CONFIG        DeviceCommandType = "update-config"
+)
+
+type DeviceCommandStatus string
+
+const (
+	COMMAND_QUEUED       DeviceCommandStatus = "queued"
+	COMMAND_SENT         DeviceCommandStatus = "sent"
+	COMMAND_ACKNOWLEDGED DeviceCommandStatus = "acknowledged"
+	COMMAND_SUCCEEDED    DeviceCommandStatus = "succeeded"
+	COMMAND_FAILED       DeviceCommandStatus = "failed"
+	COMMAND_TIMED_OUT    DeviceCommandStatus = "timed-out"
+)
+
+// Broker topic used by the gRPC gateway to hand command results reported by
+// device agents to the SSE service.
+const DEVICE_COMMAND_RESULT_TOPIC = "device-command-result"
@@ -0,0 +1,5 @@
+package enum
+
+// Broker topic the API gateway publishes when logins are signed out, so the
+// socket and SSE services disconnect the sessions they belonged to.
+const SESSION_REVOKED_TOPIC = "session-revoked"
@@ -7,4 +7,23 @@ const (
 	DOWNLOADING = "downloading"
 	PROCESSING  = "processing"
 	COMPLETED   = "completed"
+	// Terminal failure after the last attempt; clients already treat "error"
+	// as failed.
+	DOWNLOAD_FAILED = "error"
+	CANCELLED       = "cancelled"
 )
+
+// Broker topic the API gateway publishes when a download is cancelled.
+const DOWNLOAD_CANCELLED_TOPIC = "cancel-yt-video"
+
+// Batch download statuses, next to the job statuses above. A batch ends as
+// COMPLETED, BATCH_PARTIAL (some items failed), DOWNLOAD_FAILED or CANCELLED.
+const (
+	BATCH_RESOLVING  = "resolving"
+	BATCH_RUNNING    = "running"
+	BATCH_FINALIZING = "finalizing"
+	BATCH_PARTIAL    = "partial"
+)
+
+// Broker topic the API gateway publishes when a batch download is created.
+const DOWNLOAD_BATCH_TOPIC = "process-yt-batch"
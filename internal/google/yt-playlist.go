@@ -0,0 +1,79 @@
+package google
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PlaylistEntry is one video of a playlist.
+type PlaylistEntry struct {
+	VideoID string
+	Title   string
+}
+
+// ResolvePlaylist lists up to limit videos of a playlist without downloading
+// anything and returns the playlist title with them.
+func ResolvePlaylist(ctx context.Context, playlistURL string, limit int) (string, []PlaylistEntry, error) {
+	cmd, err := buildYtDlpCmd(
+		"--flat-playlist",
+		"--dump-single-json",
+		"--no-warnings",
+		"--playlist-end", strconv.Itoa(limit),
+		playlistURL,
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return "", nil, fmt.Errorf("start yt-dlp: %v", err)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			cmd.Process.Kill()
+		case <-finished:
+		}
+	}()
+	err = cmd.Wait()
+	close(finished)
+	if ctx.Err() != nil {
+		return "", nil, ctx.Err()
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to read playlist: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	playlist := struct {
+		Title   string `json:"title"`
+		Entries []struct {
+			ID    string `json:"id"`
+			Title string `json:"title"`
+		} `json:"entries"`
+	}{}
+	if err := json.Unmarshal(stdout.Bytes(), &playlist); err != nil {
+		return "", nil, fmt.Errorf("unexpected yt-dlp output: %v", err)
+	}
+	entries := make([]PlaylistEntry, 0, len(playlist.Entries))
+	for _, entry := range playlist.Entries {
+		if entry.ID == "" {
+			continue
+		}
+		entries = append(entries, PlaylistEntry{VideoID: entry.ID, Title: entry.Title})
+		if len(entries) == limit {
+			break
+		}
+	}
+	if len(entries) == 0 {
+		return playlist.Title, nil, fmt.Errorf("playlist has no videos")
+	}
+	return playlist.Title, entries, nil
+}
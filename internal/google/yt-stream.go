@@ -14,6 +14,9 @@ import (
 	"sync"
 )
 
+// DownloadDir is where yt-dlp writes downloads before they are uploaded.
+const DownloadDir = "/tmp/yt-downloads"
+
 type StreamSession struct {
 	filePath string
 	fileSize int64
@@ -85,12 +88,21 @@ func (yt *StreamSession) runYtDlp(cmd *exec.Cmd, progressCallback ProgressCallba
 		progressCallback(10) // 10% indicates yt-dlp has started
 	}
 
+	yt.mu.Lock()
+	if yt.ctx.Err() != nil {
+		yt.mu.Unlock()
+		yt.done <- fmt.Errorf("download cancelled")
+		close(yt.done)
+		return
+	}
 	if err := cmd.Start(); err != nil {
+		yt.mu.Unlock()
 		logger.Printf("start yt-dlp: %v", err)
 		yt.done <- err
 		close(yt.done)
 		return
 	}
+	yt.mu.Unlock()
 	var stderrBuf bytes.Buffer
 	go func() {
 		scanner := bufio.NewScanner(stderror)
@@ -121,6 +133,11 @@ func (yt *StreamSession) runYtDlp(cmd *exec.Cmd, progressCallback ProgressCallba
 	}()
 
 	if err := yt.cmd.Wait(); err != nil {
+		if yt.ctx.Err() != nil {
+			yt.done <- fmt.Errorf("download cancelled")
+			close(yt.done)
+			return
+		}
 		logger.Printf(" yt-dlp exited with error: %v", err)
 		logger.Printf("STDERR: %s", stderrBuf.String())
 		yt.done <- fmt.Errorf("yt-dlp failed: %w", err)
@@ -129,15 +146,15 @@ func (yt *StreamSession) runYtDlp(cmd *exec.Cmd, progressCallback ProgressCallba
 	}
 
 	// Locate actual output file (handles cases like mp4.mp3 produced by post-processing)
-	pattern := fmt.Sprintf("/tmp/yt-downloads/%s_%s*", videoTitle, videoId)
+	pattern := fmt.Sprintf("%s/%s_%s*", DownloadDir, videoTitle, videoId)
 	logger.Printf(" Searching for files matching: %s", pattern)
 
 	matches, gerr := filepath.Glob(pattern)
 	if gerr != nil || len(matches) == 0 {
 		logger.Printf(" No files found matching pattern")
 		// List directory contents for debugging
-		files, _ := os.ReadDir("/tmp/yt-downloads")
-		logger.Printf(" Files in /tmp/yt-downloads:")
+		files, _ := os.ReadDir(DownloadDir)
+		logger.Printf(" Files in %s:", DownloadDir)
 		for _, f := range files {
 			if info, err := f.Info(); err == nil {
 				logger.Printf("   - %s (size: %d)", f.Name(), info.Size())
@@ -180,6 +197,20 @@ func (yt *StreamSession) Wait() error {
 	return err
 }
 
+// Cancel stops the download, killing yt-dlp if it is already running. Wait
+// then returns a "download cancelled" error.
+func (yt *StreamSession) Cancel() {
+	if yt == nil {
+		return
+	}
+	yt.mu.Lock()
+	defer yt.mu.Unlock()
+	yt.cancel()
+	if yt.cmd != nil && yt.cmd.Process != nil {
+		yt.cmd.Process.Kill()
+	}
+}
+
 // GetFilePath returns the downloaded file path
 func (yt *StreamSession) GetFilePath() string {
 	yt.mu.RLock()
@@ -210,8 +241,7 @@ func validateAndBuild(binPath string, args []string) (*exec.Cmd, error) {
 
 func DownloadYoutubeVideoToBuffer(videoLink string, videoId string, format string, quality string, bitRate string, videoTitle string, progressCallback ProgressCallback) (*StreamSession, error) {
 
-	downloadDir := "/tmp/yt-downloads"
-	if err := os.MkdirAll(downloadDir, 0755); err != nil {
+	if err := os.MkdirAll(DownloadDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create download dir: %w", err)
 	}
 
@@ -241,7 +271,7 @@ func DownloadYoutubeVideoToBuffer(videoLink string, videoId string, format strin
 			"--extract-audio",
 			"--audio-format", "mp3",
 			"--audio-quality", getBitrate(bitRate),
-			"--output", fmt.Sprintf("/tmp/yt-downloads/%s_%s.%%(ext)s", videoTitle, videoId),
+			"--output", fmt.Sprintf("%s/%s_%s.%%(ext)s", DownloadDir, videoTitle, videoId),
 			videoURL,
 		}, commonArgs...)
 	} else {
@@ -249,7 +279,7 @@ func DownloadYoutubeVideoToBuffer(videoLink string, videoId string, format strin
 		// Use progressive format for better stdout streaming
 		args = append([]string{
 			"--format", formatStr,
-			"--output", fmt.Sprintf("/tmp/yt-downloads/%s_%s.%%(ext)s", videoTitle, videoId),
+			"--output", fmt.Sprintf("%s/%s_%s.%%(ext)s", DownloadDir, videoTitle, videoId),
 			videoURL,
 		}, commonArgs...)
 	}
@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LogMailer is for local testing: it logs emails instead of sending them
+// and, when a directory is set, also writes each one there as an .eml file.
+type LogMailer struct {
+	dir  string
+	from string
+}
+
+func NewLogMailer(dir string, from string) *LogMailer {
+	if from == "" {
+		from = "phoenix@localhost"
+	}
+	return &LogMailer{dir: dir, from: from}
+}
+
+// NewLogMailerFromEnv writes emails to EMAIL_OUTBOX_DIR when it is set.
+func NewLogMailerFromEnv() *LogMailer {
+	return NewLogMailer(os.Getenv("EMAIL_OUTBOX_DIR"), os.Getenv("EMAIL_FROM"))
+}
+
+func (m *LogMailer) Name() string {
+	return TransportLog
+}
+
+func (m *LogMailer) Send(ctx context.Context, message Message) error {
+	log.Printf("[MAILER] To: %s | Subject: %s\n%s", message.To, message.Subject, message.Body)
+	if m.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), filepath.Base(message.To))
+	return os.WriteFile(filepath.Join(m.dir, name), formatMessage(m.from, message), 0o644)
+}
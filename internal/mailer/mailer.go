@@ -0,0 +1,79 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	TransportSMTP = "smtp"
+	TransportLog  = "log"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends outbound email, such as verification and password reset
+// links.
+type Mailer interface {
+	// Name is the transport, "smtp" or "log".
+	Name() string
+	Send(ctx context.Context, message Message) error
+}
+
+var (
+	once     sync.Once
+	instance Mailer
+)
+
+// GetInstance returns the transport chosen by EMAIL_TRANSPORT ("smtp" or
+// "log"). Without it, SMTP is used when SMTP_HOST is set and emails are
+// logged otherwise. It returns nil if the chosen transport cannot start.
+func GetInstance() Mailer {
+	once.Do(func() {
+		godotenv.Load()
+		transport, err := newFromEnv(strings.ToLower(strings.TrimSpace(os.Getenv("EMAIL_TRANSPORT"))))
+		if err != nil {
+			log.Println("Unable to initialize mailer:", err)
+			return
+		}
+		log.Println("Email transport:", transport.Name())
+		instance = transport
+	})
+	return instance
+}
+
+func newFromEnv(kind string) (Mailer, error) {
+	switch kind {
+	case TransportSMTP:
+		return NewSMTPMailerFromEnv()
+	case TransportLog:
+		return NewLogMailerFromEnv(), nil
+	case "":
+		if smtpMailer, err := NewSMTPMailerFromEnv(); err == nil {
+			return smtpMailer, nil
+		}
+		return NewLogMailerFromEnv(), nil
+	}
+	return nil, errors.New("unknown EMAIL_TRANSPORT " + kind)
+}
+
+// Link builds a link into the web app from APP_BASE_URL, e.g.
+// Link("/reset-password", "token", t). Without APP_BASE_URL it returns "".
+func Link(path string, param string, value string) string {
+	base := strings.TrimRight(os.Getenv("APP_BASE_URL"), "/")
+	if base == "" {
+		return ""
+	}
+	return base + path + "?" + param + "=" + value
+}
@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogMailerWritesOutbox(t *testing.T) {
+	dir := t.TempDir()
+	m := NewLogMailer(dir, "phoenix@example.com")
+	if err := m.Send(context.Background(), Message{To: "a@b.c", Subject: "Hi", Body: "line 1\nline 2"}); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("want one .eml file, got %v", files)
+	}
+	raw, _ := os.ReadFile(files[0])
+	email := string(raw)
+	for _, want := range []string{"From: phoenix@example.com\r\n", "To: a@b.c\r\n", "Subject: Hi\r\n", "\r\n\r\nline 1\r\nline 2"} {
+		if !strings.Contains(email, want) {
+			t.Fatalf("email is missing %q:\n%s", want, email)
+		}
+	}
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	m := NewSMTPMailer("localhost", "25", "", "", "phoenix@example.com")
+	err := m.Send(context.Background(), Message{To: "a@b.c\r\nBcc: x@y.z", Subject: "Hi"})
+	if err == nil {
+		t.Fatal("multi-line recipient was accepted")
+	}
+}
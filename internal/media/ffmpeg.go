@@ -0,0 +1,170 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// InvalidOptionsError is returned for options that can never succeed, so
+// callers know retrying is pointless.
+type InvalidOptionsError struct {
+	Reason string
+}
+
+func (e InvalidOptionsError) Error() string {
+	return "invalid post-processing options: " + e.Reason
+}
+
+func ffmpegBinary() string {
+	if bin := strings.TrimSpace(os.Getenv("FFMPEG_BIN")); bin != "" {
+		return bin
+	}
+	return "ffmpeg"
+}
+
+func ffprobeBinary() string {
+	if bin := strings.TrimSpace(os.Getenv("FFPROBE_BIN")); bin != "" {
+		return bin
+	}
+	return "ffprobe"
+}
+
+// ParseTimestamp converts "90", "12.5", "1:30" or "01:02:03.5" into seconds.
+func ParseTimestamp(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+	seconds := 0.0
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(part, 64)
+		if err != nil || number < 0 {
+			return 0, fmt.Errorf("invalid timestamp %q", value)
+		}
+		// Only the last field may have a fraction, and minutes and seconds
+		// stay below 60 in clock notation.
+		if i < len(parts)-1 && number != float64(int(number)) {
+			return 0, fmt.Errorf("invalid timestamp %q", value)
+		}
+		if i > 0 && number >= 60 {
+			return 0, fmt.Errorf("invalid timestamp %q", value)
+		}
+		seconds = seconds*60 + number
+	}
+	return seconds, nil
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
+
+// Probe returns the duration of a media file and whether it has a video
+// stream. Embedded cover art does not count as video.
+func Probe(ctx context.Context, path string) (float64, bool, error) {
+	cmd := exec.CommandContext(ctx, ffprobeBinary(),
+		"-v", "error",
+		"-show_entries", "format=duration:stream=codec_type:stream_disposition=attached_pic",
+		"-of", "json",
+		path,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, false, fmt.Errorf("ffprobe failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	probe := struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType   string `json:"codec_type"`
+			Disposition struct {
+				AttachedPic int `json:"attached_pic"`
+			} `json:"disposition"`
+		} `json:"streams"`
+	}{}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return 0, false, fmt.Errorf("unexpected ffprobe output: %v", err)
+	}
+	duration, _ := strconv.ParseFloat(probe.Format.Duration, 64)
+	hasVideo := false
+	for _, stream := range probe.Streams {
+		if stream.CodecType == "video" && stream.Disposition.AttachedPic == 0 {
+			hasVideo = true
+		}
+	}
+	return duration, hasVideo, nil
+}
+
+// runFFmpeg runs ffmpeg with machine-readable progress on stdout and reports
+// the fraction of duration processed so far.
+func runFFmpeg(ctx context.Context, args []string, duration float64, progress func(float64)) error {
+	args = append([]string{"-hide_banner", "-nostdin", "-y", "-progress", "pipe:1", "-nostats"}, args...)
+	cmd := exec.CommandContext(ctx, ffmpegBinary(), args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("unable to start ffmpeg: %v", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		// out_time_ms is in microseconds as well, despite its name.
+		if !found || (key != "out_time_us" && key != "out_time_ms") || duration <= 0 || progress == nil {
+			continue
+		}
+		if micros, err := strconv.ParseFloat(value, 64); err == nil {
+			progress(clamp(micros / 1e6 / duration))
+		}
+	}
+	io.Copy(io.Discard, stdout)
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("ffmpeg failed: %v: %s", err, lastLines(stderr.String(), 5))
+	}
+	return nil
+}
+
+func clamp(fraction float64) float64 {
+	if fraction < 0 {
+		return 0
+	}
+	if fraction > 1 {
+		return 1
+	}
+	return fraction
+}
+
+func lastLines(text string, count int) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	if len(lines) > count {
+		lines = lines[len(lines)-count:]
+	}
+	return strings.Join(lines, " | ")
+}
+
+func extension(path string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+}
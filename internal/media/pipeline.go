@@ -0,0 +1,408 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"project-phoenix/v2/internal/model"
+)
+
+const (
+	loudnessFilter   = "loudnorm=I=-16:TP=-1.5:LRA=11"
+	waveformSize     = "1280x240"
+	waveformColor    = "0x3b82f6"
+	thumbnailWidth   = 640
+	maxCoverArtBytes = 10 << 20
+)
+
+var audioFormats = map[string]bool{"mp3": true, "m4a": true, "opus": true, "wav": true}
+
+// Result lists the files produced by Process. Waveform and thumbnail are empty
+// when they were not requested or could not be made.
+type Result struct {
+	OutputPath    string
+	WaveformPath  string
+	ThumbnailPath string
+}
+
+// ProgressFunc receives the running step and the overall fraction done.
+type ProgressFunc func(stage string, fraction float64)
+
+// plan is the validated form of the options.
+type plan struct {
+	options   model.MediaProcessingOptions
+	start     float64
+	end       float64
+	outputExt string
+	transcode bool
+}
+
+func newPlan(input string, options model.MediaProcessingOptions) (*plan, error) {
+	p := &plan{options: options, outputExt: extension(input)}
+	var err error
+	if p.start, err = ParseTimestamp(options.StartTime); err != nil {
+		return nil, InvalidOptionsError{err.Error()}
+	}
+	if p.end, err = ParseTimestamp(options.EndTime); err != nil {
+		return nil, InvalidOptionsError{err.Error()}
+	}
+	if p.end > 0 && p.end <= p.start {
+		return nil, InvalidOptionsError{"endTime must be after startTime"}
+	}
+	if options.CoverURL != "" {
+		if coverURL, err := url.Parse(options.CoverURL); err != nil || checkCoverURL(coverURL) != nil {
+			return nil, InvalidOptionsError{"coverUrl must be an https URL"}
+		}
+	}
+	if options.ExtractAudio {
+		p.outputExt = strings.ToLower(options.AudioFormat)
+		if p.outputExt == "" {
+			p.outputExt = "mp3"
+		}
+		if !audioFormats[p.outputExt] {
+			return nil, InvalidOptionsError{"unsupported audioFormat " + options.AudioFormat}
+		}
+	}
+	p.transcode = p.trimmed() || options.ExtractAudio || options.NormalizeLoudness || options.CoverArt ||
+		options.Title != "" || options.Artist != "" || options.Album != ""
+	return p, nil
+}
+
+func (p *plan) trimmed() bool {
+	return p.start > 0 || p.end > 0
+}
+
+// supportsCoverArt reports whether the output container can hold an embedded
+// picture.
+func (p *plan) supportsCoverArt() bool {
+	switch p.outputExt {
+	case "mp3", "m4a", "mp4", "mov":
+		return true
+	}
+	return false
+}
+
+func audioCodecArgs(ext string) []string {
+	switch ext {
+	case "mp3":
+		return []string{"-c:a", "libmp3lame", "-q:a", "2"}
+	case "webm", "opus", "ogg":
+		return []string{"-c:a", "libopus", "-b:a", "128k"}
+	case "wav":
+		return []string{"-c:a", "pcm_s16le"}
+	}
+	return []string{"-c:a", "aac", "-b:a", "192k"}
+}
+
+func videoCodecArgs(ext string) []string {
+	if ext == "webm" {
+		return []string{"-c:v", "libvpx-vp9", "-b:v", "0", "-crf", "32", "-row-mt", "1"}
+	}
+	return []string{"-c:v", "libx264", "-preset", "veryfast", "-crf", "20", "-pix_fmt", "yuv420p"}
+}
+
+// transcodeArgs builds the single ffmpeg run that trims, extracts audio,
+// normalizes loudness and writes metadata and cover art. Streams are copied
+// unless a step needs them re-encoded.
+func (p *plan) transcodeArgs(input string, hasVideo bool, cover string, output string) []string {
+	args := []string{}
+	if p.start > 0 {
+		args = append(args, "-ss", formatSeconds(p.start))
+	}
+	if p.end > 0 {
+		args = append(args, "-t", formatSeconds(p.end-p.start))
+	}
+	args = append(args, "-i", input)
+	if cover != "" {
+		args = append(args, "-i", cover)
+	}
+
+	keepVideo := hasVideo && !p.options.ExtractAudio
+	videoStreams := 0
+	if keepVideo {
+		args = append(args, "-map", "0:v:0")
+		videoStreams = 1
+	}
+	args = append(args, "-map", "0:a:0?")
+	if cover != "" {
+		args = append(args, "-map", "1:v:0")
+	}
+
+	if keepVideo {
+		if p.trimmed() {
+			args = append(args, videoCodecArgs(p.outputExt)...)
+		} else {
+			args = append(args, "-c:v", "copy")
+		}
+	}
+	if p.trimmed() || p.options.ExtractAudio || p.options.NormalizeLoudness {
+		args = append(args, audioCodecArgs(p.outputExt)...)
+	} else {
+		args = append(args, "-c:a", "copy")
+	}
+	if p.options.NormalizeLoudness {
+		// loudnorm resamples to 192 kHz internally; bring it back down.
+		args = append(args, "-af", loudnessFilter, "-ar", "48000")
+	}
+	if cover != "" {
+		index := fmt.Sprint(videoStreams)
+		args = append(args,
+			"-c:v:"+index, "mjpeg",
+			"-disposition:v:"+index, "attached_pic",
+			"-metadata:s:v:"+index, "title=Album cover",
+			"-metadata:s:v:"+index, "comment=Cover (front)",
+		)
+	}
+
+	for _, tag := range [][2]string{{"title", p.options.Title}, {"artist", p.options.Artist}, {"album", p.options.Album}} {
+		if tag[1] != "" {
+			args = append(args, "-metadata", tag[0]+"="+tag[1])
+		}
+	}
+	switch p.outputExt {
+	case "mp3":
+		args = append(args, "-id3v2_version", "3")
+	case "mp4", "m4a", "mov":
+		args = append(args, "-movflags", "+faststart")
+	}
+	return append(args, output)
+}
+
+func waveformArgs(input string, output string) []string {
+	return []string{
+		"-i", input,
+		"-filter_complex", "aformat=channel_layouts=mono,showwavespic=s=" + waveformSize + ":colors=" + waveformColor,
+		"-frames:v", "1",
+		output,
+	}
+}
+
+func thumbnailArgs(input string, at float64, output string) []string {
+	return []string{
+		"-ss", formatSeconds(at),
+		"-i", input,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=%d:-2", thumbnailWidth),
+		"-q:v", "3",
+		output,
+	}
+}
+
+// Validate checks options without running anything, so bad requests can be
+// rejected before the download starts.
+func Validate(options model.MediaProcessingOptions) error {
+	_, err := newPlan("input.mp4", options)
+	return err
+}
+
+// Process runs the requested steps on input. The processed file is written
+// next to it; input itself is left untouched. videoID is used to fetch the
+// YouTube thumbnail when cover art is requested without a CoverURL.
+func Process(ctx context.Context, input string, options model.MediaProcessingOptions, videoID string, progress ProgressFunc) (*Result, error) {
+	p, err := newPlan(input, options)
+	if err != nil {
+		return nil, err
+	}
+	if progress == nil {
+		progress = func(string, float64) {}
+	}
+	base := strings.TrimSuffix(input, filepath.Ext(input))
+	result := &Result{OutputPath: input}
+
+	steps := 0.0
+	for _, enabled := range []bool{p.transcode, options.Waveform, options.Thumbnail} {
+		if enabled {
+			steps++
+		}
+	}
+	if steps == 0 {
+		return result, nil
+	}
+	done := 0.0
+	report := func(stage string) func(float64) {
+		return func(fraction float64) {
+			progress(stage, (done+fraction)/steps)
+		}
+	}
+
+	duration, inputHasVideo, err := Probe(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if p.start >= duration && duration > 0 {
+		return nil, InvalidOptionsError{fmt.Sprintf("startTime is past the end of the media (%.1fs)", duration)}
+	}
+
+	var cover string
+	if options.CoverArt {
+		if p.supportsCoverArt() {
+			if cover, err = fetchCoverArt(ctx, options.CoverURL, videoID, base); err != nil {
+				log.Println("Skipping cover art:", err)
+			} else {
+				defer os.Remove(cover)
+			}
+		} else {
+			log.Printf("Skipping cover art: .%s files cannot embed pictures", p.outputExt)
+		}
+	}
+
+	if p.transcode {
+		output := base + "_processed." + p.outputExt
+		expected := duration - p.start
+		if p.end > 0 && p.end < duration {
+			expected = p.end - p.start
+		}
+		if err := runFFmpeg(ctx, p.transcodeArgs(input, inputHasVideo, cover, output), expected, report("transcode")); err != nil {
+			os.Remove(output)
+			return nil, err
+		}
+		result.OutputPath = output
+		done++
+	}
+
+	outputDuration, hasVideo, err := Probe(ctx, result.OutputPath)
+	if err != nil {
+		return result, err
+	}
+
+	if options.Waveform {
+		progress("waveform", done/steps)
+		waveform := base + "_waveform.png"
+		if err := runFFmpeg(ctx, waveformArgs(result.OutputPath, waveform), 0, nil); err != nil {
+			log.Println("Unable to render waveform:", err)
+		} else {
+			result.WaveformPath = waveform
+		}
+		done++
+	}
+
+	if options.Thumbnail {
+		progress("thumbnail", done/steps)
+		thumbnail := base + "_thumb.jpg"
+		source, at := result.OutputPath, outputDuration/10
+		if !hasVideo {
+			// Audio only: fall back to the cover picture, if there is one.
+			source, at = cover, 0
+		}
+		if source != "" {
+			if err := runFFmpeg(ctx, thumbnailArgs(source, at, thumbnail), 0, nil); err != nil {
+				log.Println("Unable to render thumbnail:", err)
+			} else {
+				result.ThumbnailPath = thumbnail
+			}
+		}
+		done++
+	}
+
+	progress("done", 1)
+	return result, nil
+}
+
+// coverArtClient fetches cover pictures. Its dialer only connects to public
+// addresses, so a coverUrl cannot reach the host or internal services, also
+// not through redirects or names resolving to private addresses.
+var coverArtClient = &http.Client{
+	Timeout: 15 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: refusePrivateAddress}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return fmt.Errorf("stopped after %d redirects", len(via))
+		}
+		return checkCoverURL(req.URL)
+	},
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, which is not routed on
+// the internet either.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP reports whether ip is routed on the internet: it is not loopback,
+// private, link-local, multicast or unspecified.
+func publicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+func refusePrivateAddress(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return fmt.Errorf("cover art host %s is not a public address", host)
+	}
+	return nil
+}
+
+// checkCoverURL only accepts https URLs with a host.
+func checkCoverURL(coverURL *url.URL) error {
+	if coverURL.Scheme != "https" || coverURL.Hostname() == "" {
+		return fmt.Errorf("coverUrl must be an https URL")
+	}
+	return nil
+}
+
+// fetchCoverArt downloads the cover picture next to the media file.
+func fetchCoverArt(ctx context.Context, coverURL string, videoID string, base string) (string, error) {
+	if coverURL == "" {
+		if videoID == "" {
+			return "", fmt.Errorf("no coverUrl and no video id")
+		}
+		coverURL = "https://i.ytimg.com/vi/" + videoID + "/hqdefault.jpg"
+	}
+	parsed, err := url.Parse(coverURL)
+	if err != nil {
+		return "", err
+	}
+	if err := checkCoverURL(parsed); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := coverArtClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cover art request returned %s", res.Status)
+	}
+	if mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type")); err != nil || !strings.HasPrefix(mediaType, "image/") {
+		return "", fmt.Errorf("cover art is not an image (%q)", res.Header.Get("Content-Type"))
+	}
+	return writeCover(io.LimitReader(res.Body, maxCoverArtBytes+1), base)
+}
+
+func writeCover(body io.Reader, base string) (string, error) {
+	path := base + "_cover"
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	written, err := io.Copy(f, body)
+	f.Close()
+	if err == nil && written > maxCoverArtBytes {
+		err = fmt.Errorf("cover art is larger than %d bytes", maxCoverArtBytes)
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
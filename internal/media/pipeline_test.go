@@ -0,0 +1,264 @@
+package media
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"project-phoenix/v2/internal/model"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	cases := map[string]float64{
+		"":           0,
+		"90":         90,
+		"12.5":       12.5,
+		"1:30":       90,
+		"01:02:03.5": 3723.5,
+	}
+	for input, want := range cases {
+		got, err := ParseTimestamp(input)
+		if err != nil {
+			t.Fatalf("ParseTimestamp(%q) error: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("ParseTimestamp(%q) = %v, want %v", input, got, want)
+		}
+	}
+	for _, input := range []string{"abc", "-5", "1:75", "1.5:20", "1:2:3:4"} {
+		if _, err := ParseTimestamp(input); err == nil {
+			t.Fatalf("ParseTimestamp(%q) succeeded, want error", input)
+		}
+	}
+}
+
+func TestValidateRejectsBadOptions(t *testing.T) {
+	for _, options := range []model.MediaProcessingOptions{
+		{StartTime: "10", EndTime: "5"},
+		{ExtractAudio: true, AudioFormat: "flac"},
+		{EndTime: "soon"},
+	} {
+		err := Validate(options)
+		if _, ok := err.(InvalidOptionsError); !ok {
+			t.Fatalf("Validate(%+v) = %v, want InvalidOptionsError", options, err)
+		}
+	}
+}
+
+func TestTranscodeArgsForAudioSegment(t *testing.T) {
+	p, err := newPlan("/tmp/in.mp4", model.MediaProcessingOptions{
+		StartTime:    "5",
+		EndTime:      "15",
+		ExtractAudio: true,
+		Title:        "Song",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := strings.Join(p.transcodeArgs("/tmp/in.mp4", true, "", "/tmp/out.mp3"), " ")
+	for _, want := range []string{"-ss 5.000", "-t 10.000", "-map 0:a:0?", "-c:a libmp3lame", "-metadata title=Song", "-id3v2_version 3"} {
+		if !strings.Contains(args, want) {
+			t.Fatalf("args %q missing %q", args, want)
+		}
+	}
+	if strings.Contains(args, "0:v") {
+		t.Fatalf("args %q should not keep the video stream", args)
+	}
+}
+
+func TestTranscodeArgsCopiesStreamsForMetadataOnly(t *testing.T) {
+	p, err := newPlan("/tmp/in.mp4", model.MediaProcessingOptions{CoverArt: true, Artist: "Band"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := strings.Join(p.transcodeArgs("/tmp/in.mp4", true, "/tmp/cover.jpg", "/tmp/out.mp4"), " ")
+	for _, want := range []string{"-c:v copy", "-c:a copy", "-map 1:v:0", "-c:v:1 mjpeg", "-disposition:v:1 attached_pic", "-metadata artist=Band"} {
+		if !strings.Contains(args, want) {
+			t.Fatalf("args %q missing %q", args, want)
+		}
+	}
+}
+
+// The tests below run ffmpeg against small generated samples and are skipped
+// when ffmpeg is not installed.
+
+func requireFFmpeg(t *testing.T) {
+	t.Helper()
+	for _, bin := range []string{ffmpegBinary(), ffprobeBinary()} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s not available", bin)
+		}
+	}
+}
+
+func generateSample(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	video := filepath.Join(dir, "sample.mp4")
+	cover := filepath.Join(dir, "cover.jpg")
+	commands := [][]string{
+		{"-f", "lavfi", "-i", "testsrc=duration=4:size=320x240:rate=15",
+			"-f", "lavfi", "-i", "sine=frequency=440:duration=4",
+			"-c:v", "libx264", "-pix_fmt", "yuv420p", "-c:a", "aac", "-shortest", video},
+		{"-f", "lavfi", "-i", "color=c=red:size=200x200", "-frames:v", "1", cover},
+	}
+	for _, args := range commands {
+		output, err := exec.Command(ffmpegBinary(), append([]string{"-hide_banner", "-y", "-loglevel", "error"}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("unable to generate sample: %v: %s", err, output)
+		}
+	}
+	return video, cover
+}
+
+func TestProcessTrimsVideoWithWaveformAndThumbnail(t *testing.T) {
+	requireFFmpeg(t)
+	video, _ := generateSample(t, t.TempDir())
+
+	stages := map[string]bool{}
+	last := 0.0
+	result, err := Process(context.Background(), video, model.MediaProcessingOptions{
+		StartTime:         "1",
+		EndTime:           "3",
+		NormalizeLoudness: true,
+		Title:             "Sample",
+		Waveform:          true,
+		Thumbnail:         true,
+	}, "", func(stage string, fraction float64) {
+		stages[stage] = true
+		if fraction < last {
+			t.Errorf("progress went backwards: %v after %v", fraction, last)
+		}
+		last = fraction
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duration, hasVideo, err := Probe(context.Background(), result.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(duration-2) > 0.3 || !hasVideo {
+		t.Fatalf("output duration %.2f (video %v), want about 2s of video", duration, hasVideo)
+	}
+	for _, path := range []string{result.WaveformPath, result.ThumbnailPath} {
+		if stat, err := os.Stat(path); err != nil || stat.Size() == 0 {
+			t.Fatalf("expected a non-empty file at %q: %v", path, err)
+		}
+	}
+	if !stages["transcode"] || last != 1 {
+		t.Fatalf("progress stages %v ended at %v", stages, last)
+	}
+}
+
+// serveCover serves body over https with the given content type and lets
+// fetchCoverArt reach the test server, which listens on loopback.
+func serveCover(t *testing.T, contentType string, body []byte) string {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	client := coverArtClient
+	coverArtClient = server.Client()
+	t.Cleanup(func() { coverArtClient = client })
+	return server.URL + "/cover.jpg"
+}
+
+func TestValidateRejectsNonHTTPSCoverURL(t *testing.T) {
+	for _, coverURL := range []string{"/etc/passwd", "file:///etc/passwd", "http://example.com/cover.jpg", "https:///cover.jpg"} {
+		err := Validate(model.MediaProcessingOptions{CoverArt: true, CoverURL: coverURL})
+		if _, ok := err.(InvalidOptionsError); !ok {
+			t.Errorf("coverUrl %q: got %v, want an InvalidOptionsError", coverURL, err)
+		}
+	}
+	if err := Validate(model.MediaProcessingOptions{CoverArt: true, CoverURL: "https://example.com/cover.jpg"}); err != nil {
+		t.Errorf("https coverUrl: %v", err)
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	for address, want := range map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"fd00::1":         false,
+		"fe80::1":         false,
+		"::ffff:10.0.0.1": false,
+	} {
+		if got := publicIP(net.ParseIP(address)); got != want {
+			t.Errorf("publicIP(%s) = %v, want %v", address, got, want)
+		}
+	}
+}
+
+func TestFetchCoverArtRefusesLoopback(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the cover request reached a loopback server")
+	}))
+	defer server.Close()
+	base := filepath.Join(t.TempDir(), "media")
+	if _, err := fetchCoverArt(context.Background(), server.URL+"/cover.jpg", "", base); err == nil || !strings.Contains(err.Error(), "not a public address") {
+		t.Fatalf("got %v, want a loopback coverUrl to be refused", err)
+	}
+}
+
+func TestFetchCoverArtChecksContentType(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "media")
+	if _, err := fetchCoverArt(context.Background(), serveCover(t, "text/html", []byte("<html>")), "", base); err == nil {
+		t.Fatal("expected a non-image response to be refused")
+	}
+	cover, err := fetchCoverArt(context.Background(), serveCover(t, "image/jpeg", []byte("jpeg")), "", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(cover); err != nil || string(data) != "jpeg" {
+		t.Fatalf("cover file holds %q, %v", data, err)
+	}
+}
+
+func TestProcessExtractsAudioWithCoverArt(t *testing.T) {
+	requireFFmpeg(t)
+	video, coverPath := generateSample(t, t.TempDir())
+	coverData, err := os.ReadFile(coverPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cover := serveCover(t, "image/jpeg", coverData)
+
+	result, err := Process(context.Background(), video, model.MediaProcessingOptions{
+		ExtractAudio: true,
+		CoverArt:     true,
+		CoverURL:     cover,
+		Artist:       "Tester",
+		Thumbnail:    true,
+	}, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Ext(result.OutputPath) != ".mp3" {
+		t.Fatalf("output %q, want an mp3", result.OutputPath)
+	}
+	if _, hasVideo, err := Probe(context.Background(), result.OutputPath); err != nil || hasVideo {
+		t.Fatalf("output should be audio only (video %v, err %v)", hasVideo, err)
+	}
+	// Audio has no frames to grab, so the thumbnail comes from the cover.
+	if result.ThumbnailPath == "" {
+		t.Fatal("expected a thumbnail made from the cover art")
+	}
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// AccountToken is a single-use token mailed to a user, for verifying the
+// email address or resetting the password. Only its hash is stored.
+type AccountToken struct {
+	ID        string     `bson:"_id,omitempty" json:"_id,omitempty"`
+	TokenHash string     `json:"-" bson:"tokenHash"`
+	Purpose   string     `json:"purpose" bson:"purpose"`
+	UserID    string     `json:"userId" bson:"userId"`
+	Email     string     `json:"email" bson:"email"`
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt" bson:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+}
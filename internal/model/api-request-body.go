@@ -9,11 +9,77 @@ type LoginModel struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 	FcmKey   string `json:"fcmKey"`
+	// TrustedDevice is the token of a remembered device, which skips the
+	// second factor.
+	TrustedDevice string `json:"trustedDevice"`
+}
+
+type RefreshTokenRequestModel struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type AccountTokenModel struct {
+	Token string `json:"token"`
+}
+
+type ForgotPasswordModel struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordModel struct {
+	Token           string `json:"token"`
+	Password        string `json:"password"`
+	ConfirmPassword string `json:"confirmPassword"`
+}
+
+type ChangePasswordModel struct {
+	CurrentPassword string `json:"currentPassword"`
+	Password        string `json:"password"`
+	ConfirmPassword string `json:"confirmPassword"`
+}
+
+// TwoFactorCodeModel carries either an authenticator code or a recovery
+// code.
+type TwoFactorCodeModel struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+type TwoFactorEnableModel struct {
+	Code             string `json:"code"`
+	RequireForGoogle *bool  `json:"requireForGoogle"`
+}
+
+type TwoFactorSettingsModel struct {
+	RequireForGoogle *bool `json:"requireForGoogle"`
+}
+
+type TwoFactorLoginModel struct {
+	TwoFactorCodeModel
+	Challenge      string `json:"challenge"`
+	RememberDevice bool   `json:"rememberDevice"`
+}
+
+// UserRolesModel sets the roles and extra permissions of the user with the
+// given id or email.
+type UserRolesModel struct {
+	UserID      string   `json:"userId"`
+	Email       string   `json:"email"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+// ProfileUpdateModel changes only the fields that are sent.
+type ProfileUpdateModel struct {
+	Name   *string `json:"name"`
+	Avatar *string `json:"avatar"`
+	Phone  *string `json:"phone"`
 }
 
 type GoogleLoginModel struct {
 	Token string `json:"token"`
 	FcmToken string `json:"fcmKey"`
+	TrustedDevice string `json:"trustedDevice"`
 }
 
 type GoogleUserModel struct {
@@ -65,6 +131,22 @@ type CaptureScreenDeviceQueryModel struct {
 	DeviceName string `json:"deviceName"`
 }
 
+type DeviceEnrollRequestModel struct {
+	DeviceName string `json:"deviceName"`
+}
+
+type DeviceWatchRequestModel struct {
+	DeviceName string `json:"deviceName"`
+	Watched    bool   `json:"watched"`
+}
+
+type DeviceCommandRequestModel struct {
+	DeviceName     string                 `json:"deviceName"`
+	Type           string                 `json:"type"`
+	Payload        map[string]interface{} `json:"payload"`
+	TimeoutSeconds int                    `json:"timeoutSeconds"`
+}
+
 type ClipboardRequestModel struct {
 	Code string `json:"code" bson:"code"`
 	DeviceInfo   string  `json:"deviceInfo" bson:"deviceInfo"`
@@ -90,4 +172,28 @@ type GoogleDownloadVideoRequestModel struct {
 	VideoTitle string  `json:"videoTitle" bson:"videoTitle"`
 	BitRate string `json:"bitRate" bson:"bitRate"`
 	Quality string `json:"quality" bson:"quality"`
+	PostProcess *MediaProcessingOptions `json:"postProcess,omitempty" bson:"postProcess,omitempty"`
+}
+
+// DownloadBatchRequestModel asks for a playlist or a list of videos at once.
+// Exactly one of PlaylistURL and Videos is set.
+type DownloadBatchRequestModel struct {
+	BatchId     string                  `json:"batchId" bson:"batchId"`
+	PlaylistURL string                  `json:"playlistUrl" bson:"playlistUrl"`
+	Videos      []DownloadBatchItem     `json:"videos" bson:"videos"`
+	Format      string                  `json:"format" bson:"format"`
+	BitRate     string                  `json:"bitRate" bson:"bitRate"`
+	Quality     string                  `json:"quality" bson:"quality"`
+	PostProcess *MediaProcessingOptions `json:"postProcess,omitempty" bson:"postProcess,omitempty"`
+	Zip         bool                    `json:"zip" bson:"zip"`
+}
+
+type ClipboardMessageActionRequestModel struct {
+	Code      string `json:"code" bson:"code"`
+	MessageID string `json:"messageId" bson:"messageId"`
+	Sender    string `json:"sender" bson:"sender"`
+	Message   string `json:"message" bson:"message"`
+	Pinned    bool   `json:"pinned" bson:"pinned"`
+	Emoji     string `json:"emoji" bson:"emoji"`
+	Remove    bool   `json:"remove" bson:"remove"`
 }
@@ -15,14 +15,25 @@ type ClipboardRoom struct {
 }
 
 type ClipboardRoomMessage struct {
-	ID             string    `bson:"_id,omitempty" json:"_id,omitempty"`
-	Message        string    `json:"message" bson:"message"`
-	CreatedAt      time.Time `json:"createdAt" bson:"createdAt"`
-	Sender         string    `json:"sender" bson:"sender"`
-	IsAttachment   bool      `json:"isAttachment" bson:"isAttachment"`
-	AttachmentType string    `json:"attachmentType" bson:"attachmentType"`
-	AttachmentURL  string    `json:"attachmentURL" bson:"attachmentURL"`
-	DeviceInfo     string    `json:"deviceInfo" bson:"deviceInfo"`
+	ID             string              `bson:"_id,omitempty" json:"_id,omitempty"`
+	Message        string              `json:"message" bson:"message"`
+	CreatedAt      time.Time           `json:"createdAt" bson:"createdAt"`
+	Sender         string              `json:"sender" bson:"sender"`
+	IsAttachment   bool                `json:"isAttachment" bson:"isAttachment"`
+	AttachmentType string              `json:"attachmentType" bson:"attachmentType"`
+	AttachmentURL  string              `json:"attachmentURL" bson:"attachmentURL"`
+	AttachmentKey  string              `json:"attachmentKey,omitempty" bson:"attachmentKey,omitempty"`
+	DeviceInfo     string              `json:"deviceInfo" bson:"deviceInfo"`
+	EditedAt       *time.Time          `json:"editedAt,omitempty" bson:"editedAt,omitempty"`
+	IsDeleted      bool                `json:"isDeleted" bson:"isDeleted"`
+	DeletedAt      *time.Time          `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	IsPinned       bool                `json:"isPinned" bson:"isPinned"`
+	PinnedAt       *time.Time          `json:"pinnedAt,omitempty" bson:"pinnedAt,omitempty"`
+	PinnedBy       string              `json:"pinnedBy,omitempty" bson:"pinnedBy,omitempty"`
+	Reactions      map[string][]string `json:"reactions,omitempty" bson:"reactions,omitempty"`
+	// SenderSession is the hashed session that sent the message, which alone
+	// may edit or delete it.
+	SenderSession string `json:"-" bson:"senderSession,omitempty"`
 }
 
 type ClipboardRoomMember struct {
@@ -31,4 +42,6 @@ type ClipboardRoomMember struct {
 	UserAgent      string    `bson:"userAgent" json:"userAgent"`
 	JoinedAt       time.Time `bson:"joinedAt" json:"joinedAt"`
 	DeviceInfo     string    `bson:"deviceInfo" json:"deviceInfo"`
-}
\ No newline at end of file
+	// Sessions are the hashed sessions the member joined with.
+	Sessions []string `bson:"sessions,omitempty" json:"-"`
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+type DeviceCommand struct {
+	ID             string                 `bson:"_id,omitempty" json:"_id,omitempty"`
+	CommandID      string                 `json:"commandId" bson:"commandId"`
+	DeviceName     string                 `json:"deviceName" bson:"deviceName"`
+	Type           string                 `json:"type" bson:"type"`
+	Payload        map[string]interface{} `json:"payload,omitempty" bson:"payload,omitempty"`
+	Status         string                 `json:"status" bson:"status"`
+	Result         string                 `json:"result,omitempty" bson:"result,omitempty"`
+	Error          string                 `json:"error,omitempty" bson:"error,omitempty"`
+	TimeoutSeconds int                    `json:"timeoutSeconds" bson:"timeoutSeconds"`
+	CreatedAt      time.Time              `json:"createdAt" bson:"createdAt"`
+	UpdatedAt      time.Time              `json:"updatedAt" bson:"updatedAt"`
+	SentAt         *time.Time             `json:"sentAt,omitempty" bson:"sentAt,omitempty"`
+	CompletedAt    *time.Time             `json:"completedAt,omitempty" bson:"completedAt,omitempty"`
+	ExpiresAt      time.Time              `json:"expiresAt" bson:"expiresAt"`
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// DeviceCredential is an API token issued to a device at enrollment. Only a
+// hash of the token is stored; the token itself is shown once.
+type DeviceCredential struct {
+	ID          string     `bson:"_id,omitempty" json:"_id,omitempty"`
+	DeviceName  string     `json:"deviceName" bson:"deviceName"`
+	TokenHash   string     `json:"-" bson:"tokenHash"`
+	TokenPrefix string     `json:"tokenPrefix" bson:"tokenPrefix"`
+	CreatedAt   time.Time  `json:"createdAt" bson:"createdAt"`
+	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+	RevokedAt   *time.Time `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// ResourceUsage is a memory or disk reading parsed from the free-form string a
+// device agent reports. Any field may be missing depending on what the agent
+// sent.
+type ResourceUsage struct {
+	Percent    *float64 `json:"percent,omitempty" bson:"percent,omitempty"`
+	UsedBytes  *float64 `json:"usedBytes,omitempty" bson:"usedBytes,omitempty"`
+	TotalBytes *float64 `json:"totalBytes,omitempty" bson:"totalBytes,omitempty"`
+}
+
+// DeviceMetric is one telemetry sample in the device_metrics time series.
+type DeviceMetric struct {
+	DeviceName string         `json:"deviceName" bson:"deviceName"`
+	At         time.Time      `json:"at" bson:"at"`
+	OSName     string         `json:"osName,omitempty" bson:"osName,omitempty"`
+	Memory     *ResourceUsage `json:"memory,omitempty" bson:"memory,omitempty"`
+	Disk       *ResourceUsage `json:"disk,omitempty" bson:"disk,omitempty"`
+}
+
+// DeviceMetricAlert reports a metric crossing its alert threshold in either
+// direction.
+type DeviceMetricAlert struct {
+	DeviceName string    `json:"deviceName"`
+	Metric     string    `json:"metric"`
+	Percent    float64   `json:"percent"`
+	Threshold  float64   `json:"threshold"`
+	Raised     bool      `json:"raised"`
+	At         time.Time `json:"at"`
+}
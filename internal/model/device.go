@@ -3,14 +3,62 @@ package model
 import "time"
 
 type Device struct {
-	ID                     string     `bson:"_id,omitempty" json:"_id,omitempty"`
+	ID               string           `bson:"_id,omitempty" json:"_id,omitempty"`
+	DeviceName       string           `json:"deviceName" bson:"deviceName"`
+	CreatedAt        time.Time        `json:"createdAt" bson:"createdAt"`
+	UpdatedAt        time.Time        `json:"updatedAt" bson:"updatedAt"`
+	IsOnline         bool             `json:"isOnline" bson:"isOnline"`
+	LastOnline       time.Time        `json:"lastOnline" bson:"lastOnline"`
+	LastImage        string           `json:"lastImage" bson:"lastImage"`
+	MemoryUsage      string           `json:"memoryUsage" bson:"memoryUsage"`
+	DiskUsage        string           `json:"diskUsage" bson:"diskUsage"`
+	OSName           string           `json:"osName" bson:"osName"`
+	Watched          bool             `json:"watched" bson:"watched"`
+	MetricAlerts     map[string]bool  `json:"metricAlerts,omitempty" bson:"metricAlerts,omitempty"`
+	LastUserActivity *time.Time       `json:"lastUserActivity,omitempty" bson:"lastUserActivity,omitempty"`
+	LastScreenshotID string           `json:"lastScreenshotId,omitempty" bson:"lastScreenshotId,omitempty"`
+	LastCaptureAt    *time.Time       `json:"lastCaptureAt,omitempty" bson:"lastCaptureAt,omitempty"`
+	CaptureSchedule  *CaptureSchedule `json:"captureSchedule,omitempty" bson:"captureSchedule,omitempty"`
+
+	// Set when a logged in user enrolls the device. Its SSE events only
+	// reach that user, on streams of the same project.
+	Owner       string `json:"owner,omitempty" bson:"owner,omitempty"`
+	ProjectType string `json:"projectType,omitempty" bson:"projectType,omitempty"`
+}
+
+// CaptureSchedule describes when the scheduler should ask a device for a
+// screenshot. Either IntervalSeconds or Cron is set, never both.
+type CaptureSchedule struct {
+	Enabled            bool         `json:"enabled" bson:"enabled"`
+	IntervalSeconds    int          `json:"intervalSeconds,omitempty" bson:"intervalSeconds,omitempty"`
+	Cron               string       `json:"cron,omitempty" bson:"cron,omitempty"`
+	Timezone           string       `json:"timezone,omitempty" bson:"timezone,omitempty"`
+	ActiveHours        *ActiveHours `json:"activeHours,omitempty" bson:"activeHours,omitempty"`
+	OnlyWhenUserActive bool         `json:"onlyWhenUserActive" bson:"onlyWhenUserActive"`
+	MissedRunPolicy    string       `json:"missedRunPolicy" bson:"missedRunPolicy"`
+
+	// Maintained by the scheduler
+	NextRunAt        *time.Time `json:"nextRunAt,omitempty" bson:"nextRunAt,omitempty"`
+	LastRunAt        *time.Time `json:"lastRunAt,omitempty" bson:"lastRunAt,omitempty"`
+	LastRunStatus    string     `json:"lastRunStatus,omitempty" bson:"lastRunStatus,omitempty"`
+	MissedRuns       int        `json:"missedRuns" bson:"missedRuns"`
+	MissedRunPending bool       `json:"missedRunPending" bson:"missedRunPending"`
+}
+
+// ActiveHours limits captures to a daily window in the schedule's timezone,
+// e.g. Start "09:00" and End "18:00". Days uses time.Weekday numbering and
+// allows every day when empty.
+type ActiveHours struct {
+	Start string `json:"start" bson:"start"`
+	End   string `json:"end" bson:"end"`
+	Days  []int  `json:"days,omitempty" bson:"days,omitempty"`
+}
+
+// DeviceUptimeEvent records a device going online or offline.
+type DeviceUptimeEvent struct {
+	ID         string    `bson:"_id,omitempty" json:"_id,omitempty"`
 	DeviceName string    `json:"deviceName" bson:"deviceName"`
-	CreatedAt  time.Time `json:"createdAt" bson:"createdAt"`
-	UpdatedAt  time.Time `json:"updatedAt" bson:"updatedAt"`
 	IsOnline   bool      `json:"isOnline" bson:"isOnline"`
-	LastOnline time.Time `json:"lastOnline" bson:"lastOnline"`
-	LastImage  string    `json:"lastImage" bson:"lastImage"`
-	MemoryUsage string `json:"memoryUsage" bson:"memoryUsage"`
-	DiskUsage string `json:"diskUsage" bson:"diskUsage"`
-	OSName string `json:"osName" bson:"osName"`
+	Reason     string    `json:"reason" bson:"reason"`
+	At         time.Time `json:"at" bson:"at"`
 }
@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// DownloadBatchItem is one video of a batch. Its progress and outcome live on
+// the DownloadJob with the same DownloadID.
+type DownloadBatchItem struct {
+	DownloadID string `json:"downloadId" bson:"downloadId"`
+	VideoID    string `json:"videoId" bson:"videoId"`
+	VideoTitle string `json:"videoTitle,omitempty" bson:"videoTitle,omitempty"`
+}
+
+// DownloadBatch is a playlist or a list of videos downloaded as one request.
+// Each item runs as its own DownloadJob, so one failing item does not fail
+// the others.
+type DownloadBatch struct {
+	ID          string                  `bson:"_id,omitempty" json:"_id,omitempty"`
+	BatchID     string                  `json:"batchId" bson:"batchId"`
+	Owner       string                  `json:"-" bson:"owner"`
+	PlaylistURL string                  `json:"playlistUrl,omitempty" bson:"playlistUrl,omitempty"`
+	Title       string                  `json:"title,omitempty" bson:"title,omitempty"`
+	Items       []DownloadBatchItem     `json:"items" bson:"items"`
+	Format      string                  `json:"format" bson:"format"`
+	Quality     string                  `json:"quality" bson:"quality"`
+	BitRate     string                  `json:"bitRate" bson:"bitRate"`
+	PostProcess *MediaProcessingOptions `json:"postProcess,omitempty" bson:"postProcess,omitempty"`
+	Zip         bool                    `json:"zip" bson:"zip"`
+	Status      string                  `json:"status" bson:"status"`
+	Error       string                  `json:"error,omitempty" bson:"error,omitempty"`
+	Total       int                     `json:"total" bson:"total"`
+	Completed   int                     `json:"completed" bson:"completed"`
+	Failed      int                     `json:"failed" bson:"failed"`
+	Cancelled   int                     `json:"cancelled" bson:"cancelled"`
+	ZipKey      string                  `json:"zipKey,omitempty" bson:"zipKey,omitempty"`
+	ZipURL      string                  `json:"zipUrl,omitempty" bson:"zipUrl,omitempty"`
+	ZipError    string                  `json:"zipError,omitempty" bson:"zipError,omitempty"`
+	CreatedAt   time.Time               `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time               `json:"updatedAt" bson:"updatedAt"`
+	CompletedAt *time.Time              `json:"completedAt,omitempty" bson:"completedAt,omitempty"`
+}
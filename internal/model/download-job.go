@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// DownloadJob is a video download processed by the SSE service. Jobs are
+// persisted so queued and interrupted downloads survive restarts. PostProcess
+// holds the optional ffmpeg steps run after the download. BatchID is set on
+// the items of a batch download. Owner is the session that requested the
+// download, when known; only it may see, cancel and follow the download, and
+// it limits how many of the session's downloads run at once. It is never sent
+// to clients.
+type DownloadJob struct {
+	ID            string                  `bson:"_id,omitempty" json:"_id,omitempty"`
+	DownloadID    string                  `json:"downloadId" bson:"downloadId"`
+	VideoID       string                  `json:"videoId" bson:"videoId"`
+	YoutubeURL    string                  `json:"youtubeURL" bson:"youtubeURL"`
+	Format        string                  `json:"format" bson:"format"`
+	Quality       string                  `json:"quality" bson:"quality"`
+	BitRate       string                  `json:"bitRate" bson:"bitRate"`
+	VideoTitle    string                  `json:"videoTitle" bson:"videoTitle"`
+	PostProcess   *MediaProcessingOptions `json:"postProcess,omitempty" bson:"postProcess,omitempty"`
+	BatchID       string                  `json:"batchId,omitempty" bson:"batchId,omitempty"`
+	Owner         string                  `json:"-" bson:"owner,omitempty"`
+	Status        string                  `json:"status" bson:"status"`
+	Progress      int                     `json:"progress" bson:"progress"`
+	Message       string                  `json:"message,omitempty" bson:"message,omitempty"`
+	Attempts      int                     `json:"attempts" bson:"attempts"`
+	MaxAttempts   int                     `json:"maxAttempts" bson:"maxAttempts"`
+	Error         string                  `json:"error,omitempty" bson:"error,omitempty"`
+	OutputKey     string                  `json:"outputKey,omitempty" bson:"outputKey,omitempty"`
+	FileName      string                  `json:"filename,omitempty" bson:"filename,omitempty"`
+	FileSize      int64                   `json:"fileSize,omitempty" bson:"fileSize,omitempty"`
+	DownloadURL   string                  `json:"downloadUrl,omitempty" bson:"downloadUrl,omitempty"`
+	WaveformKey   string                  `json:"waveformKey,omitempty" bson:"waveformKey,omitempty"`
+	WaveformURL   string                  `json:"waveformUrl,omitempty" bson:"waveformUrl,omitempty"`
+	ThumbnailKey  string                  `json:"thumbnailKey,omitempty" bson:"thumbnailKey,omitempty"`
+	ThumbnailURL  string                  `json:"thumbnailUrl,omitempty" bson:"thumbnailUrl,omitempty"`
+	WorkerID      string                  `json:"workerId,omitempty" bson:"workerId,omitempty"`
+	NextAttemptAt time.Time               `json:"nextAttemptAt" bson:"nextAttemptAt"`
+	HeartbeatAt   *time.Time              `json:"heartbeatAt,omitempty" bson:"heartbeatAt,omitempty"`
+	StartedAt     *time.Time              `json:"startedAt,omitempty" bson:"startedAt,omitempty"`
+	CompletedAt   *time.Time              `json:"completedAt,omitempty" bson:"completedAt,omitempty"`
+	CreatedAt     time.Time               `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time               `json:"updatedAt" bson:"updatedAt"`
+}
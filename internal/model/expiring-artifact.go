@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// ExpiringArtifact is a temporary file or stored object that the cleanup
+// sweeper deletes once ExpiresAt passes.
+type ExpiringArtifact struct {
+	ID        string    `bson:"_id,omitempty" json:"_id,omitempty"`
+	Kind      string    `json:"kind" bson:"kind"`
+	Location  string    `json:"location" bson:"location"`
+	Backend   string    `json:"backend,omitempty" bson:"backend,omitempty"`
+	Owner     string    `json:"owner" bson:"owner"`
+	Reference string    `json:"reference,omitempty" bson:"reference,omitempty"`
+	SizeBytes int64     `json:"sizeBytes" bson:"sizeBytes"`
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	Attempts  int       `json:"attempts" bson:"attempts"`
+	LastError string    `json:"lastError,omitempty" bson:"lastError,omitempty"`
+}
+
+// CleanupReport summarises one sweep or garbage collection run.
+type CleanupReport struct {
+	Deleted        int   `json:"deleted"`
+	Failed         int   `json:"failed"`
+	ReclaimedBytes int64 `json:"reclaimedBytes"`
+}
@@ -8,6 +8,7 @@ type LoginActivity struct {
 	UserAgent   string    `bson:"userAgent" json:"userAgent"`
 	IPAddress   string    `bson:"ipAddress" json:"ipAddress"`
 	Token       string    `bson:"token" json:"token"`
+	TokenFamily string    `bson:"tokenFamily" json:"tokenFamily"`
 	Email       string    `bson:"email" json:"email"`
 	GoogleToken string    `bson:"googleToken" json:"googleToken"`
 	FCMKey      string    `bson:"fcmKey" json:"fcmKey"`
@@ -18,4 +19,26 @@ type LoginActivity struct {
 	IsSpectator bool      `bson:"isSpectator" json:"isSpectator"`
 	DeviceName  string    `bson:"deviceName" json:"deviceName"`
 	IP          string    `bson:"ip" json:"ip"`
+	Country     string    `bson:"country" json:"country"`
+	// SignedInAt is when the login started. CreatedAt moves along with
+	// LastSeenAt, as the record expires a while after it was last used.
+	SignedInAt time.Time `bson:"signedInAt" json:"signedInAt"`
+	LastSeenAt time.Time `bson:"lastSeenAt" json:"lastSeenAt"`
+	// TrustedDeviceID is the remembered device the login came from or
+	// registered, if any.
+	TrustedDeviceID string `bson:"trustedDeviceId,omitempty" json:"trustedDeviceId,omitempty"`
+}
+
+// ActiveSession is a login as its user sees it when listing their sessions.
+type ActiveSession struct {
+	ID            string    `json:"id"`
+	DeviceName    string    `json:"deviceName"`
+	UserAgent     string    `json:"userAgent"`
+	IP            string    `json:"ip"`
+	Country       string    `json:"country"`
+	SignedInAt    time.Time `json:"signedInAt"`
+	LastSeenAt    time.Time `json:"lastSeenAt"`
+	TrustedDevice bool      `json:"trustedDevice"`
+	// Current is the login the list was requested with.
+	Current bool `json:"current"`
 }
@@ -0,0 +1,32 @@
+package model
+
+// MediaProcessingOptions are the optional ffmpeg steps run on a finished
+// download. Times accept seconds ("90", "12.5") or clock notation ("1:30",
+// "01:02:03.5").
+type MediaProcessingOptions struct {
+	StartTime string `json:"startTime,omitempty" bson:"startTime,omitempty"`
+	EndTime   string `json:"endTime,omitempty" bson:"endTime,omitempty"`
+	// ExtractAudio drops the video stream; AudioFormat is "mp3" (default),
+	// "m4a", "opus" or "wav".
+	ExtractAudio bool   `json:"extractAudio,omitempty" bson:"extractAudio,omitempty"`
+	AudioFormat  string `json:"audioFormat,omitempty" bson:"audioFormat,omitempty"`
+	Title        string `json:"title,omitempty" bson:"title,omitempty"`
+	Artist       string `json:"artist,omitempty" bson:"artist,omitempty"`
+	Album        string `json:"album,omitempty" bson:"album,omitempty"`
+	// CoverArt embeds CoverURL, an https image URL on a public host, or the
+	// video's YouTube thumbnail when empty.
+	CoverArt          bool   `json:"coverArt,omitempty" bson:"coverArt,omitempty"`
+	CoverURL          string `json:"coverUrl,omitempty" bson:"coverUrl,omitempty"`
+	NormalizeLoudness bool   `json:"normalizeLoudness,omitempty" bson:"normalizeLoudness,omitempty"`
+	Waveform          bool   `json:"waveform,omitempty" bson:"waveform,omitempty"`
+	Thumbnail         bool   `json:"thumbnail,omitempty" bson:"thumbnail,omitempty"`
+}
+
+// Requested reports whether any step is enabled.
+func (o *MediaProcessingOptions) Requested() bool {
+	if o == nil {
+		return false
+	}
+	return o.StartTime != "" || o.EndTime != "" || o.ExtractAudio || o.Title != "" || o.Artist != "" ||
+		o.Album != "" || o.CoverArt || o.NormalizeLoudness || o.Waveform || o.Thumbnail
+}
@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// RefreshToken is a stored refresh token. Every refresh replaces it with a
+// new token of the same family; UsedAt marks a token that was replaced, so
+// presenting it again shows the family was stolen.
+type RefreshToken struct {
+	ID        string     `bson:"_id,omitempty" json:"_id,omitempty"`
+	TokenHash string     `json:"-" bson:"tokenHash"`
+	FamilyID  string     `json:"familyId" bson:"familyId"`
+	UserID    string     `json:"userId" bson:"userId"`
+	Email     string     `json:"email" bson:"email"`
+	SessionID string     `json:"sessionId" bson:"sessionId"`
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt" bson:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
+
+// RevokedToken rejects an access token (by jti) or every access token of a
+// refresh token family until ExpiresAt, when such tokens expire anyway.
+type RevokedToken struct {
+	ID        string    `bson:"_id,omitempty" json:"_id,omitempty"`
+	Kind      string    `json:"kind" bson:"kind"`
+	Value     string    `json:"value" bson:"value"`
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+// TokenPair is what a login or refresh returns to the client.
+type TokenPair struct {
+	AccessToken  string    `json:"token"`
+	RefreshToken string    `json:"refreshToken"`
+	TokenType    string    `json:"tokenType"`
+	ExpiresIn    int       `json:"expiresIn"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
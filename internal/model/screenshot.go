@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Screenshot is the metadata row for a single stored device capture. The image
+// itself lives in object storage under StorageKey.
+type Screenshot struct {
+	ID           string    `bson:"_id,omitempty" json:"_id,omitempty"`
+	DeviceName   string    `json:"deviceName" bson:"deviceName"`
+	CapturedAt   time.Time `json:"capturedAt" bson:"capturedAt"`
+	Storage      string    `json:"storage" bson:"storage"`
+	StorageKey   string    `json:"storageKey" bson:"storageKey"`
+	ThumbnailKey string    `json:"thumbnailKey,omitempty" bson:"thumbnailKey,omitempty"`
+	ContentType  string    `json:"contentType" bson:"contentType"`
+	SizeBytes    int       `json:"sizeBytes" bson:"sizeBytes"`
+	Width        int       `json:"width,omitempty" bson:"width,omitempty"`
+	Height       int       `json:"height,omitempty" bson:"height,omitempty"`
+	OSName       string    `json:"osName" bson:"osName"`
+	MemoryUsage  string    `json:"memoryUsage" bson:"memoryUsage"`
+	DiskUsage    string    `json:"diskUsage" bson:"diskUsage"`
+	ImageURL     string    `json:"imageUrl,omitempty" bson:"-"`
+	ThumbnailURL string    `json:"thumbnailUrl,omitempty" bson:"-"`
+}
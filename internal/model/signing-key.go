@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// SigningKey is a stored access token signing key. Keys take over from each
+// other in Generation order once ActivatesAt is reached; a key is published
+// in the JWKS before it activates and stays there until the tokens it signed
+// have expired.
+type SigningKey struct {
+	Kid         string    `json:"kid" bson:"_id"`
+	Algorithm   string    `json:"alg" bson:"algorithm"`
+	Generation  int       `json:"generation" bson:"generation"`
+	PrivateKey  string    `json:"-" bson:"privateKey"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+	ActivatesAt time.Time `json:"activatesAt" bson:"activatesAt"`
+}
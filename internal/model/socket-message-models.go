@@ -30,6 +30,7 @@ type ClipBoardSendRoomMessage struct {
 	IsAttachment       bool      				 `json:"isAttachment"   bson:"isAttachment"`
 	AttachmentType     string    			     `json:"attachmentType" bson:"attachmentType"`
 	AttachmentURL      string    				 `json:"attachmentURL"  bson:"attachmentURL"`
+	AttachmentKey      string    				 `json:"attachmentKey"  bson:"attachmentKey"`
 	DeviceInfo         ClipBoardRoomDeviceInfo   `json:"deviceInfo"     bson:"deviceInfo"`
 	IsAnonymous        bool                      `json:"isAnonymous"    bson:"isAnonymous"`
 }
@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// TwoFactor is a user's TOTP enrollment. The secret is pending until the
+// user confirms a first code, which enables it. Recovery codes are stored
+// hashed and removed as they are used; LastUsedStep stops a code from being
+// used twice.
+type TwoFactor struct {
+	UserID           string     `json:"userId" bson:"_id"`
+	Secret           string     `json:"-" bson:"secret"`
+	Enabled          bool       `json:"enabled" bson:"enabled"`
+	RequireForGoogle bool       `json:"requireForGoogle" bson:"requireForGoogle"`
+	RecoveryCodes    []string   `json:"-" bson:"recoveryCodes"`
+	LastUsedStep     int64      `json:"-" bson:"lastUsedStep"`
+	CreatedAt        time.Time  `json:"createdAt" bson:"createdAt"`
+	EnabledAt        *time.Time `json:"enabledAt,omitempty" bson:"enabledAt,omitempty"`
+}
+
+// TwoFactorChallenge is a login that passed the first factor and waits for
+// a code. It belongs to the session it was started in.
+type TwoFactorChallenge struct {
+	ID        string    `json:"_id,omitempty" bson:"_id,omitempty"`
+	TokenHash string    `json:"-" bson:"tokenHash"`
+	UserID    string    `json:"userId" bson:"userId"`
+	SessionID string    `json:"sessionId" bson:"sessionId"`
+	Method    string    `json:"method" bson:"method"`
+	FcmKey    string    `json:"fcmKey" bson:"fcmKey"`
+	Attempts  int       `json:"attempts" bson:"attempts"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+// TrustedDevice is a device a user asked to remember after a second factor.
+// Logins from it skip the code; the login activities it started point to it.
+type TrustedDevice struct {
+	ID         string    `json:"_id,omitempty" bson:"_id,omitempty"`
+	TokenHash  string    `json:"-" bson:"tokenHash"`
+	UserID     string    `json:"userId" bson:"userId"`
+	UserAgent  string    `json:"userAgent" bson:"userAgent"`
+	IP         string    `json:"ip" bson:"ip"`
+	CreatedAt  time.Time `json:"createdAt" bson:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt" bson:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt" bson:"expiresAt"`
+}
@@ -8,10 +8,18 @@ type User struct {
 	ID        string    `bson:"_id,omitempty" json:"_id,omitempty"`
 	Name      string    `bson:"name" validate:"required" json:"name"`
 	Username  string    `bson:"username" validate:"required" json:"username"`
-	Email     string    `bson:"email" validate:"required" json:"email"`
+	Email     string    `bson:"email" validate:"required,email" json:"email"`
 	Avatar    string    `bson:"avatar" json:"avatar"`
 	Password  string    `bson:"password" validate:"required" json:"password"`
 	Phone     string    `bson:"phone" json:"phone"`
 	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
 	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+	// EmailVerified is set once the user opened a verification link, or
+	// signed in with Google.
+	EmailVerified     bool       `bson:"emailVerified" json:"emailVerified"`
+	PasswordChangedAt *time.Time `bson:"passwordChangedAt,omitempty" json:"passwordChangedAt,omitempty"`
+	// Roles and Permissions grant access to the operational routes; see
+	// auth.Roles. Only admins can change them.
+	Roles       []string `bson:"roles,omitempty" json:"roles,omitempty"`
+	Permissions []string `bson:"permissions,omitempty" json:"permissions,omitempty"`
 }
@@ -0,0 +1,31 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Dedup hands out one value per key for Window: the first caller's value is
+// kept and callers within Window get it back instead of theirs, for example
+// the session created for a client that keeps asking for a new one.
+type Dedup struct {
+	Name   string
+	Window time.Duration
+	Store  Store
+}
+
+func (d *Dedup) key(key string) string {
+	return d.Name + ":" + key
+}
+
+// Claim returns the value kept for key, keeping value when there is none.
+// The caller's value won when the result equals it.
+func (d *Dedup) Claim(ctx context.Context, key string, value string) (string, error) {
+	return d.Store.Claim(ctx, d.key(key), value, d.Window)
+}
+
+// Release forgets value for key, if it is still the one kept, for when the
+// caller could not use it after all.
+func (d *Dedup) Release(ctx context.Context, key string, value string) error {
+	return d.Store.Release(ctx, d.key(key), value)
+}
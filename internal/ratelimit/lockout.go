@@ -0,0 +1,36 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Lockout locks a key for Lock once it failed Failures times within Window,
+// for example an account after repeated wrong passwords.
+type Lockout struct {
+	Name     string
+	Failures int
+	Window   time.Duration
+	Lock     time.Duration
+	Store    Store
+}
+
+func (l *Lockout) key(key string) string {
+	return l.Name + ":" + key
+}
+
+// LockedFor returns how long key stays locked, or zero.
+func (l *Lockout) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	return l.Store.LockedFor(ctx, l.key(key))
+}
+
+// Fail counts a failure of key. It returns how long key is now locked for
+// when this failure locked it.
+func (l *Lockout) Fail(ctx context.Context, key string) (time.Duration, error) {
+	return l.Store.Fail(ctx, l.key(key), l.Failures, l.Window, l.Lock)
+}
+
+// Succeed forgets the failures of key.
+func (l *Lockout) Succeed(ctx context.Context, key string) error {
+	return l.Store.Clear(ctx, l.key(key))
+}
@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"project-phoenix/v2/internal/cache"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Limit allows Requests per Window. They may all come at once; after that
+// one more is allowed every Window/Requests.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// ParseLimit reads a limit written as "10/1m": requests, a slash and a
+// duration.
+func ParseLimit(spec string) (Limit, error) {
+	requests, window, found := strings.Cut(strings.TrimSpace(spec), "/")
+	if !found {
+		return Limit{}, fmt.Errorf("rate limit %q is not requests/window", spec)
+	}
+	count, e := strconv.Atoi(strings.TrimSpace(requests))
+	if e != nil || count <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q needs a positive number of requests", spec)
+	}
+	duration, e := time.ParseDuration(strings.TrimSpace(window))
+	if e != nil || duration <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q needs a positive window", spec)
+	}
+	return Limit{Requests: count, Window: duration}, nil
+}
+
+func (l Limit) String() string {
+	return strconv.Itoa(l.Requests) + "/" + l.Window.String()
+}
+
+// interval is the time one request uses up, in milliseconds.
+func (l Limit) interval() int64 {
+	interval := l.Window.Milliseconds() / int64(l.Requests)
+	if interval < 1 {
+		return 1
+	}
+	return interval
+}
+
+// Result is the outcome of taking a request from a limit.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long to wait before a request is allowed again. It
+	// is zero for allowed requests.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the limit is back to full.
+	ResetAfter time.Duration
+}
+
+// Store keeps the state of limits, lockouts and de-duplicated values. Gateway replicas sharing a
+// Redis store share their limits.
+type Store interface {
+	// Take counts a request against the limit of key.
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+	// Fail counts a failure against key and returns how long key is locked
+	// for when it reached failures within window.
+	Fail(ctx context.Context, key string, failures int, window time.Duration, lock time.Duration) (time.Duration, error)
+	// LockedFor returns how long key stays locked.
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	// Clear forgets the failures and lock of key.
+	Clear(ctx context.Context, key string) error
+	// Claim keeps value for key for ttl unless key has a value already, and
+	// returns the value kept.
+	Claim(ctx context.Context, key string, value string, ttl time.Duration) (string, error)
+	// Release forgets the value of key if it is value.
+	Release(ctx context.Context, key string, value string) error
+}
+
+// NewStore returns a store on the shared Redis, or one in memory when Redis
+// is disabled. Limits kept in memory apply to each gateway replica alone.
+func NewStore() Store {
+	redisCache := cache.GetInstance()
+	if redisCache != nil {
+		if client, ok := redisCache.GetClient().(*redis.Client); ok && client != nil {
+			return &RedisStore{client: client}
+		}
+	}
+	log.Println("Rate Limit | Redis is disabled, keeping limits in memory")
+	return NewMemoryStore()
+}
+
+// gcra is the generic cell rate algorithm behind Take. tat is when the limit
+// would be full again, in milliseconds; it returns the new one and the
+// result. The Redis script does the same.
+func gcra(tat int64, now int64, limit Limit) (int64, Result) {
+	interval := limit.interval()
+	window := interval * int64(limit.Requests)
+	if tat < now {
+		tat = now
+	}
+	next := tat + interval
+	result := Result{Limit: limit.Requests}
+	if allowAt := next - window; now < allowAt {
+		result.RetryAfter = time.Duration(allowAt-now) * time.Millisecond
+		result.ResetAfter = time.Duration(tat-now) * time.Millisecond
+		return tat, result
+	}
+	result.Allowed = true
+	result.Remaining = int((window - (next - now)) / interval)
+	result.ResetAfter = time.Duration(next-now) * time.Millisecond
+	return next, result
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	limit, e := ParseLimit(" 10 / 1m ")
+	if e != nil || limit != (Limit{Requests: 10, Window: time.Minute}) {
+		t.Fatalf("got %v, %v", limit, e)
+	}
+	for _, spec := range []string{"", "10", "0/1m", "10/0s", "x/1m", "10/soon"} {
+		if _, e := ParseLimit(spec); e == nil {
+			t.Fatalf("%q should not parse", spec)
+		}
+	}
+}
+
+func TestTakeAllowsBurstThenRefills(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 3, Window: 3 * time.Second}
+	now := time.Unix(1000, 0)
+	for i := 2; i >= 0; i-- {
+		result, _ := store.Take(context.Background(), "ip", limit, now)
+		if !result.Allowed || result.Remaining != i {
+			t.Fatalf("request %d: got %+v", 3-i, result)
+		}
+	}
+	result, _ := store.Take(context.Background(), "ip", limit, now)
+	if result.Allowed || result.RetryAfter != time.Second || result.ResetAfter != 3*time.Second {
+		t.Fatalf("over the limit: got %+v", result)
+	}
+	if other, _ := store.Take(context.Background(), "other", limit, now); !other.Allowed {
+		t.Fatal("keys should not share a limit")
+	}
+	result, _ = store.Take(context.Background(), "ip", limit, now.Add(time.Second))
+	if !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("after a second: got %+v", result)
+	}
+	result, _ = store.Take(context.Background(), "ip", limit, now.Add(10*time.Second))
+	if !result.Allowed || result.Remaining != 2 {
+		t.Fatalf("after the window: got %+v", result)
+	}
+}
+
+func TestLockout(t *testing.T) {
+	lockout := &Lockout{Name: "login", Failures: 3, Window: time.Minute, Lock: time.Minute, Store: NewMemoryStore()}
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if locked, _ := lockout.Fail(ctx, "a"); locked != 0 {
+			t.Fatalf("failure %d locked", i+1)
+		}
+	}
+	if locked, _ := lockout.LockedFor(ctx, "a"); locked != 0 {
+		t.Fatal("locked too early")
+	}
+	if locked, _ := lockout.Fail(ctx, "a"); locked != time.Minute {
+		t.Fatalf("third failure: got %v", locked)
+	}
+	if locked, _ := lockout.LockedFor(ctx, "a"); locked <= 0 {
+		t.Fatal("should be locked")
+	}
+	if locked, _ := lockout.LockedFor(ctx, "b"); locked != 0 {
+		t.Fatal("keys should not share a lock")
+	}
+	lockout.Succeed(ctx, "a")
+	if locked, _ := lockout.LockedFor(ctx, "a"); locked != 0 {
+		t.Fatal("should be unlocked")
+	}
+}
+
+func TestDedup(t *testing.T) {
+	dedup := &Dedup{Name: "session", Window: 50 * time.Millisecond, Store: NewMemoryStore()}
+	ctx := context.Background()
+	if kept, _ := dedup.Claim(ctx, "a", "first"); kept != "first" {
+		t.Fatalf("first claim: got %q", kept)
+	}
+	if kept, _ := dedup.Claim(ctx, "a", "second"); kept != "first" {
+		t.Fatalf("second claim: got %q, want the first value", kept)
+	}
+	if kept, _ := dedup.Claim(ctx, "b", "other"); kept != "other" {
+		t.Fatalf("keys should not share a value, got %q", kept)
+	}
+	dedup.Release(ctx, "a", "second")
+	if kept, _ := dedup.Claim(ctx, "a", "third"); kept != "first" {
+		t.Fatalf("releasing another value: got %q", kept)
+	}
+	dedup.Release(ctx, "a", "first")
+	if kept, _ := dedup.Claim(ctx, "a", "fourth"); kept != "fourth" {
+		t.Fatalf("after release: got %q", kept)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if kept, _ := dedup.Claim(ctx, "a", "fifth"); kept != "fifth" {
+		t.Fatalf("after the window: got %q", kept)
+	}
+}
@@ -0,0 +1,219 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript is gcra on Redis. It returns whether the request is allowed and
+// the new theoretical arrival time.
+var takeScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local window = tonumber(ARGV[3])
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then tat = now end
+local nextTat = tat + interval
+if now < nextTat - window then
+  return {0, tat}
+end
+redis.call('SET', KEYS[1], nextTat, 'PX', nextTat - now)
+return {1, nextTat}
+`)
+
+// failScript counts a failure and swaps the count for a lock once it reaches
+// the limit. It returns the lock in milliseconds, or 0.
+var failScript = redis.NewScript(`
+local failures = redis.call('INCR', KEYS[1])
+if failures == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[2]) end
+if failures >= tonumber(ARGV[1]) then
+  redis.call('SET', KEYS[2], 1, 'PX', ARGV[3])
+  redis.call('DEL', KEYS[1])
+  return tonumber(ARGV[3])
+end
+return 0
+`)
+
+// claimScript keeps a value unless the key has one, and returns the kept
+// value.
+var claimScript = redis.NewScript(`
+local kept = redis.call('GET', KEYS[1])
+if kept then return kept end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return ARGV[1]
+`)
+
+// releaseScript deletes a key if it still holds the value.
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisStore keeps limits in Redis, shared by every gateway replica.
+type RedisStore struct {
+	client *redis.Client
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	nowMs := now.UnixMilli()
+	interval := limit.interval()
+	reply, e := takeScript.Run(ctx, s.client, []string{"ratelimit:" + key}, nowMs, interval, interval*int64(limit.Requests)).Int64Slice()
+	if e != nil {
+		return Result{}, e
+	}
+	// Replay the decision locally for the numbers of the result.
+	_, result := gcra(reply[1]-interval*reply[0], nowMs, limit)
+	return result, nil
+}
+
+func (s *RedisStore) Fail(ctx context.Context, key string, failures int, window time.Duration, lock time.Duration) (time.Duration, error) {
+	locked, e := failScript.Run(ctx, s.client, []string{"lockout:failures:" + key, "lockout:" + key}, failures, window.Milliseconds(), lock.Milliseconds()).Int64()
+	if e != nil {
+		return 0, e
+	}
+	return time.Duration(locked) * time.Millisecond, nil
+}
+
+func (s *RedisStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, e := s.client.PTTL(ctx, "lockout:"+key).Result()
+	if e != nil || ttl < 0 {
+		return 0, e
+	}
+	return ttl, nil
+}
+
+func (s *RedisStore) Clear(ctx context.Context, key string) error {
+	return s.client.Del(ctx, "lockout:failures:"+key, "lockout:"+key).Err()
+}
+
+func (s *RedisStore) Claim(ctx context.Context, key string, value string, ttl time.Duration) (string, error) {
+	return claimScript.Run(ctx, s.client, []string{"dedup:" + key}, value, ttl.Milliseconds()).Text()
+}
+
+func (s *RedisStore) Release(ctx context.Context, key string, value string) error {
+	return releaseScript.Run(ctx, s.client, []string{"dedup:" + key}, value).Err()
+}
+
+// memorySweepSize is how many limits a MemoryStore holds before it drops
+// the ones that are full again.
+const memorySweepSize = 10000
+
+// MemoryStore keeps limits in this process.
+type MemoryStore struct {
+	mutex    sync.Mutex
+	tats     map[string]int64
+	failures map[string]memoryFailures
+	locks    map[string]time.Time
+	claims   map[string]memoryClaim
+}
+
+type memoryClaim struct {
+	value   string
+	expires time.Time
+}
+
+type memoryFailures struct {
+	count   int
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tats:     map[string]int64{},
+		failures: map[string]memoryFailures{},
+		locks:    map[string]time.Time{},
+		claims:   map[string]memoryClaim{},
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.tats) >= memorySweepSize {
+		for stale, tat := range s.tats {
+			if tat <= now.UnixMilli() {
+				delete(s.tats, stale)
+			}
+		}
+	}
+	tat, result := gcra(s.tats[key], now.UnixMilli(), limit)
+	if tat <= now.UnixMilli() {
+		delete(s.tats, key)
+	} else {
+		s.tats[key] = tat
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) Fail(ctx context.Context, key string, failures int, window time.Duration, lock time.Duration) (time.Duration, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	counted := s.failures[key]
+	if !now.Before(counted.expires) {
+		counted = memoryFailures{expires: now.Add(window)}
+	}
+	counted.count++
+	if counted.count >= failures {
+		delete(s.failures, key)
+		s.locks[key] = now.Add(lock)
+		return lock, nil
+	}
+	s.failures[key] = counted
+	return 0, nil
+}
+
+func (s *MemoryStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	until, ok := s.locks[key]
+	if !ok {
+		return 0, nil
+	}
+	left := time.Until(until)
+	if left <= 0 {
+		delete(s.locks, key)
+		return 0, nil
+	}
+	return left, nil
+}
+
+func (s *MemoryStore) Clear(ctx context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.failures, key)
+	delete(s.locks, key)
+	return nil
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, key string, value string, ttl time.Duration) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	if len(s.claims) >= memorySweepSize {
+		for stale, claim := range s.claims {
+			if !now.Before(claim.expires) {
+				delete(s.claims, stale)
+			}
+		}
+	}
+	if claim, ok := s.claims[key]; ok && now.Before(claim.expires) {
+		return claim.value, nil
+	}
+	s.claims[key] = memoryClaim{value: value, expires: now.Add(ttl)}
+	return value, nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string, value string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.claims[key].value == value {
+		delete(s.claims, key)
+	}
+	return nil
+}
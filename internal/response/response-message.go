@@ -103,6 +103,89 @@ var responseMessage = map[int]string{
 	1093: "Room Not Updated",
 	1094: "Visits Fetched",
 	1095: "Visits Not Fetched",
+	1096: "Room Message Updated",
+	1097: "Room Message Not Updated",
+	1098: "Room Message Deleted",
+	1099: "Room Message Not Deleted",
+	1100: "Room Message Not Found",
+	1101: "Device Command Sent",
+	1102: "Device Command Not Sent",
+	1103: "Device Command Found",
+	1104: "Device Command Not Found",
+	1105: "Device Commands Found",
+	1106: "Invalid Device Command",
+	1107: "Device Schedule Updated",
+	1108: "Device Schedule Not Updated",
+	1109: "Invalid Device Schedule",
+	1110: "Screenshots Found",
+	1111: "Screenshots Not Found",
+	1112: "Device Uptime Found",
+	1113: "Device Watch Updated",
+	1114: "Device Watch Not Updated",
+	1115: "Device Metrics Found",
+	1116: "Device Metrics Not Found",
+	1117: "Device Enrolled",
+	1118: "Device Enrollment Failed",
+	1119: "Device Token Revoked",
+	1120: "Device Token Not Revoked",
+	1121: "Download Found",
+	1122: "Download Not Found",
+	1123: "Downloads Found",
+	1124: "Download Cancelled",
+	1125: "Download Not Cancelled",
+	1126: "Attachment Uploaded",
+	1127: "Attachment Not Uploaded",
+	1128: "Invalid Download Options",
+	1129: "Batch Download Created",
+	1130: "Batch Download Not Created",
+	1131: "Batch Download Found",
+	1132: "Batch Download Not Found",
+	1133: "Batch Download Cancelled",
+	1134: "Batch Download Not Cancelled",
+	1135: "Device Is Owned By Another User",
+	1136: "Token Refreshed",
+	1137: "Token Not Refreshed",
+	1138: "Refresh Token Reused, Please Login Again",
+	1139: "Access Token Invalid",
+	1140: "Access Token Expired",
+	1141: "Email Verified",
+	1142: "Email Could Not Be Verified",
+	1143: "Email Is Already Verified",
+	1144: "Verification Email Sent",
+	1145: "Unable To Send Verification Email",
+	1146: "If The Email Is Registered, A Reset Link Was Sent",
+	1147: "Password Reset",
+	1148: "Unable To Reset Password",
+	1149: "Password Changed",
+	1150: "Unable To Change Password",
+	1151: "Password Is Too Short",
+	1152: "Profile Updated",
+	1153: "Unable To Update Profile",
+	1154: "Registration Details Are Invalid",
+	1155: "This Username Already Exists",
+	1156: "Two-Factor Code Required",
+	1157: "Two-Factor Login Expired, Log In Again",
+	1158: "Invalid Two-Factor Code",
+	1159: "Two-Factor Status Fetched",
+	1160: "Two-Factor Setup Started",
+	1161: "Two-Factor Authentication Enabled",
+	1162: "Two-Factor Authentication Disabled",
+	1163: "Two-Factor Authentication Is Already Enabled",
+	1164: "Two-Factor Authentication Is Not Enabled",
+	1165: "Two-Factor Settings Updated",
+	1166: "Recovery Codes Generated",
+	1167: "Remembered Devices Forgotten",
+	1168: "Session Signed Out",
+	1169: "Unable To Sign Out Session",
+	1170: "Other Sessions Signed Out",
+	1171: "Login Session Not Found",
+	1172: "You Do Not Have Permission For This",
+	1173: "Roles Fetched",
+	1174: "Roles Updated",
+	1175: "Unable To Update Roles",
+	1176: "Unknown Role Or Permission",
+	1177: "Too Many Requests",
+	1178: "Too Many Failed Logins. Try Again Later",
 }
 
 type MessageResponse struct {
@@ -117,6 +200,13 @@ func SendResponse(w http.ResponseWriter, responseCode int, response interface{})
 	json.NewEncoder(w).Encode(extractMessage(responseCode, response))
 }
 
+// SendStatusResponse is SendResponse with an HTTP status other than 200.
+func SendStatusResponse(w http.ResponseWriter, status int, responseCode int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(extractMessage(responseCode, response))
+}
+
 func SendErrorResponse(w http.ResponseWriter, responseCode int, response interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusInternalServerError)
@@ -7,7 +7,7 @@ import (
 )
 
 type ServiceConfig struct {
-	Port                   string               `json:"port`
+	Port                   string               `json:"port"`
 	ServiceName            string               `json:"serviceName"`
 	ServiceExchange        string               `json:"serviceExchange"`
 	ServiceQueue           string               `json:"serviceQueue"`
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCleanKey(t *testing.T) {
+	for _, tc := range []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{key: "clipboard/abc/file.txt", want: "clipboard/abc/file.txt"},
+		{key: "/clipboard/abc/file.txt", want: "clipboard/abc/file.txt"},
+		{key: `clipboard\abc\file.txt`, want: "clipboard/abc/file.txt"},
+		{key: "a/..b/c", want: "a/..b/c"},
+		{key: "", wantErr: true},
+		{key: "/", wantErr: true},
+		{key: "..", wantErr: true},
+		{key: "../etc/passwd", wantErr: true},
+		{key: "clipboard/../../etc/passwd", wantErr: true},
+		{key: `clipboard\..\..\etc\passwd`, wantErr: true},
+		{key: "/../secret", wantErr: true},
+	} {
+		got, err := CleanKey(tc.key)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("CleanKey(%q) = %q, want an error", tc.key, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("CleanKey(%q) = %q, %v, want %q", tc.key, got, err, tc.want)
+		}
+	}
+}
+
+// serve requests a signed URL from storage and returns the response.
+func serve(storage *LocalStorage, signedURL string) *httptest.ResponseRecorder {
+	parsed, _ := url.Parse(signedURL)
+	recorder := httptest.NewRecorder()
+	storage.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, parsed.RequestURI(), nil))
+	return recorder
+}
+
+func TestLocalStorageServeHTTP(t *testing.T) {
+	ctx := context.Background()
+	storage := NewLocalStorage(t.TempDir(), "http://files.test", []byte("secret"))
+	if err := storage.Put(ctx, "clipboard/abc/note.txt", strings.NewReader("hello"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(ctx, "clipboard/abc/other.txt", strings.NewReader("other"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := storage.SignedURL(ctx, "clipboard/abc/note.txt", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("valid signature", func(t *testing.T) {
+		response := serve(storage, signed)
+		if response.Code != http.StatusOK || response.Body.String() != "hello" {
+			t.Fatalf("got %d %q, want 200 %q", response.Code, response.Body.String(), "hello")
+		}
+	})
+
+	t.Run("tampered signature", func(t *testing.T) {
+		tampered := signed[:len(signed)-1] + "0"
+		if strings.HasSuffix(signed, "0") {
+			tampered = signed[:len(signed)-1] + "1"
+		}
+		if response := serve(storage, tampered); response.Code != http.StatusForbidden {
+			t.Fatalf("got %d, want 403", response.Code)
+		}
+	})
+
+	t.Run("signature of another key", func(t *testing.T) {
+		other := strings.Replace(signed, "note.txt", "other.txt", 1)
+		if response := serve(storage, other); response.Code != http.StatusForbidden {
+			t.Fatalf("got %d, want 403", response.Code)
+		}
+	})
+
+	t.Run("extended expiry", func(t *testing.T) {
+		parsed, _ := url.Parse(signed)
+		query := parsed.Query()
+		query.Set("expires", "99999999999")
+		parsed.RawQuery = query.Encode()
+		if response := serve(storage, parsed.String()); response.Code != http.StatusForbidden {
+			t.Fatalf("got %d, want 403", response.Code)
+		}
+	})
+
+	t.Run("other secret", func(t *testing.T) {
+		other := NewLocalStorage(storage.root, "http://files.test", []byte("another secret"))
+		if response := serve(other, signed); response.Code != http.StatusForbidden {
+			t.Fatalf("got %d, want 403", response.Code)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		expired, err := storage.SignedURL(ctx, "clipboard/abc/note.txt", -time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response := serve(storage, expired); response.Code != http.StatusForbidden {
+			t.Fatalf("got %d, want 403", response.Code)
+		}
+	})
+
+	t.Run("missing expiry", func(t *testing.T) {
+		parsed, _ := url.Parse(signed)
+		parsed.RawQuery = "signature=" + parsed.Query().Get("signature")
+		if response := serve(storage, parsed.String()); response.Code != http.StatusForbidden {
+			t.Fatalf("got %d, want 403", response.Code)
+		}
+	})
+
+	t.Run("missing object", func(t *testing.T) {
+		missing, err := storage.SignedURL(ctx, "clipboard/abc/gone.txt", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response := serve(storage, missing); response.Code != http.StatusNotFound {
+			t.Fatalf("got %d, want 404", response.Code)
+		}
+	})
+
+	t.Run("path traversal", func(t *testing.T) {
+		expires := time.Now().Add(time.Minute).Unix()
+		request := httptest.NewRequest(http.MethodGet, LocalFilesPath, nil)
+		request.URL.Path = LocalFilesPath + "../outside.txt"
+		request.URL.RawQuery = "expires=" + strconv.FormatInt(expires, 10) + "&signature=" + storage.signature("../outside.txt", expires)
+		recorder := httptest.NewRecorder()
+		storage.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusNotFound {
+			t.Fatalf("got %d, want 404", recorder.Code)
+		}
+	})
+}
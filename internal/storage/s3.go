@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"project-phoenix/v2/internal/aws"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3Storage stores objects in S3 or an S3-compatible server such as MinIO
+// (set S3_ENDPOINT).
+type S3Storage struct {
+	service *aws.S3Service
+}
+
+func NewS3StorageFromEnv() (*S3Storage, error) {
+	service, _, err := aws.NewS3ServiceFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return &S3Storage{service: service}, nil
+}
+
+func (s *S3Storage) Name() string {
+	return BackendS3
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	key, err := CleanKey(key)
+	if err != nil {
+		return err
+	}
+	return s.service.PutFileStream(ctx, key, body, contentType)
+}
+
+func (s *S3Storage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	body, err := s.service.GetFileStream(ctx, key)
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
+func (s *S3Storage) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	minutes := int(ttl / time.Minute)
+	if minutes < 1 {
+		minutes = 1
+	}
+	return s.service.GetPresignedUrl(ctx, key, minutes)
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	return s.service.DeleteFile(ctx, key)
+}
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	head, err := s.service.HeadFile(ctx, key)
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	info := &ObjectInfo{Key: key}
+	if head.ContentLength != nil {
+		info.Size = *head.ContentLength
+	}
+	if head.ContentType != nil {
+		info.ContentType = *head.ContentType
+	}
+	if head.LastModified != nil {
+		info.LastModified = *head.LastModified
+	}
+	return info, nil
+}
+
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects, err := s.service.ListFiles(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]ObjectInfo, 0, len(objects))
+	for _, object := range objects {
+		info := ObjectInfo{}
+		if object.Key != nil {
+			info.Key = *object.Key
+		}
+		if object.Size != nil {
+			info.Size = *object.Size
+		}
+		if object.LastModified != nil {
+			info.LastModified = *object.LastModified
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	BackendS3    = "s3"
+	BackendLocal = "local"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"contentType"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// Storage is the object store used for downloads, clipboard attachments and
+// screenshots. Keys are slash separated and never start with a slash.
+type Storage interface {
+	// Name is the backend recorded next to stored keys, "s3" or "local".
+	Name() string
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	// Open returns the object's content; the caller closes it.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// SignedURL returns a URL anyone can use to fetch the object until ttl passes.
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+	// Delete removes an object; deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+var (
+	once     sync.Once
+	instance Storage
+)
+
+// GetInstance returns the backend chosen by STORAGE_BACKEND ("s3", "minio"
+// or "local"). Without it, S3 is used when its env variables are present and
+// local disk otherwise. It returns nil if the chosen backend cannot start.
+func GetInstance() Storage {
+	once.Do(func() {
+		godotenv.Load()
+		backend, err := newFromEnv(strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_BACKEND"))))
+		if err != nil {
+			log.Println("Unable to initialize object storage:", err)
+			return
+		}
+		log.Println("Object storage backend:", backend.Name())
+		instance = backend
+	})
+	return instance
+}
+
+func newFromEnv(kind string) (Storage, error) {
+	switch kind {
+	case "s3", "minio":
+		return NewS3StorageFromEnv()
+	case "local":
+		return NewLocalStorageFromEnv(), nil
+	case "":
+		if s3Storage, err := NewS3StorageFromEnv(); err == nil {
+			return s3Storage, nil
+		}
+		return NewLocalStorageFromEnv(), nil
+	}
+	return nil, errors.New("unknown STORAGE_BACKEND " + kind)
+}
+
+// CleanKey rejects keys that would escape the storage root.
+func CleanKey(key string) (string, error) {
+	key = strings.TrimLeft(strings.ReplaceAll(key, "\\", "/"), "/")
+	if key == "" {
+		return "", errors.New("empty storage key")
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." {
+			return "", errors.New("invalid storage key " + key)
+		}
+	}
+	return key, nil
+}
@@ -42,7 +42,8 @@ func main() {
 			serviceTypeFlag := c.String("service-name")
 			portFlag := c.Int("port")
 
-			ctx, _ := context.WithCancel(context.Background())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
 			service := micro.NewService(
 				micro.Name(serviceTypeFlag),
 				micro.Address(fmt.Sprintf(":0")),
@@ -74,6 +74,71 @@ func (apiHandler APIRequestHandler) DELETERoutes(w http.ResponseWriter, r *http.
 			response.SendResponse(w, code, message)
 			return
 		}
+	case apiRequestHandlerObj.Endpoint + "/download":
+		log.Println("Cancel Download")
+		controller := controllers.GetControllerInstance(enum.DownloadJobController, enum.MONGODB)
+		downloadJobController := controller.(*controllers.DownloadJobController)
+		code, data, e := downloadJobController.CancelDownload(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
+	case apiRequestHandlerObj.Endpoint + "/download-batch":
+		log.Println("Cancel Batch Download")
+		controller := controllers.GetControllerInstance(enum.DownloadBatchController, enum.MONGODB)
+		downloadBatchController := controller.(*controllers.DownloadBatchController)
+		code, data, e := downloadBatchController.CancelBatchDownload(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
+	case apiRequestHandlerObj.Endpoint + "/session":
+		log.Println("Sign Out Session")
+		controller := controllers.GetControllerInstance(enum.LoginActivityController, enum.MONGODB)
+		loginActivityController := controller.(*controllers.LoginActivityController)
+		code, data, e := loginActivityController.RevokeSession(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
+	case apiRequestHandlerObj.Endpoint + "/sessions/others":
+		log.Println("Sign Out Other Sessions")
+		controller := controllers.GetControllerInstance(enum.LoginActivityController, enum.MONGODB)
+		loginActivityController := controller.(*controllers.LoginActivityController)
+		code, data, e := loginActivityController.RevokeOtherSessions(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
+	case apiRequestHandlerObj.Endpoint + "/2fa/trusted-devices":
+		controller := controllers.GetControllerInstance(enum.TwoFactorController, enum.MONGODB)
+		twoFactorController := controller.(*controllers.TwoFactorController)
+		code, data, e := twoFactorController.ForgetTrustedDevices(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
+	case apiRequestHandlerObj.Endpoint + "/device/token":
+		log.Println("Revoke Device Token")
+		controller := controllers.GetControllerInstance(enum.DeviceCredentialController, enum.MONGODB)
+		deviceCredentialController := controller.(*controllers.DeviceCredentialController)
+		code, data, e := deviceCredentialController.RevokeToken(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
 	case apiRequestHandlerObj.Endpoint + "/device":
 		log.Println("Delete Device")
 		controller := controllers.GetControllerInstance(enum.CaptureScreenController, enum.MONGODB)
@@ -85,6 +150,17 @@ func (apiHandler APIRequestHandler) DELETERoutes(w http.ResponseWriter, r *http.
 		}
 		response.SendResponse(w, code, nil)
 		return
+	case apiRequestHandlerObj.Endpoint + "/room/message":
+		log.Println("Delete Room Message")
+		controller := controllers.GetControllerInstance(enum.ClipboardRoomController, enum.MONGODB)
+		clipboardRoomController := controller.(*controllers.ClipboardRoomController)
+		code, data, e := clipboardRoomController.HandleMessageAction(w, r, enum.CLIPBOARD_MESSAGE_DELETED)
+		if e != nil {
+			response.SendResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
 	case apiRequestHandlerObj.Endpoint + "/llm-api-config":
 		log.Println("Delete LLM API Config")
 		controller := controllers.GetControllerInstance(enum.LLMAPIConfigController, enum.MONGODB)
@@ -101,10 +177,6 @@ func (apiHandler APIRequestHandler) DELETERoutes(w http.ResponseWriter, r *http.
 		if len(r.URL.Path) > len(apiRequestHandlerObj.Endpoint+"/config/queries/") &&
 			r.URL.Path[:len(apiRequestHandlerObj.Endpoint+"/config/queries/")] == apiRequestHandlerObj.Endpoint+"/config/queries/" {
 			log.Println("Delete Search Query")
-			// TODO: Add authentication later
-			// if !ValidateSession(w, r) {
-			// 	return
-			// }
 
 			// Extract ID from path
 			idStr := r.URL.Path[len(apiRequestHandlerObj.Endpoint+"/config/queries/"):]
@@ -132,6 +204,60 @@ func (apiHandler APIRequestHandler) DELETERoutes(w http.ResponseWriter, r *http.
 
 func (apiHandler APIRequestHandler) PUTRoutes(w http.ResponseWriter, r *http.Request) {
 	switch r.URL.Path {
+	case apiRequestHandlerObj.Endpoint + "/2fa":
+		controller := controllers.GetControllerInstance(enum.TwoFactorController, enum.MONGODB)
+		twoFactorController := controller.(*controllers.TwoFactorController)
+		code, data, e := twoFactorController.UpdateTwoFactor(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
+	case apiRequestHandlerObj.Endpoint + "/admin/user/roles":
+		controller := controllers.GetControllerInstance(enum.UserController, enum.MONGODB)
+		userController := controller.(*controllers.UserController)
+		code, res, data, ok := userController.SetUserRoles(w, r)
+		if ok != nil {
+			response.SendResponse(w, code, res)
+			return
+		} else {
+			response.SendResponse(w, code, data)
+			return
+		}
+	case apiRequestHandlerObj.Endpoint + "/profile":
+		controller := controllers.GetControllerInstance(enum.UserController, enum.MONGODB)
+		userController := controller.(*controllers.UserController)
+		code, res, data, ok := userController.UpdateProfile(w, r)
+		if ok != nil {
+			response.SendResponse(w, code, res)
+			return
+		} else {
+			response.SendResponse(w, code, data)
+			return
+		}
+	case apiRequestHandlerObj.Endpoint + "/device/schedule":
+		log.Println("Set Device Capture Schedule")
+		controller := controllers.GetControllerInstance(enum.CaptureScreenController, enum.MONGODB)
+		captureScreenController := controller.(*controllers.CaptureScreenController)
+		code, data, e := captureScreenController.SetCaptureSchedule(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
+	case apiRequestHandlerObj.Endpoint + "/device/watch":
+		log.Println("Set Device Watch")
+		controller := controllers.GetControllerInstance(enum.CaptureScreenController, enum.MONGODB)
+		captureScreenController := controller.(*controllers.CaptureScreenController)
+		code, data, e := captureScreenController.SetDeviceWatch(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
 	case apiRequestHandlerObj.Endpoint + "/createSession":
 		controller := controllers.GetControllerInstance(enum.SessionController, enum.MONGODB)
 		sessionController := controller.(*controllers.SessionController)
@@ -156,6 +282,17 @@ func (apiHandler APIRequestHandler) PUTRoutes(w http.ResponseWriter, r *http.Req
 			return
 		}
 		break
+	case apiRequestHandlerObj.Endpoint + "/room/message":
+		log.Println("Edit Room Message")
+		controller := controllers.GetControllerInstance(enum.ClipboardRoomController, enum.MONGODB)
+		clipboardRoomController := controller.(*controllers.ClipboardRoomController)
+		code, data, e := clipboardRoomController.HandleMessageAction(w, r, enum.CLIPBOARD_MESSAGE_EDITED)
+		if e != nil {
+			response.SendResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
 	case apiRequestHandlerObj.Endpoint + "/llm-api-config":
 		log.Println("Update LLM API Config")
 		controller := controllers.GetControllerInstance(enum.LLMAPIConfigController, enum.MONGODB)
@@ -193,6 +330,9 @@ func POSTRoutes(w http.ResponseWriter, r *http.Request) {
 		if ok != nil {
 			response.SendResponse(w, code, res)
 			return
+		} else if code == int(enum.LOGIN_LOCKED) {
+			response.SendStatusResponse(w, http.StatusTooManyRequests, code, data)
+			return
 		} else {
 			response.SendResponse(w, code, data)
 			return
@@ -231,6 +371,128 @@ func POSTRoutes(w http.ResponseWriter, r *http.Request) {
 			response.SendResponse(w, code, data)
 			return
 		}
+	case apiRequestHandlerObj.Endpoint + "/token/refresh":
+		log.Println("Refresh Token")
+		controller := controllers.GetControllerInstance(enum.RefreshTokenController, enum.MONGODB)
+		refreshTokenController := controller.(*controllers.RefreshTokenController)
+		code, data, e := refreshTokenController.RefreshToken(w, r)
+		if e != nil {
+			log.Println("Unable to refresh token", e)
+			response.SendResponse(w, code, nil)
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
+	case apiRequestHandlerObj.Endpoint + "/email/verify":
+		controller := controllers.GetControllerInstance(enum.UserController, enum.MONGODB)
+		userController := controller.(*controllers.UserController)
+		code, res, data, ok := userController.VerifyEmail(w, r)
+		if ok != nil {
+			response.SendResponse(w, code, res)
+			return
+		} else {
+			response.SendResponse(w, code, data)
+			return
+		}
+	case apiRequestHandlerObj.Endpoint + "/email/verification":
+		controller := controllers.GetControllerInstance(enum.UserController, enum.MONGODB)
+		userController := controller.(*controllers.UserController)
+		code, res, data, ok := userController.ResendVerification(w, r)
+		if ok != nil {
+			response.SendResponse(w, code, res)
+			return
+		} else {
+			response.SendResponse(w, code, data)
+			return
+		}
+	case apiRequestHandlerObj.Endpoint + "/password/forgot":
+		controller := controllers.GetControllerInstance(enum.UserController, enum.MONGODB)
+		userController := controller.(*controllers.UserController)
+		code, res, data, ok := userController.ForgotPassword(w, r)
+		if ok != nil {
+			response.SendResponse(w, code, res)
+			return
+		} else {
+			response.SendResponse(w, code, data)
+			return
+		}
+	case apiRequestHandlerObj.Endpoint + "/password/reset":
+		controller := controllers.GetControllerInstance(enum.UserController, enum.MONGODB)
+		userController := controller.(*controllers.UserController)
+		code, res, data, ok := userController.ResetPassword(w, r)
+		if ok != nil {
+			response.SendResponse(w, code, res)
+			return
+		} else {
+			response.SendResponse(w, code, data)
+			return
+		}
+	case apiRequestHandlerObj.Endpoint + "/password/change":
+		controller := controllers.GetControllerInstance(enum.UserController, enum.MONGODB)
+		userController := controller.(*controllers.UserController)
+		code, res, data, ok := userController.ChangePassword(w, r)
+		if ok != nil {
+			response.SendResponse(w, code, res)
+			return
+		} else {
+			response.SendResponse(w, code, data)
+			return
+		}
+	case apiRequestHandlerObj.Endpoint + "/login/2fa":
+		log.Println("Complete Two-Factor Login")
+		controller := controllers.GetControllerInstance(enum.UserController, enum.MONGODB)
+		userController := controller.(*controllers.UserController)
+		code, res, data, ok := userController.CompleteTwoFactorLogin(w, r)
+		if ok != nil {
+			response.SendResponse(w, code, res)
+			return
+		} else if code == int(enum.LOGIN_LOCKED) {
+			response.SendStatusResponse(w, http.StatusTooManyRequests, code, data)
+			return
+		} else {
+			response.SendResponse(w, code, data)
+			return
+		}
+	case apiRequestHandlerObj.Endpoint + "/2fa/setup":
+		controller := controllers.GetControllerInstance(enum.TwoFactorController, enum.MONGODB)
+		twoFactorController := controller.(*controllers.TwoFactorController)
+		code, data, e := twoFactorController.SetupTwoFactor(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
+	case apiRequestHandlerObj.Endpoint + "/2fa/enable":
+		controller := controllers.GetControllerInstance(enum.TwoFactorController, enum.MONGODB)
+		twoFactorController := controller.(*controllers.TwoFactorController)
+		code, data, e := twoFactorController.EnableTwoFactor(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
+	case apiRequestHandlerObj.Endpoint + "/2fa/disable":
+		controller := controllers.GetControllerInstance(enum.TwoFactorController, enum.MONGODB)
+		twoFactorController := controller.(*controllers.TwoFactorController)
+		code, data, e := twoFactorController.DisableTwoFactor(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
+	case apiRequestHandlerObj.Endpoint + "/2fa/recovery-codes":
+		controller := controllers.GetControllerInstance(enum.TwoFactorController, enum.MONGODB)
+		twoFactorController := controller.(*controllers.TwoFactorController)
+		code, data, e := twoFactorController.RegenerateRecoveryCodes(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
 	case apiRequestHandlerObj.Endpoint + "/startTracking":
 		controller := controllers.GetControllerInstance(enum.UserTripController, enum.MONGODB)
 		userTripController := controller.(*controllers.UserTripController)
@@ -327,6 +589,28 @@ func POSTRoutes(w http.ResponseWriter, r *http.Request) {
 			response.SendResponse(w, int(enum.DEVICE_NAME_FETCHED), res)
 			return
 		}
+	case apiRequestHandlerObj.Endpoint + "/device/enroll":
+		log.Println("Enroll Device")
+		controller := controllers.GetControllerInstance(enum.DeviceCredentialController, enum.MONGODB)
+		deviceCredentialController := controller.(*controllers.DeviceCredentialController)
+		code, data, e := deviceCredentialController.Enroll(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
+	case apiRequestHandlerObj.Endpoint + "/device/command":
+		log.Println("Send Device Command")
+		controller := controllers.GetControllerInstance(enum.DeviceCommandController, enum.MONGODB)
+		deviceCommandController := controller.(*controllers.DeviceCommandController)
+		code, data, e := deviceCommandController.SendCommand(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
 	case apiRequestHandlerObj.Endpoint + "/ping":
 		log.Println("Capture Screen")
 		controller := controllers.GetControllerInstance(enum.CaptureScreenController, enum.MONGODB)
@@ -351,6 +635,17 @@ func POSTRoutes(w http.ResponseWriter, r *http.Request) {
 			response.SendResponse(w, code, roomData)
 			return
 		}
+	case apiRequestHandlerObj.Endpoint + "/room/attachment":
+		log.Println("Upload Room Attachment")
+		controller := controllers.GetControllerInstance(enum.ClipboardRoomController, enum.MONGODB)
+		clipboardRoomController := controller.(*controllers.ClipboardRoomController)
+		code, d, e := clipboardRoomController.UploadAttachment(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, d)
+		return
 	case apiRequestHandlerObj.Endpoint + "/room/join":
 		log.Println("Join Room")
 		controller := controllers.GetControllerInstance(enum.ClipboardRoomController, enum.MONGODB)
@@ -363,6 +658,28 @@ func POSTRoutes(w http.ResponseWriter, r *http.Request) {
 			response.SendResponse(w, int(enum.ROOM_JOINED), roomData)
 			return
 		}
+	case apiRequestHandlerObj.Endpoint + "/room/message/pin":
+		log.Println("Pin Room Message")
+		controller := controllers.GetControllerInstance(enum.ClipboardRoomController, enum.MONGODB)
+		clipboardRoomController := controller.(*controllers.ClipboardRoomController)
+		code, data, e := clipboardRoomController.HandleMessageAction(w, r, enum.CLIPBOARD_MESSAGE_PINNED)
+		if e != nil {
+			response.SendResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
+	case apiRequestHandlerObj.Endpoint + "/room/message/react":
+		log.Println("React To Room Message")
+		controller := controllers.GetControllerInstance(enum.ClipboardRoomController, enum.MONGODB)
+		clipboardRoomController := controller.(*controllers.ClipboardRoomController)
+		code, data, e := clipboardRoomController.HandleMessageAction(w, r, enum.CLIPBOARD_MESSAGE_REACTED)
+		if e != nil {
+			response.SendResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
 	case apiRequestHandlerObj.Endpoint + "/search-yt-videos":
 		log.Println("Search YT Videos")
 		controller := controllers.GetControllerInstance(enum.GoogleController, enum.MONGODB)
@@ -387,6 +704,18 @@ func POSTRoutes(w http.ResponseWriter, r *http.Request) {
 			response.SendResponse(w, int(enum.DATA_FETCHED), res)
 			return
 		}
+	case apiRequestHandlerObj.Endpoint + "/download-batch":
+		log.Println("Batch Download")
+		controller := controllers.GetControllerInstance(enum.DownloadBatchController, enum.MONGODB)
+		downloadBatchController := controller.(*controllers.DownloadBatchController)
+		code, res, e := downloadBatchController.CreateBatchDownload(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		} else {
+			response.SendResponse(w, code, res)
+			return
+		}
 	case apiRequestHandlerObj.Endpoint + "/gollm/chat/completions":
 		log.Println("GoLLM Chat Completion")
 		controller := controllers.GetControllerInstance(enum.GoLLMController, enum.MONGODB)
@@ -509,10 +838,6 @@ func POSTRoutes(w http.ResponseWriter, r *http.Request) {
 		}
 	case apiRequestHandlerObj.Endpoint + "/config/queries":
 		log.Println("Create Search Query")
-		// TODO: Add authentication later
-		// if !ValidateSession(w, r) {
-		// 	return
-		// }
 		controller := controllers.GetControllerInstance(enum.ScraperConfigController, enum.MONGODB)
 		configController := controller.(*controllers.ScraperConfigController)
 
@@ -561,10 +886,68 @@ func GETRoutes(w http.ResponseWriter, r *http.Request) {
 		log.Print("Welcome to API Gateway")
 		response.SendResponse(w, int(enum.WELCOME), nil)
 		break
-	case apiRequestHandlerObj.Endpoint + "/getSessions":
+	case apiRequestHandlerObj.Endpoint + "/returnJWK":
+		controller := controllers.GetControllerInstance(enum.SigningKeyController, enum.MONGODB)
+		signingKeyController := controller.(*controllers.SigningKeyController)
+		if e := signingKeyController.ReturnJWK(w, r); e != nil {
+			log.Println("Unable to return JWKS", e)
+			http.Error(w, "Unable to load signing keys", http.StatusServiceUnavailable)
+		}
+		return
+	case apiRequestHandlerObj.Endpoint + "/profile":
+		controller := controllers.GetControllerInstance(enum.UserController, enum.MONGODB)
+		userController := controller.(*controllers.UserController)
+		code, res, data, ok := userController.GetProfile(w, r)
+		if ok != nil {
+			response.SendResponse(w, code, res)
+			return
+		} else {
+			response.SendResponse(w, code, data)
+			return
+		}
+	case apiRequestHandlerObj.Endpoint + "/2fa":
+		controller := controllers.GetControllerInstance(enum.TwoFactorController, enum.MONGODB)
+		twoFactorController := controller.(*controllers.TwoFactorController)
+		code, data, e := twoFactorController.TwoFactorStatus(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
+	case apiRequestHandlerObj.Endpoint + "/admin/roles":
+		controller := controllers.GetControllerInstance(enum.UserController, enum.MONGODB)
+		userController := controller.(*controllers.UserController)
+		code, res, data, ok := userController.ListRoles(w, r)
+		if ok != nil {
+			response.SendResponse(w, code, res)
+			return
+		} else {
+			response.SendResponse(w, code, data)
+			return
+		}
+	case apiRequestHandlerObj.Endpoint + "/admin/user/roles":
+		controller := controllers.GetControllerInstance(enum.UserController, enum.MONGODB)
+		userController := controller.(*controllers.UserController)
+		code, res, data, ok := userController.GetUserRoles(w, r)
+		if ok != nil {
+			response.SendResponse(w, code, res)
+			return
+		} else {
+			response.SendResponse(w, code, data)
+			return
+		}
+	case apiRequestHandlerObj.Endpoint + "/sessions", apiRequestHandlerObj.Endpoint + "/getSessions":
 		log.Println("Get All Sessions")
-		response.SendResponse(w, int(enum.SESSIONS_LISTED), nil)
-		break
+		controller := controllers.GetControllerInstance(enum.LoginActivityController, enum.MONGODB)
+		loginActivityController := controller.(*controllers.LoginActivityController)
+		code, data, e := loginActivityController.ListSessions(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+			return
+		}
+		response.SendResponse(w, code, data)
+		return
 	case apiRequestHandlerObj.Endpoint + "/getTrips":
 		controller := controllers.GetControllerInstance(enum.UserTripController, enum.MONGODB)
 		userTripController := controller.(*controllers.UserTripController)
@@ -610,13 +993,106 @@ func GETRoutes(w http.ResponseWriter, r *http.Request) {
 			response.SendErrorResponse(w, int(enum.DEVICE_ID_NOT_SET), nil)
 			break
 		}
-		code, d, e := screenCaptureController.ShowDeviceInfo(deviceId)
+		code, d, e := screenCaptureController.ShowDeviceInfo(r, deviceId)
+		if e != nil {
+			response.SendErrorResponse(w, code, e)
+		} else {
+			response.SendResponse(w, code, d)
+		}
+		break
+	case apiRequestHandlerObj.Endpoint + "/download":
+		log.Println("Download Status")
+		controller := controllers.GetControllerInstance(enum.DownloadJobController, enum.MONGODB)
+		downloadJobController := controller.(*controllers.DownloadJobController)
+		code, d, e := downloadJobController.GetDownload(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+		} else {
+			response.SendResponse(w, code, d)
+		}
+		break
+	case apiRequestHandlerObj.Endpoint + "/download-batch":
+		log.Println("Batch Download Status")
+		controller := controllers.GetControllerInstance(enum.DownloadBatchController, enum.MONGODB)
+		downloadBatchController := controller.(*controllers.DownloadBatchController)
+		code, d, e := downloadBatchController.GetBatchDownload(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+		} else {
+			response.SendResponse(w, code, d)
+		}
+		break
+	case apiRequestHandlerObj.Endpoint + "/downloads":
+		log.Println("List Downloads")
+		controller := controllers.GetControllerInstance(enum.DownloadJobController, enum.MONGODB)
+		downloadJobController := controller.(*controllers.DownloadJobController)
+		code, d, e := downloadJobController.ListDownloads(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+		} else {
+			response.SendResponse(w, code, d)
+		}
+		break
+	case apiRequestHandlerObj.Endpoint + "/device/uptime":
+		log.Println("Device Uptime History")
+		controller := controllers.GetControllerInstance(enum.CaptureScreenController, enum.MONGODB)
+		captureScreenController := controller.(*controllers.CaptureScreenController)
+		code, d, e := captureScreenController.GetUptimeHistory(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+		} else {
+			response.SendResponse(w, code, d)
+		}
+		break
+	case apiRequestHandlerObj.Endpoint + "/device/metrics":
+		log.Println("Device Metrics")
+		controller := controllers.GetControllerInstance(enum.DeviceMetricController, enum.MONGODB)
+		deviceMetricController := controller.(*controllers.DeviceMetricController)
+		code, d, e := deviceMetricController.GetMetrics(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+		} else {
+			response.SendResponse(w, code, d)
+		}
+		break
+	case apiRequestHandlerObj.Endpoint + "/device/screenshots":
+		log.Println("Device Screenshot Timeline")
+		controller := controllers.GetControllerInstance(enum.ScreenshotController, enum.MONGODB)
+		screenshotController := controller.(*controllers.ScreenshotController)
+		code, d, e := screenshotController.GetTimeline(w, r)
+		if e != nil {
+			response.SendErrorResponse(w, code, e.Error())
+		} else {
+			response.SendResponse(w, code, d)
+		}
+		break
+	case apiRequestHandlerObj.Endpoint + "/device/commands":
+		log.Println("List Device Commands")
+		controller := controllers.GetControllerInstance(enum.DeviceCommandController, enum.MONGODB)
+		deviceCommandController := controller.(*controllers.DeviceCommandController)
+		code, d, e := deviceCommandController.ListCommands(r)
 		if e != nil {
 			response.SendErrorResponse(w, code, e)
 		} else {
 			response.SendResponse(w, code, d)
 		}
 		break
+	case apiRequestHandlerObj.Endpoint + "/device/command":
+		log.Println("Get Device Command")
+		controller := controllers.GetControllerInstance(enum.DeviceCommandController, enum.MONGODB)
+		deviceCommandController := controller.(*controllers.DeviceCommandController)
+		commandId := r.URL.Query().Get("commandId")
+		if commandId == "" {
+			response.SendErrorResponse(w, int(enum.DEVICE_COMMAND_NOT_FOUND), nil)
+			break
+		}
+		code, d, e := deviceCommandController.GetCommand(r, commandId)
+		if e != nil || d == nil {
+			response.SendErrorResponse(w, code, e)
+		} else {
+			response.SendResponse(w, code, d)
+		}
+		break
 	case apiRequestHandlerObj.Endpoint + "/llm-api-configs":
 		log.Println("List LLM API Configs")
 		controller := controllers.GetControllerInstance(enum.LLMAPIConfigController, enum.MONGODB)
@@ -649,6 +1125,17 @@ func GETRoutes(w http.ResponseWriter, r *http.Request) {
 			response.SendResponse(w, code, data)
 		}
 		break
+	case apiRequestHandlerObj.Endpoint + "/room/search":
+		log.Println("Search Room Messages")
+		controller := controllers.GetControllerInstance(enum.ClipboardRoomController, enum.MONGODB)
+		clipboardRoomController := controller.(*controllers.ClipboardRoomController)
+		code, data, e := clipboardRoomController.SearchMessages(w, r)
+		if e != nil {
+			response.SendResponse(w, code, e.Error())
+		} else {
+			response.SendResponse(w, code, data)
+		}
+		break
 	case apiRequestHandlerObj.Endpoint + "/keys":
 		log.Println("List Valid API Keys with Pagination")
 		controller := controllers.GetControllerInstance(enum.APIKeyController, enum.MONGODB)
@@ -702,10 +1189,6 @@ func GETRoutes(w http.ResponseWriter, r *http.Request) {
 		break
 	case apiRequestHandlerObj.Endpoint + "/keys/valid":
 		log.Println("List Valid API Keys")
-		// TODO: Add authentication later
-		// if !ValidateSession(w, r) {
-		// 	return
-		// }
 		controller := controllers.GetControllerInstance(enum.APIKeyController, enum.MONGODB)
 		apiKeyController := controller.(*controllers.APIKeyController)
 
@@ -761,10 +1244,6 @@ func GETRoutes(w http.ResponseWriter, r *http.Request) {
 		break
 	case apiRequestHandlerObj.Endpoint + "/stats":
 		log.Println("Get API Key Statistics")
-		// TODO: Add authentication later
-		// if !ValidateSession(w, r) {
-		// 	return
-		// }
 		controller := controllers.GetControllerInstance(enum.APIKeyController, enum.MONGODB)
 		apiKeyController := controller.(*controllers.APIKeyController)
 
@@ -801,10 +1280,6 @@ func GETRoutes(w http.ResponseWriter, r *http.Request) {
 		break
 	case apiRequestHandlerObj.Endpoint + "/config/queries":
 		log.Println("List Search Queries")
-		// TODO: Add authentication later
-		// if !ValidateSession(w, r) {
-		// 	return
-		// }
 		controller := controllers.GetControllerInstance(enum.ScraperConfigController, enum.MONGODB)
 		configController := controller.(*controllers.ScraperConfigController)
 
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SSEBusEvent is an event as it travels between replicas.
+type SSEBusEvent struct {
+	RouteKey string
+	Event    SSEEvent
+}
+
+// SSEEventBus carries SSE events between the replicas of a service, so a
+// client sees an event whichever replica it is connected to.
+type SSEEventBus interface {
+	// Publish gives the event its id and sends it to every replica,
+	// including this one.
+	Publish(ctx context.Context, routeKey string, event SSEEvent) error
+	// Subscribe delivers the events of all replicas in the order they were
+	// published. The channel is closed once ctx ends or the bus gives up.
+	Subscribe(ctx context.Context) (<-chan SSEBusEvent, error)
+}
+
+// publishSSEEventScript assigns the next id and publishes in one step, so ids
+// reach every replica in increasing order. The id never drops below the
+// caller's clock, which keeps it ahead of ids handed out before the bus was
+// used.
+var publishSSEEventScript = redis.NewScript(`
+local id = redis.call('INCR', KEYS[1])
+local floor = tonumber(ARGV[1])
+if id < floor then
+	redis.call('SET', KEYS[1], ARGV[1])
+	id = floor
+end
+redis.call('PUBLISH', ARGV[2], string.format('%d', id) .. ' ' .. ARGV[3])
+return id
+`)
+
+type redisBusEnvelope struct {
+	RouteKey string          `json:"routeKey,omitempty"`
+	Name     string          `json:"name,omitempty"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// RedisSSEEventBus is an SSEEventBus over Redis pub/sub.
+type RedisSSEEventBus struct {
+	client  *redis.Client
+	channel string
+	idKey   string
+}
+
+func NewRedisSSEEventBus(client *redis.Client, channel string) *RedisSSEEventBus {
+	return &RedisSSEEventBus{client: client, channel: channel, idKey: channel + ":event-id"}
+}
+
+func (bus *RedisSSEEventBus) Publish(ctx context.Context, routeKey string, event SSEEvent) error {
+	payload, err := json.Marshal(redisBusEnvelope{RouteKey: routeKey, Name: event.Name, Data: event.Data})
+	if err != nil {
+		return err
+	}
+	floor := strconv.FormatInt(time.Now().UnixMicro(), 10)
+	return publishSSEEventScript.Run(ctx, bus.client, []string{bus.idKey}, floor, bus.channel, payload).Err()
+}
+
+func (bus *RedisSSEEventBus) Subscribe(ctx context.Context) (<-chan SSEBusEvent, error) {
+	pubsub := bus.client.Subscribe(ctx, bus.channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	events := make(chan SSEBusEvent, clientEventBuffer)
+	go func() {
+		defer close(events)
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				event, err := decodeRedisBusMessage(message.Payload)
+				if err != nil {
+					log.Printf("[SSE BUS] Ignoring malformed event: %v", err)
+					continue
+				}
+				events <- event
+			}
+		}
+	}()
+	return events, nil
+}
+
+func decodeRedisBusMessage(payload string) (SSEBusEvent, error) {
+	idText, body, found := strings.Cut(payload, " ")
+	if !found {
+		return SSEBusEvent{}, fmt.Errorf("missing event id")
+	}
+	id, err := strconv.ParseUint(idText, 10, 64)
+	if err != nil {
+		return SSEBusEvent{}, fmt.Errorf("invalid event id %q", idText)
+	}
+	var envelope redisBusEnvelope
+	if err := json.Unmarshal([]byte(body), &envelope); err != nil {
+		return SSEBusEvent{}, err
+	}
+	return SSEBusEvent{
+		RouteKey: envelope.RouteKey,
+		Event:    SSEEvent{ID: id, Name: envelope.Name, Data: envelope.Data},
+	}, nil
+}
@@ -1,24 +1,115 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
-type SSERequestHandler struct {
-	clients map[chan map[string]interface{}]bool
-	// Add client routing support
-	clientRoutes    map[chan map[string]interface{}]map[string]bool // client -> route keys
-	addClient       chan chan map[string]interface{}
-	removeClient    chan chan map[string]interface{}
-	broadcast       chan map[string]interface{}
-	mutex           sync.Mutex
+const (
+	defaultReplayEvents = 256
+	// Events queued for one client before it counts as too slow and is
+	// dropped. It can reconnect with Last-Event-ID and catch up.
+	clientEventBuffer = 256
+	// Replay buffers of routes without listeners or new events are freed
+	// after this long.
+	replayBufferIdleTTL = 15 * time.Minute
+	replayPruneInterval = time.Minute
+	// How long to wait before subscribing to the event bus again.
+	busRetryInterval  = 5 * time.Second
+	busPublishTimeout = 2 * time.Second
+)
+
+// SessionRevokedEvent tells a client its session was signed out. Streams
+// end right after sending it.
+const SessionRevokedEvent = "session_revoked"
+
+// SSEEvent is one message as it is written to the stream. Events without an
+// ID are not replayed.
+type SSEEvent struct {
+	ID   uint64
+	Name string
+	Data []byte
+}
+
+// SSEClient is one open event stream.
+type SSEClient struct {
+	events  chan SSEEvent
+	routes  map[string]bool
+	dropped chan struct{}
+}
+
+// Events delivers the events for this client.
+func (client *SSEClient) Events() <-chan SSEEvent {
+	return client.events
+}
+
+// Dropped is closed when the client fell too far behind and was removed.
+func (client *SSEClient) Dropped() <-chan struct{} {
+	return client.dropped
+}
+
+// replayBuffer is a ring of the most recent events of one route.
+type replayBuffer struct {
+	events    []SSEEvent
+	next      int
+	full      bool
+	evictedID uint64
+	updatedAt time.Time
+}
+
+func (buffer *replayBuffer) add(event SSEEvent) {
+	if buffer.full {
+		buffer.evictedID = buffer.events[buffer.next].ID
+	}
+	buffer.events[buffer.next] = event
+	buffer.next = (buffer.next + 1) % len(buffer.events)
+	if buffer.next == 0 {
+		buffer.full = true
+	}
+	buffer.updatedAt = time.Now()
+}
+
+// since returns the buffered events after lastID, oldest first, and whether
+// nothing in between was evicted.
+func (buffer *replayBuffer) since(lastID uint64) ([]SSEEvent, bool) {
+	ordered := buffer.events[:buffer.next]
+	if buffer.full {
+		ordered = append(append([]SSEEvent{}, buffer.events[buffer.next:]...), buffer.events[:buffer.next]...)
+	}
+	// Ids are shared by all routes, so only an evicted event newer than
+	// lastID means something was lost.
+	complete := buffer.evictedID <= lastID
+	for i, event := range ordered {
+		if event.ID > lastID {
+			return append([]SSEEvent{}, ordered[i:]...), complete
+		}
+	}
+	return nil, complete
 }
 
-var sseRequestHandlerObj SSERequestHandler
+// SSERequestHandler is the hub behind the SSE endpoints. Route events are
+// delivered to the clients subscribed to that route and kept for replay;
+// plain broadcasts go to every client. With an event bus, events go through
+// the bus so that the clients of every replica receive them.
+type SSERequestHandler struct {
+	clients     map[*SSEClient]bool
+	replay      map[string]*replayBuffer
+	replaySize  int
+	lastEventID uint64
+	mutex       sync.Mutex
+	bus         SSEEventBus
+	// busReady is set while this replica is subscribed to the bus. Until
+	// then events are delivered locally only.
+	busReady bool
+}
 
 // filterLogMessage removes base64 content from log messages to avoid cluttering logs
 func filterLogMessage(message map[string]interface{}) map[string]interface{} {
@@ -86,130 +177,264 @@ func filterLogMessage(message map[string]interface{}) map[string]interface{} {
 }
 
 func NewSSERequestHandler() *SSERequestHandler {
-	handler := &SSERequestHandler{
-		clients:      make(map[chan map[string]interface{}]bool),
-		clientRoutes: make(map[chan map[string]interface{}]map[string]bool),
-		addClient:    make(chan chan map[string]interface{}),
-		removeClient: make(chan chan map[string]interface{}),
-		broadcast:    make(chan map[string]interface{}),
+	replaySize := defaultReplayEvents
+	if size, err := strconv.Atoi(os.Getenv("SSE_REPLAY_EVENTS")); err == nil && size > 0 {
+		replaySize = size
 	}
+	return &SSERequestHandler{
+		clients:    make(map[*SSEClient]bool),
+		replay:     make(map[string]*replayBuffer),
+		replaySize: replaySize,
+		// Ids continue from the clock so they keep increasing across
+		// restarts and a Last-Event-ID from before one is never ahead.
+		lastEventID: uint64(time.Now().UnixMicro()),
+	}
+}
 
-	go handler.Run()
+// Run frees the replay buffers of routes nobody listens to anymore.
+func (handler *SSERequestHandler) Run() {
+	ticker := time.NewTicker(replayPruneInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		handler.mutex.Lock()
+		listened := make(map[string]bool)
+		for client := range handler.clients {
+			for route := range client.routes {
+				listened[route] = true
+			}
+		}
+		for route, buffer := range handler.replay {
+			if !listened[route] && time.Since(buffer.updatedAt) > replayBufferIdleTTL {
+				delete(handler.replay, route)
+			}
+		}
+		handler.mutex.Unlock()
+	}
+}
 
-	return handler
+// UseBus routes events through bus from now on. It keeps a subscription open
+// for as long as the handler lives.
+func (handler *SSERequestHandler) UseBus(bus SSEEventBus) {
+	handler.mutex.Lock()
+	handler.bus = bus
+	handler.mutex.Unlock()
+	go handler.listen(bus)
 }
 
-func (handler *SSERequestHandler) Run() {
+func (handler *SSERequestHandler) listen(bus SSEEventBus) {
 	for {
-		select {
-		case client := <-handler.addClient:
-			handler.mutex.Lock()
-			handler.clients[client] = true
-			handler.mutex.Unlock()
-			log.Println("New client connected")
-		case client := <-handler.removeClient:
-			log.Println("Remove client called")
-			handler.mutex.Lock()
-			if _, ok := handler.clients[client]; ok {
-				delete(handler.clients, client)
-				delete(handler.clientRoutes, client)
-				close(client)
-				log.Println("Client disconnected")
-			}
-			handler.mutex.Unlock()
-		case msg := <-handler.broadcast:
-			// log.Printf("Broadcast message received: type=%s, progress=%v", msg["type"], msg["progress"])
+		events, err := bus.Subscribe(context.Background())
+		if err != nil {
+			log.Printf("[HANDLER] Unable to subscribe to the event bus: %v", err)
+			time.Sleep(busRetryInterval)
+			continue
+		}
+		handler.setBusReady(true)
+		log.Println("[HANDLER] Subscribed to the event bus")
+		for busEvent := range events {
 			handler.mutex.Lock()
-			// log.Printf("HANDLER CLIENTS", handler.clients)
-			for client := range handler.clients {
-				client <- msg
+			if busEvent.Event.ID > handler.lastEventID {
+				handler.lastEventID = busEvent.Event.ID
 			}
+			handler.deliver(busEvent.RouteKey, busEvent.Event)
 			handler.mutex.Unlock()
-		default:
-			// log.Println("Default case",handler.clients)
 		}
+		handler.setBusReady(false)
+		log.Println("[HANDLER] Lost the event bus subscription")
+		time.Sleep(busRetryInterval)
 	}
 }
 
-func (handler *SSERequestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Set headers for SSE
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	log.Println("Serve HTTP | Method: ", r.Method)
-
-	// Create a new client channel
-	clientChan := make(chan map[string]interface{})
+func (handler *SSERequestHandler) setBusReady(ready bool) {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	handler.busReady = ready
+}
 
-	// Add this client to our map
-	handler.addClient <- clientChan
+// WriteEvent writes one event in the text/event-stream format and flushes it.
+func WriteEvent(w http.ResponseWriter, event SSEEvent) error {
+	var frame strings.Builder
+	if event.ID != 0 {
+		fmt.Fprintf(&frame, "id: %d\n", event.ID)
+	}
+	if event.Name != "" {
+		fmt.Fprintf(&frame, "event: %s\n", event.Name)
+	}
+	fmt.Fprintf(&frame, "data: %s\n\n", event.Data)
+	if _, err := fmt.Fprint(w, frame.String()); err != nil {
+		return err
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
 
-	// Remove client when connection is closed
-	defer func() {
-		handler.removeClient <- clientChan
-	}()
+// NewEvent builds an event that is not buffered, such as a state snapshot
+// sent to one client. The name comes from the message's "type".
+func NewEvent(message map[string]interface{}) (SSEEvent, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return SSEEvent{}, err
+	}
+	name, _ := message["type"].(string)
+	return SSEEvent{Name: name, Data: data}, nil
+}
 
+// Stream writes the client's events until the request ends, the client is
+// dropped for falling behind or its session is signed out.
+func (handler *SSERequestHandler) Stream(w http.ResponseWriter, r *http.Request, client *SSEClient) {
 	for {
 		select {
-		case msg := <-clientChan:
-
-			// Serialize the message to JSON
-			jsonData, err := json.Marshal(msg)
-			if err != nil {
-				log.Printf("Error marshalling message to JSON: %v", err)
+		case event := <-client.events:
+			if err := WriteEvent(w, event); err != nil {
+				log.Printf("Error sending message to client: %v", err)
 				return
 			}
-			// Send the JSON data as a string
-			_, err = fmt.Fprintf(w, "data: %s\n\n", jsonData)
-			if err != nil {
-				log.Printf("Error sending message to client: %v", err)
+			if event.Name == SessionRevokedEvent {
 				return
 			}
-			log.Println("Message sent to client:", w)
-			w.(http.Flusher).Flush()
+		case <-client.dropped:
+			return
 		case <-r.Context().Done():
 			return
 		}
 	}
 }
 
-// Public method to add client with route subscription
-// Note: No message replay - SSE is real-time. Clients connecting late should handle their own state recovery.
-func (handler *SSERequestHandler) AddClientWithRoute(routeKey string) chan map[string]interface{} {
-	clientChan := make(chan map[string]interface{}, 1000)
-	handler.addClient <- clientChan
-	handler.SubscribeClientToRoute(clientChan, routeKey)
-	log.Printf("[HANDLER] Client connected to route: %s", routeKey)
-	return clientChan
-}
+func (handler *SSERequestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Set headers for SSE
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	log.Println("Serve HTTP | Method: ", r.Method)
 
-// Public method to remove client
-func (handler *SSERequestHandler) RemoveClient(clientChan chan map[string]interface{}) {
-	handler.removeClient <- clientChan
+	client, _ := handler.AddClientWithRoute("", "")
+	defer handler.RemoveClient(client)
+	handler.Stream(w, r, client)
 }
 
-func (handler *SSERequestHandler) Broadcast(message map[string]interface{}) {
-	handler.broadcast <- message
-	log.Println("Broadcast message:", message)
-}
+// AddClientWithRoute registers a client, subscribed to routeKey unless it is
+// empty. With a lastEventID (the Last-Event-ID header of a reconnecting
+// client) it also returns the buffered events the client missed. If some of
+// them were already evicted, the replay starts with a "replay_gap" event so
+// the client knows to reload its state.
+func (handler *SSERequestHandler) AddClientWithRoute(routeKey string, lastEventID string) (*SSEClient, []SSEEvent) {
+	client := &SSEClient{
+		events:  make(chan SSEEvent, clientEventBuffer),
+		routes:  make(map[string]bool),
+		dropped: make(chan struct{}),
+	}
+	if routeKey != "" {
+		client.routes[routeKey] = true
+	}
 
-// Subscribe client to specific routes (for targeted messaging)
-func (handler *SSERequestHandler) SubscribeClientToRoute(client chan map[string]interface{}, routeKey string) {
 	handler.mutex.Lock()
 	defer handler.mutex.Unlock()
+	handler.clients[client] = true
 
-	if handler.clientRoutes[client] == nil {
-		handler.clientRoutes[client] = make(map[string]bool)
+	var missed []SSEEvent
+	if lastID, err := strconv.ParseUint(strings.TrimSpace(lastEventID), 10, 64); err == nil && routeKey != "" {
+		complete := true
+		if buffer, ok := handler.replay[routeKey]; ok {
+			missed, complete = buffer.since(lastID)
+		} else if lastID < handler.lastEventID {
+			// Nothing buffered for this route, so whether anything was
+			// missed is unknown.
+			complete = false
+		}
+		if !complete {
+			gap, _ := NewEvent(map[string]interface{}{
+				"type":        "replay_gap",
+				"routeKey":    routeKey,
+				"lastEventId": lastID,
+			})
+			missed = append([]SSEEvent{gap}, missed...)
+		}
 	}
-	handler.clientRoutes[client][routeKey] = true
+	log.Printf("[HANDLER] Client connected to route: %s (replaying %d events)", routeKey, len(missed))
+	return client, missed
+}
+
+// RemoveClient unregisters a client. Removing it twice is harmless.
+func (handler *SSERequestHandler) RemoveClient(client *SSEClient) {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	delete(handler.clients, client)
+}
+
+// SubscribeClientToRoute adds a route to an open client.
+func (handler *SSERequestHandler) SubscribeClientToRoute(client *SSEClient, routeKey string) {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	client.routes[routeKey] = true
 	log.Printf("Client subscribed to route: %s", routeKey)
 }
 
-// Broadcast to specific route only
-// Note: No buffering - messages are real-time only. Reduces memory usage and prevents
-// issues with large file chunks being replayed incorrectly.
+// Broadcast sends a message to every client. It is not kept for replay.
+func (handler *SSERequestHandler) Broadcast(message map[string]interface{}) {
+	handler.publish("", message)
+}
+
+// BroadcastToRoute sends a message to the clients subscribed to routeKey and
+// keeps it in the route's replay buffer.
 func (handler *SSERequestHandler) BroadcastToRoute(routeKey string, message map[string]interface{}) {
 	message["routeKey"] = routeKey
-	handler.broadcast <- message
+	handler.publish(routeKey, message)
+}
+
+func (handler *SSERequestHandler) publish(routeKey string, message map[string]interface{}) {
+	event, err := NewEvent(message)
+	if err != nil {
+		log.Printf("Error marshalling message to JSON: %v", err)
+		return
+	}
+
+	handler.mutex.Lock()
+	bus, busReady := handler.bus, handler.busReady
+	handler.mutex.Unlock()
+	if busReady {
+		// The event comes back through the subscription, with its id.
+		ctx, cancel := context.WithTimeout(context.Background(), busPublishTimeout)
+		err := bus.Publish(ctx, routeKey, event)
+		cancel()
+		if err == nil {
+			return
+		}
+		log.Printf("[HANDLER] Event bus unavailable, delivering locally: %v", err)
+	}
+
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	handler.lastEventID++
+	event.ID = handler.lastEventID
+	handler.deliver(routeKey, event)
+}
+
+// deliver buffers an event and hands it to the local clients. The caller
+// holds the mutex.
+func (handler *SSERequestHandler) deliver(routeKey string, event SSEEvent) {
+	if routeKey != "" {
+		buffer, ok := handler.replay[routeKey]
+		if !ok {
+			buffer = &replayBuffer{events: make([]SSEEvent, handler.replaySize)}
+			handler.replay[routeKey] = buffer
+		}
+		buffer.add(event)
+	}
+
+	for client := range handler.clients {
+		if routeKey != "" && !client.routes[routeKey] {
+			continue
+		}
+		select {
+		case client.events <- event:
+		default:
+			// Never wait on a slow client while holding the hub.
+			log.Printf("[HANDLER] Dropping client that fell %d events behind", clientEventBuffer)
+			delete(handler.clients, client)
+			close(client.dropped)
+		}
+	}
 }
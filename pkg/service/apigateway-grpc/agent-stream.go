@@ -0,0 +1,357 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"project-phoenix/v2/internal/broker"
+	"project-phoenix/v2/internal/cache"
+	"project-phoenix/v2/internal/controllers"
+	"project-phoenix/v2/internal/enum"
+	pb "project-phoenix/v2/pkg/service/apigateway-grpc/src/go"
+
+	"github.com/gosimple/slug"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultMaxStreamImageBytes    = 20 << 20
+	defaultMaxStreamCaptures      = 4
+	defaultMaxStreamBufferedBytes = 40 << 20
+	// A capture that gets no chunk for this long is dropped, so an agent
+	// that gives up on one does not keep it in memory for the whole stream.
+	staleCaptureAfter = 2 * time.Minute
+)
+
+func envLimit(name string, fallback int) int {
+	limit, e := strconv.Atoi(os.Getenv(name))
+	if e != nil || limit <= 0 {
+		return fallback
+	}
+	return limit
+}
+
+// maxStreamImageBytes caps the size of an image assembled from chunks, from
+// GRPC_MAX_IMAGE_BYTES.
+func maxStreamImageBytes() int {
+	return envLimit("GRPC_MAX_IMAGE_BYTES", defaultMaxStreamImageBytes)
+}
+
+// maxStreamCaptures caps the captures one stream may assemble at once, from
+// GRPC_MAX_STREAM_CAPTURES.
+func maxStreamCaptures() int {
+	return envLimit("GRPC_MAX_STREAM_CAPTURES", defaultMaxStreamCaptures)
+}
+
+// maxStreamBufferedBytes caps the bytes one stream may hold across all of its
+// unfinished captures, from GRPC_MAX_STREAM_BUFFERED_BYTES.
+func maxStreamBufferedBytes() int {
+	return envLimit("GRPC_MAX_STREAM_BUFFERED_BYTES", defaultMaxStreamBufferedBytes)
+}
+
+type imageBuffer struct {
+	next     uint32
+	data     []byte
+	lastSeen time.Time
+}
+
+// imageBuffers holds the captures a stream is still receiving chunks for.
+type imageBuffers struct {
+	captures map[string]*imageBuffer
+	buffered int
+}
+
+func newImageBuffers() *imageBuffers {
+	return &imageBuffers{captures: map[string]*imageBuffer{}}
+}
+
+func (b *imageBuffers) remove(captureID string) {
+	if buffer, ok := b.captures[captureID]; ok {
+		b.buffered -= len(buffer.data)
+		delete(b.captures, captureID)
+	}
+}
+
+// evictStale drops the captures that got no chunk since staleCaptureAfter.
+func (b *imageBuffers) evictStale(now time.Time) {
+	for captureID, buffer := range b.captures {
+		if now.Sub(buffer.lastSeen) > staleCaptureAfter {
+			log.Printf("Dropping capture %s, no chunk for %s", captureID, now.Sub(buffer.lastSeen).Round(time.Second))
+			b.remove(captureID)
+		}
+	}
+}
+
+// Connect serves a device agent over one bidirectional stream. Commands still
+// travel over the device's Redis channels so the REST endpoints and the
+// offline detection work unchanged; this stream subscribes to them and
+// forwards each one to the agent.
+func (s *APIGatewayGRPCService) Connect(stream pb.ScreenCaptureService_ConnectServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	hello := first.GetHello()
+	if hello == nil {
+		return status.Error(codes.InvalidArgument, "the first message must be a hello")
+	}
+	ctx := stream.Context()
+	deviceName, err := boundDeviceName(ctx, hello.GetDeviceName())
+	if err != nil {
+		return err
+	}
+	deviceSlug := slug.Make(deviceName)
+
+	pubsub, err := cache.GetInstance().Subscribe(ctx,
+		"capture-screen-"+deviceSlug,
+		"ping-device-"+deviceSlug,
+		"device-command-"+deviceSlug,
+		controllers.DeviceRevokedChannel(deviceName),
+	)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "unable to open command channel: %v", err)
+	}
+	defer pubsub.Close()
+	log.Printf("Agent %s connected (version %s)", deviceName, hello.GetAgentVersion())
+
+	// A gRPC stream must not be written from two goroutines at once.
+	var sendMutex sync.Mutex
+	send := func(message *pb.ServerMessage) error {
+		sendMutex.Lock()
+		defer sendMutex.Unlock()
+		return stream.Send(message)
+	}
+
+	publishDeviceData(deviceName, enum.PING_DEVICE, map[string]interface{}{
+		"osName":    hello.GetOsName(),
+		"timesTamp": formatTimestamp(hello.GetSentAt()),
+	})
+
+	revoked := make(chan struct{})
+	go forwardDeviceCommands(ctx, pubsub, send, revoked)
+
+	received := make(chan error, 1)
+	go func() {
+		received <- receiveAgentMessages(stream, deviceName, send)
+	}()
+
+	select {
+	case err := <-received:
+		return err
+	case <-revoked:
+		log.Printf("Closing stream for %s, its credentials were revoked", deviceName)
+		return status.Error(codes.Unauthenticated, "device credentials were revoked")
+	case <-s.closeStreams:
+		log.Printf("Closing stream for %s, the gateway is shutting down", deviceName)
+		return status.Error(codes.Unavailable, "gateway is shutting down, reconnect")
+	}
+}
+
+// receiveAgentMessages handles everything the agent sends until it hangs up.
+func receiveAgentMessages(stream pb.ScreenCaptureService_ConnectServer, deviceName string, send func(*pb.ServerMessage) error) error {
+	images := newImageBuffers()
+	for {
+		message, err := stream.Recv()
+		if err == io.EOF {
+			log.Printf("Agent %s disconnected", deviceName)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch payload := message.GetPayload().(type) {
+		case *pb.AgentMessage_Telemetry:
+			publishDeviceData(deviceName, enum.PING_DEVICE, telemetryData(payload.Telemetry))
+
+		case *pb.AgentMessage_ImageChunk:
+			if err := handleImageChunk(deviceName, images, payload.ImageChunk, send); err != nil {
+				return err
+			}
+
+		case *pb.AgentMessage_CommandResult:
+			result := payload.CommandResult
+			result.DeviceName = deviceName
+			ack := &pb.StreamAck{Ref: result.GetCommandId(), Success: true, Message: "Command result received"}
+			if err := publishCommandResult(result); err != nil {
+				ack.Success = false
+				ack.Message = status.Convert(err).Message()
+			}
+			if err := send(&pb.ServerMessage{Payload: &pb.ServerMessage_Ack{Ack: ack}}); err != nil {
+				return err
+			}
+
+		case *pb.AgentMessage_Hello:
+			// Agents may resend their hello after a config reload; nothing to do.
+		}
+	}
+}
+
+// handleImageChunk appends a chunk to its capture and publishes the capture
+// once the last chunk arrives. Chunks must arrive in order, and a stream can
+// only buffer a few captures and bytes at a time.
+func handleImageChunk(deviceName string, images *imageBuffers, chunk *pb.ImageChunk, send func(*pb.ServerMessage) error) error {
+	captureID := chunk.GetCaptureId()
+	if captureID == "" {
+		return status.Error(codes.InvalidArgument, "image chunk without captureId")
+	}
+	now := time.Now()
+	images.evictStale(now)
+	buffer, ok := images.captures[captureID]
+	if !ok {
+		if len(images.captures) >= maxStreamCaptures() {
+			return status.Errorf(codes.ResourceExhausted, "more than %d captures in flight", maxStreamCaptures())
+		}
+		buffer = &imageBuffer{}
+		images.captures[captureID] = buffer
+	}
+	if chunk.GetSequence() != buffer.next {
+		images.remove(captureID)
+		return status.Errorf(codes.InvalidArgument, "capture %s: expected chunk %d, got %d", captureID, buffer.next, chunk.GetSequence())
+	}
+	if len(buffer.data)+len(chunk.GetData()) > maxStreamImageBytes() {
+		images.remove(captureID)
+		return status.Errorf(codes.ResourceExhausted, "capture %s is larger than %d bytes", captureID, maxStreamImageBytes())
+	}
+	if images.buffered+len(chunk.GetData()) > maxStreamBufferedBytes() {
+		images.remove(captureID)
+		return status.Errorf(codes.ResourceExhausted, "captures in flight are larger than %d bytes", maxStreamBufferedBytes())
+	}
+	buffer.data = append(buffer.data, chunk.GetData()...)
+	buffer.next++
+	buffer.lastSeen = now
+	images.buffered += len(chunk.GetData())
+	if !chunk.GetLast() {
+		return nil
+	}
+	images.remove(captureID)
+
+	data := telemetryData(chunk.GetTelemetry())
+	data["lastImage"] = base64.StdEncoding.EncodeToString(buffer.data)
+	if chunk.GetCapturedAt() != nil {
+		data["timesTamp"] = formatTimestamp(chunk.GetCapturedAt())
+	}
+	publishDeviceData(deviceName, enum.CAPTURE_SCREEN, data)
+
+	return send(&pb.ServerMessage{Payload: &pb.ServerMessage_Ack{Ack: &pb.StreamAck{
+		Ref:     captureID,
+		Success: true,
+		Message: fmt.Sprintf("Capture received (%d bytes)", len(buffer.data)),
+	}}})
+}
+
+// forwardDeviceCommands relays the device's Redis command channels onto the
+// stream until the agent disconnects. It closes revoked when the device's
+// credentials are revoked.
+func forwardDeviceCommands(ctx context.Context, pubsub *redis.PubSub, send func(*pb.ServerMessage) error, revoked chan<- struct{}) {
+	channel := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case received, ok := <-channel:
+			if !ok {
+				return
+			}
+			if strings.HasPrefix(received.Channel, "device-revoked-") {
+				close(revoked)
+				return
+			}
+			message, err := commandMessage(received)
+			if err != nil {
+				log.Println("Dropping device command", err)
+				continue
+			}
+			if err := send(message); err != nil {
+				log.Println("Error forwarding command to agent", err)
+				return
+			}
+		}
+	}
+}
+
+func commandMessage(received *redis.Message) (*pb.ServerMessage, error) {
+	now := timestamppb.Now()
+	switch {
+	case strings.HasPrefix(received.Channel, "capture-screen-"):
+		return &pb.ServerMessage{Payload: &pb.ServerMessage_Capture{Capture: &pb.CaptureCommand{IssuedAt: now}}}, nil
+	case strings.HasPrefix(received.Channel, "ping-device-"):
+		return &pb.ServerMessage{Payload: &pb.ServerMessage_Ping{Ping: &pb.PingCommand{IssuedAt: now}}}, nil
+	case strings.HasPrefix(received.Channel, "device-command-"):
+		command := struct {
+			CommandID      string          `json:"commandId"`
+			Type           string          `json:"type"`
+			Payload        json.RawMessage `json:"payload"`
+			TimeoutSeconds int32           `json:"timeoutSeconds"`
+			IssuedAt       time.Time       `json:"issuedAt"`
+		}{}
+		if err := json.Unmarshal([]byte(received.Payload), &command); err != nil {
+			return nil, fmt.Errorf("invalid command on %s: %v", received.Channel, err)
+		}
+		return &pb.ServerMessage{Payload: &pb.ServerMessage_Command{Command: &pb.DeviceCommand{
+			CommandId:      command.CommandID,
+			Type:           command.Type,
+			Payload:        string(command.Payload),
+			TimeoutSeconds: command.TimeoutSeconds,
+			IssuedAt:       timestamppb.New(command.IssuedAt),
+		}}}, nil
+	}
+	return nil, fmt.Errorf("unexpected channel %s", received.Channel)
+}
+
+// telemetryData converts typed telemetry into the device data fields the SSE
+// service already understands. Usage is rendered in a form its parser reads
+// back without loss.
+func telemetryData(telemetry *pb.Telemetry) map[string]interface{} {
+	data := map[string]interface{}{}
+	if telemetry == nil {
+		return data
+	}
+	data["osName"] = telemetry.GetOsName()
+	data["memoryUsage"] = formatUsage(telemetry.GetMemory())
+	data["diskUsage"] = formatUsage(telemetry.GetDisk())
+	if telemetry.Timestamp != nil {
+		data["timesTamp"] = formatTimestamp(telemetry.GetTimestamp())
+	}
+	if telemetry.IdleSeconds != nil {
+		data["idleSeconds"] = telemetry.GetIdleSeconds()
+	}
+	return data
+}
+
+func formatUsage(usage *pb.ResourceUsage) string {
+	if usage == nil {
+		return ""
+	}
+	if usage.GetTotalBytes() > 0 {
+		return fmt.Sprintf("%.2f%% (%d B / %d B)", usage.GetPercent(), usage.GetUsedBytes(), usage.GetTotalBytes())
+	}
+	return fmt.Sprintf("%.2f%%", usage.GetPercent())
+}
+
+func formatTimestamp(timestamp *timestamppb.Timestamp) string {
+	if timestamp == nil {
+		return time.Now().UTC().Format(time.RFC3339)
+	}
+	return timestamp.AsTime().UTC().Format(time.RFC3339Nano)
+}
+
+func publishDeviceData(deviceName string, messageType enum.CaptureScreenEnum, data map[string]interface{}) {
+	data["deviceName"] = deviceName
+	broker.CreateBroker(enum.RABBITMQ).PublishMessage(map[string]interface{}{
+		"data":        data,
+		"messageType": int32(messageType),
+	}, "api-gateway-grpc-queue", "capture-device-data")
+}
@@ -14,16 +14,27 @@ import (
 	"project-phoenix/v2/pkg/service"
 	pb "project-phoenix/v2/pkg/service/apigateway-grpc/src/go"
 	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
 	"go-micro.dev/v4"
 	microBroker "go-micro.dev/v4/broker"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type APIGatewayGRPCService struct {
 	service            micro.Service
 	grpcServer         *grpc.Server
+	healthServer       *health.Server
+	stopHealthChecks   chan struct{}
+	closeStreams       chan struct{}
+	stopOnce           sync.Once
 	serviceConfig      internal.ServiceConfig
 	subscribedServices []internal.SubscribedServices
 	brokerObj          microBroker.Broker
@@ -40,7 +51,10 @@ func (api *APIGatewayGRPCService) InitializeService(serviceObj micro.Service, se
 	once.Do(func() {
 		service := serviceObj
 		api.service = service
-		api.grpcServer = grpc.NewServer()
+		api.grpcServer = grpc.NewServer(serverOptions()...)
+		api.healthServer = health.NewServer()
+		api.stopHealthChecks = make(chan struct{})
+		api.closeStreams = make(chan struct{})
 		api.brokerObj = service.Options().Broker
 		godotenv.Load()
 		servicePath := "api-gateway-grpc"
@@ -51,6 +65,8 @@ func (api *APIGatewayGRPCService) InitializeService(serviceObj micro.Service, se
 
 		// Register the gRPC service
 		pb.RegisterScreenCaptureServiceServer(api.grpcServer, api)
+		healthpb.RegisterHealthServer(api.grpcServer, api.healthServer)
+		reflection.Register(api.grpcServer)
 	})
 
 	return api
@@ -87,31 +103,60 @@ func (s *APIGatewayGRPCService) Start(port string) error {
 
 	lis, err := net.Listen("tcp", ":"+port)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		return fmt.Errorf("failed to listen: %v", err)
 	}
 
-	grpcServer := grpc.NewServer()
-	pb.RegisterScreenCaptureServiceServer(grpcServer, s)
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	go s.watchBrokerHealth()
+	if err := s.grpcServer.Serve(lis); err != nil {
+		return fmt.Errorf("failed to serve: %v", err)
 	}
 
 	return nil
 }
 
+// serverOptions returns the options the gateway's gRPC server is built with.
+// All calls except health checks and reflection must carry an enrolled
+// device's token.
+func serverOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryDeviceAuthInterceptor),
+		grpc.ChainStreamInterceptor(streamDeviceAuthInterceptor),
+		// Inline base64 screenshots in SendCapture run to several megabytes.
+		grpc.MaxRecvMsgSize(maxMessageBytes()),
+		grpc.MaxSendMsgSize(maxMessageBytes()),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle: 15 * time.Minute,
+			Time:              time.Minute,
+			Timeout:           20 * time.Second,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             20 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	}
+}
+
 func (s *APIGatewayGRPCService) SendCapture(ctx context.Context, req *pb.ScreenCaptureRequest) (*pb.ScreenCaptureResponse, error) {
 	log.Printf("Received screen capture request from client")
 
+	deviceName, err := boundDeviceName(ctx, req.GetDeviceName())
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]interface{}{
+		"lastImage":   req.GetLastImage(),
+		"deviceName":  deviceName,
+		"timesTamp":   req.GetTimesTamp(),
+		"osName":      req.GetOsName(),
+		"memoryUsage": req.GetMemoryUsage(),
+		"diskUsage":   req.GetDiskUsage(),
+	}
+	if req.IdleSeconds != nil {
+		data["idleSeconds"] = req.GetIdleSeconds()
+	}
 	message := map[string]interface{}{
-		"data": map[string]interface{}{
-			"lastImage":    req.GetLastImage(),
-		 	"deviceName":   req.GetDeviceName(),
-			"timesTamp":    req.GetTimesTamp(),
-			"osName":       req.GetOsName(),
-			"memoryUsage":  req.GetMemoryUsage(),
-			"diskUsage":    req.GetDiskUsage(),
-		},
-		"messageType" : req.GetMessageType(),
+		"data":        data,
+		"messageType": req.GetMessageType(),
 	}
 
 	broker.CreateBroker(enum.RABBITMQ).PublishMessage(message,"api-gateway-grpc-queue","capture-device-data")
@@ -122,6 +167,49 @@ func (s *APIGatewayGRPCService) SendCapture(ctx context.Context, req *pb.ScreenC
 	}, nil
 }
 
+// ReportCommandResult receives the outcome of a device command from the agent
+// and hands it to the SSE service, which persists it and notifies clients.
+func (s *APIGatewayGRPCService) ReportCommandResult(ctx context.Context, req *pb.CommandResultRequest) (*pb.CommandResultResponse, error) {
+	deviceName, err := boundDeviceName(ctx, req.GetDeviceName())
+	if err != nil {
+		return nil, err
+	}
+	req.DeviceName = deviceName
+	if err := publishCommandResult(req); err != nil {
+		return nil, err
+	}
+	return &pb.CommandResultResponse{
+		Success: true,
+		Message: "Command result received",
+	}, nil
+}
+
+// publishCommandResult validates a command result, whether it came in unary or
+// on an agent stream, and publishes it for the SSE service.
+func publishCommandResult(req *pb.CommandResultRequest) error {
+	log.Printf("Received command result %s from %s: %s", req.GetCommandId(), req.GetDeviceName(), req.GetStatus())
+
+	if req.GetCommandId() == "" || req.GetDeviceName() == "" {
+		return status.Error(codes.InvalidArgument, "commandId and deviceName are required")
+	}
+	switch enum.DeviceCommandStatus(req.GetStatus()) {
+	case enum.COMMAND_ACKNOWLEDGED, enum.COMMAND_SUCCEEDED, enum.COMMAND_FAILED:
+	default:
+		return status.Errorf(codes.InvalidArgument, "invalid command status %q", req.GetStatus())
+	}
+
+	message := map[string]interface{}{
+		"commandId":  req.GetCommandId(),
+		"deviceName": req.GetDeviceName(),
+		"status":     req.GetStatus(),
+		"result":     req.GetResult(),
+		"error":      req.GetError(),
+	}
+
+	broker.CreateBroker(enum.RABBITMQ).PublishMessage(message, "api-gateway-grpc-queue", enum.DEVICE_COMMAND_RESULT_TOPIC)
+	return nil
+}
+
 func SaveImageToFile(imageBlob string, deviceName string) error {
 	// Create output directory if it doesn't exist
 	err := os.MkdirAll("output/images", 0755)
@@ -149,10 +237,35 @@ func SaveImageToFile(imageBlob string, deviceName string) error {
 }
 
 
+// Stop drains the server: health checks report NOT_SERVING first so load
+// balancers stop routing new calls, then agent streams are told to reconnect
+// elsewhere and in-flight calls get up to GRPC_SHUTDOWN_TIMEOUT_SECONDS to
+// finish before the server is stopped hard. Calling it again does nothing.
 func (s *APIGatewayGRPCService) Stop() error {
-	log.Println("Stopping GRPC API Gateway")
-	if s.grpcServer != nil {
-		s.grpcServer.GracefulStop()
+	if s.grpcServer == nil {
+		return nil
 	}
+	s.stopOnce.Do(func() {
+		log.Println("Stopping GRPC API Gateway")
+		close(s.stopHealthChecks)
+		s.healthServer.Shutdown()
+		time.Sleep(time.Duration(envSeconds("GRPC_DRAIN_SECONDS", defaultDrainSeconds)) * time.Second)
+
+		// Agent streams never end on their own and would hold GracefulStop
+		// until the timeout.
+		close(s.closeStreams)
+		stopped := make(chan struct{})
+		go func() {
+			s.grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			log.Println("GRPC API Gateway drained")
+		case <-time.After(time.Duration(envSeconds("GRPC_SHUTDOWN_TIMEOUT_SECONDS", defaultShutdownTimeoutSeconds)) * time.Second):
+			log.Println("GRPC API Gateway drain timed out, closing remaining connections")
+			s.grpcServer.Stop()
+		}
+	})
 	return nil
 }
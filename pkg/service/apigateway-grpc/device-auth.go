@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"project-phoenix/v2/internal/controllers"
+	"project-phoenix/v2/internal/enum"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type deviceContextKey struct{}
+
+// deviceTokenFromMetadata reads the token from "authorization: Bearer <token>"
+// or, for agents that cannot set that header, "x-device-token".
+func deviceTokenFromMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, value := range md.Get("authorization") {
+		if token, found := strings.CutPrefix(value, "Bearer "); found {
+			return strings.TrimSpace(token)
+		}
+	}
+	if values := md.Get("x-device-token"); len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+// authenticateDevice resolves the calling device from its token and stores
+// its name on the context.
+func authenticateDevice(ctx context.Context) (context.Context, error) {
+	token := deviceTokenFromMetadata(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing device token")
+	}
+	controller := controllers.GetControllerInstance(enum.DeviceCredentialController, enum.MONGODB)
+	deviceCredentialController, ok := controller.(*controllers.DeviceCredentialController)
+	if !ok {
+		return nil, status.Error(codes.Unavailable, "device credentials unavailable")
+	}
+	deviceName, err := deviceCredentialController.Authenticate(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return context.WithValue(ctx, deviceContextKey{}, deviceName), nil
+}
+
+// boundDeviceName returns the authenticated device for a call. A deviceName
+// sent in the request must match it; an empty one defaults to it.
+func boundDeviceName(ctx context.Context, requested string) (string, error) {
+	deviceName, _ := ctx.Value(deviceContextKey{}).(string)
+	if deviceName == "" {
+		return "", status.Error(codes.Unauthenticated, "call is not bound to a device")
+	}
+	if requested != "" && requested != deviceName {
+		return "", status.Errorf(codes.PermissionDenied, "token belongs to %q, not %q", deviceName, requested)
+	}
+	return deviceName, nil
+}
+
+// publicMethod reports whether a method is served without a device token:
+// health checks from load balancers and reflection for tooling.
+func publicMethod(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/grpc.health.v1.Health/") ||
+		strings.HasPrefix(fullMethod, "/grpc.reflection.")
+}
+
+func unaryDeviceAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if publicMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	ctx, err := authenticateDevice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func streamDeviceAuthInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if publicMethod(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	ctx, err := authenticateDevice(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"project-phoenix/v2/internal/broker"
+	pb "project-phoenix/v2/pkg/service/apigateway-grpc/src/go"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	healthCheckInterval           = 10 * time.Second
+	defaultMaxMessageBytes        = 32 << 20
+	defaultDrainSeconds           = 5
+	defaultShutdownTimeoutSeconds = 30
+)
+
+func envSeconds(name string, fallback int) int {
+	seconds, e := strconv.Atoi(os.Getenv(name))
+	if e != nil || seconds < 0 {
+		return fallback
+	}
+	return seconds
+}
+
+// maxMessageBytes is the largest gRPC message accepted or sent, from
+// GRPC_MAX_MESSAGE_BYTES.
+func maxMessageBytes() int {
+	limit, e := strconv.Atoi(os.Getenv("GRPC_MAX_MESSAGE_BYTES"))
+	if e != nil || limit <= 0 {
+		return defaultMaxMessageBytes
+	}
+	return limit
+}
+
+// watchBrokerHealth reports SERVING while RabbitMQ is reachable. Every call the
+// gateway handles ends in a broker publish, so without it the gateway can only
+// drop data.
+func (s *APIGatewayGRPCService) watchBrokerHealth() {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	var last healthpb.HealthCheckResponse_ServingStatus
+	for {
+		status := healthpb.HealthCheckResponse_SERVING
+		if err := broker.CheckRabbitMQ(); err != nil {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+			if last != status {
+				log.Println("RabbitMQ unreachable, reporting NOT_SERVING:", err)
+			}
+		}
+		if last != status {
+			s.healthServer.SetServingStatus("", status)
+			s.healthServer.SetServingStatus(pb.ScreenCaptureService_ServiceDesc.ServiceName, status)
+			last = status
+		}
+
+		select {
+		case <-s.stopHealthChecks:
+			return
+		case <-ticker.C:
+		}
+	}
+}
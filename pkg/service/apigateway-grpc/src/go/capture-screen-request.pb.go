@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.35.1
+// 	protoc-gen-go v1.36.11
 // 	protoc        v5.29.0--rc2
 // source: capture-screen-request.proto
 
@@ -9,8 +9,10 @@ package _go
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
+	unsafe "unsafe"
 )
 
 const (
@@ -21,17 +23,19 @@ const (
 )
 
 type ScreenCaptureRequest struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	DeviceName  string                 `protobuf:"bytes,1,opt,name=deviceName,proto3" json:"deviceName,omitempty"`
+	TimesTamp   string                 `protobuf:"bytes,2,opt,name=timesTamp,proto3" json:"timesTamp,omitempty"`
+	OsName      string                 `protobuf:"bytes,3,opt,name=osName,proto3" json:"osName,omitempty"`
+	MemoryUsage string                 `protobuf:"bytes,5,opt,name=memoryUsage,proto3" json:"memoryUsage,omitempty"`
+	DiskUsage   string                 `protobuf:"bytes,6,opt,name=diskUsage,proto3" json:"diskUsage,omitempty"`
+	LastImage   string                 `protobuf:"bytes,7,opt,name=lastImage,proto3" json:"lastImage,omitempty"`
+	MessageType int32                  `protobuf:"varint,8,opt,name=messageType,proto3" json:"messageType,omitempty"`
+	// Seconds since the last keyboard/mouse input on the device, if the agent
+	// can tell. Used by schedules that only capture while the user is active.
+	IdleSeconds   *int64 `protobuf:"varint,9,opt,name=idleSeconds,proto3,oneof" json:"idleSeconds,omitempty"`
 	unknownFields protoimpl.UnknownFields
-
-	DeviceName  string `protobuf:"bytes,1,opt,name=deviceName,proto3" json:"deviceName,omitempty"`
-	TimesTamp   string `protobuf:"bytes,2,opt,name=timesTamp,proto3" json:"timesTamp,omitempty"`
-	OsName      string `protobuf:"bytes,3,opt,name=osName,proto3" json:"osName,omitempty"`
-	MemoryUsage string `protobuf:"bytes,5,opt,name=memoryUsage,proto3" json:"memoryUsage,omitempty"`
-	DiskUsage   string `protobuf:"bytes,6,opt,name=diskUsage,proto3" json:"diskUsage,omitempty"`
-	LastImage   string `protobuf:"bytes,7,opt,name=lastImage,proto3" json:"lastImage,omitempty"`
-	MessageType int32  `protobuf:"varint,8,opt,name=messageType,proto3" json:"messageType,omitempty"`
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *ScreenCaptureRequest) Reset() {
@@ -113,13 +117,19 @@ func (x *ScreenCaptureRequest) GetMessageType() int32 {
 	return 0
 }
 
+func (x *ScreenCaptureRequest) GetIdleSeconds() int64 {
+	if x != nil && x.IdleSeconds != nil {
+		return *x.IdleSeconds
+	}
+	return 0
+}
+
 type ScreenCaptureResponse struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
 	unknownFields protoimpl.UnknownFields
-
-	Success bool   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
-	Message string `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *ScreenCaptureResponse) Reset() {
@@ -166,84 +176,1074 @@ func (x *ScreenCaptureResponse) GetMessage() string {
 	return ""
 }
 
-var File_capture_screen_request_proto protoreflect.FileDescriptor
+// Sent by a device agent when it acknowledges, completes or fails a command
+// received on its device-command channel.
+type CommandResultRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CommandId     string                 `protobuf:"bytes,1,opt,name=commandId,proto3" json:"commandId,omitempty"`
+	DeviceName    string                 `protobuf:"bytes,2,opt,name=deviceName,proto3" json:"deviceName,omitempty"`
+	Status        string                 `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	Result        string                 `protobuf:"bytes,4,opt,name=result,proto3" json:"result,omitempty"`
+	Error         string                 `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandResultRequest) Reset() {
+	*x = CommandResultRequest{}
+	mi := &file_capture_screen_request_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
 
-var file_capture_screen_request_proto_rawDesc = []byte{
-	0x0a, 0x1c, 0x63, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65, 0x2d, 0x73, 0x63, 0x72, 0x65, 0x65, 0x6e,
-	0x2d, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0d,
-	0x73, 0x63, 0x72, 0x65, 0x65, 0x6e, 0x63, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65, 0x22, 0xec, 0x01,
-	0x0a, 0x14, 0x53, 0x63, 0x72, 0x65, 0x65, 0x6e, 0x43, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65, 0x52,
-	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x64, 0x65, 0x76, 0x69, 0x63, 0x65,
-	0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x64, 0x65, 0x76, 0x69,
-	0x63, 0x65, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x54,
-	0x61, 0x6d, 0x70, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73,
-	0x54, 0x61, 0x6d, 0x70, 0x12, 0x16, 0x0a, 0x06, 0x6f, 0x73, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x03,
-	0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x6f, 0x73, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x20, 0x0a, 0x0b,
-	0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x55, 0x73, 0x61, 0x67, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x0b, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x55, 0x73, 0x61, 0x67, 0x65, 0x12, 0x1c,
-	0x0a, 0x09, 0x64, 0x69, 0x73, 0x6b, 0x55, 0x73, 0x61, 0x67, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x09, 0x64, 0x69, 0x73, 0x6b, 0x55, 0x73, 0x61, 0x67, 0x65, 0x12, 0x1c, 0x0a, 0x09,
-	0x6c, 0x61, 0x73, 0x74, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52,
-	0x09, 0x6c, 0x61, 0x73, 0x74, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x6d, 0x65,
-	0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x05, 0x52,
-	0x0b, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70, 0x65, 0x22, 0x4b, 0x0a, 0x15,
-	0x53, 0x63, 0x72, 0x65, 0x65, 0x6e, 0x43, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65, 0x52, 0x65, 0x73,
-	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x12,
-	0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x32, 0x72, 0x0a, 0x14, 0x53, 0x63, 0x72,
-	0x65, 0x65, 0x6e, 0x43, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63,
-	0x65, 0x12, 0x5a, 0x0a, 0x0b, 0x53, 0x65, 0x6e, 0x64, 0x43, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65,
-	0x12, 0x23, 0x2e, 0x73, 0x63, 0x72, 0x65, 0x65, 0x6e, 0x63, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65,
-	0x2e, 0x53, 0x63, 0x72, 0x65, 0x65, 0x6e, 0x43, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65, 0x52, 0x65,
-	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x24, 0x2e, 0x73, 0x63, 0x72, 0x65, 0x65, 0x6e, 0x63, 0x61,
-	0x70, 0x74, 0x75, 0x72, 0x65, 0x2e, 0x53, 0x63, 0x72, 0x65, 0x65, 0x6e, 0x43, 0x61, 0x70, 0x74,
-	0x75, 0x72, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x37, 0x5a,
-	0x35, 0x70, 0x72, 0x6f, 0x6a, 0x65, 0x63, 0x74, 0x2d, 0x70, 0x68, 0x6f, 0x65, 0x6e, 0x69, 0x78,
-	0x2f, 0x76, 0x32, 0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2f,
-	0x61, 0x70, 0x69, 0x67, 0x61, 0x74, 0x65, 0x77, 0x61, 0x79, 0x2d, 0x67, 0x72, 0x70, 0x63, 0x2f,
-	0x73, 0x72, 0x63, 0x2f, 0x67, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+func (x *CommandResultRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-var (
-	file_capture_screen_request_proto_rawDescOnce sync.Once
-	file_capture_screen_request_proto_rawDescData = file_capture_screen_request_proto_rawDesc
-)
+func (*CommandResultRequest) ProtoMessage() {}
 
-func file_capture_screen_request_proto_rawDescGZIP() []byte {
-	file_capture_screen_request_proto_rawDescOnce.Do(func() {
-		file_capture_screen_request_proto_rawDescData = protoimpl.X.CompressGZIP(file_capture_screen_request_proto_rawDescData)
-	})
-	return file_capture_screen_request_proto_rawDescData
+func (x *CommandResultRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_capture_screen_request_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
 }
 
-var file_capture_screen_request_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
-var file_capture_screen_request_proto_goTypes = []any{
-	(*ScreenCaptureRequest)(nil),  // 0: screencapture.ScreenCaptureRequest
-	(*ScreenCaptureResponse)(nil), // 1: screencapture.ScreenCaptureResponse
+// Deprecated: Use CommandResultRequest.ProtoReflect.Descriptor instead.
+func (*CommandResultRequest) Descriptor() ([]byte, []int) {
+	return file_capture_screen_request_proto_rawDescGZIP(), []int{2}
 }
-var file_capture_screen_request_proto_depIdxs = []int32{
-	0, // 0: screencapture.ScreenCaptureService.SendCapture:input_type -> screencapture.ScreenCaptureRequest
-	1, // 1: screencapture.ScreenCaptureService.SendCapture:output_type -> screencapture.ScreenCaptureResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+
+func (x *CommandResultRequest) GetCommandId() string {
+	if x != nil {
+		return x.CommandId
+	}
+	return ""
 }
 
-func init() { file_capture_screen_request_proto_init() }
-func file_capture_screen_request_proto_init() {
-	if File_capture_screen_request_proto != nil {
-		return
+func (x *CommandResultRequest) GetDeviceName() string {
+	if x != nil {
+		return x.DeviceName
+	}
+	return ""
+}
+
+func (x *CommandResultRequest) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *CommandResultRequest) GetResult() string {
+	if x != nil {
+		return x.Result
+	}
+	return ""
+}
+
+func (x *CommandResultRequest) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type CommandResultResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandResultResponse) Reset() {
+	*x = CommandResultResponse{}
+	mi := &file_capture_screen_request_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandResultResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandResultResponse) ProtoMessage() {}
+
+func (x *CommandResultResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_capture_screen_request_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandResultResponse.ProtoReflect.Descriptor instead.
+func (*CommandResultResponse) Descriptor() ([]byte, []int) {
+	return file_capture_screen_request_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CommandResultResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *CommandResultResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type AgentMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*AgentMessage_Hello
+	//	*AgentMessage_Telemetry
+	//	*AgentMessage_ImageChunk
+	//	*AgentMessage_CommandResult
+	Payload       isAgentMessage_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AgentMessage) Reset() {
+	*x = AgentMessage{}
+	mi := &file_capture_screen_request_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentMessage) ProtoMessage() {}
+
+func (x *AgentMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_capture_screen_request_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentMessage.ProtoReflect.Descriptor instead.
+func (*AgentMessage) Descriptor() ([]byte, []int) {
+	return file_capture_screen_request_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *AgentMessage) GetPayload() isAgentMessage_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetHello() *AgentHello {
+	if x != nil {
+		if x, ok := x.Payload.(*AgentMessage_Hello); ok {
+			return x.Hello
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetTelemetry() *Telemetry {
+	if x != nil {
+		if x, ok := x.Payload.(*AgentMessage_Telemetry); ok {
+			return x.Telemetry
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetImageChunk() *ImageChunk {
+	if x != nil {
+		if x, ok := x.Payload.(*AgentMessage_ImageChunk); ok {
+			return x.ImageChunk
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetCommandResult() *CommandResultRequest {
+	if x != nil {
+		if x, ok := x.Payload.(*AgentMessage_CommandResult); ok {
+			return x.CommandResult
+		}
+	}
+	return nil
+}
+
+type isAgentMessage_Payload interface {
+	isAgentMessage_Payload()
+}
+
+type AgentMessage_Hello struct {
+	Hello *AgentHello `protobuf:"bytes,1,opt,name=hello,proto3,oneof"`
+}
+
+type AgentMessage_Telemetry struct {
+	Telemetry *Telemetry `protobuf:"bytes,2,opt,name=telemetry,proto3,oneof"`
+}
+
+type AgentMessage_ImageChunk struct {
+	ImageChunk *ImageChunk `protobuf:"bytes,3,opt,name=imageChunk,proto3,oneof"`
+}
+
+type AgentMessage_CommandResult struct {
+	CommandResult *CommandResultRequest `protobuf:"bytes,4,opt,name=commandResult,proto3,oneof"`
+}
+
+func (*AgentMessage_Hello) isAgentMessage_Payload() {}
+
+func (*AgentMessage_Telemetry) isAgentMessage_Payload() {}
+
+func (*AgentMessage_ImageChunk) isAgentMessage_Payload() {}
+
+func (*AgentMessage_CommandResult) isAgentMessage_Payload() {}
+
+type AgentHello struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DeviceName    string                 `protobuf:"bytes,1,opt,name=deviceName,proto3" json:"deviceName,omitempty"`
+	OsName        string                 `protobuf:"bytes,2,opt,name=osName,proto3" json:"osName,omitempty"`
+	AgentVersion  string                 `protobuf:"bytes,3,opt,name=agentVersion,proto3" json:"agentVersion,omitempty"`
+	SentAt        *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=sentAt,proto3" json:"sentAt,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AgentHello) Reset() {
+	*x = AgentHello{}
+	mi := &file_capture_screen_request_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentHello) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentHello) ProtoMessage() {}
+
+func (x *AgentHello) ProtoReflect() protoreflect.Message {
+	mi := &file_capture_screen_request_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentHello.ProtoReflect.Descriptor instead.
+func (*AgentHello) Descriptor() ([]byte, []int) {
+	return file_capture_screen_request_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *AgentHello) GetDeviceName() string {
+	if x != nil {
+		return x.DeviceName
+	}
+	return ""
+}
+
+func (x *AgentHello) GetOsName() string {
+	if x != nil {
+		return x.OsName
+	}
+	return ""
+}
+
+func (x *AgentHello) GetAgentVersion() string {
+	if x != nil {
+		return x.AgentVersion
+	}
+	return ""
+}
+
+func (x *AgentHello) GetSentAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.SentAt
+	}
+	return nil
+}
+
+type ResourceUsage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Percent       float64                `protobuf:"fixed64,1,opt,name=percent,proto3" json:"percent,omitempty"`
+	UsedBytes     uint64                 `protobuf:"varint,2,opt,name=usedBytes,proto3" json:"usedBytes,omitempty"`
+	TotalBytes    uint64                 `protobuf:"varint,3,opt,name=totalBytes,proto3" json:"totalBytes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResourceUsage) Reset() {
+	*x = ResourceUsage{}
+	mi := &file_capture_screen_request_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResourceUsage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResourceUsage) ProtoMessage() {}
+
+func (x *ResourceUsage) ProtoReflect() protoreflect.Message {
+	mi := &file_capture_screen_request_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResourceUsage.ProtoReflect.Descriptor instead.
+func (*ResourceUsage) Descriptor() ([]byte, []int) {
+	return file_capture_screen_request_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ResourceUsage) GetPercent() float64 {
+	if x != nil {
+		return x.Percent
+	}
+	return 0
+}
+
+func (x *ResourceUsage) GetUsedBytes() uint64 {
+	if x != nil {
+		return x.UsedBytes
+	}
+	return 0
+}
+
+func (x *ResourceUsage) GetTotalBytes() uint64 {
+	if x != nil {
+		return x.TotalBytes
+	}
+	return 0
+}
+
+type Telemetry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	OsName        string                 `protobuf:"bytes,2,opt,name=osName,proto3" json:"osName,omitempty"`
+	Memory        *ResourceUsage         `protobuf:"bytes,3,opt,name=memory,proto3" json:"memory,omitempty"`
+	Disk          *ResourceUsage         `protobuf:"bytes,4,opt,name=disk,proto3" json:"disk,omitempty"`
+	IdleSeconds   *int64                 `protobuf:"varint,5,opt,name=idleSeconds,proto3,oneof" json:"idleSeconds,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Telemetry) Reset() {
+	*x = Telemetry{}
+	mi := &file_capture_screen_request_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Telemetry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Telemetry) ProtoMessage() {}
+
+func (x *Telemetry) ProtoReflect() protoreflect.Message {
+	mi := &file_capture_screen_request_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Telemetry.ProtoReflect.Descriptor instead.
+func (*Telemetry) Descriptor() ([]byte, []int) {
+	return file_capture_screen_request_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Telemetry) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *Telemetry) GetOsName() string {
+	if x != nil {
+		return x.OsName
+	}
+	return ""
+}
+
+func (x *Telemetry) GetMemory() *ResourceUsage {
+	if x != nil {
+		return x.Memory
+	}
+	return nil
+}
+
+func (x *Telemetry) GetDisk() *ResourceUsage {
+	if x != nil {
+		return x.Disk
+	}
+	return nil
+}
+
+func (x *Telemetry) GetIdleSeconds() int64 {
+	if x != nil && x.IdleSeconds != nil {
+		return *x.IdleSeconds
+	}
+	return 0
+}
+
+// A screenshot is sent as a run of chunks sharing a captureId, numbered from
+// zero. The chunk with last set completes the image; telemetry taken with the
+// capture rides on that chunk.
+type ImageChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CaptureId     string                 `protobuf:"bytes,1,opt,name=captureId,proto3" json:"captureId,omitempty"`
+	Sequence      uint32                 `protobuf:"varint,2,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Data          []byte                 `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	Last          bool                   `protobuf:"varint,4,opt,name=last,proto3" json:"last,omitempty"`
+	ContentType   string                 `protobuf:"bytes,5,opt,name=contentType,proto3" json:"contentType,omitempty"`
+	CapturedAt    *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=capturedAt,proto3" json:"capturedAt,omitempty"`
+	Telemetry     *Telemetry             `protobuf:"bytes,7,opt,name=telemetry,proto3" json:"telemetry,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImageChunk) Reset() {
+	*x = ImageChunk{}
+	mi := &file_capture_screen_request_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImageChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImageChunk) ProtoMessage() {}
+
+func (x *ImageChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_capture_screen_request_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImageChunk.ProtoReflect.Descriptor instead.
+func (*ImageChunk) Descriptor() ([]byte, []int) {
+	return file_capture_screen_request_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ImageChunk) GetCaptureId() string {
+	if x != nil {
+		return x.CaptureId
+	}
+	return ""
+}
+
+func (x *ImageChunk) GetSequence() uint32 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *ImageChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *ImageChunk) GetLast() bool {
+	if x != nil {
+		return x.Last
+	}
+	return false
+}
+
+func (x *ImageChunk) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *ImageChunk) GetCapturedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CapturedAt
+	}
+	return nil
+}
+
+func (x *ImageChunk) GetTelemetry() *Telemetry {
+	if x != nil {
+		return x.Telemetry
+	}
+	return nil
+}
+
+type ServerMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*ServerMessage_Capture
+	//	*ServerMessage_Ping
+	//	*ServerMessage_Command
+	//	*ServerMessage_Ack
+	Payload       isServerMessage_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServerMessage) Reset() {
+	*x = ServerMessage{}
+	mi := &file_capture_screen_request_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServerMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerMessage) ProtoMessage() {}
+
+func (x *ServerMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_capture_screen_request_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerMessage.ProtoReflect.Descriptor instead.
+func (*ServerMessage) Descriptor() ([]byte, []int) {
+	return file_capture_screen_request_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ServerMessage) GetPayload() isServerMessage_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *ServerMessage) GetCapture() *CaptureCommand {
+	if x != nil {
+		if x, ok := x.Payload.(*ServerMessage_Capture); ok {
+			return x.Capture
+		}
+	}
+	return nil
+}
+
+func (x *ServerMessage) GetPing() *PingCommand {
+	if x != nil {
+		if x, ok := x.Payload.(*ServerMessage_Ping); ok {
+			return x.Ping
+		}
+	}
+	return nil
+}
+
+func (x *ServerMessage) GetCommand() *DeviceCommand {
+	if x != nil {
+		if x, ok := x.Payload.(*ServerMessage_Command); ok {
+			return x.Command
+		}
+	}
+	return nil
+}
+
+func (x *ServerMessage) GetAck() *StreamAck {
+	if x != nil {
+		if x, ok := x.Payload.(*ServerMessage_Ack); ok {
+			return x.Ack
+		}
+	}
+	return nil
+}
+
+type isServerMessage_Payload interface {
+	isServerMessage_Payload()
+}
+
+type ServerMessage_Capture struct {
+	Capture *CaptureCommand `protobuf:"bytes,1,opt,name=capture,proto3,oneof"`
+}
+
+type ServerMessage_Ping struct {
+	Ping *PingCommand `protobuf:"bytes,2,opt,name=ping,proto3,oneof"`
+}
+
+type ServerMessage_Command struct {
+	Command *DeviceCommand `protobuf:"bytes,3,opt,name=command,proto3,oneof"`
+}
+
+type ServerMessage_Ack struct {
+	Ack *StreamAck `protobuf:"bytes,4,opt,name=ack,proto3,oneof"`
+}
+
+func (*ServerMessage_Capture) isServerMessage_Payload() {}
+
+func (*ServerMessage_Ping) isServerMessage_Payload() {}
+
+func (*ServerMessage_Command) isServerMessage_Payload() {}
+
+func (*ServerMessage_Ack) isServerMessage_Payload() {}
+
+type CaptureCommand struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	IssuedAt      *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=issuedAt,proto3" json:"issuedAt,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CaptureCommand) Reset() {
+	*x = CaptureCommand{}
+	mi := &file_capture_screen_request_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CaptureCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CaptureCommand) ProtoMessage() {}
+
+func (x *CaptureCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_capture_screen_request_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CaptureCommand.ProtoReflect.Descriptor instead.
+func (*CaptureCommand) Descriptor() ([]byte, []int) {
+	return file_capture_screen_request_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *CaptureCommand) GetIssuedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.IssuedAt
+	}
+	return nil
+}
+
+type PingCommand struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	IssuedAt      *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=issuedAt,proto3" json:"issuedAt,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PingCommand) Reset() {
+	*x = PingCommand{}
+	mi := &file_capture_screen_request_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PingCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PingCommand) ProtoMessage() {}
+
+func (x *PingCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_capture_screen_request_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PingCommand.ProtoReflect.Descriptor instead.
+func (*PingCommand) Descriptor() ([]byte, []int) {
+	return file_capture_screen_request_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *PingCommand) GetIssuedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.IssuedAt
+	}
+	return nil
+}
+
+// Mirrors the commands sent through POST /device/command. payload is the
+// command's JSON payload.
+type DeviceCommand struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	CommandId      string                 `protobuf:"bytes,1,opt,name=commandId,proto3" json:"commandId,omitempty"`
+	Type           string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Payload        string                 `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	TimeoutSeconds int32                  `protobuf:"varint,4,opt,name=timeoutSeconds,proto3" json:"timeoutSeconds,omitempty"`
+	IssuedAt       *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=issuedAt,proto3" json:"issuedAt,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *DeviceCommand) Reset() {
+	*x = DeviceCommand{}
+	mi := &file_capture_screen_request_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeviceCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeviceCommand) ProtoMessage() {}
+
+func (x *DeviceCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_capture_screen_request_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeviceCommand.ProtoReflect.Descriptor instead.
+func (*DeviceCommand) Descriptor() ([]byte, []int) {
+	return file_capture_screen_request_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *DeviceCommand) GetCommandId() string {
+	if x != nil {
+		return x.CommandId
+	}
+	return ""
+}
+
+func (x *DeviceCommand) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *DeviceCommand) GetPayload() string {
+	if x != nil {
+		return x.Payload
+	}
+	return ""
+}
+
+func (x *DeviceCommand) GetTimeoutSeconds() int32 {
+	if x != nil {
+		return x.TimeoutSeconds
+	}
+	return 0
+}
+
+func (x *DeviceCommand) GetIssuedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.IssuedAt
+	}
+	return nil
+}
+
+// Acknowledges a completed image or a command result so the agent can free
+// its buffers.
+type StreamAck struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ref           string                 `protobuf:"bytes,1,opt,name=ref,proto3" json:"ref,omitempty"`
+	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamAck) Reset() {
+	*x = StreamAck{}
+	mi := &file_capture_screen_request_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamAck) ProtoMessage() {}
+
+func (x *StreamAck) ProtoReflect() protoreflect.Message {
+	mi := &file_capture_screen_request_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamAck.ProtoReflect.Descriptor instead.
+func (*StreamAck) Descriptor() ([]byte, []int) {
+	return file_capture_screen_request_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *StreamAck) GetRef() string {
+	if x != nil {
+		return x.Ref
+	}
+	return ""
+}
+
+func (x *StreamAck) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *StreamAck) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+var File_capture_screen_request_proto protoreflect.FileDescriptor
+
+const file_capture_screen_request_proto_rawDesc = "" +
+	"\n" +
+	"\x1ccapture-screen-request.proto\x12\rscreencapture\x1a\x1fgoogle/protobuf/timestamp.proto\"\xa3\x02\n" +
+	"\x14ScreenCaptureRequest\x12\x1e\n" +
+	"\n" +
+	"deviceName\x18\x01 \x01(\tR\n" +
+	"deviceName\x12\x1c\n" +
+	"\ttimesTamp\x18\x02 \x01(\tR\ttimesTamp\x12\x16\n" +
+	"\x06osName\x18\x03 \x01(\tR\x06osName\x12 \n" +
+	"\vmemoryUsage\x18\x05 \x01(\tR\vmemoryUsage\x12\x1c\n" +
+	"\tdiskUsage\x18\x06 \x01(\tR\tdiskUsage\x12\x1c\n" +
+	"\tlastImage\x18\a \x01(\tR\tlastImage\x12 \n" +
+	"\vmessageType\x18\b \x01(\x05R\vmessageType\x12%\n" +
+	"\vidleSeconds\x18\t \x01(\x03H\x00R\vidleSeconds\x88\x01\x01B\x0e\n" +
+	"\f_idleSeconds\"K\n" +
+	"\x15ScreenCaptureResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"\x9a\x01\n" +
+	"\x14CommandResultRequest\x12\x1c\n" +
+	"\tcommandId\x18\x01 \x01(\tR\tcommandId\x12\x1e\n" +
+	"\n" +
+	"deviceName\x18\x02 \x01(\tR\n" +
+	"deviceName\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\tR\x06status\x12\x16\n" +
+	"\x06result\x18\x04 \x01(\tR\x06result\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error\"K\n" +
+	"\x15CommandResultResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"\x90\x02\n" +
+	"\fAgentMessage\x121\n" +
+	"\x05hello\x18\x01 \x01(\v2\x19.screencapture.AgentHelloH\x00R\x05hello\x128\n" +
+	"\ttelemetry\x18\x02 \x01(\v2\x18.screencapture.TelemetryH\x00R\ttelemetry\x12;\n" +
+	"\n" +
+	"imageChunk\x18\x03 \x01(\v2\x19.screencapture.ImageChunkH\x00R\n" +
+	"imageChunk\x12K\n" +
+	"\rcommandResult\x18\x04 \x01(\v2#.screencapture.CommandResultRequestH\x00R\rcommandResultB\t\n" +
+	"\apayload\"\x9c\x01\n" +
+	"\n" +
+	"AgentHello\x12\x1e\n" +
+	"\n" +
+	"deviceName\x18\x01 \x01(\tR\n" +
+	"deviceName\x12\x16\n" +
+	"\x06osName\x18\x02 \x01(\tR\x06osName\x12\"\n" +
+	"\fagentVersion\x18\x03 \x01(\tR\fagentVersion\x122\n" +
+	"\x06sentAt\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x06sentAt\"g\n" +
+	"\rResourceUsage\x12\x18\n" +
+	"\apercent\x18\x01 \x01(\x01R\apercent\x12\x1c\n" +
+	"\tusedBytes\x18\x02 \x01(\x04R\tusedBytes\x12\x1e\n" +
+	"\n" +
+	"totalBytes\x18\x03 \x01(\x04R\n" +
+	"totalBytes\"\xfc\x01\n" +
+	"\tTelemetry\x128\n" +
+	"\ttimestamp\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x16\n" +
+	"\x06osName\x18\x02 \x01(\tR\x06osName\x124\n" +
+	"\x06memory\x18\x03 \x01(\v2\x1c.screencapture.ResourceUsageR\x06memory\x120\n" +
+	"\x04disk\x18\x04 \x01(\v2\x1c.screencapture.ResourceUsageR\x04disk\x12%\n" +
+	"\vidleSeconds\x18\x05 \x01(\x03H\x00R\vidleSeconds\x88\x01\x01B\x0e\n" +
+	"\f_idleSeconds\"\x84\x02\n" +
+	"\n" +
+	"ImageChunk\x12\x1c\n" +
+	"\tcaptureId\x18\x01 \x01(\tR\tcaptureId\x12\x1a\n" +
+	"\bsequence\x18\x02 \x01(\rR\bsequence\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\x12\x12\n" +
+	"\x04last\x18\x04 \x01(\bR\x04last\x12 \n" +
+	"\vcontentType\x18\x05 \x01(\tR\vcontentType\x12:\n" +
+	"\n" +
+	"capturedAt\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"capturedAt\x126\n" +
+	"\ttelemetry\x18\a \x01(\v2\x18.screencapture.TelemetryR\ttelemetry\"\xef\x01\n" +
+	"\rServerMessage\x129\n" +
+	"\acapture\x18\x01 \x01(\v2\x1d.screencapture.CaptureCommandH\x00R\acapture\x120\n" +
+	"\x04ping\x18\x02 \x01(\v2\x1a.screencapture.PingCommandH\x00R\x04ping\x128\n" +
+	"\acommand\x18\x03 \x01(\v2\x1c.screencapture.DeviceCommandH\x00R\acommand\x12,\n" +
+	"\x03ack\x18\x04 \x01(\v2\x18.screencapture.StreamAckH\x00R\x03ackB\t\n" +
+	"\apayload\"H\n" +
+	"\x0eCaptureCommand\x126\n" +
+	"\bissuedAt\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\bissuedAt\"E\n" +
+	"\vPingCommand\x126\n" +
+	"\bissuedAt\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\bissuedAt\"\xbb\x01\n" +
+	"\rDeviceCommand\x12\x1c\n" +
+	"\tcommandId\x18\x01 \x01(\tR\tcommandId\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x18\n" +
+	"\apayload\x18\x03 \x01(\tR\apayload\x12&\n" +
+	"\x0etimeoutSeconds\x18\x04 \x01(\x05R\x0etimeoutSeconds\x126\n" +
+	"\bissuedAt\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\bissuedAt\"Q\n" +
+	"\tStreamAck\x12\x10\n" +
+	"\x03ref\x18\x01 \x01(\tR\x03ref\x12\x18\n" +
+	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage2\xa2\x02\n" +
+	"\x14ScreenCaptureService\x12Z\n" +
+	"\vSendCapture\x12#.screencapture.ScreenCaptureRequest\x1a$.screencapture.ScreenCaptureResponse\"\x00\x12b\n" +
+	"\x13ReportCommandResult\x12#.screencapture.CommandResultRequest\x1a$.screencapture.CommandResultResponse\"\x00\x12J\n" +
+	"\aConnect\x12\x1b.screencapture.AgentMessage\x1a\x1c.screencapture.ServerMessage\"\x00(\x010\x01B7Z5project-phoenix/v2/pkg/service/apigateway-grpc/src/gob\x06proto3"
+
+var (
+	file_capture_screen_request_proto_rawDescOnce sync.Once
+	file_capture_screen_request_proto_rawDescData []byte
+)
+
+func file_capture_screen_request_proto_rawDescGZIP() []byte {
+	file_capture_screen_request_proto_rawDescOnce.Do(func() {
+		file_capture_screen_request_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_capture_screen_request_proto_rawDesc), len(file_capture_screen_request_proto_rawDesc)))
+	})
+	return file_capture_screen_request_proto_rawDescData
+}
+
+var file_capture_screen_request_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_capture_screen_request_proto_goTypes = []any{
+	(*ScreenCaptureRequest)(nil),  // 0: screencapture.ScreenCaptureRequest
+	(*ScreenCaptureResponse)(nil), // 1: screencapture.ScreenCaptureResponse
+	(*CommandResultRequest)(nil),  // 2: screencapture.CommandResultRequest
+	(*CommandResultResponse)(nil), // 3: screencapture.CommandResultResponse
+	(*AgentMessage)(nil),          // 4: screencapture.AgentMessage
+	(*AgentHello)(nil),            // 5: screencapture.AgentHello
+	(*ResourceUsage)(nil),         // 6: screencapture.ResourceUsage
+	(*Telemetry)(nil),             // 7: screencapture.Telemetry
+	(*ImageChunk)(nil),            // 8: screencapture.ImageChunk
+	(*ServerMessage)(nil),         // 9: screencapture.ServerMessage
+	(*CaptureCommand)(nil),        // 10: screencapture.CaptureCommand
+	(*PingCommand)(nil),           // 11: screencapture.PingCommand
+	(*DeviceCommand)(nil),         // 12: screencapture.DeviceCommand
+	(*StreamAck)(nil),             // 13: screencapture.StreamAck
+	(*timestamppb.Timestamp)(nil), // 14: google.protobuf.Timestamp
+}
+var file_capture_screen_request_proto_depIdxs = []int32{
+	5,  // 0: screencapture.AgentMessage.hello:type_name -> screencapture.AgentHello
+	7,  // 1: screencapture.AgentMessage.telemetry:type_name -> screencapture.Telemetry
+	8,  // 2: screencapture.AgentMessage.imageChunk:type_name -> screencapture.ImageChunk
+	2,  // 3: screencapture.AgentMessage.commandResult:type_name -> screencapture.CommandResultRequest
+	14, // 4: screencapture.AgentHello.sentAt:type_name -> google.protobuf.Timestamp
+	14, // 5: screencapture.Telemetry.timestamp:type_name -> google.protobuf.Timestamp
+	6,  // 6: screencapture.Telemetry.memory:type_name -> screencapture.ResourceUsage
+	6,  // 7: screencapture.Telemetry.disk:type_name -> screencapture.ResourceUsage
+	14, // 8: screencapture.ImageChunk.capturedAt:type_name -> google.protobuf.Timestamp
+	7,  // 9: screencapture.ImageChunk.telemetry:type_name -> screencapture.Telemetry
+	10, // 10: screencapture.ServerMessage.capture:type_name -> screencapture.CaptureCommand
+	11, // 11: screencapture.ServerMessage.ping:type_name -> screencapture.PingCommand
+	12, // 12: screencapture.ServerMessage.command:type_name -> screencapture.DeviceCommand
+	13, // 13: screencapture.ServerMessage.ack:type_name -> screencapture.StreamAck
+	14, // 14: screencapture.CaptureCommand.issuedAt:type_name -> google.protobuf.Timestamp
+	14, // 15: screencapture.PingCommand.issuedAt:type_name -> google.protobuf.Timestamp
+	14, // 16: screencapture.DeviceCommand.issuedAt:type_name -> google.protobuf.Timestamp
+	0,  // 17: screencapture.ScreenCaptureService.SendCapture:input_type -> screencapture.ScreenCaptureRequest
+	2,  // 18: screencapture.ScreenCaptureService.ReportCommandResult:input_type -> screencapture.CommandResultRequest
+	4,  // 19: screencapture.ScreenCaptureService.Connect:input_type -> screencapture.AgentMessage
+	1,  // 20: screencapture.ScreenCaptureService.SendCapture:output_type -> screencapture.ScreenCaptureResponse
+	3,  // 21: screencapture.ScreenCaptureService.ReportCommandResult:output_type -> screencapture.CommandResultResponse
+	9,  // 22: screencapture.ScreenCaptureService.Connect:output_type -> screencapture.ServerMessage
+	20, // [20:23] is the sub-list for method output_type
+	17, // [17:20] is the sub-list for method input_type
+	17, // [17:17] is the sub-list for extension type_name
+	17, // [17:17] is the sub-list for extension extendee
+	0,  // [0:17] is the sub-list for field type_name
+}
+
+func init() { file_capture_screen_request_proto_init() }
+func file_capture_screen_request_proto_init() {
+	if File_capture_screen_request_proto != nil {
+		return
+	}
+	file_capture_screen_request_proto_msgTypes[0].OneofWrappers = []any{}
+	file_capture_screen_request_proto_msgTypes[4].OneofWrappers = []any{
+		(*AgentMessage_Hello)(nil),
+		(*AgentMessage_Telemetry)(nil),
+		(*AgentMessage_ImageChunk)(nil),
+		(*AgentMessage_CommandResult)(nil),
+	}
+	file_capture_screen_request_proto_msgTypes[7].OneofWrappers = []any{}
+	file_capture_screen_request_proto_msgTypes[9].OneofWrappers = []any{
+		(*ServerMessage_Capture)(nil),
+		(*ServerMessage_Ping)(nil),
+		(*ServerMessage_Command)(nil),
+		(*ServerMessage_Ack)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
-			RawDescriptor: file_capture_screen_request_proto_rawDesc,
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_capture_screen_request_proto_rawDesc), len(file_capture_screen_request_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   14,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -252,7 +1252,6 @@ func file_capture_screen_request_proto_init() {
 		MessageInfos:      file_capture_screen_request_proto_msgTypes,
 	}.Build()
 	File_capture_screen_request_proto = out.File
-	file_capture_screen_request_proto_rawDesc = nil
 	file_capture_screen_request_proto_goTypes = nil
 	file_capture_screen_request_proto_depIdxs = nil
 }
@@ -19,7 +19,9 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	ScreenCaptureService_SendCapture_FullMethodName = "/screencapture.ScreenCaptureService/SendCapture"
+	ScreenCaptureService_SendCapture_FullMethodName         = "/screencapture.ScreenCaptureService/SendCapture"
+	ScreenCaptureService_ReportCommandResult_FullMethodName = "/screencapture.ScreenCaptureService/ReportCommandResult"
+	ScreenCaptureService_Connect_FullMethodName             = "/screencapture.ScreenCaptureService/Connect"
 )
 
 // ScreenCaptureServiceClient is the client API for ScreenCaptureService service.
@@ -27,6 +29,11 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type ScreenCaptureServiceClient interface {
 	SendCapture(ctx context.Context, in *ScreenCaptureRequest, opts ...grpc.CallOption) (*ScreenCaptureResponse, error)
+	ReportCommandResult(ctx context.Context, in *CommandResultRequest, opts ...grpc.CallOption) (*CommandResultResponse, error)
+	// Connect keeps a device agent on a single stream. The agent opens with
+	// an AgentHello, then receives commands and sends telemetry, image chunks
+	// and command results as they happen.
+	Connect(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AgentMessage, ServerMessage], error)
 }
 
 type screenCaptureServiceClient struct {
@@ -47,11 +54,39 @@ func (c *screenCaptureServiceClient) SendCapture(ctx context.Context, in *Screen
 	return out, nil
 }
 
+func (c *screenCaptureServiceClient) ReportCommandResult(ctx context.Context, in *CommandResultRequest, opts ...grpc.CallOption) (*CommandResultResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CommandResultResponse)
+	err := c.cc.Invoke(ctx, ScreenCaptureService_ReportCommandResult_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *screenCaptureServiceClient) Connect(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AgentMessage, ServerMessage], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ScreenCaptureService_ServiceDesc.Streams[0], ScreenCaptureService_Connect_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[AgentMessage, ServerMessage]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ScreenCaptureService_ConnectClient = grpc.BidiStreamingClient[AgentMessage, ServerMessage]
+
 // ScreenCaptureServiceServer is the server API for ScreenCaptureService service.
 // All implementations must embed UnimplementedScreenCaptureServiceServer
 // for forward compatibility.
 type ScreenCaptureServiceServer interface {
 	SendCapture(context.Context, *ScreenCaptureRequest) (*ScreenCaptureResponse, error)
+	ReportCommandResult(context.Context, *CommandResultRequest) (*CommandResultResponse, error)
+	// Connect keeps a device agent on a single stream. The agent opens with
+	// an AgentHello, then receives commands and sends telemetry, image chunks
+	// and command results as they happen.
+	Connect(grpc.BidiStreamingServer[AgentMessage, ServerMessage]) error
 	mustEmbedUnimplementedScreenCaptureServiceServer()
 }
 
@@ -65,6 +100,12 @@ type UnimplementedScreenCaptureServiceServer struct{}
 func (UnimplementedScreenCaptureServiceServer) SendCapture(context.Context, *ScreenCaptureRequest) (*ScreenCaptureResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SendCapture not implemented")
 }
+func (UnimplementedScreenCaptureServiceServer) ReportCommandResult(context.Context, *CommandResultRequest) (*CommandResultResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReportCommandResult not implemented")
+}
+func (UnimplementedScreenCaptureServiceServer) Connect(grpc.BidiStreamingServer[AgentMessage, ServerMessage]) error {
+	return status.Errorf(codes.Unimplemented, "method Connect not implemented")
+}
 func (UnimplementedScreenCaptureServiceServer) mustEmbedUnimplementedScreenCaptureServiceServer() {}
 func (UnimplementedScreenCaptureServiceServer) testEmbeddedByValue()                              {}
 
@@ -104,6 +145,31 @@ func _ScreenCaptureService_SendCapture_Handler(srv interface{}, ctx context.Cont
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ScreenCaptureService_ReportCommandResult_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CommandResultRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScreenCaptureServiceServer).ReportCommandResult(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScreenCaptureService_ReportCommandResult_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScreenCaptureServiceServer).ReportCommandResult(ctx, req.(*CommandResultRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScreenCaptureService_Connect_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ScreenCaptureServiceServer).Connect(&grpc.GenericServerStream[AgentMessage, ServerMessage]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ScreenCaptureService_ConnectServer = grpc.BidiStreamingServer[AgentMessage, ServerMessage]
+
 // ScreenCaptureService_ServiceDesc is the grpc.ServiceDesc for ScreenCaptureService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -115,7 +181,18 @@ var ScreenCaptureService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SendCapture",
 			Handler:    _ScreenCaptureService_SendCapture_Handler,
 		},
+		{
+			MethodName: "ReportCommandResult",
+			Handler:    _ScreenCaptureService_ReportCommandResult_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Connect",
+			Handler:       _ScreenCaptureService_Connect_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "capture-screen-request.proto",
 }
@@ -10,7 +10,6 @@ import (
 	"strings"
 	"sync"
 
-	"project-phoenix/v2/internal/controllers/middleware"
 	internal "project-phoenix/v2/internal/service-configs"
 	"project-phoenix/v2/pkg/handler"
 	"project-phoenix/v2/pkg/service"
@@ -90,82 +89,9 @@ func NewAPIGatewayService(serviceObj micro.Service, serviceName string) service.
 }
 
 func (s *APIGatewayService) registerRoutes() {
-	sessionMiddleware := middleware.NewSessionMiddleware()
-	authMiddleware := middleware.NewAuthMiddleware()
 	apiRequestHandler := &handler.APIRequestHandler{}
 	apiRequestHandler.Endpoint = s.serviceConfig.EndpointPrefix
 
-	openRoutes := []string{
-		s.serviceConfig.EndpointPrefix + "/createSession",
-		s.serviceConfig.EndpointPrefix + "/",
-		s.serviceConfig.EndpointPrefix + "/signJWT",
-		s.serviceConfig.EndpointPrefix + "/returnJWK",
-		s.serviceConfig.EndpointPrefix + "/handle-webhook",
-		s.serviceConfig.EndpointPrefix + "/return-device-name",
-		s.serviceConfig.EndpointPrefix + "/search-yt-videos",
-		s.serviceConfig.EndpointPrefix + "/download-yt-videos",
-		s.serviceConfig.EndpointPrefix + "/llm-api-configs",
-		s.serviceConfig.EndpointPrefix + "/llm-api-config",
-		s.serviceConfig.EndpointPrefix + "/gollm/test-connection",
-		s.serviceConfig.EndpointPrefix + "/gollm/fetch-models",
-		s.serviceConfig.EndpointPrefix + "/gollm/ats/scan",
-		s.serviceConfig.EndpointPrefix + "/gollm/ats/analyze-resume",
-		s.serviceConfig.EndpointPrefix + "/gollm/ats/enhance-description",
-		s.serviceConfig.EndpointPrefix + "/gollm/ats/regenerate-item",
-		s.serviceConfig.EndpointPrefix + "/gollm/ats/regenerate-skills",
-		s.serviceConfig.EndpointPrefix + "/keys/repos",
-	}
-	customMiddlewareWrapper := func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Check if the request path is one of the open routes
-			log.Println("Request URL: ", r.URL.Path)
-			for _, path := range openRoutes {
-				if strings.HasSuffix(r.URL.Path, path) {
-					apiRequestHandler.ServeHTTP(w, r)
-					// next.ServeHTTP(w, r)
-					return
-				}
-			}
-			// authMiddleware.Middleware(next).ServeHTTP(w, r)
-			sessionMiddleware.Middleware(next).ServeHTTP(w, r)
-		})
-	}
-
-	openRoutesWithSession := []string{
-		s.serviceConfig.EndpointPrefix + "/login",
-		s.serviceConfig.EndpointPrefix + "/googleLogin",
-		s.serviceConfig.EndpointPrefix + "/visits",
-		s.serviceConfig.EndpointPrefix + "/capture-screen",
-		s.serviceConfig.EndpointPrefix + "/scan-devices",
-		s.serviceConfig.EndpointPrefix + "/ping",
-		s.serviceConfig.EndpointPrefix + "/devices",
-		s.serviceConfig.EndpointPrefix + "/device", //deleting a device
-		s.serviceConfig.EndpointPrefix + "/room/create",
-		s.serviceConfig.EndpointPrefix + "/room/join",
-		s.serviceConfig.EndpointPrefix + "/room/update",
-		s.serviceConfig.EndpointPrefix + "/room/messages",
-
-		s.serviceConfig.EndpointPrefix + "/keys",
-		s.serviceConfig.EndpointPrefix + "/stats",
-		s.serviceConfig.EndpointPrefix + "/validate-key",
-		s.serviceConfig.EndpointPrefix + "/validate-key/openrouter-models",
-	}
-	customMiddlewareWrapperWithSession := func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Check if the request path is one of the open routes
-			log.Println("Request URL: ", r.URL.Path)
-
-			for _, path := range openRoutesWithSession {
-				if strings.HasSuffix(r.URL.Path, path) {
-					next.ServeHTTP(w, r)
-					return
-				}
-			}
-
-			sessionMiddleware.Middleware(authMiddleware.Middleware(next)).ServeHTTP(w, r)
-		})
-	}
-
 	// Custom CORS middleware to handle browser extensions and job sites
 	customCORSMiddleware := func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -202,6 +128,7 @@ func (s *APIGatewayService) registerRoutes() {
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, sessionId, project-type")
 			w.Header().Set("Access-Control-Max-Age", "3600")
+			w.Header().Set("Access-Control-Expose-Headers", "Retry-After, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset")
 
 			// Handle preflight requests
 			if r.Method == "OPTIONS" {
@@ -217,8 +144,7 @@ func (s *APIGatewayService) registerRoutes() {
 	s.router.Use(customCORSMiddleware)
 
 	s.router.Use(s.ConfigureSentry().Handle)
-	s.router.Use(customMiddlewareWrapper)
-	s.router.Use(customMiddlewareWrapperWithSession)
+	s.router.Use(s.accessMiddleware)
 	s.router.PathPrefix(s.serviceConfig.EndpointPrefix).Handler(apiRequestHandler)
 }
 
@@ -252,6 +178,8 @@ func (s *APIGatewayService) Start(port string) error {
 		Handler: s.router,
 	}
 	s.registerRoutes()
+	go s.runCaptureScheduler()
+	go s.runKeyRotation()
 
 	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("HTTP server ListenAndServe error: %v\n", err)
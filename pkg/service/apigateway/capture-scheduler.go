@@ -0,0 +1,30 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"project-phoenix/v2/internal/controllers"
+	"project-phoenix/v2/internal/enum"
+)
+
+const captureSchedulerInterval = 15 * time.Second
+
+// runCaptureScheduler triggers due device capture schedules. Schedules are
+// re-read from the database on every tick, so edits made through
+// /device/schedule apply without restarting the gateway.
+func (s *APIGatewayService) runCaptureScheduler() {
+	ticker := time.NewTicker(captureSchedulerInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		controller := controllers.GetControllerInstance(enum.CaptureScreenController, enum.MONGODB)
+		captureScreenController, ok := controller.(*controllers.CaptureScreenController)
+		if !ok {
+			continue
+		}
+		if err := captureScreenController.RunScheduledCaptures(now.UTC()); err != nil {
+			log.Println("Error running scheduled captures", err)
+		}
+	}
+}
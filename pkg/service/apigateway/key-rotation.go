@@ -0,0 +1,28 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"project-phoenix/v2/internal/controllers"
+	"project-phoenix/v2/internal/enum"
+)
+
+const keyRotationCheckInterval = 15 * time.Minute
+
+// runKeyRotation makes sure there is a signing key at startup and then
+// rotates keys as they come due. Every gateway runs it; the key generations
+// are unique, so only one replica creates each key.
+func (s *APIGatewayService) runKeyRotation() {
+	ticker := time.NewTicker(keyRotationCheckInterval)
+	defer ticker.Stop()
+
+	for now := time.Now(); ; now = <-ticker.C {
+		signingKeyController, ok := controllers.GetControllerInstance(enum.SigningKeyController, enum.MONGODB).(*controllers.SigningKeyController)
+		if ok {
+			if err := signingKeyController.RotateKeys(now.UTC()); err != nil {
+				log.Println("Error rotating signing keys", err)
+			}
+		}
+	}
+}
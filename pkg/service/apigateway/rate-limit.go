@@ -0,0 +1,154 @@
+package service
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"project-phoenix/v2/internal/auth"
+	"project-phoenix/v2/internal/controllers"
+	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/ratelimit"
+	"project-phoenix/v2/internal/response"
+)
+
+// rateLimitSubject is whose requests a limit counts.
+type rateLimitSubject string
+
+const (
+	limitByIP      rateLimitSubject = "ip"
+	limitBySession rateLimitSubject = "session"
+	limitByUser    rateLimitSubject = "user"
+)
+
+type rateLimitRule struct {
+	By    rateLimitSubject
+	Limit string
+}
+
+// rateLimitGroups are the limits of each group of routes, as requests/window.
+// Routes pick their group in routePolicies and the rest count against
+// "default". RATE_LIMIT_<GROUP>_<SUBJECT>, e.g. RATE_LIMIT_AUTH_IP=20/1m,
+// replaces a limit and "off" turns it off.
+var rateLimitGroups = map[string][]rateLimitRule{
+	"default": {{limitByIP, "600/1m"}, {limitBySession, "300/1m"}, {limitByUser, "300/1m"}},
+	// Every client asks for a session first, so this one stays generous
+	// for clients sharing an IP.
+	"session": {{limitByIP, "30/1m"}},
+	"auth":    {{limitByIP, "20/1m"}, {limitBySession, "10/1m"}},
+	"rooms":   {{limitByIP, "30/1m"}, {limitBySession, "10/1m"}},
+	"llm":     {{limitByIP, "30/1m"}, {limitBySession, "20/1m"}, {limitByUser, "200/1h"}},
+}
+
+type rateLimit struct {
+	by    rateLimitSubject
+	limit ratelimit.Limit
+}
+
+// rateLimiter counts requests against the limits of their route group.
+type rateLimiter struct {
+	store  ratelimit.Store
+	groups map[string][]rateLimit
+}
+
+func newRateLimiter(store ratelimit.Store) *rateLimiter {
+	limiter := &rateLimiter{store: store, groups: map[string][]rateLimit{}}
+	for group, rules := range rateLimitGroups {
+		for _, rule := range rules {
+			spec := rule.Limit
+			if configured := strings.TrimSpace(os.Getenv("RATE_LIMIT_" + strings.ToUpper(group) + "_" + strings.ToUpper(string(rule.By)))); configured != "" {
+				spec = configured
+			}
+			if strings.EqualFold(spec, "off") {
+				continue
+			}
+			limit, e := ratelimit.ParseLimit(spec)
+			if e != nil {
+				log.Printf("Rate Limit | Keeping %s for %s by %s: %v", rule.Limit, group, rule.By, e)
+				limit, _ = ratelimit.ParseLimit(rule.Limit)
+			}
+			limiter.groups[group] = append(limiter.groups[group], rateLimit{by: rule.By, limit: limit})
+		}
+	}
+	return limiter
+}
+
+// subjectKey returns whom a request counts against, or "" when it has no
+// such subject. Sessions and users are only known after their middleware.
+// Forwarded IPs only count when TRUSTED_PROXIES lists the proxy.
+func subjectKey(r *http.Request, by rateLimitSubject) string {
+	switch by {
+	case limitByIP:
+		return controllers.TrustedClientIP(r)
+	case limitBySession:
+		return r.Header.Get("sessionId")
+	case limitByUser:
+		if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+			return claims.Subject
+		}
+	}
+	return ""
+}
+
+// limit runs next when the request is within the limits of group for the
+// given subjects, and answers 429 otherwise. Limits are not enforced when
+// the store fails.
+func (l *rateLimiter) limit(group string, subjects []rateLimitSubject, next http.Handler) http.Handler {
+	if _, ok := l.groups[group]; !ok {
+		group = "default"
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		for _, rule := range l.groups[group] {
+			if !hasSubject(subjects, rule.by) {
+				continue
+			}
+			subject := subjectKey(r, rule.by)
+			if subject == "" {
+				continue
+			}
+			result, e := l.store.Take(r.Context(), group+":"+string(rule.by)+":"+subject, rule.limit, now)
+			if e != nil {
+				log.Println("Rate Limit | Unable to count request: ", e)
+				continue
+			}
+			setRateLimitHeaders(w, result)
+			if !result.Allowed {
+				retryAfter := seconds(result.RetryAfter)
+				log.Printf("Rate Limit | %s %s over %s for %s by %s", r.Method, r.URL.Path, rule.limit, group, rule.by)
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				response.SendStatusResponse(w, http.StatusTooManyRequests, int(enum.RATE_LIMITED), map[string]interface{}{"retryAfter": retryAfter})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func hasSubject(subjects []rateLimitSubject, by rateLimitSubject) bool {
+	for _, subject := range subjects {
+		if subject == by {
+			return true
+		}
+	}
+	return false
+}
+
+// setRateLimitHeaders reports the tightest limit a request counted against.
+func setRateLimitHeaders(w http.ResponseWriter, result ratelimit.Result) {
+	if current, e := strconv.Atoi(w.Header().Get("RateLimit-Remaining")); e == nil && current < result.Remaining {
+		return
+	}
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(result.ResetAfter)))
+}
+
+// seconds rounds a duration up to whole seconds, at least one.
+func seconds(duration time.Duration) int {
+	return int(math.Max(1, math.Ceil(duration.Seconds())))
+}
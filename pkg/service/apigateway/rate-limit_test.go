@@ -0,0 +1,75 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"project-phoenix/v2/internal/ratelimit"
+)
+
+func TestRateLimiterAnswers429(t *testing.T) {
+	t.Setenv("RATE_LIMIT_AUTH_IP", "2/1m")
+	t.Setenv("RATE_LIMIT_AUTH_SESSION", "off")
+	limiter := newRateLimiter(ratelimit.NewMemoryStore())
+	if rules := limiter.groups["auth"]; len(rules) != 1 || rules[0].by != limitByIP {
+		t.Fatalf("auth limits: got %+v", rules)
+	}
+	handler := limiter.limit("auth", []rateLimitSubject{limitByIP}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i, want := range []string{"1", "0"} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/login", nil))
+		if recorder.Code != http.StatusOK || recorder.Header().Get("RateLimit-Remaining") != want {
+			t.Fatalf("request %d: got %d, remaining %q", i+1, recorder.Code, recorder.Header().Get("RateLimit-Remaining"))
+		}
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/login", nil))
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "30" || recorder.Header().Get("RateLimit-Limit") != "2" {
+		t.Fatalf("over the limit: got %d, headers %v", recorder.Code, recorder.Header())
+	}
+
+	// A client cannot get a fresh limit by claiming another IP.
+	spoofed := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	spoofed.Header.Set("X-Forwarded-For", "198.51.100.7")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, spoofed)
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("forwarded IP from an untrusted client: got %d", recorder.Code)
+	}
+
+	other := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	other.RemoteAddr = "198.51.100.8:1234"
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, other)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("another IP: got %d", recorder.Code)
+	}
+}
+
+func TestSubjectKeyTrustsConfiguredProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.1")
+	for _, tc := range []struct {
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"203.0.113.5:1234", "198.51.100.7", "203.0.113.5"},
+		{"10.1.2.3:1234", "", "10.1.2.3"},
+		{"10.1.2.3:1234", "198.51.100.7", "198.51.100.7"},
+		{"192.0.2.1:1234", "198.51.100.7", "198.51.100.7"},
+		// The client can prepend anything; the proxies append what they saw.
+		{"10.1.2.3:1234", "1.2.3.4, 198.51.100.7, 10.9.9.9", "198.51.100.7"},
+		{"10.1.2.3:1234", "10.5.5.5, 10.9.9.9", "10.5.5.5"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/login", nil)
+		r.RemoteAddr = tc.remote
+		if tc.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		if got := subjectKey(r, limitByIP); got != tc.want {
+			t.Errorf("remote %s, forwarded %q: got %q, want %q", tc.remote, tc.forwarded, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"project-phoenix/v2/internal/auth"
+	"project-phoenix/v2/internal/controllers/middleware"
+	"project-phoenix/v2/internal/ratelimit"
+)
+
+// routeAccess is what a request has to bring before it reaches a handler.
+type routeAccess int
+
+const (
+	// accessLogin needs a session and an access token. Routes without a
+	// policy get it.
+	accessLogin routeAccess = iota
+	// accessPublic needs nothing.
+	accessPublic
+	// accessSession needs a session.
+	accessSession
+)
+
+// routePolicy says who may call a route and how often. Methods limits the
+// policy to some HTTP methods; Subpaths extends it to the paths below Path,
+// for routes with ids in the path. A Permission implies accessLogin.
+// RateLimit names the group of rateLimitGroups the route counts against.
+type routePolicy struct {
+	Path       string
+	Methods    []string
+	Access     routeAccess
+	Permission string
+	Subpaths   bool
+	RateLimit  string
+}
+
+// routePolicies are checked in order and the first match applies.
+var routePolicies = []routePolicy{
+	// Operational data and settings.
+	{Path: "/admin", Subpaths: true, Permission: auth.PermissionRolesManage},
+	{Path: "/visits", Methods: []string{http.MethodGet}, Permission: auth.PermissionVisitsRead},
+	{Path: "/stats", Methods: []string{http.MethodGet}, Permission: auth.PermissionKeysRead},
+	{Path: "/keys", Subpaths: true, Methods: []string{http.MethodGet}, Permission: auth.PermissionKeysRead},
+	{Path: "/config/queries", Subpaths: true, Permission: auth.PermissionScraperManage},
+	{Path: "/llm-api-configs", Permission: auth.PermissionLLMConfigsManage},
+	{Path: "/llm-api-config", Permission: auth.PermissionLLMConfigsManage},
+
+	{Path: "/", Access: accessPublic},
+	{Path: "/createSession", Access: accessPublic, RateLimit: "session"},
+	{Path: "/returnJWK", Access: accessPublic},
+	{Path: "/handle-webhook", Access: accessPublic},
+	{Path: "/return-device-name", Access: accessPublic},
+	{Path: "/search-yt-videos", Access: accessPublic},
+	{Path: "/download-yt-videos", Access: accessPublic},
+	{Path: "/gollm/test-connection", Access: accessPublic, RateLimit: "llm"},
+	{Path: "/gollm/fetch-models", Access: accessPublic, RateLimit: "llm"},
+	{Path: "/gollm/ats", Subpaths: true, Access: accessPublic, RateLimit: "llm"},
+	{Path: "/gollm", Subpaths: true, RateLimit: "llm"},
+
+	{Path: "/login", Access: accessSession, RateLimit: "auth"},
+	{Path: "/login/2fa", Access: accessSession, RateLimit: "auth"},
+	{Path: "/register", Access: accessSession, RateLimit: "auth"},
+	{Path: "/email/verify", Access: accessSession, RateLimit: "auth"},
+	{Path: "/email/verification", RateLimit: "auth"},
+	{Path: "/password/forgot", Access: accessSession, RateLimit: "auth"},
+	{Path: "/password/reset", Access: accessSession, RateLimit: "auth"},
+	{Path: "/password/change", RateLimit: "auth"},
+	{Path: "/googleLogin", Access: accessSession, RateLimit: "auth"},
+	{Path: "/token/refresh", Access: accessSession},
+	{Path: "/capture-screen", Access: accessSession},
+	{Path: "/scan-devices", Access: accessSession},
+	{Path: "/ping", Access: accessSession},
+	{Path: "/devices", Access: accessSession},
+	// Device routes act on one device of the caller's, so they need a login.
+	{Path: "/device", Subpaths: true},
+	{Path: "/download", Access: accessSession},
+	{Path: "/downloads", Access: accessSession},
+	{Path: "/download-batch", Access: accessSession},
+	{Path: "/room/join", Access: accessSession, RateLimit: "rooms"},
+	{Path: "/room", Subpaths: true, Access: accessSession},
+	{Path: "/validate-key", Subpaths: true, Access: accessSession, RateLimit: "llm"},
+}
+
+// matches tells whether the policy covers a request to path, which is
+// relative to the endpoint prefix.
+func (policy routePolicy) matches(method string, path string) bool {
+	if len(policy.Methods) > 0 {
+		allowed := false
+		for _, candidate := range policy.Methods {
+			allowed = allowed || candidate == method
+		}
+		if !allowed {
+			return false
+		}
+	}
+	if path == policy.Path {
+		return true
+	}
+	return policy.Subpaths && strings.HasPrefix(path, strings.TrimSuffix(policy.Path, "/")+"/")
+}
+
+// findRoutePolicy returns the policy of a request, or the login policy when
+// none matches.
+func findRoutePolicy(policies []routePolicy, prefix string, method string, path string) routePolicy {
+	relative, found := strings.CutPrefix(path, prefix)
+	if !found {
+		return routePolicy{Path: path}
+	}
+	for _, policy := range policies {
+		if policy.matches(method, relative) {
+			return policy
+		}
+	}
+	return routePolicy{Path: relative}
+}
+
+// accessMiddleware applies the route policies: it runs the session, auth and
+// permission checks a route needs before the handler. Requests count against
+// their IP's limits first and their session's and user's once those are
+// known.
+func (s *APIGatewayService) accessMiddleware(next http.Handler) http.Handler {
+	sessionMiddleware := middleware.NewSessionMiddleware()
+	authMiddleware := middleware.NewAuthMiddleware()
+	permissionMiddleware := middleware.NewPermissionMiddleware()
+	limiter := newRateLimiter(ratelimit.NewStore())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Request URL: ", r.URL.Path)
+		policy := findRoutePolicy(routePolicies, s.serviceConfig.EndpointPrefix, r.Method, r.URL.Path)
+		limited := limiter.limit(policy.RateLimit, []rateLimitSubject{limitBySession, limitByUser}, next)
+		var handler http.Handler
+		switch {
+		case policy.Permission != "":
+			handler = sessionMiddleware.Middleware(authMiddleware.Middleware(permissionMiddleware.Require(policy.Permission, limited)))
+		case policy.Access == accessPublic:
+			handler = limited
+		case policy.Access == accessSession:
+			handler = sessionMiddleware.Middleware(limited)
+		default:
+			handler = sessionMiddleware.Middleware(authMiddleware.Middleware(limited))
+		}
+		limiter.limit(policy.RateLimit, []rateLimitSubject{limitByIP}, handler).ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"project-phoenix/v2/internal/auth"
+)
+
+func TestFindRoutePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		method     string
+		path       string
+		access     routeAccess
+		permission string
+	}{
+		{http.MethodPost, "/api/createSession", accessPublic, ""},
+		{http.MethodPost, "/api/gollm/ats/scan", accessPublic, ""},
+		{http.MethodPost, "/api/login", accessSession, ""},
+		{http.MethodGet, "/api/download", accessSession, ""},
+		{http.MethodDelete, "/api/download", accessSession, ""},
+		{http.MethodDelete, "/api/device", accessLogin, ""},
+		{http.MethodGet, "/api/device/metrics", accessLogin, ""},
+		{http.MethodPost, "/api/device/command", accessLogin, ""},
+		{http.MethodGet, "/api/device/command", accessLogin, ""},
+		{http.MethodGet, "/api/device/commands", accessLogin, ""},
+		{http.MethodPut, "/api/device/schedule", accessLogin, ""},
+		{http.MethodGet, "/api/device/screenshots", accessLogin, ""},
+		{http.MethodPut, "/api/device/watch", accessLogin, ""},
+		{http.MethodGet, "/api/device/uptime", accessLogin, ""},
+		{http.MethodGet, "/api/device", accessLogin, ""},
+		{http.MethodPost, "/api/device/enroll", accessLogin, ""},
+		{http.MethodDelete, "/api/device/token", accessLogin, ""},
+		{http.MethodGet, "/api/visits", accessLogin, auth.PermissionVisitsRead},
+		{http.MethodGet, "/api/keys/repos", accessLogin, auth.PermissionKeysRead},
+		{http.MethodDelete, "/api/config/queries/abc", accessLogin, auth.PermissionScraperManage},
+		{http.MethodPut, "/api/llm-api-config", accessLogin, auth.PermissionLLMConfigsManage},
+		{http.MethodPut, "/api/admin/user/roles", accessLogin, auth.PermissionRolesManage},
+		{http.MethodGet, "/api/profile", accessLogin, ""},
+		{http.MethodGet, "/api/loginx", accessLogin, ""},
+		{http.MethodGet, "/other/login", accessLogin, ""},
+	} {
+		policy := findRoutePolicy(routePolicies, "/api", tc.method, tc.path)
+		if policy.Access != tc.access || policy.Permission != tc.permission {
+			t.Errorf("%s %s: got access %d permission %q, want %d %q", tc.method, tc.path, policy.Access, policy.Permission, tc.access, tc.permission)
+		}
+	}
+}
+
+func TestRoutePolicyRateLimitGroups(t *testing.T) {
+	for path, want := range map[string]string{
+		"/api/createSession":          "session",
+		"/api/login":                  "auth",
+		"/api/room/join":              "rooms",
+		"/api/room/create":            "",
+		"/api/gollm/chat/completions": "llm",
+		"/api/profile":                "",
+	} {
+		if got := findRoutePolicy(routePolicies, "/api", http.MethodPost, path).RateLimit; got != want {
+			t.Errorf("%s: got %q, want %q", path, got, want)
+		}
+		if _, ok := rateLimitGroups[want]; want != "" && !ok {
+			t.Errorf("%s: group %q has no limits", path, want)
+		}
+	}
+}
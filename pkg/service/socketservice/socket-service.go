@@ -15,6 +15,7 @@ import (
 	"project-phoenix/v2/pkg/helper"
 	"project-phoenix/v2/pkg/service"
 	"reflect"
+	"strings"
 	"sync"
 	"time"
 
@@ -54,7 +55,15 @@ const (
 	serviceName = "location-service"
 )
 
+// rooms is shared by the connections and the broker handlers; roomsMu guards
+// the map and is taken before a room's own mutex.
 var rooms = make(map[string]*Room)
+var roomsMu sync.Mutex
+
+// sessionConns are the open connections of each session, so they can be
+// closed when the session is signed out.
+var sessionConns = make(map[string]map[*websocket.Conn]bool)
+var sessionConnsMu sync.Mutex
 var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
 
 var socketOnce sync.Once
@@ -140,7 +149,9 @@ func (ss *SocketService) HandleTripStart(p microBroker.Event) error {
 		log.Println("Error occurred while unmarshalling the data", err)
 	}
 	log.Println("Data Received: ", data)
-	ss.Broadcast(getSocketRoom(data["userId"].(string), data["tripId"].(string)), map[string]interface{}{"action": "trip-started", "data": "Trip Started"}, ss.socketObj)
+	userId, _ := data["userId"].(string)
+	tripId, _ := data["tripId"].(string)
+	ss.Broadcast(getSocketRoom(userId, tripId), map[string]interface{}{"action": "trip-started", "data": "Trip Started"}, ss.socketObj)
 	return nil
 }
 
@@ -151,7 +162,9 @@ func (ss *SocketService) HandleTripEnded(p microBroker.Event) error {
 		log.Println("Error occurred while unmarshalling the data", err)
 	}
 	log.Println("Data Received: ", data)
-	ss.Broadcast(getSocketRoom(data["userId"].(string), data["tripId"].(string)), map[string]interface{}{"action": "trip-ended", "data": "Trip Stopped"}, ss.socketObj)
+	userId, _ := data["userId"].(string)
+	tripId, _ := data["tripId"].(string)
+	ss.Broadcast(getSocketRoom(userId, tripId), map[string]interface{}{"action": "trip-ended", "data": "Trip Stopped"}, ss.socketObj)
 	return nil
 }
 
@@ -164,17 +177,13 @@ func (ss *SocketService) HandleConnections(w http.ResponseWriter, r *http.Reques
 
 	log.Println(conn.LocalAddr(), conn.RemoteAddr(), conn.LocalAddr().String())
 	ss.socketObj = conn
+	sessionID, _ := controllers.RequestCredentials(r)
+	trackSession(sessionID, conn)
 
 	defer func() {
+		untrackSession(sessionID, conn)
 		// Clean up connection
-		for roomID, room := range rooms {
-			room.mu.Lock()
-			if _, exists := room.clients[conn]; exists {
-				ss.RemoveClient(roomID, conn)
-				log.Printf("Cleaned up client from room %s on connection close", roomID)
-			}
-			room.mu.Unlock()
-		}
+		ss.leaveRooms(conn)
 		conn.Close()
 	}()
 
@@ -219,7 +228,19 @@ func (ss *SocketService) HandleConnections(w http.ResponseWriter, r *http.Reques
 				ss.handleClipRoomJoined(conn, msg)
 			case "sendRoomMessage":
 				log.Println("Send Room Message Event Fetched")
-				ss.handleSendRoomMessage(conn, msg)
+				ss.handleSendRoomMessage(conn, msg, sessionID)
+			case "editRoomMessage":
+				log.Println("Edit Room Message Event Received")
+				ss.handleRoomMessageAction(conn, msg, enum.CLIPBOARD_MESSAGE_EDITED, sessionID)
+			case "deleteRoomMessage":
+				log.Println("Delete Room Message Event Received")
+				ss.handleRoomMessageAction(conn, msg, enum.CLIPBOARD_MESSAGE_DELETED, sessionID)
+			case "pinRoomMessage":
+				log.Println("Pin Room Message Event Received")
+				ss.handleRoomMessageAction(conn, msg, enum.CLIPBOARD_MESSAGE_PINNED, sessionID)
+			case "reactRoomMessage":
+				log.Println("React Room Message Event Received")
+				ss.handleRoomMessageAction(conn, msg, enum.CLIPBOARD_MESSAGE_REACTED, sessionID)
 			default:
 				log.Println("No Action Found", action)
 			}
@@ -227,6 +248,54 @@ func (ss *SocketService) HandleConnections(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+func trackSession(sessionID string, conn *websocket.Conn) {
+	if sessionID == "" {
+		return
+	}
+	sessionConnsMu.Lock()
+	defer sessionConnsMu.Unlock()
+	if sessionConns[sessionID] == nil {
+		sessionConns[sessionID] = make(map[*websocket.Conn]bool)
+	}
+	sessionConns[sessionID][conn] = true
+}
+
+func untrackSession(sessionID string, conn *websocket.Conn) {
+	sessionConnsMu.Lock()
+	defer sessionConnsMu.Unlock()
+	delete(sessionConns[sessionID], conn)
+	if len(sessionConns[sessionID]) == 0 {
+		delete(sessionConns, sessionID)
+	}
+}
+
+// HandleSessionRevoked closes the connections of sessions that were signed
+// out. Clients get a "sessionRevoked" message first.
+func (ss *SocketService) HandleSessionRevoked(p microBroker.Event) error {
+	data := struct {
+		SessionIDs []string `json:"sessionIds"`
+	}{}
+	if err := json.Unmarshal(p.Message().Body, &data); err != nil {
+		log.Println("Error occurred while unmarshalling the data", err)
+		return err
+	}
+	for _, sessionID := range data.SessionIDs {
+		sessionConnsMu.Lock()
+		conns := make([]*websocket.Conn, 0, len(sessionConns[sessionID]))
+		for conn := range sessionConns[sessionID] {
+			conns = append(conns, conn)
+		}
+		sessionConnsMu.Unlock()
+		for _, conn := range conns {
+			conn.WriteJSON(map[string]interface{}{"action": "sessionRevoked", "data": map[string]interface{}{"sessionId": sessionID}})
+			// Closing ends the read loop, which removes it from its rooms.
+			conn.Close()
+		}
+		log.Printf("Closed %d connection(s) of revoked session %s", len(conns), sessionID)
+	}
+	return nil
+}
+
 func (ss *SocketService) handleDisconnect(conn *websocket.Conn, msg map[string]interface{}) {
 	dat, err := helper.StructToMap(msg)
 	if err != nil {
@@ -280,15 +349,6 @@ func (ss *SocketService) handleDisconnect(conn *websocket.Conn, msg map[string]i
 			// Finally close the connection
 			conn.Close()
 
-			// Cleanup empty room
-			if room, exists := rooms[roomID]; exists {
-				room.mu.Lock()
-				if len(room.clients) == 0 {
-					delete(rooms, roomID)
-					log.Printf("Room %s removed as it has no clients", roomID)
-				}
-				room.mu.Unlock()
-			}
 		}
 	}
 }
@@ -319,7 +379,7 @@ func (ss *SocketService) handleIdentifyUser(conn *websocket.Conn, msg map[string
 	}
 }
 
-func (ss *SocketService) handleSendRoomMessage(conn *websocket.Conn, msg map[string]interface{}) {
+func (ss *SocketService) handleSendRoomMessage(conn *websocket.Conn, msg map[string]interface{}, sessionID string) {
 	dat, e := helper.StructToMap(msg)
 	clipBoardRoom := &model.ClipBoardSendRoomMessage{}
 	log.Println("Data:", dat)
@@ -333,6 +393,27 @@ func (ss *SocketService) handleSendRoomMessage(conn *websocket.Conn, msg map[str
 			log.Println(er)
 		}
 
+		// Persist first so every recipient gets the stored message id, which is
+		// needed to edit, delete, pin or react to the message later on
+		controller := controllers.GetControllerInstance(enum.ClipboardRoomController, enum.MONGODB)
+		clipboardRoomController := controller.(*controllers.ClipboardRoomController)
+		_, saved, err := clipboardRoomController.ProcessRoomMessage(clipBoardRoom.Code, msg, sessionID)
+		if err == nil {
+			if savedMessage, ok := saved.(map[string]interface{}); ok {
+				if data, ok := msg["data"].(map[string]interface{}); ok {
+					data["messageId"] = savedMessage["_id"]
+				}
+				conn.WriteJSON(map[string]interface{}{
+					"action": "roomMessageSaved",
+					"data": map[string]interface{}{
+						"code":      clipBoardRoom.Code,
+						"messageId": savedMessage["_id"],
+						"createdAt": savedMessage["createdAt"],
+					},
+				})
+			}
+		}
+
 		// log.Println("", clipBoardRoom.Code, " joined the room - ", getClipBoardRoom(clipBoardRoom.Code))
 		if clipBoardRoom.IsAnonymous == false {
 			log.Println("Broadcasting to user clipboard room", clipBoardRoom.Sender)
@@ -341,9 +422,90 @@ func (ss *SocketService) handleSendRoomMessage(conn *websocket.Conn, msg map[str
 			log.Println("Broadcasting to anonymous clipboard room")
 			ss.Broadcast(getAnonymousClipBoardRoom(clipBoardRoom.Code), msg, conn)
 		}
-		controller := controllers.GetControllerInstance(enum.ClipboardRoomController, enum.MONGODB)
-		clipboardRoomController := controller.(*controllers.ClipboardRoomController)
-		clipboardRoomController.ProcessRoomMessage(clipBoardRoom.Code, msg)
+	}
+}
+
+// handleRoomMessageAction applies a message action as the connection's
+// session, which must be a member of the room and, to edit or delete, the
+// sender of the message.
+func (ss *SocketService) handleRoomMessageAction(conn *websocket.Conn, msg map[string]interface{}, event enum.ClipboardMessageEvent, sessionID string) {
+	dat, e := helper.StructToMap(msg)
+	if e != nil {
+		log.Println(e)
+		return
+	}
+	actionRequest := model.ClipboardMessageActionRequestModel{}
+	if er := helper.InterfaceToStruct(dat["data"], &actionRequest); er != nil {
+		log.Println(er)
+		return
+	}
+
+	controller := controllers.GetControllerInstance(enum.ClipboardRoomController, enum.MONGODB)
+	clipboardRoomController := controller.(*controllers.ClipboardRoomController)
+
+	var (
+		payload map[string]interface{}
+		err     error
+	)
+	switch event {
+	case enum.CLIPBOARD_MESSAGE_EDITED:
+		_, payload, err = clipboardRoomController.EditMessage(actionRequest, sessionID)
+	case enum.CLIPBOARD_MESSAGE_DELETED:
+		_, payload, err = clipboardRoomController.DeleteMessage(actionRequest, sessionID)
+	case enum.CLIPBOARD_MESSAGE_PINNED:
+		_, payload, err = clipboardRoomController.PinMessage(actionRequest, sessionID)
+	case enum.CLIPBOARD_MESSAGE_REACTED:
+		_, payload, err = clipboardRoomController.ReactToMessage(actionRequest, sessionID)
+	}
+	if err != nil {
+		log.Println("Room message action failed:", event, err)
+		conn.WriteJSON(map[string]interface{}{
+			"action": "roomMessageActionFailed",
+			"data": map[string]interface{}{
+				"code":      actionRequest.Code,
+				"messageId": actionRequest.MessageID,
+				"event":     string(event),
+				"error":     err.Error(),
+			},
+		})
+		return
+	}
+	ss.broadcastToClipBoardRooms(actionRequest.Code, map[string]interface{}{"action": string(event), "data": payload})
+}
+
+// HandleClipboardMessageUpdated broadcasts message changes made through the REST API.
+func (ss *SocketService) HandleClipboardMessageUpdated(p microBroker.Event) error {
+	data := make(map[string]interface{})
+	if err := json.Unmarshal(p.Message().Body, &data); err != nil {
+		log.Println("Error occurred while unmarshalling the data", err)
+		return err
+	}
+	payload, ok := data["data"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	code, _ := payload["code"].(string)
+	if code == "" {
+		return nil
+	}
+	ss.broadcastToClipBoardRooms(code, data)
+	return nil
+}
+
+// broadcastToClipBoardRooms delivers a message to the anonymous room and every
+// per-user room that belongs to the given clipboard code.
+func (ss *SocketService) broadcastToClipBoardRooms(code string, msg map[string]interface{}) {
+	anonymousRoom := getAnonymousClipBoardRoom(code)
+	roomIDs := []string{}
+	roomsMu.Lock()
+	for roomID := range rooms {
+		if roomID == anonymousRoom || strings.HasPrefix(roomID, anonymousRoom+"-") {
+			roomIDs = append(roomIDs, roomID)
+		}
+	}
+	roomsMu.Unlock()
+	for _, roomID := range roomIDs {
+		ss.Broadcast(roomID, msg, nil)
 	}
 }
 
@@ -497,6 +659,8 @@ func (ss *SocketService) SubscribeTopics() {
 func (ss *SocketService) JoinRoom(roomID string, conn *websocket.Conn) {
 	log.Printf("Attempting to join room %s for connection %v", roomID, conn.RemoteAddr())
 
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
 	room, exists := rooms[roomID]
 	if !exists {
 		room = &Room{clients: make(map[*websocket.Conn]bool)}
@@ -504,11 +668,9 @@ func (ss *SocketService) JoinRoom(roomID string, conn *websocket.Conn) {
 		log.Printf("Created new room %s", roomID)
 	}
 
-	ss.RemoveClient(roomID, conn)
-	// Use defer to ensure the mutex is always unlocked
 	room.mu.Lock()
 	defer room.mu.Unlock()
-	
+
 	// Check if connection is already in room
 	if _, already := room.clients[conn]; already {
 		log.Printf("Connection %v is already in room %s", conn.RemoteAddr(), roomID)
@@ -522,10 +684,12 @@ func (ss *SocketService) JoinRoom(roomID string, conn *websocket.Conn) {
 }
 
 func (ss *SocketService) RemoveClient(roomID string, conn *websocket.Conn) {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
 	if room, exists := rooms[roomID]; exists {
 		room.mu.Lock()
 		defer room.mu.Unlock()
-		
+
 		if _, found := room.clients[conn]; found {
 			delete(room.clients, conn)
 			clientCount := len(room.clients)
@@ -533,7 +697,7 @@ func (ss *SocketService) RemoveClient(roomID string, conn *websocket.Conn) {
 		} else {
 			log.Printf("Client not found in room %s", roomID)
 		}
-		
+
 		// Cleanup empty room
 		if len(room.clients) == 0 {
 			delete(rooms, roomID)
@@ -544,8 +708,28 @@ func (ss *SocketService) RemoveClient(roomID string, conn *websocket.Conn) {
 	}
 }
 
+// leaveRooms removes a closed connection from every room it was in.
+func (ss *SocketService) leaveRooms(conn *websocket.Conn) {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	for roomID, room := range rooms {
+		room.mu.Lock()
+		if _, exists := room.clients[conn]; exists {
+			delete(room.clients, conn)
+			log.Printf("Cleaned up client from room %s on connection close", roomID)
+		}
+		if len(room.clients) == 0 {
+			delete(rooms, roomID)
+		}
+		room.mu.Unlock()
+	}
+}
+
 func (ss *SocketService) Broadcast(roomID string, msg map[string]interface{}, sender *websocket.Conn) {
-	if room, exists := rooms[roomID]; exists {
+	roomsMu.Lock()
+	room, exists := rooms[roomID]
+	roomsMu.Unlock()
+	if exists {
 		room.mu.Lock()
 		defer room.mu.Unlock()
 		broadcastCount := 0
@@ -595,6 +779,7 @@ func (s *SocketService) Start(port string) error {
 			Handler: handlers.CORS(handlers.AllowedOrigins([]string{"*"}))(s.router), // Allow all origins
 		}
 		s.InitServer()
+		go s.SubscribeTopics()
 		log.Println("Running on port: ", s.server.Addr, port)
 		log.Fatal(http.ListenAndServe("0.0.0.0:"+port, nil))
 
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"project-phoenix/v2/internal/controllers"
+	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/google"
+)
+
+const (
+	artifactSweepInterval = 5 * time.Minute
+	// Download files younger than this may still be written by yt-dlp.
+	orphanedDownloadMinAge = 30 * time.Minute
+
+	defaultDownloadRetention = time.Hour
+)
+
+// downloadRetention is how long a finished download is kept, locally and in
+// object storage, from DOWNLOAD_RETENTION_MINUTES.
+func downloadRetention() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("DOWNLOAD_RETENTION_MINUTES"))
+	if err != nil || minutes <= 0 {
+		return defaultDownloadRetention
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+func artifactExpiryController() *controllers.ArtifactExpiryController {
+	controller, _ := controllers.GetControllerInstance(enum.ArtifactExpiryController, enum.MONGODB).(*controllers.ArtifactExpiryController)
+	return controller
+}
+
+// sweepExpiredArtifacts removes leftover download files once at startup, then
+// deletes expired files and objects from the registry on every tick.
+func (sse *SSEService) sweepExpiredArtifacts() {
+	controller := artifactExpiryController()
+	if controller == nil {
+		return
+	}
+
+	report, err := controller.CollectGarbage(google.DownloadDir, orphanedDownloadMinAge)
+	if err != nil {
+		log.Println("Error collecting orphaned downloads", err)
+	} else if report.Deleted > 0 || report.Failed > 0 {
+		log.Printf("Removed %d orphaned downloads, reclaimed %d bytes (%d failed)", report.Deleted, report.ReclaimedBytes, report.Failed)
+	}
+
+	ticker := time.NewTicker(artifactSweepInterval)
+	defer ticker.Stop()
+	for {
+		report, err := controller.Sweep()
+		if err != nil {
+			log.Println("Error sweeping expired artifacts", err)
+		} else if report.Deleted > 0 || report.Failed > 0 {
+			log.Printf("Removed %d expired artifacts, reclaimed %d bytes (%d failed)", report.Deleted, report.ReclaimedBytes, report.Failed)
+		}
+		<-ticker.C
+	}
+}
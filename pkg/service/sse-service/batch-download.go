@@ -0,0 +1,473 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"project-phoenix/v2/internal/controllers"
+	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/google"
+	"project-phoenix/v2/internal/model"
+
+	microBroker "go-micro.dev/v4/broker"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const playlistResolveTimeout = 2 * time.Minute
+
+func downloadBatchController() *controllers.DownloadBatchController {
+	controller, _ := controllers.GetControllerInstance(enum.DownloadBatchController, enum.MONGODB).(*controllers.DownloadBatchController)
+	return controller
+}
+
+func batchRoute(batchID string) string {
+	return "batch-" + batchID
+}
+
+type batchItemState struct {
+	status   string
+	progress int
+}
+
+func (item batchItemState) settled() bool {
+	switch item.status {
+	case enum.COMPLETED, enum.DOWNLOAD_FAILED, enum.CANCELLED:
+		return true
+	}
+	return false
+}
+
+type trackedBatch struct {
+	items    map[string]batchItemState
+	syncedAt time.Time
+}
+
+// batchTracker keeps the last reported state of every item of the running
+// batches, so aggregate progress does not need a query per progress event.
+// Items may run on other replicas, so the state is read from Mongo again
+// once per heartbeat interval.
+type batchTracker struct {
+	controller *controllers.DownloadJobController
+	mu         sync.Mutex
+	batches    map[string]*trackedBatch
+}
+
+func newBatchTracker(controller *controllers.DownloadJobController) *batchTracker {
+	return &batchTracker{controller: controller, batches: make(map[string]*trackedBatch)}
+}
+
+func (bt *batchTracker) load(batchID string) (map[string]batchItemState, error) {
+	jobs, err := bt.controller.ListByBatch(batchID)
+	if err != nil {
+		return nil, err
+	}
+	items := make(map[string]batchItemState, len(jobs))
+	for _, job := range jobs {
+		items[job.DownloadID] = batchItemState{status: job.Status, progress: job.Progress}
+	}
+	return items, nil
+}
+
+// sync merges the stored item states into the tracked ones. Stored progress
+// is only as recent as the last heartbeat, so a newer local state of the same
+// item wins.
+func (batch *trackedBatch) sync(stored map[string]batchItemState) {
+	for downloadID, storedItem := range stored {
+		local, ok := batch.items[downloadID]
+		if ok && (local.settled() || (!storedItem.settled() && local.status == storedItem.status && local.progress > storedItem.progress)) {
+			continue
+		}
+		batch.items[downloadID] = storedItem
+	}
+	batch.syncedAt = time.Now()
+}
+
+// update records an item's state, unless downloadID is empty, and returns the
+// batch's aggregate progress.
+func (bt *batchTracker) update(batchID string, downloadID string, status string, progress int) map[string]interface{} {
+	bt.mu.Lock()
+	batch, ok := bt.batches[batchID]
+	stale := !ok || time.Since(batch.syncedAt) > downloadHeartbeatInterval
+	bt.mu.Unlock()
+
+	var stored map[string]batchItemState
+	if stale {
+		var err error
+		if stored, err = bt.load(batchID); err != nil {
+			log.Printf("Unable to load items of batch %s: %v", batchID, err)
+		}
+	}
+
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	batch, ok = bt.batches[batchID]
+	if !ok {
+		batch = &trackedBatch{items: make(map[string]batchItemState)}
+		bt.batches[batchID] = batch
+	}
+	if stale {
+		batch.sync(stored)
+	}
+	items := batch.items
+	if downloadID != "" {
+		items[downloadID] = batchItemState{status: status, progress: progress}
+	}
+
+	counts := map[string]int{}
+	total := 0
+	for _, item := range items {
+		counts[item.status]++
+		if item.settled() {
+			// Settled items count as done for the overall progress.
+			total += 100
+		} else {
+			total += item.progress
+		}
+	}
+	aggregate := map[string]interface{}{
+		"batchId":   batchID,
+		"type":      "batch_progress",
+		"total":     len(items),
+		"queued":    counts[enum.QUEUED],
+		"running":   counts[enum.DOWNLOADING] + counts[enum.PROCESSING],
+		"completed": counts[enum.COMPLETED],
+		"failed":    counts[enum.DOWNLOAD_FAILED],
+		"cancelled": counts[enum.CANCELLED],
+		"progress":  0,
+	}
+	if len(items) > 0 {
+		aggregate["progress"] = total / len(items)
+	}
+	return aggregate
+}
+
+func (bt *batchTracker) forget(batchID string) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	delete(bt.batches, batchID)
+}
+
+// broadcastDownload sends a download event to the download's route. Events of
+// batch items also go to the batch route, followed by the batch's aggregate
+// progress, so one subscription shows the whole batch.
+func (sse *SSEService) broadcastDownload(job *model.DownloadJob, event map[string]interface{}) {
+	sse.sseHandler.BroadcastToRoute("download-"+job.DownloadID, event)
+	if job.BatchID == "" {
+		return
+	}
+
+	itemEvent := make(map[string]interface{}, len(event)+1)
+	for key, value := range event {
+		itemEvent[key] = value
+	}
+	itemEvent["batchId"] = job.BatchID
+	sse.sseHandler.BroadcastToRoute(batchRoute(job.BatchID), itemEvent)
+
+	status, _ := event["status"].(string)
+	progress, _ := event["progress"].(int)
+	sse.sseHandler.BroadcastToRoute(batchRoute(job.BatchID), sse.batches.update(job.BatchID, job.DownloadID, status, progress))
+}
+
+// HandleBatchDownload expands a batch created by the API gateway into one
+// download job per video. Playlists are read here because yt-dlp runs here.
+func (sse *SSEService) HandleBatchDownload(p microBroker.Event) error {
+	data := make(map[string]interface{})
+	if err := json.Unmarshal(p.Message().Body, &data); err != nil {
+		return fmt.Errorf("error unmarshalling batch download: %v", err)
+	}
+	batchID, _ := data["batchId"].(string)
+	controller := downloadBatchController()
+	if batchID == "" || controller == nil {
+		return nil
+	}
+	batch, err := controller.Get(batchID)
+	if err != nil {
+		return fmt.Errorf("unable to load batch %s: %v", batchID, err)
+	}
+	if batch.Status != enum.BATCH_RESOLVING {
+		// Redelivered, or cancelled before it started.
+		return nil
+	}
+
+	items, title := batch.Items, ""
+	if batch.PlaylistURL != "" {
+		sse.sseHandler.BroadcastToRoute(batchRoute(batchID), map[string]interface{}{
+			"batchId": batchID,
+			"status":  enum.BATCH_RESOLVING,
+			"message": "Reading playlist...",
+			"type":    "batch_progress",
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), playlistResolveTimeout)
+		playlistTitle, entries, err := google.ResolvePlaylist(ctx, batch.PlaylistURL, controllers.MaxDownloadBatchItems())
+		cancel()
+		if err != nil {
+			log.Printf("Unable to resolve playlist for batch %s: %v", batchID, err)
+			if e := controller.FailToResolve(batchID, err); e != nil {
+				log.Printf("Unable to record failure of batch %s: %v", batchID, e)
+			}
+			sse.sseHandler.BroadcastToRoute(batchRoute(batchID), map[string]interface{}{
+				"batchId": batchID,
+				"status":  enum.DOWNLOAD_FAILED,
+				"message": err.Error(),
+				"type":    "batch_error",
+			})
+			return nil
+		}
+		title = playlistTitle
+		items = make([]model.DownloadBatchItem, 0, len(entries))
+		for _, entry := range entries {
+			items = append(items, model.DownloadBatchItem{VideoID: entry.VideoID, VideoTitle: entry.Title})
+		}
+	}
+
+	for i := range items {
+		items[i].DownloadID = controllers.BatchItemDownloadID(batchID, i)
+		job := model.DownloadJob{
+			DownloadID:  items[i].DownloadID,
+			VideoID:     items[i].VideoID,
+			VideoTitle:  items[i].VideoTitle,
+			Format:      batch.Format,
+			Quality:     batch.Quality,
+			BitRate:     batch.BitRate,
+			PostProcess: batch.PostProcess,
+			BatchID:     batchID,
+			Owner:       batch.Owner,
+			Message:     "Waiting for a free worker...",
+		}
+		if err := sse.downloadQueue.AddJob(job); err != nil {
+			return fmt.Errorf("unable to queue item %s of batch %s: %v", job.DownloadID, batchID, err)
+		}
+	}
+
+	started, err := controller.Start(batchID, title, items)
+	if err != nil {
+		return fmt.Errorf("unable to start batch %s: %v", batchID, err)
+	}
+	if !started {
+		// Cancelled while the playlist was read; drop the jobs just queued.
+		if _, err := sse.downloadQueue.controller.CancelBatch(batchID); err != nil {
+			log.Printf("Unable to cancel items of batch %s: %v", batchID, err)
+		}
+		return nil
+	}
+
+	log.Printf("📋 Batch %s queued with %d items", batchID, len(items))
+	aggregate := sse.batches.update(batchID, "", "", 0)
+	aggregate["status"] = enum.BATCH_RUNNING
+	aggregate["title"] = title
+	aggregate["items"] = items
+	sse.sseHandler.BroadcastToRoute(batchRoute(batchID), aggregate)
+	return nil
+}
+
+// settleBatch finishes a batch once every item has completed, failed or been
+// cancelled. Only one caller gets to finish it, even across instances.
+func (sse *SSEService) settleBatch(batchID string) {
+	controller := downloadBatchController()
+	if controller == nil {
+		return
+	}
+	jobs, err := sse.downloadQueue.controller.ListByBatch(batchID)
+	if err != nil {
+		log.Printf("Unable to load items of batch %s: %v", batchID, err)
+		return
+	}
+	completed, failed, cancelled, settled := controllers.SettledCounts(jobs)
+	if !settled || len(jobs) == 0 {
+		return
+	}
+	if won, err := controller.BeginFinalizing(batchID); err != nil || !won {
+		return
+	}
+	defer sse.batches.forget(batchID)
+
+	batch, err := controller.Get(batchID)
+	if err != nil {
+		log.Printf("Unable to load batch %s: %v", batchID, err)
+		return
+	}
+
+	status := enum.BATCH_PARTIAL
+	switch {
+	case completed == len(jobs):
+		status = enum.COMPLETED
+	case cancelled == len(jobs):
+		status = enum.CANCELLED
+	case completed == 0:
+		status = enum.DOWNLOAD_FAILED
+	}
+	fields := bson.M{
+		"status":    status,
+		"completed": completed,
+		"failed":    failed,
+		"cancelled": cancelled,
+	}
+	event := map[string]interface{}{
+		"batchId":   batchID,
+		"type":      "batch_complete",
+		"status":    status,
+		"progress":  100,
+		"total":     len(jobs),
+		"completed": completed,
+		"failed":    failed,
+		"cancelled": cancelled,
+		"items":     batchItemSummaries(jobs),
+	}
+
+	if batch.Zip && completed > 0 {
+		sse.sseHandler.BroadcastToRoute(batchRoute(batchID), map[string]interface{}{
+			"batchId": batchID,
+			"status":  enum.PROCESSING,
+			"stage":   "zip",
+			"message": "Bundling downloads...",
+			"type":    "batch_progress",
+		})
+		zipKey, zipURL, err := sse.bundleBatch(batch, jobs)
+		if err != nil {
+			// The items are still available one by one.
+			log.Printf("Unable to bundle batch %s: %v", batchID, err)
+			fields["zipError"] = err.Error()
+			event["zipError"] = err.Error()
+		} else {
+			fields["zipKey"] = zipKey
+			fields["zipUrl"] = zipURL
+			event["zipUrl"] = zipURL
+		}
+	}
+
+	if err := controller.Finish(batchID, fields); err != nil {
+		log.Printf("Unable to record outcome of batch %s: %v", batchID, err)
+	}
+	log.Printf("Batch %s finished: %s (%d completed, %d failed, %d cancelled)", batchID, status, completed, failed, cancelled)
+	sse.sseHandler.BroadcastToRoute(batchRoute(batchID), event)
+}
+
+// batchItemSummaries is the per-item outcome sent to clients.
+func batchItemSummaries(jobs []model.DownloadJob) []map[string]interface{} {
+	summaries := make([]map[string]interface{}, 0, len(jobs))
+	for _, job := range jobs {
+		summaries = append(summaries, map[string]interface{}{
+			"downloadId":  job.DownloadID,
+			"videoId":     job.VideoID,
+			"videoTitle":  job.VideoTitle,
+			"status":      job.Status,
+			"progress":    job.Progress,
+			"error":       job.Error,
+			"filename":    job.FileName,
+			"fileSize":    job.FileSize,
+			"downloadUrl": job.DownloadURL,
+		})
+	}
+	return summaries
+}
+
+// bundleBatch zips the completed items into one object. The items are read
+// back from storage because they may have been downloaded by other instances.
+func (sse *SSEService) bundleBatch(batch *model.DownloadBatch, jobs []model.DownloadJob) (string, string, error) {
+	if sse.storage == nil {
+		return "", "", fmt.Errorf("object storage not initialized")
+	}
+	if err := os.MkdirAll(google.DownloadDir, 0755); err != nil {
+		return "", "", err
+	}
+	path := filepath.Join(google.DownloadDir, fmt.Sprintf("batch-%s.zip", batch.BatchID))
+	defer os.Remove(path)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", "", err
+	}
+	archive := zip.NewWriter(f)
+	names := map[string]int{}
+	added := 0
+	for _, job := range jobs {
+		if job.Status != enum.COMPLETED || job.OutputKey == "" {
+			continue
+		}
+		if err := sse.addToZip(archive, job, names); err != nil {
+			log.Printf("Leaving %s out of batch %s: %v", job.DownloadID, batch.BatchID, err)
+			continue
+		}
+		added++
+	}
+	if err := archive.Close(); err != nil {
+		f.Close()
+		return "", "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", "", err
+	}
+	if added == 0 {
+		return "", "", fmt.Errorf("none of the completed items could be read back from storage")
+	}
+
+	zipFile, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer zipFile.Close()
+	stat, err := zipFile.Stat()
+	if err != nil {
+		return "", "", err
+	}
+
+	name := batch.Title
+	if name == "" {
+		name = "downloads"
+	}
+	objectKey := fmt.Sprintf("downloads/batches/%s/%s.zip", batch.BatchID, sanitizeFilename(name))
+	if err := sse.storage.Put(context.Background(), objectKey, zipFile, "application/zip"); err != nil {
+		return "", "", err
+	}
+	url, err := sse.storage.SignedURL(context.Background(), objectKey, 24*time.Hour)
+	if err != nil {
+		return "", "", err
+	}
+	if expiry := artifactExpiryController(); expiry != nil {
+		if err := expiry.RegisterObject(objectKey, stat.Size(), serviceName, batch.BatchID, downloadRetention()); err != nil {
+			log.Printf("Failed to schedule cleanup of %s: %v", objectKey, err)
+		}
+	}
+	return objectKey, url, nil
+}
+
+// addToZip copies one stored item into the archive. Media files are already
+// compressed, so they are stored as they are.
+func (sse *SSEService) addToZip(archive *zip.Writer, job model.DownloadJob, names map[string]int) error {
+	body, err := sse.storage.Open(context.Background(), job.OutputKey)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	base := job.FileName
+	if base == "" {
+		base = filepath.Base(job.OutputKey)
+	}
+	// Two items of a playlist can share a title.
+	name := base
+	if count := names[base]; count > 0 {
+		ext := filepath.Ext(base)
+		name = fmt.Sprintf("%s_%d%s", base[:len(base)-len(ext)], count+1, ext)
+	}
+	names[base]++
+
+	writer, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, body)
+	return err
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"project-phoenix/v2/internal/controllers"
+	"project-phoenix/v2/internal/enum"
+
+	microBroker "go-micro.dev/v4/broker"
+)
+
+const commandTimeoutSweepInterval = 15 * time.Second
+
+// HandleDeviceCommandResult persists a command result reported through the
+// gRPC gateway and forwards it to SSE clients.
+func (sse *SSEService) HandleDeviceCommandResult(p microBroker.Event) error {
+	data := struct {
+		CommandID  string `json:"commandId"`
+		DeviceName string `json:"deviceName"`
+		Status     string `json:"status"`
+		Result     string `json:"result"`
+		Error      string `json:"error"`
+	}{}
+	if err := json.Unmarshal(p.Message().Body, &data); err != nil {
+		return fmt.Errorf("error unmarshalling command result: %v", err)
+	}
+
+	controller := controllers.GetControllerInstance(enum.DeviceCommandController, enum.MONGODB)
+	deviceCommandController := controller.(*controllers.DeviceCommandController)
+
+	command, err := deviceCommandController.RecordResult(data.CommandID, data.DeviceName, data.Status, data.Result, data.Error)
+	if err != nil {
+		// Late or duplicate results are dropped rather than requeued.
+		log.Printf("Ignoring result for command %s: %v", data.CommandID, err)
+		return nil
+	}
+
+	sse.broadcastDeviceEventByName(data.DeviceName, map[string]interface{}{
+		"message": command,
+		"type":    "device_command_result",
+	})
+	return nil
+}
+
+// sweepTimedOutCommands periodically fails commands whose devices never
+// reported back.
+func (sse *SSEService) sweepTimedOutCommands() {
+	ticker := time.NewTicker(commandTimeoutSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		controller := controllers.GetControllerInstance(enum.DeviceCommandController, enum.MONGODB)
+		deviceCommandController, ok := controller.(*controllers.DeviceCommandController)
+		if !ok {
+			continue
+		}
+		expired, err := deviceCommandController.ExpireTimedOutCommands()
+		if err != nil {
+			log.Println("Error expiring device commands", err)
+			continue
+		}
+		for _, command := range expired {
+			log.Printf("Device command %v timed out", command["commandId"])
+			deviceName, _ := command["deviceName"].(string)
+			sse.broadcastDeviceEventByName(deviceName, map[string]interface{}{
+				"message": command,
+				"type":    "device_command_result",
+			})
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"project-phoenix/v2/internal/controllers"
+	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/model"
+	"project-phoenix/v2/internal/notifier"
+
+	microBroker "go-micro.dev/v4/broker"
+)
+
+const heartbeatCheckInterval = 30 * time.Second
+
+// deviceAlertNotifier returns the Discord notifier for watched devices, or nil
+// when no webhook is configured.
+func deviceAlertNotifier() *notifier.DiscordNotifier {
+	webhookURL := os.Getenv("DISCORD_WEBHOOK_DEVICES")
+	if webhookURL == "" {
+		webhookURL = os.Getenv("DISCORD_WEBHOOK_URL")
+	}
+	if webhookURL == "" {
+		return nil
+	}
+	return notifier.NewDiscordNotifier(webhookURL)
+}
+
+// announceDeviceStatus tells SSE clients about an online/offline transition
+// and alerts on Discord when a watched device drops or comes back.
+func (sse *SSEService) announceDeviceStatus(device model.Device, isOnline bool, reason enum.DeviceStatusReason) {
+	sse.broadcastDeviceEvent(device, map[string]interface{}{
+		"message": map[string]interface{}{
+			"deviceName": device.DeviceName,
+			"isOnline":   isOnline,
+			"lastOnline": device.LastOnline,
+			"reason":     string(reason),
+		},
+		"type": "ping_device",
+	})
+
+	if !device.Watched {
+		return
+	}
+	discordNotifier := deviceAlertNotifier()
+	if discordNotifier == nil {
+		return
+	}
+	var e error
+	if isOnline {
+		e = discordNotifier.SendSystemAlert("Device back online", fmt.Sprintf("**%s** is reporting again.", device.DeviceName), "success")
+	} else {
+		e = discordNotifier.SendSystemAlert("Device offline", fmt.Sprintf("**%s** went offline (%s). Last seen %s.", device.DeviceName, reason, device.LastOnline.Format(time.RFC1123)), "error")
+	}
+	if e != nil {
+		log.Println("Error sending device alert", e)
+	}
+}
+
+// findDevice loads a device for an announcement; a missing device still gets
+// announced by name.
+func findDevice(captureScreenController *controllers.CaptureScreenController, deviceName string) model.Device {
+	device := model.Device{DeviceName: deviceName}
+	if found, e := captureScreenController.Find(map[string]interface{}{"deviceName": deviceName}); e == nil && found != nil {
+		raw, _ := json.Marshal(found)
+		json.Unmarshal(raw, &device)
+	}
+	return device
+}
+
+// HandleDeviceStatusChanged announces devices the API gateway marked offline
+// after failing to reach them.
+func (sse *SSEService) HandleDeviceStatusChanged(p microBroker.Event) error {
+	data := struct {
+		DeviceName string `json:"deviceName"`
+		IsOnline   bool   `json:"isOnline"`
+		Reason     string `json:"reason"`
+	}{}
+	if err := json.Unmarshal(p.Message().Body, &data); err != nil {
+		return fmt.Errorf("error unmarshalling device status: %v", err)
+	}
+
+	controller := controllers.GetControllerInstance(enum.CaptureScreenController, enum.MONGODB)
+	captureScreenController := controller.(*controllers.CaptureScreenController)
+	sse.announceDeviceStatus(findDevice(captureScreenController, data.DeviceName), data.IsOnline, enum.DeviceStatusReason(data.Reason))
+	return nil
+}
+
+// monitorDeviceHeartbeats periodically marks devices that stopped pinging as
+// offline.
+func (sse *SSEService) monitorDeviceHeartbeats() {
+	ticker := time.NewTicker(heartbeatCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		controller := controllers.GetControllerInstance(enum.CaptureScreenController, enum.MONGODB)
+		captureScreenController, ok := controller.(*controllers.CaptureScreenController)
+		if !ok {
+			continue
+		}
+		changed, err := captureScreenController.MarkStaleDevicesOffline(controllers.DeviceOfflineThreshold())
+		if err != nil {
+			log.Println("Error checking device heartbeats", err)
+			continue
+		}
+		for _, device := range changed {
+			log.Printf("Device %s missed its heartbeat, marked offline", device.DeviceName)
+			sse.announceDeviceStatus(device, false, enum.DEVICE_HEARTBEAT_TIMEOUT)
+		}
+	}
+}
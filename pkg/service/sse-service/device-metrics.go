@@ -0,0 +1,55 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"project-phoenix/v2/internal/controllers"
+	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/model"
+)
+
+// recordDeviceMetrics stores the usage figures from a device report and
+// announces any metric that crossed its alert threshold.
+func (sse *SSEService) recordDeviceMetrics(device model.Device) {
+	controller := controllers.GetControllerInstance(enum.DeviceMetricController, enum.MONGODB)
+	deviceMetricController, ok := controller.(*controllers.DeviceMetricController)
+	if !ok {
+		return
+	}
+	_, alerts, err := deviceMetricController.RecordSample(device, time.Now().UTC())
+	if err != nil {
+		log.Println("Error recording device metrics", err)
+		return
+	}
+	if len(alerts) == 0 {
+		return
+	}
+
+	captureScreenController := controllers.GetControllerInstance(enum.CaptureScreenController, enum.MONGODB).(*controllers.CaptureScreenController)
+	stored := findDevice(captureScreenController, device.DeviceName)
+	watched := stored.Watched
+	discordNotifier := deviceAlertNotifier()
+
+	for _, alert := range alerts {
+		log.Printf("Device %s %s usage at %.1f%% (threshold %.0f%%)", alert.DeviceName, alert.Metric, alert.Percent, alert.Threshold)
+		sse.broadcastDeviceEvent(stored, map[string]interface{}{
+			"message": alert,
+			"type":    "device_metric_alert",
+		})
+
+		if !watched || discordNotifier == nil {
+			continue
+		}
+		var e error
+		if alert.Raised {
+			e = discordNotifier.SendSystemAlert(fmt.Sprintf("High %s usage", alert.Metric), fmt.Sprintf("**%s** is at %.1f%% %s usage (threshold %.0f%%).", alert.DeviceName, alert.Percent, alert.Metric, alert.Threshold), "warning")
+		} else {
+			e = discordNotifier.SendSystemAlert(fmt.Sprintf("%s usage recovered", alert.Metric), fmt.Sprintf("**%s** is back to %.1f%% %s usage.", alert.DeviceName, alert.Percent, alert.Metric), "success")
+		}
+		if e != nil {
+			log.Println("Error sending metric alert", e)
+		}
+	}
+}
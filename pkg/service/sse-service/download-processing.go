@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/media"
+)
+
+// processedOutputs are the extra files made by post-processing, once uploaded.
+type processedOutputs struct {
+	waveformKey  string
+	waveformURL  string
+	thumbnailKey string
+	thumbnailURL string
+}
+
+var downloadMimeTypes = map[string]string{
+	"mp3":  "audio/mpeg",
+	"m4a":  "audio/mp4",
+	"opus": "audio/ogg",
+	"wav":  "audio/wav",
+	"mp4":  "video/mp4",
+	"webm": "video/webm",
+	"png":  "image/png",
+	"jpg":  "image/jpeg",
+}
+
+func mimeTypeFor(path string) string {
+	if mimeType, ok := downloadMimeTypes[strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))]; ok {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
+
+// postProcessDownload runs the job's ffmpeg steps on the downloaded file and
+// reports them as download_progress events between 95 and 99 percent.
+func (sse *SSEService) postProcessDownload(job *DownloadJob, filePath string) (*media.Result, error) {
+	lastStage, lastPercent := "", -1
+	onProgress := func(stage string, fraction float64) {
+		percent := int(fraction * 100)
+		if stage == lastStage && percent-lastPercent < 5 {
+			return
+		}
+		lastStage, lastPercent = stage, percent
+		progress := 95 + int(fraction*4)
+		job.SetProgress(enum.PROCESSING, progress)
+		sse.broadcastDownload(job.DownloadJob, map[string]interface{}{
+			"downloadId":    job.DownloadID,
+			"status":        enum.PROCESSING,
+			"progress":      progress,
+			"stage":         stage,
+			"stageProgress": percent,
+			"message":       "Processing media...",
+			"type":          "download_progress",
+		})
+	}
+
+	result, err := media.Process(job.ctx, filePath, *job.PostProcess, job.VideoID, onProgress)
+	if err != nil {
+		if _, invalid := err.(media.InvalidOptionsError); invalid {
+			return nil, permanentDownloadError{err}
+		}
+		return nil, fmt.Errorf("post-processing failed: %v", err)
+	}
+	return result, nil
+}
+
+// uploadProcessedOutputs stores the waveform and thumbnail next to the
+// download. A failed upload only loses that extra, not the download.
+func (sse *SSEService) uploadProcessedOutputs(downloadId string, result *media.Result) processedOutputs {
+	outputs := processedOutputs{}
+	if result == nil {
+		return outputs
+	}
+	outputs.waveformKey, outputs.waveformURL = sse.uploadDownloadArtifact(downloadId, result.WaveformPath)
+	outputs.thumbnailKey, outputs.thumbnailURL = sse.uploadDownloadArtifact(downloadId, result.ThumbnailPath)
+	return outputs
+}
+
+func (sse *SSEService) uploadDownloadArtifact(downloadId string, path string) (string, string) {
+	if path == "" {
+		return "", ""
+	}
+	defer os.Remove(path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("Unable to open %s: %v", path, err)
+		return "", ""
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		log.Printf("Unable to read %s: %v", path, err)
+		return "", ""
+	}
+
+	objectKey := fmt.Sprintf("downloads/%s/%s", downloadId, filepath.Base(path))
+	if err := sse.storage.Put(context.Background(), objectKey, f, mimeTypeFor(path)); err != nil {
+		log.Printf("Unable to upload %s: %v", objectKey, err)
+		return "", ""
+	}
+	url, err := sse.storage.SignedURL(context.Background(), objectKey, 24*time.Hour)
+	if err != nil {
+		log.Printf("Unable to sign %s: %v", objectKey, err)
+		return "", ""
+	}
+	if expiry := artifactExpiryController(); expiry != nil {
+		if err := expiry.RegisterObject(objectKey, stat.Size(), serviceName, downloadId, downloadRetention()); err != nil {
+			log.Printf("Failed to schedule cleanup of %s: %v", objectKey, err)
+		}
+	}
+	return objectKey, url
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"log"
+	"os"
+
+	"project-phoenix/v2/internal/cache"
+	"project-phoenix/v2/pkg/handler"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultSSEEventChannel = "sse-events"
+
+// sseEventBus returns the bus shared by the sse-service replicas, or nil when
+// SSE_EVENT_BUS is not set and events stay on this instance. Set it when
+// running more than one replica.
+func sseEventBus() handler.SSEEventBus {
+	switch os.Getenv("SSE_EVENT_BUS") {
+	case "":
+		return nil
+	case "redis":
+		redisCache := cache.GetInstance()
+		if redisCache == nil {
+			log.Println("Warning: SSE_EVENT_BUS is redis but Redis is disabled. Events stay on this instance.")
+			return nil
+		}
+		channel := os.Getenv("SSE_EVENT_CHANNEL")
+		if channel == "" {
+			channel = defaultSSEEventChannel
+		}
+		log.Printf("SSE events are shared through Redis channel %s", channel)
+		return handler.NewRedisSSEEventBus(redisCache.GetClient().(*redis.Client), channel)
+	default:
+		log.Printf("Warning: unknown SSE_EVENT_BUS %q. Events stay on this instance.", os.Getenv("SSE_EVENT_BUS"))
+		return nil
+	}
+}
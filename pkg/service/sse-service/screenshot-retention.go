@@ -0,0 +1,34 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"project-phoenix/v2/internal/controllers"
+	"project-phoenix/v2/internal/enum"
+)
+
+const screenshotRetentionSweepInterval = time.Hour
+
+// purgeExpiredScreenshots removes screenshots that have outlived the retention
+// window, together with their stored images.
+func (sse *SSEService) purgeExpiredScreenshots() {
+	ticker := time.NewTicker(screenshotRetentionSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		controller := controllers.GetControllerInstance(enum.ScreenshotController, enum.MONGODB)
+		screenshotController, ok := controller.(*controllers.ScreenshotController)
+		if !ok {
+			continue
+		}
+		removed, err := screenshotController.PurgeExpired()
+		if err != nil {
+			log.Println("Error purging expired screenshots", err)
+			continue
+		}
+		if removed > 0 {
+			log.Printf("Purged %d expired screenshots", removed)
+		}
+	}
+}
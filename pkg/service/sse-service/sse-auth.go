@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"project-phoenix/v2/internal/controllers"
+	"project-phoenix/v2/internal/enum"
+	"project-phoenix/v2/internal/model"
+	"project-phoenix/v2/internal/ratelimit"
+	"project-phoenix/v2/pkg/handler"
+
+	microBroker "go-micro.dev/v4/broker"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// sseSubscriber is who opened an event stream. UserID is empty for sessions
+// that are not logged in, which then get no device events.
+type sseSubscriber struct {
+	SessionID   string
+	UserID      string
+	ProjectType string
+}
+
+// deviceRoute is the channel for the devices of one owner within a project.
+func deviceRoute(owner string, projectType string) string {
+	route := "devices-" + owner
+	if projectType != "" {
+		route += "-" + projectType
+	}
+	return route
+}
+
+// sessionRoute is the channel every stream of a session listens to, used to
+// end them when the session is signed out.
+func sessionRoute(sessionID string) string {
+	return "session-" + sessionID
+}
+
+// deviceRoute returns the subscriber's device channel, or "" without a user.
+func (subscriber *sseSubscriber) deviceRoute() string {
+	if subscriber.UserID == "" {
+		return ""
+	}
+	return deviceRoute(subscriber.UserID, subscriber.ProjectType)
+}
+
+// authenticateSSE checks the session, and the login token if one is given,
+// of a stream that is being opened. The project comes from the session; a
+// project-type the client sends has to match it.
+func authenticateSSE(r *http.Request) (*sseSubscriber, error) {
+	sessionID, token := controllers.RequestCredentials(r)
+	if sessionID == "" {
+		return nil, errors.New("session id is required")
+	}
+	sessionController, ok := controllers.GetControllerInstance(enum.SessionController, enum.MONGODB).(*controllers.SessionController)
+	if !ok {
+		return nil, errors.New("sessions are unavailable")
+	}
+	session, err := sessionController.FindSession(sessionID)
+	if err != nil {
+		return nil, errors.New("unknown session")
+	}
+
+	subscriber := &sseSubscriber{SessionID: sessionID, ProjectType: session.ProjectType}
+	requested := r.Header.Get("project-type")
+	if requested == "" {
+		requested = r.URL.Query().Get("project")
+	}
+	if projectType := string(enum.ParseProjectType(requested)); projectType != "" {
+		if subscriber.ProjectType != "" && subscriber.ProjectType != projectType {
+			return nil, errors.New("session belongs to another project")
+		}
+		subscriber.ProjectType = projectType
+	}
+
+	if token != "" {
+		refreshTokenController := controllers.GetControllerInstance(enum.RefreshTokenController, enum.MONGODB).(*controllers.RefreshTokenController)
+		claims, err := refreshTokenController.Authenticate(token, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		subscriber.UserID = claims.Subject
+	}
+	return subscriber, nil
+}
+
+var (
+	downloadClaimsOnce sync.Once
+	downloadClaimsObj  *ratelimit.Dedup
+)
+
+// downloadClaims records which session a download id that is not stored yet
+// belongs to: direct streams are never stored, and queued downloads are
+// stored after clients start listening. The first session to stream or
+// follow an id claims it for a day, shared by every replica.
+func downloadClaims() *ratelimit.Dedup {
+	downloadClaimsOnce.Do(func() {
+		downloadClaimsObj = &ratelimit.Dedup{
+			Name:   "download-owner",
+			Window: 24 * time.Hour,
+			Store:  ratelimit.NewStore(),
+		}
+	})
+	return downloadClaimsObj
+}
+
+// claimDownload tells whether a download id that is not stored belongs to the
+// session, claiming it when nobody has.
+func claimDownload(ctx context.Context, downloadId string, sessionID string) bool {
+	owner, err := downloadClaims().Claim(ctx, downloadId, sessionID)
+	if err != nil {
+		log.Printf("Unable to claim download %s: %v", downloadId, err)
+		return false
+	}
+	return owner == sessionID
+}
+
+// authorizeRoute tells whether a subscriber may listen to a route. Downloads
+// and batches belong to the session that requested them, and device channels
+// to their user. A download that is not stored yet belongs to the session
+// that claimed it first; any other lookup error denies. Batches are stored
+// before the request returns, so unknown ones are denied, and so is every
+// other route.
+func (sse *SSEService) authorizeRoute(ctx context.Context, subscriber *sseSubscriber, route string) bool {
+	if strings.HasPrefix(route, "devices-") {
+		return route == subscriber.deviceRoute()
+	}
+	if strings.HasPrefix(route, "session-") {
+		return route == sessionRoute(subscriber.SessionID)
+	}
+	if downloadId := strings.TrimPrefix(route, "download-"); downloadId != route {
+		job, err := sse.downloadQueue.controller.Get(downloadId)
+		if err != nil {
+			return errors.Is(err, mongo.ErrNoDocuments) && claimDownload(ctx, downloadId, subscriber.SessionID)
+		}
+		return job.Owner == "" || job.Owner == subscriber.SessionID
+	}
+	if batchId := strings.TrimPrefix(route, "batch-"); batchId != route {
+		controller := downloadBatchController()
+		if controller == nil {
+			return false
+		}
+		batch, err := controller.Get(batchId)
+		return err == nil && batch.Owner == subscriber.SessionID
+	}
+	return false
+}
+
+// openStream checks the request and writes the headers of an event stream.
+// Rejected requests get a 401, or a 403 for a route of someone else, before
+// anything is streamed.
+func (sse *SSEService) openStream(w http.ResponseWriter, r *http.Request, route string) (*sseSubscriber, bool) {
+	allowSSEOrigin(w, r)
+	subscriber, err := authenticateSSE(r)
+	if err != nil {
+		log.Printf("Rejected SSE connection for route %q: %v", route, err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	if route != "" && !sse.authorizeRoute(r.Context(), subscriber, route) {
+		log.Printf("Rejected SSE connection of session %s for route %q", subscriber.SessionID, route)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	return subscriber, true
+}
+
+// allowSSEOrigin sets the CORS header for origins listed in
+// SSE_ALLOWED_ORIGINS, or for any origin when it is not set.
+func allowSSEOrigin(w http.ResponseWriter, r *http.Request) {
+	allowed := strings.TrimSpace(os.Getenv("SSE_ALLOWED_ORIGINS"))
+	if allowed == "" || allowed == "*" {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	origin := r.Header.Get("Origin")
+	for _, candidate := range strings.Split(allowed, ",") {
+		if origin != "" && strings.TrimSpace(candidate) == origin {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+			return
+		}
+	}
+}
+
+// handleEvents serves /events, the stream of device events for the logged
+// in user.
+func (sse *SSEService) handleEvents(w http.ResponseWriter, r *http.Request) {
+	subscriber, ok := sse.openStream(w, r, "")
+	if !ok {
+		return
+	}
+	client, missed := sse.sseHandler.AddClientWithRoute(subscriber.deviceRoute(), r.Header.Get("Last-Event-ID"))
+	defer sse.sseHandler.RemoveClient(client)
+	sse.sseHandler.SubscribeClientToRoute(client, sessionRoute(subscriber.SessionID))
+	if subscriber.UserID == "" {
+		log.Printf("SSE session %s is not logged in and will not get device events", subscriber.SessionID)
+	}
+	for _, event := range missed {
+		if err := handler.WriteEvent(w, event); err != nil {
+			return
+		}
+	}
+	sse.sseHandler.Stream(w, r, client)
+}
+
+// broadcastDeviceEvent sends a device event to the device's owner. Events of
+// devices without an owner are not sent to anyone.
+func (sse *SSEService) broadcastDeviceEvent(device model.Device, event map[string]interface{}) {
+	if device.Owner == "" {
+		return
+	}
+	sse.sseHandler.BroadcastToRoute(deviceRoute(device.Owner, device.ProjectType), event)
+}
+
+// broadcastDeviceEventByName looks the device up and sends it an event.
+func (sse *SSEService) broadcastDeviceEventByName(deviceName string, event map[string]interface{}) {
+	captureScreenController, ok := controllers.GetControllerInstance(enum.CaptureScreenController, enum.MONGODB).(*controllers.CaptureScreenController)
+	if !ok {
+		return
+	}
+	sse.broadcastDeviceEvent(findDevice(captureScreenController, deviceName), event)
+}
+
+// HandleSessionRevoked ends the event streams of sessions that were signed
+// out. The notice goes through the event bus, so every replica closes the
+// streams connected to it.
+func (sse *SSEService) HandleSessionRevoked(p microBroker.Event) error {
+	data := struct {
+		SessionIDs []string `json:"sessionIds"`
+	}{}
+	if err := json.Unmarshal(p.Message().Body, &data); err != nil {
+		return fmt.Errorf("error unmarshalling revoked sessions: %v", err)
+	}
+	for _, sessionID := range data.SessionIDs {
+		sse.sseHandler.BroadcastToRoute(sessionRoute(sessionID), map[string]interface{}{
+			"type":      handler.SessionRevokedEvent,
+			"sessionId": sessionID,
+		})
+	}
+	return nil
+}
@@ -17,12 +17,13 @@ import (
 	"syscall"
 	"time"
 
-	"project-phoenix/v2/internal/aws"
 	"project-phoenix/v2/internal/controllers"
 	"project-phoenix/v2/internal/enum"
 	"project-phoenix/v2/internal/google"
+	"project-phoenix/v2/internal/media"
 	"project-phoenix/v2/internal/model"
 	internal "project-phoenix/v2/internal/service-configs"
+	"project-phoenix/v2/internal/storage"
 	"project-phoenix/v2/pkg/handler"
 	"project-phoenix/v2/pkg/helper"
 	"project-phoenix/v2/pkg/service"
@@ -32,6 +33,7 @@ import (
 	"github.com/joho/godotenv"
 	"go-micro.dev/v4"
 	microBroker "go-micro.dev/v4/broker"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 type SSEService struct {
@@ -43,7 +45,8 @@ type SSEService struct {
 	brokerObj          microBroker.Broker
 	sseHandler         *handler.SSERequestHandler
 	downloadQueue      *DownloadQueue
-	s3Service          *aws.S3Service
+	batches            *batchTracker
+	storage            storage.Storage
 }
 
 func sanitizeFilename(name string) string {
@@ -126,14 +129,14 @@ func (sse *SSEService) InitializeService(serviceObj micro.Service, serviceName s
 		// Initialize the SSE handler
 		sse.sseHandler = handler.NewSSERequestHandler()
 		go sse.sseHandler.Run()
+		if bus := sseEventBus(); bus != nil {
+			sse.sseHandler.UseBus(bus)
+		}
 
-		// Initialize S3 service
-		s3Svc, _, err := aws.NewS3ServiceFromEnv()
-		if err != nil {
-			log.Printf("Warning: S3 service initialization failed: %v. File uploads will not work.", err)
-		} else {
-			sse.s3Service = s3Svc
-			log.Println("S3 service initialized successfully")
+		// Object storage for finished downloads
+		sse.storage = storage.GetInstance()
+		if sse.storage == nil {
+			log.Println("Warning: object storage is not available. Downloads will fail.")
 		}
 	})
 
@@ -265,7 +268,7 @@ func (sse *SSEService) HandleCaptureDeviceData(p microBroker.Event) error {
 
 		log.Println("Attempting to broadcast PING_DEVICE", messageType)
 		log.Println("Message Data:", deviceDataMap)
-		sse.sseHandler.Broadcast(map[string]interface{}{
+		sse.broadcastDeviceEventByName(deviceData.DeviceName, map[string]interface{}{
 			"message": deviceDataMap,
 			"type":    "ping_device",
 		})
@@ -282,14 +285,6 @@ func (sse *SSEService) HandleCaptureDeviceData(p microBroker.Event) error {
 
 	case int32(enum.CAPTURE_SCREEN):
 
-		// Use the SSE handler to broadcast
-		log.Println("Attempting to broadcast CAPTURE_SCREEN", messageType)
-		log.Println("Message Data:", deviceDataMap)
-		sse.sseHandler.Broadcast(map[string]interface{}{
-			"message": deviceDataMap,
-			"type":    "capture_screen",
-		})
-
 		updateData = map[string]interface{}{
 			"lastImage":   deviceData.LastImage,
 			"isOnline":    true,
@@ -299,11 +294,56 @@ func (sse *SSEService) HandleCaptureDeviceData(p microBroker.Event) error {
 			"diskUsage":   deviceData.DiskUsage,
 		}
 
+		// Keep every capture in the device's history and send clients URLs
+		// instead of the inline image. If storage fails the old inline
+		// behaviour is kept so the capture is not lost.
+		capturedAt := time.Now().UTC()
+		screenshotController, ok := controllers.GetControllerInstance(enum.ScreenshotController, enum.MONGODB).(*controllers.ScreenshotController)
+		if !ok {
+			log.Println("Screenshot controller unavailable, broadcasting inline image")
+		} else if screenshot, storeErr := screenshotController.StoreCapture(deviceData, capturedAt); storeErr != nil {
+			log.Println("Error storing screenshot", storeErr)
+		} else {
+			delete(deviceDataMap, "lastImage")
+			deviceDataMap["screenshotId"] = screenshot.ID
+			deviceDataMap["imageUrl"] = screenshot.ImageURL
+			deviceDataMap["thumbnailUrl"] = screenshot.ThumbnailURL
+			deviceDataMap["capturedAt"] = capturedAt
+			updateData["lastImage"] = ""
+			updateData["lastScreenshotId"] = screenshot.ID
+			updateData["lastCaptureAt"] = capturedAt
+		}
+
+		// Use the SSE handler to broadcast
+		log.Println("Attempting to broadcast CAPTURE_SCREEN", messageType)
+		log.Println("Message Data:", deviceDataMap)
+		sse.broadcastDeviceEventByName(deviceData.DeviceName, map[string]interface{}{
+			"message": deviceDataMap,
+			"type":    "capture_screen",
+		})
+
 		break
 	default:
 		log.Println("No case found for", messageType)
 	}
 
+	// Agents that can read input idle time report it so schedules limited to
+	// active users know when the machine was last used.
+	if fields, ok := dataField.(map[string]interface{}); ok && len(updateData) > 0 {
+		if idleSeconds, ok := fields["idleSeconds"].(float64); ok {
+			updateData["lastUserActivity"] = time.Now().UTC().Add(-time.Duration(idleSeconds) * time.Second)
+		}
+	}
+
+	if len(updateData) > 0 {
+		if cameOnline, err := captureScreenController.MarkDeviceOnline(deviceData.DeviceName); err != nil {
+			log.Println("Error marking device online", err)
+		} else if cameOnline {
+			sse.announceDeviceStatus(findDevice(captureScreenController, deviceData.DeviceName), true, enum.DEVICE_HEARTBEAT_RESUMED)
+		}
+		sse.recordDeviceMetrics(deviceData)
+	}
+
 	e := captureScreenController.Update(query, updateData)
 	if e != nil {
 		log.Println("Error updating device")
@@ -321,101 +361,144 @@ func (sse *SSEService) HandleVideoDownload(p microBroker.Event) error {
 		return fmt.Errorf("error unmarshalling video download data: %v", err)
 	}
 
-	downloadId := data["downloadId"].(string)
-	videoId := data["videoId"].(string)
-	videoTitle := data["videoTitle"].(string)
-	format := data["format"].(string)
-	var quality string
-	qualityStr, ok := data["quality"].(string)
-	if !ok {
-		quality = ""
-	} else {
-		quality = qualityStr
+	job := model.DownloadJob{}
+	job.DownloadID, _ = data["downloadId"].(string)
+	job.VideoID, _ = data["videoId"].(string)
+	job.VideoTitle, _ = data["videoTitle"].(string)
+	job.Format, _ = data["format"].(string)
+	job.Quality, _ = data["quality"].(string)
+	job.BitRate, _ = data["bitRate"].(string)
+	job.YoutubeURL, _ = data["youtubeURL"].(string)
+	job.Owner, _ = data["owner"].(string)
+	if options, ok := data["postProcess"]; ok && options != nil {
+		job.PostProcess = &model.MediaProcessingOptions{}
+		if err := helper.InterfaceToStruct(options, job.PostProcess); err != nil {
+			return fmt.Errorf("invalid postProcess options for %s: %v", job.DownloadID, err)
+		}
 	}
-	bitRate := data["bitRate"].(string)
-	var youtubeURL string
-	if urlStr, ok := data["youtubeURL"].(string); ok {
-		youtubeURL = urlStr
+	if job.DownloadID == "" || job.VideoID == "" {
+		return fmt.Errorf("download request without downloadId or videoId: %v", data)
 	}
+	job.Message = "Waiting for a free worker..."
+
+	log.Printf("🟡 Processing: %s (format: %s, quality: %s)", job.DownloadID, job.Format, job.Quality)
 
-	log.Printf("🟡 Processing: %s (format: %s, quality: %s)", downloadId, format, quality)
+	if err := sse.downloadQueue.AddJob(job); err != nil {
+		return fmt.Errorf("unable to queue download %s: %v", job.DownloadID, err)
+	}
 
 	// Send initial status to SSE clients
-	sse.sseHandler.BroadcastToRoute(fmt.Sprintf("download-%s", downloadId), map[string]interface{}{
-		"downloadId": downloadId,
-		"status":     "processing",
+	sse.broadcastDownload(&job, map[string]interface{}{
+		"downloadId": job.DownloadID,
+		"status":     enum.QUEUED,
 		"progress":   0,
-		"message":    "Starting download...",
+		"message":    job.Message,
 		"type":       "download_progress",
 	})
 
-	// Process the actual video download
-	sse.downloadQueue.AddJob(downloadId, videoId, youtubeURL, format, quality, bitRate, videoTitle)
+	return nil
+}
 
+// HandleDownloadCancelled stops a cancelled download if it is running here.
+// Other instances notice the cancellation on their next heartbeat.
+func (sse *SSEService) HandleDownloadCancelled(p microBroker.Event) error {
+	data := make(map[string]interface{})
+	if err := json.Unmarshal(p.Message().Body, &data); err != nil {
+		return fmt.Errorf("error unmarshalling download cancellation: %v", err)
+	}
+	downloadId, _ := data["downloadId"].(string)
+	if downloadId == "" {
+		return nil
+	}
+	if sse.downloadQueue.Cancel(downloadId) {
+		log.Printf("Stopping cancelled download %s", downloadId)
+	}
+	job, err := sse.downloadQueue.controller.Get(downloadId)
+	if err != nil {
+		job = &model.DownloadJob{DownloadID: downloadId}
+	}
+	sse.broadcastDownload(job, map[string]interface{}{
+		"downloadId": downloadId,
+		"status":     enum.CANCELLED,
+		"progress":   job.Progress,
+		"message":    "Download cancelled",
+		"type":       "download_cancelled",
+	})
+	if job.BatchID != "" {
+		go sse.settleBatch(job.BatchID)
+	}
 	return nil
 }
 
-// processVideoDownload handles the actual video download and S3 upload
-func (sse *SSEService) processVideoDownload(downloadId, videoId, youtubeURL, format, quality, bitRate, videoTitle string) {
-	routeKey := fmt.Sprintf("download-%s", downloadId)
+// processVideoDownload handles the actual video download and upload. It
+// returns the fields to store on the completed job.
+func (sse *SSEService) processVideoDownload(job *DownloadJob) (bson.M, error) {
+	downloadId := job.DownloadID
+	videoId := job.VideoID
+	format := job.Format
 
-	job := sse.downloadQueue.GetJob(downloadId)
-	if job == nil {
-		return
+	if sse.storage == nil {
+		return nil, permanentDownloadError{errors.New("object storage not initialized")}
 	}
 
-	job.mu.Lock()
-	job.Status = enum.DOWNLOADING
-	job.mu.Unlock()
-
 	// Sanitize title to ensure safe filesystem pathing and consistent output name
-	sanitizedTitle := sanitizeFilename(videoTitle)
+	sanitizedTitle := sanitizeFilename(job.VideoTitle)
 
+	lastBroadcast := -1
 	onProgress := func(progress float64) {
-		job.mu.Lock()
-		job.Progress = int(progress)
-		job.mu.Unlock()
+		job.SetProgress(enum.DOWNLOADING, int(progress))
+		// yt-dlp reports several times a second; clients only need steps.
+		if int(progress)-lastBroadcast < 5 {
+			return
+		}
+		lastBroadcast = int(progress)
+		sse.broadcastDownload(job.DownloadJob, map[string]interface{}{
+			"downloadId": downloadId,
+			"status":     enum.DOWNLOADING,
+			"progress":   int(progress),
+			"message":    "Downloading...",
+			"type":       "download_progress",
+		})
 	}
 
-	log.Printf("[SSE-SERVICE:] Starting download for video %s with format %s, quality %s, bitrate %s", videoId, format, quality, bitRate)
+	log.Printf("[SSE-SERVICE:] Starting download for video %s with format %s, quality %s, bitrate %s", videoId, format, job.Quality, job.BitRate)
 	session, err := google.DownloadYoutubeVideoToBuffer(
-		youtubeURL,
+		job.YoutubeURL,
 		videoId,
 		format,
-		quality,
-		bitRate,
+		job.Quality,
+		job.BitRate,
 		sanitizedTitle,
 		onProgress,
 	)
-
 	if err != nil {
-		job.mu.Lock()
-		job.Status = enum.SSEStreamEnum("error")
-		job.mu.Unlock()
-		sse.sseHandler.BroadcastToRoute(routeKey, map[string]interface{}{
-			"downloadId": downloadId,
-			"status":     "error",
-			"message":    fmt.Sprintf("Failed to start download: %v", err),
-			"type":       "download_error",
-		})
-		return
+		return nil, fmt.Errorf("failed to start download: %v", err)
 	}
+	job.SetSession(session)
 
 	if err := session.Wait(); err != nil {
-		job.mu.Lock()
-		job.Status = enum.SSEStreamEnum("error")
-		job.mu.Unlock()
-		sse.sseHandler.BroadcastToRoute(routeKey, map[string]interface{}{
-			"downloadId": downloadId,
-			"status":     "error",
-			"message":    fmt.Sprintf("Download failed: %v", err),
-			"type":       "download_error",
-		})
-		return
+		return nil, fmt.Errorf("download failed: %v", err)
 	}
 
 	filePath := session.GetFilePath()
 	fileSize := session.GetFileSize()
+
+	var processed *media.Result
+	if job.PostProcess.Requested() {
+		processed, err = sse.postProcessDownload(job, filePath)
+		if err != nil {
+			os.Remove(filePath)
+			return nil, err
+		}
+		if processed.OutputPath != filePath {
+			// Only the processed file is kept and uploaded.
+			os.Remove(filePath)
+			filePath = processed.OutputPath
+			if stat, err := os.Stat(filePath); err == nil {
+				fileSize = stat.Size()
+			}
+		}
+	}
 	// Derive final filename using sanitized title and actual file extension
 	var filename string
 	{
@@ -428,80 +511,40 @@ func (sse *SSEService) processVideoDownload(downloadId, videoId, youtubeURL, for
 		}
 		filename = fmt.Sprintf("%s_%s.%s", sanitizedTitle, videoId, ext)
 	}
-	if sse.s3Service == nil {
-		job.mu.Lock()
-		job.Status = enum.SSEStreamEnum("error")
-		job.mu.Unlock()
-		sse.sseHandler.BroadcastToRoute(routeKey, map[string]interface{}{
-			"downloadId": downloadId,
-			"status":     "error",
-			"message":    "S3 service not initialized",
-			"type":       "download_error",
-		})
-		return
-	}
+
+	job.SetProgress(enum.PROCESSING, 95)
+	sse.broadcastDownload(job.DownloadJob, map[string]interface{}{
+		"downloadId": downloadId,
+		"status":     enum.PROCESSING,
+		"progress":   95,
+		"message":    "Uploading...",
+		"type":       "download_progress",
+	})
 
 	// Open file as stream
 	f, err := os.Open(filePath)
 	if err != nil {
-		job.mu.Lock()
-		job.Status = enum.SSEStreamEnum("error")
-		job.mu.Unlock()
-		sse.sseHandler.BroadcastToRoute(routeKey, map[string]interface{}{
-			"downloadId": downloadId,
-			"status":     "error",
-			"message":    fmt.Sprintf("Failed to open file: %v", err),
-			"type":       "download_error",
-		})
 		os.Remove(filePath)
-		return
+		return nil, fmt.Errorf("failed to open file: %v", err)
 	}
 	defer f.Close()
 
-	// Generate S3 key
-	s3Key := fmt.Sprintf("downloads/%s/%s", downloadId, filename)
+	// Generate storage key
+	objectKey := fmt.Sprintf("downloads/%s/%s", downloadId, filename)
 
-	// Determine MIME type based on format
-	mimeType := "application/octet-stream"
-	if format == "mp3" {
-		mimeType = "audio/mpeg"
-	} else if format == "mp4" {
-		mimeType = "video/mp4"
+	// Upload as a stream and sign a link valid for 24 hours
+	if err := sse.storage.Put(context.Background(), objectKey, f, mimeTypeFor(filePath)); err != nil {
+		os.Remove(filePath)
+		return nil, fmt.Errorf("failed to upload file: %v", err)
 	}
-
-	// Upload to S3 with 24-hour TTL using streaming
-	presignedUrl, err := sse.s3Service.UploadFileStream(
-		context.Background(),
-		s3Key,
-		f,
-		mimeType,
-		1440, // 24 hours
-	)
-
+	presignedUrl, err := sse.storage.SignedURL(context.Background(), objectKey, 24*time.Hour)
 	if err != nil {
-		job.mu.Lock()
-		job.Status = enum.SSEStreamEnum("error")
-		job.mu.Unlock()
-		sse.sseHandler.BroadcastToRoute(routeKey, map[string]interface{}{
-			"downloadId": downloadId,
-			"status":     "error",
-			"message":    fmt.Sprintf("Failed to upload to S3: %v", err),
-			"type":       "download_error",
-		})
-		os.Remove(filePath)
-		return
+		return nil, fmt.Errorf("failed to sign download URL: %v", err)
 	}
-
-	// Mark job as completed
-	job.mu.Lock()
-	job.FilePath = filePath
-	job.FileSize = fileSize
-	job.Status = enum.COMPLETED
-	job.Progress = 100
-	job.mu.Unlock()
+	extras := sse.uploadProcessedOutputs(downloadId, processed)
 
 	// Send completion message with download URL
-	sse.sseHandler.BroadcastToRoute(routeKey, map[string]interface{}{
+	completion := map[string]interface{}{
 		"downloadId":  downloadId,
 		"type":        "download_complete",
 		"status":      "completed",
@@ -510,28 +553,29 @@ func (sse *SSEService) processVideoDownload(downloadId, videoId, youtubeURL, for
 		"filename":    filename,
 		"fileSize":    fileSize,
 		"downloadUrl": presignedUrl,
-	})
+	}
+	if extras.waveformURL != "" {
+		completion["waveformUrl"] = extras.waveformURL
+	}
+	if extras.thumbnailURL != "" {
+		completion["thumbnailUrl"] = extras.thumbnailURL
+	}
+	sse.broadcastDownload(job.DownloadJob, completion)
 
-	log.Printf("File uploaded to S3: %s", s3Key)
+	log.Printf("File uploaded to %s storage: %s", sse.storage.Name(), objectKey)
 
-	// Clean up local file and S3 file after 1 hour
-	time.AfterFunc(1*time.Hour, func() {
-		// Delete local file
-		if err := os.Remove(filePath); err != nil {
-			log.Printf("Failed to delete local file %s: %v", filePath, err)
-		} else {
-			log.Printf("Cleaned up local file: %s", filePath)
+	// The sweeper deletes both copies once the retention window passes, even
+	// across restarts.
+	if expiry := artifactExpiryController(); expiry != nil {
+		if err := expiry.RegisterFile(filePath, serviceName, downloadId, downloadRetention()); err != nil {
+			log.Printf("Failed to schedule cleanup of %s: %v", filePath, err)
 		}
-
-		// Delete S3 file
-		if sse.s3Service != nil {
-			if err := sse.s3Service.DeleteFile(context.Background(), s3Key); err != nil {
-				log.Printf("Failed to delete S3 file %s: %v", s3Key, err)
-			} else {
-				log.Printf("Cleaned up S3 file: %s", s3Key)
-			}
+		if err := expiry.RegisterObject(objectKey, fileSize, serviceName, downloadId, downloadRetention()); err != nil {
+			log.Printf("Failed to schedule cleanup of %s: %v", objectKey, err)
 		}
-	})
+	}
+
+	return completedDownload(objectKey, filename, fileSize, presignedUrl, extras), nil
 }
 
 func (ls *SSEService) InitServiceConfig() {
@@ -549,12 +593,18 @@ func NewSSEService(serviceObj micro.Service, serviceName string) service.Service
 	sse := base.(*SSEService)
 
 	sse.downloadQueue = NewDownloadQueue(3, sse)
+	sse.batches = newBatchTracker(sse.downloadQueue.controller)
 	return sse
 }
 
 func (s *SSEService) registerRoutes() {
 	// Direct streaming endpoint for large file downloads (with full format/quality control)
 	s.router.HandleFunc("/stream/{downloadId}", s.handleDirectStream).Methods("GET")
+
+	// Signed links to objects kept on local disk
+	if localStorage, ok := s.storage.(*storage.LocalStorage); ok {
+		s.router.PathPrefix(storage.LocalFilesPath).Handler(localStorage).Methods("GET", "HEAD")
+	}
 }
 
 func (sse *SSEService) Start(port string) error {
@@ -563,12 +613,16 @@ func (sse *SSEService) Start(port string) error {
 	log.Println("Starting SSE Service on Port:", port)
 
 	sse.SubscribeTopics()
+	go sse.sweepTimedOutCommands()
+	go sse.purgeExpiredScreenshots()
+	go sse.sweepExpiredArtifacts()
+	go sse.monitorDeviceHeartbeats()
 
 	// Create a new router and register the SSE handler
 	sse.router = mux.NewRouter()
 
 	// Generic events endpoint (existing functionality)
-	sse.router.HandleFunc("/events", sse.sseHandler.ServeHTTP)
+	sse.router.HandleFunc("/events", sse.handleEvents)
 
 	// Route-specific endpoints for different projects
 	sse.router.HandleFunc("/events/{route}", sse.handleRouteSpecificSSE)
@@ -594,42 +648,81 @@ func (sse *SSEService) handleRouteSpecificSSE(w http.ResponseWriter, r *http.Req
 	vars := mux.Vars(r)
 	route := vars["route"]
 
-	// Set headers for SSE
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	subscriber, ok := sse.openStream(w, r, route)
+	if !ok {
+		return
+	}
 
 	log.Printf("Route-specific SSE connection for route: %s", route)
 
-	// Add client with route subscription using public method
-	clientChan := sse.sseHandler.AddClientWithRoute(route)
+	// Add client with route subscription; a reconnecting client gets the
+	// events it missed first. Logged in users also get their device events.
+	client, missed := sse.sseHandler.AddClientWithRoute(route, r.Header.Get("Last-Event-ID"))
+	if deviceRoute := subscriber.deviceRoute(); deviceRoute != "" && deviceRoute != route {
+		sse.sseHandler.SubscribeClientToRoute(client, deviceRoute)
+	}
+	if route != sessionRoute(subscriber.SessionID) {
+		sse.sseHandler.SubscribeClientToRoute(client, sessionRoute(subscriber.SessionID))
+	}
 
 	// Remove client when connection is closed
 	defer func() {
-		sse.sseHandler.RemoveClient(clientChan)
+		sse.sseHandler.RemoveClient(client)
 	}()
 
-	for {
-		select {
-		case msg := <-clientChan:
-			// Serialize the message to JSON
-			jsonData, err := json.Marshal(msg)
-			if err != nil {
-				log.Printf("Error marshalling message to JSON: %v", err)
-				return
-			}
-			// Send the JSON data as a string
-			_, err = fmt.Fprintf(w, "data: %s\n\n", jsonData)
-			if err != nil {
-				log.Printf("Error sending message to client: %v", err)
-				return
+	// A client reconnecting to a download gets its current state right away
+	// instead of waiting for the next progress event.
+	if downloadId := strings.TrimPrefix(route, "download-"); downloadId != route {
+		if job, err := sse.downloadQueue.controller.Get(downloadId); err == nil {
+			sse.writeSnapshot(w, map[string]interface{}{
+				"downloadId":  job.DownloadID,
+				"status":      job.Status,
+				"progress":    job.Progress,
+				"message":     job.Message,
+				"error":       job.Error,
+				"attempts":    job.Attempts,
+				"filename":    job.FileName,
+				"fileSize":    job.FileSize,
+				"downloadUrl": job.DownloadURL,
+				"type":        "download_status",
+			})
+		}
+	}
+	if batchId := strings.TrimPrefix(route, "batch-"); batchId != route {
+		if controller := downloadBatchController(); controller != nil {
+			if batch, err := controller.Get(batchId); err == nil {
+				jobs, _ := sse.downloadQueue.controller.ListByBatch(batchId)
+				sse.writeSnapshot(w, map[string]interface{}{
+					"batchId":   batch.BatchID,
+					"title":     batch.Title,
+					"status":    batch.Status,
+					"error":     batch.Error,
+					"total":     batch.Total,
+					"completed": batch.Completed,
+					"failed":    batch.Failed,
+					"cancelled": batch.Cancelled,
+					"zipUrl":    batch.ZipURL,
+					"zipError":  batch.ZipError,
+					"items":     batchItemSummaries(jobs),
+					"type":      "batch_status",
+				})
 			}
-			w.(http.Flusher).Flush()
-		case <-r.Context().Done():
+		}
+	}
+
+	for _, event := range missed {
+		if err := handler.WriteEvent(w, event); err != nil {
 			return
 		}
 	}
+	sse.sseHandler.Stream(w, r, client)
+}
+
+// writeSnapshot sends one client the current state of what it subscribed to.
+func (sse *SSEService) writeSnapshot(w http.ResponseWriter, message map[string]interface{}) {
+	if event, err := handler.NewEvent(message); err == nil {
+		handler.WriteEvent(w, event)
+	}
 }
 
 // handleDirectStream streams video directly from yt-dlp to HTTP response
@@ -648,6 +741,20 @@ func (sse *SSEService) handleDirectStream(w http.ResponseWriter, r *http.Request
 	log.Printf("Direct stream request: downloadId=%s, videoId=%s, format=%s, quality=%s",
 		downloadId, videoId, format, quality)
 
+	// The stream's progress goes to its download route, so the session that
+	// starts it has to own the id.
+	subscriber, err := authenticateSSE(r)
+	if err != nil {
+		log.Printf("Rejected direct stream %s: %v", downloadId, err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !claimDownload(r.Context(), downloadId, subscriber.SessionID) {
+		log.Printf("Rejected direct stream %s of session %s, the id belongs to another session", downloadId, subscriber.SessionID)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
 	// Validate required parameters
 	if videoId == "" {
 		http.Error(w, "videoId is required", http.StatusBadRequest)
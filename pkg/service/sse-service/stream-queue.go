@@ -1,32 +1,84 @@
 package service
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"os"
 	"sync"
+	"time"
 
+	"project-phoenix/v2/internal/controllers"
 	"project-phoenix/v2/internal/enum"
 	"project-phoenix/v2/internal/google"
+	"project-phoenix/v2/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	downloadPollInterval      = 5 * time.Second
+	downloadHeartbeatInterval = 30 * time.Second
+	// A job whose worker has not sent a heartbeat for this long is assumed
+	// lost (for example the service restarted) and is queued again.
+	downloadStaleAfter = 2 * time.Minute
+	// A batch still finalizing after this long is assumed interrupted.
+	batchFinalizeTimeout = 30 * time.Minute
 )
 
+// DownloadJob is a job a worker of this instance is running. The job itself
+// lives in Mongo; this only holds what the worker needs while it runs.
 type DownloadJob struct {
-	ID         string
-	VideoID    string
-	YoutubeURL string
-	Format     string
-	Quality  string
-	BitRate  string
-	VideoTitle string
-	Status   enum.SSEStreamEnum // "queued", "downloading", "completed", "error"
-	Progress int
-	FilePath string
-	FileSize int64
-	session  *google.StreamSession
-	mu       sync.Mutex
-} 
+	*model.DownloadJob
+	workerID  string
+	session   *google.StreamSession
+	cancelled bool
+	mu        sync.Mutex
+	// ctx is cancelled with the job and stops post-processing.
+	ctx  context.Context
+	stop context.CancelFunc
+}
+
+// SetSession records the yt-dlp session so the job can be cancelled.
+func (job *DownloadJob) SetSession(session *google.StreamSession) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.session = session
+	if job.cancelled {
+		session.Cancel()
+	}
+}
+
+// SetProgress updates the status and progress sent with the next heartbeat.
+func (job *DownloadJob) SetProgress(status string, progress int) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.Status = status
+	job.Progress = progress
+}
+
+func (job *DownloadJob) Cancel() {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.cancelled = true
+	job.stop()
+	if job.session != nil {
+		job.session.Cancel()
+	}
+}
+
+func (job *DownloadJob) IsCancelled() bool {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return job.cancelled
+}
+
+// DownloadQueue runs download jobs stored in Mongo, so queued and interrupted
+// downloads survive a restart and can be shared by several instances.
 type DownloadQueue struct {
-	jobs            map[string]*DownloadJob
-	queue           chan *DownloadJob
+	controller      *controllers.DownloadJobController
 	activeDownloads map[string]*DownloadJob
+	wake            chan struct{}
 	maxConcurrent   int
 	mu              sync.RWMutex
 	sseService      *SSEService
@@ -34,74 +86,220 @@ type DownloadQueue struct {
 
 func NewDownloadQueue(maxConcurrent int, sse *SSEService) *DownloadQueue {
 	dq := &DownloadQueue{
-		jobs:            make(map[string]*DownloadJob),
-		queue:           make(chan *DownloadJob, 100),
+		controller:      controllers.GetControllerInstance(enum.DownloadJobController, enum.MONGODB).(*controllers.DownloadJobController),
 		activeDownloads: make(map[string]*DownloadJob),
+		wake:            make(chan struct{}, maxConcurrent),
 		maxConcurrent:   maxConcurrent,
 		sseService:      sse,
 	}
 
+	hostname, _ := os.Hostname()
 	for i := 0; i < maxConcurrent; i++ {
-		go dq.worker(i)
+		go dq.worker(fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), i))
 	}
+	go dq.requeueStaleJobs()
 
 	return dq
 }
 
-func (dq *DownloadQueue) worker(id int) {
-	for job := range dq.queue {
-		dq.mu.Lock()
-		dq.activeDownloads[job.ID] = job
-		dq.mu.Unlock()
+// notify wakes an idle worker without blocking the broker handler.
+func (dq *DownloadQueue) notify() {
+	select {
+	case dq.wake <- struct{}{}:
+	default:
+	}
+}
 
-		log.Printf("[WORKER %d] Processing: %s", id, job.ID)
+func (dq *DownloadQueue) worker(workerID string) {
+	ticker := time.NewTicker(downloadPollInterval)
+	defer ticker.Stop()
+	for {
+		record, err := dq.controller.ClaimNext(workerID)
+		if err != nil {
+			log.Printf("[WORKER %s] Unable to claim a download: %v", workerID, err)
+		}
+		if record == nil {
+			select {
+			case <-dq.wake:
+			case <-ticker.C:
+			}
+			continue
+		}
 
-		job.mu.Lock()
-		job.Status = enum.DOWNLOADING
-		job.mu.Unlock()
+		job := &DownloadJob{DownloadJob: record, workerID: workerID}
+		job.ctx, job.stop = context.WithCancel(context.Background())
+		dq.mu.Lock()
+		dq.activeDownloads[job.DownloadID] = job
+		dq.mu.Unlock()
 
-		dq.sseService.processVideoDownload(
-			job.ID,
-			job.VideoID,
-			job.YoutubeURL,
-			job.Format,
-			job.Quality,
-			job.BitRate,
-			job.VideoTitle,
-		)
+		log.Printf("[WORKER %s] Processing: %s (attempt %d/%d)", workerID, job.DownloadID, job.Attempts, job.MaxAttempts)
+		dq.run(job)
+		job.stop()
 
 		dq.mu.Lock()
-		delete(dq.activeDownloads, job.ID)
+		delete(dq.activeDownloads, job.DownloadID)
 		dq.mu.Unlock()
+	}
+}
+
+// run processes one claimed job and records the outcome.
+func (dq *DownloadQueue) run(job *DownloadJob) {
+	stopHeartbeat := make(chan struct{})
+	go dq.heartbeat(job, stopHeartbeat)
+	result, err := dq.sseService.processVideoDownload(job)
+	close(stopHeartbeat)
 
-		log.Printf(" [WORKER %d] Finished: %s (status: %s)", id, job.ID, job.Status)
+	if job.IsCancelled() {
+		log.Printf("Download %s cancelled", job.DownloadID)
+		return
+	}
+	if err == nil {
+		if e := dq.controller.Complete(job.DownloadID, job.workerID, result); e != nil {
+			log.Printf("Unable to mark download %s as completed: %v", job.DownloadID, e)
+		}
+		dq.settleBatch(job)
+		return
+	}
+
+	_, permanent := err.(permanentDownloadError)
+	updated, e := dq.controller.Fail(job.DownloadJob, job.workerID, err, permanent)
+	if e != nil {
+		log.Printf("Unable to record failure of download %s: %v", job.DownloadID, e)
+		return
+	}
+	if updated.Status == enum.QUEUED {
+		log.Printf("Download %s failed, retrying at %s: %v", job.DownloadID, updated.NextAttemptAt, err)
+		dq.sseService.broadcastDownload(job.DownloadJob, map[string]interface{}{
+			"downloadId":    job.DownloadID,
+			"status":        enum.QUEUED,
+			"progress":      0,
+			"message":       fmt.Sprintf("%v. Retrying (attempt %d of %d)...", err, updated.Attempts+1, updated.MaxAttempts),
+			"nextAttemptAt": updated.NextAttemptAt,
+			"type":          "download_progress",
+		})
+		return
+	}
+	dq.sseService.broadcastDownload(job.DownloadJob, map[string]interface{}{
+		"downloadId": job.DownloadID,
+		"status":     "error",
+		"message":    err.Error(),
+		"type":       "download_error",
+	})
+	dq.settleBatch(job)
+}
+
+// settleRunningBatches finishes batches whose last item settled without
+// finishing the batch, for example because the service stopped in between.
+func (dq *DownloadQueue) settleRunningBatches() {
+	controller := downloadBatchController()
+	if controller == nil {
+		return
+	}
+	batchIDs, err := controller.RunningBatches(batchFinalizeTimeout)
+	if err != nil {
+		log.Println("Unable to list running batches", err)
+		return
+	}
+	for _, batchID := range batchIDs {
+		dq.sseService.settleBatch(batchID)
+	}
+}
+
+// settleBatch lets the job's batch finish if this was its last open item.
+// Bundling can take a while, so it does not hold up the worker.
+func (dq *DownloadQueue) settleBatch(job *DownloadJob) {
+	if job.BatchID != "" {
+		go dq.sseService.settleBatch(job.BatchID)
 	}
 }
 
-func (dq *DownloadQueue) AddJob(id, videoID, youtubeURL, format, quality, bitRate, videoTitle string) {
-	job := &DownloadJob{
-		ID:         id,
-		VideoID:    videoID,
-		YoutubeURL: youtubeURL,
-		Format:     format,
-		Quality:  quality,
-		BitRate:  bitRate,
-		VideoTitle: videoTitle,
-		Status:   enum.QUEUED,
-		Progress: 0,
+// heartbeat keeps the job's claim alive and stops the download once it is
+// cancelled, including when the cancel request reached another instance.
+func (dq *DownloadQueue) heartbeat(job *DownloadJob, stop <-chan struct{}) {
+	ticker := time.NewTicker(downloadHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			job.mu.Lock()
+			status, progress := job.Status, job.Progress
+			job.mu.Unlock()
+			stored, err := dq.controller.Heartbeat(job.DownloadID, job.workerID, status, progress)
+			if err != nil {
+				log.Printf("Heartbeat failed for download %s: %v", job.DownloadID, err)
+				continue
+			}
+			if stored == enum.CANCELLED {
+				job.Cancel()
+			}
+		}
 	}
+}
 
-	dq.mu.Lock()
-	dq.jobs[id] = job
-	dq.mu.Unlock()
+func (dq *DownloadQueue) requeueStaleJobs() {
+	for {
+		requeued, err := dq.controller.RequeueStale(downloadStaleAfter)
+		if err != nil {
+			log.Println("Unable to requeue interrupted downloads", err)
+		} else if requeued > 0 {
+			log.Printf("Requeued %d interrupted downloads", requeued)
+			for i := 0; i < dq.maxConcurrent; i++ {
+				dq.notify()
+			}
+		}
+		dq.settleRunningBatches()
+		time.Sleep(downloadStaleAfter / 2)
+	}
+}
 
-	dq.queue <- job
-	log.Printf(" Download queued: %s", id)
-	log.Printf("📋 Download queued: %s", id)
+// AddJob stores a download requested through the broker. Redelivered requests
+// are ignored.
+func (dq *DownloadQueue) AddJob(job model.DownloadJob) error {
+	created, err := dq.controller.Enqueue(job)
+	if err != nil {
+		return err
+	}
+	if created {
+		log.Printf("📋 Download queued: %s", job.DownloadID)
+	}
+	dq.notify()
+	return nil
 }
 
-func (dq *DownloadQueue) GetJob(id string) *DownloadJob {
+// Cancel stops a download if one of this instance's workers is running it.
+func (dq *DownloadQueue) Cancel(downloadID string) bool {
 	dq.mu.RLock()
-	defer dq.mu.RUnlock()
-	return dq.jobs[id]
+	job, ok := dq.activeDownloads[downloadID]
+	dq.mu.RUnlock()
+	if ok {
+		job.Cancel()
+	}
+	return ok
+}
+
+// permanentDownloadError marks failures that retrying cannot fix.
+type permanentDownloadError struct {
+	error
+}
+
+// completedDownload is what processVideoDownload stores on the finished job.
+func completedDownload(outputKey, filename string, fileSize int64, downloadURL string, extras processedOutputs) bson.M {
+	fields := bson.M{
+		"outputKey":   outputKey,
+		"filename":    filename,
+		"fileSize":    fileSize,
+		"downloadUrl": downloadURL,
+		"message":     "Download completed!",
+	}
+	if extras.waveformKey != "" {
+		fields["waveformKey"] = extras.waveformKey
+		fields["waveformUrl"] = extras.waveformURL
+	}
+	if extras.thumbnailKey != "" {
+		fields["thumbnailKey"] = extras.thumbnailKey
+		fields["thumbnailUrl"] = extras.thumbnailURL
+	}
+	return fields
 }